@@ -0,0 +1,20 @@
+// Package blob stores files the database should not hold itself, behind a
+// Store so where they live is a deployment choice.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned for keys that hold nothing.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs under slash-separated keys like "owner/id/file".
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete of a missing key is not an error, so cleanups can be retried.
+	Delete(ctx context.Context, key string) error
+}
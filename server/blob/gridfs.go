@@ -0,0 +1,44 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// GridFSStore keeps blobs in a GridFS bucket, the key is the file id.
+type GridFSStore struct {
+	Bucket *gridfs.Bucket
+}
+
+func NewGridFSStore(bucket *gridfs.Bucket) *GridFSStore {
+	return &GridFSStore{Bucket: bucket}
+}
+
+// Put replaces what the key held before.
+func (s *GridFSStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := s.Delete(ctx, key); err != nil {
+		return err
+	}
+	return s.Bucket.UploadFromStreamWithID(key, key, r)
+}
+
+func (s *GridFSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	stream, err := s.Bucket.OpenDownloadStream(key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (s *GridFSStore) Delete(ctx context.Context, key string) error {
+	if err := s.Bucket.DeleteContext(ctx, key); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return err
+	}
+	return nil
+}
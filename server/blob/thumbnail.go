@@ -0,0 +1,65 @@
+package blob
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// ThumbnailSize is the longest side of a thumbnail, in pixels.
+	ThumbnailSize = 256
+	// maxThumbnailPixels keeps a small file that unpacks into a huge image
+	// from eating the server's memory.
+	maxThumbnailPixels = 50_000_000
+)
+
+// Thumbnail shrinks a JPEG, PNG or GIF image to fit ThumbnailSize and
+// encodes it as JPEG on white. ok is false for anything it cannot read.
+func Thumbnail(data []byte) (thumb []byte, ok bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 || cfg.Width*cfg.Height > maxThumbnailPixels {
+		return nil, false
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if longest := max(w, h); longest > ThumbnailSize {
+		tw, th = max(1, w*ThumbnailSize/longest), max(1, h*ThumbnailSize/longest)
+	}
+
+	// Each thumbnail pixel averages the block of the image it covers
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// colors are premultiplied, what is see-through shows white
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), 0xff})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"fintrack/server/blob"
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func AddAttachment(c *gin.Context) {
+	tmp, _ := c.Get("ownedTransaction")
+	transaction := tmp.(model.Transaction)
+	tmp, _ = c.Get("attachmentFile")
+	data := tmp.([]byte)
+
+	attachment, err := service.AddAttachment(c.Request.Context(), transaction,
+		c.GetString("attachmentName"), c.GetString("attachmentType"), data)
+	if errors.Is(err, service.ErrTooManyAttachments) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error adding attachment",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Attachment added successfully",
+		"attachment": attachment,
+	})
+}
+
+// DownloadAttachment sends the file, or its thumbnail with
+// `?thumbnail=true`.
+func DownloadAttachment(c *gin.Context) {
+	tmp, _ := c.Get("attachment")
+	attachment := tmp.(model.Attachment)
+	thumbnail := c.Query("thumbnail") == "true"
+
+	file, err := service.OpenAttachment(c.Request.Context(), attachment, thumbnail)
+	if errors.Is(err, blob.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error opening attachment",
+			"detail": err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	contentType := attachment.ContentType
+	if thumbnail {
+		contentType = "image/jpeg"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.FileName}))
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, file)
+}
+
+func DeleteAttachment(c *gin.Context) {
+	tmp, _ := c.Get("ownedTransaction")
+	transaction := tmp.(model.Transaction)
+	tmp, _ = c.Get("attachment")
+	attachment := tmp.(model.Attachment)
+
+	if err := service.DeleteAttachment(c.Request.Context(), transaction, attachment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error deleting attachment",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// PurgeTransaction removes a deleted transaction and its attachments for
+// good.
+func PurgeTransaction(c *gin.Context) {
+	tmp, _ := c.Get("ownedTransaction")
+	transaction := tmp.(model.Transaction)
+	if !transaction.IsDeleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Delete the transaction before purging it"})
+		return
+	}
+
+	err := service.PurgeTransaction(c.Request.Context(), transaction)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error purging transaction",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction purged"})
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"net/http"
+
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+func GetNetWorthHistory(c *gin.Context) {
+	tmp, _ := c.Get("reportQuery")
+	query := tmp.(service.ReportQuery)
+
+	history, err := service.BuildBalanceHistory(
+		c.Request.Context(),
+		query.Owner,
+		query.From,
+		query.To,
+		c.DefaultQuery("interval", "day"),
+		query.Location,
+	)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Error building balance history",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
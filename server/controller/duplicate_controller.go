@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+func GetDuplicates(c *gin.Context) {
+	tmp, _ := c.Get("duplicateCriteria")
+	criteria := tmp.(service.DuplicateCriteria)
+	tmp, _ = c.Get("duplicateFrom")
+	from := tmp.(time.Time)
+
+	pairs, err := service.FindDuplicates(c.Request.Context(), c.GetString("username"), criteria, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error finding duplicates",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, pairs)
+}
+
+func MergeTransactions(c *gin.Context) {
+	tmp, _ := c.Get("keepTransaction")
+	keep := tmp.(model.Transaction)
+	tmp, _ = c.Get("removeTransaction")
+	remove := tmp.(model.Transaction)
+
+	merged, err := service.MergeTransactions(c.Request.Context(), keep, remove)
+	if errors.Is(err, service.ErrMergeConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error merging transactions",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Transactions merged successfully",
+		"transaction": merged,
+	})
+}
+
+func DismissDuplicate(c *gin.Context) {
+	tmp, _ := c.Get("keepTransaction")
+	keep := tmp.(model.Transaction)
+	tmp, _ = c.Get("removeTransaction")
+	remove := tmp.(model.Transaction)
+
+	if err := service.DismissDuplicate(c.Request.Context(), keep, remove); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error dismissing duplicate",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transactions kept apart"})
+}
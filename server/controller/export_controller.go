@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"fintrack/server/journal"
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+func CreateExport(c *gin.Context) {
+	tmp, _ := c.Get("exportJob")
+	job := tmp.(model.ExportJob)
+
+	job, err := service.CreateExport(c.Request.Context(), job)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error creating export",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	// Large exports are still being built
+	status := http.StatusOK
+	if job.Status == model.ExportPending || job.Status == model.ExportRunning {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, job)
+}
+
+func GetExports(c *gin.Context) {
+	jobs, err := service.FetchExportJobs(c.Request.Context(), c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching exports",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+func GetExport(c *gin.Context) {
+	tmp, _ := c.Get("exportJob")
+	c.JSON(http.StatusOK, tmp.(model.ExportJob))
+}
+
+func DownloadExport(c *gin.Context) {
+	tmp, _ := c.Get("exportJob")
+	job := tmp.(model.ExportJob)
+
+	if job.Status != model.ExportDone {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Export is not ready",
+			"status": job.Status,
+		})
+		return
+	}
+
+	stream, err := service.OpenExportArchive(job)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error opening export",
+			"detail": err.Error(),
+		})
+		return
+	}
+	defer stream.Close()
+
+	c.DataFromReader(http.StatusOK, job.Size, "application/zip", stream, map[string]string{
+		"Content-Disposition": `attachment; filename="` + job.FileName + `"`,
+	})
+}
+
+func DeleteExport(c *gin.Context) {
+	tmp, _ := c.Get("exportJob")
+	job := tmp.(model.ExportJob)
+
+	if err := service.DeleteExport(c.Request.Context(), job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error deleting export",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Export deleted successfully"})
+}
+
+// ExportJournal writes the filtered data as a beancount or ledger journal,
+// `dialect` picks which.
+func ExportJournal(c *gin.Context) {
+	dialect := c.DefaultQuery("dialect", string(journal.Beancount))
+	if !journal.IsDialect(dialect) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "`dialect` should be beancount or ledger"})
+		return
+	}
+
+	tmp, _ := c.Get("exportJob")
+	job := tmp.(model.ExportJob)
+
+	ds, err := service.LoadDataset(c.Request.Context(), job.Owner, job.Filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error loading data",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := journal.Write(&buf, ds, journal.Dialect(dialect)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error writing journal",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	name := "fintrack-" + time.Now().UTC().Format("20060102") + "." + dialect
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+}
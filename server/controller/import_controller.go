@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func AddImportProfile(c *gin.Context) {
+	tmp, _ := c.Get("importProfile")
+	profile := tmp.(model.ImportProfile)
+
+	result, err := service.AddImportProfile(c.Request.Context(), profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error adding import profile",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Import profile added successfully",
+		"id":      result,
+	})
+}
+
+func GetImportProfilesSince(c *gin.Context) {
+	sinceTime, err := time.Parse(time.RFC3339, c.Param("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	cursor, err := service.FetchImportProfilesSince(ctx, c.GetString("username"), sinceTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching import profiles",
+			"detail": err.Error(),
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		if cursor.Next(ctx) {
+			var profile model.ImportProfile
+			if err := cursor.Decode(&profile); err != nil {
+				fmt.Println("Error decoding import profile:", err)
+				return false
+			}
+			json.NewEncoder(w).Encode(profile)
+			return true
+		}
+		return false
+	})
+}
+
+func UpdateImportProfile(c *gin.Context) {
+	tmp, _ := c.Get("importProfile")
+	profile := tmp.(model.ImportProfile)
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import profile ID"})
+		return
+	}
+
+	if err := service.UpdateImportProfile(c.Request.Context(), id, profile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error updating import profile",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Import profile updated successfully"})
+}
+
+func DeleteImportProfile(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import profile ID"})
+		return
+	}
+
+	if err := service.DeleteImportProfile(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error deleting import profile",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Import profile deleted successfully"})
+}
+
+// PreviewImport parses an upload and stores it as a preview. Nothing is
+// booked until the preview is committed.
+func PreviewImport(c *gin.Context) {
+	tmp, _ := c.Get("importFile")
+	data := tmp.([]byte)
+	tmp, _ = c.Get("importProfile")
+	profile := tmp.(model.ImportProfile)
+	tmp, _ = c.Get("importBatch")
+	batch := tmp.(model.ImportBatch)
+
+	rows, balances, err := service.ParseImportFile(batch.Format, data, profile)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Error reading file",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	batch, err = service.PreviewImport(c.Request.Context(), batch, rows, balances)
+	if errors.Is(err, service.ErrImportTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error previewing import",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+func GetImport(c *gin.Context) {
+	tmp, _ := c.Get("importBatch")
+	c.JSON(http.StatusOK, tmp.(model.ImportBatch))
+}
+
+func CommitImport(c *gin.Context) {
+	tmp, _ := c.Get("importBatch")
+	batch := tmp.(model.ImportBatch)
+
+	var body struct {
+		Skip              []int `json:"skip"`
+		IncludeDuplicates bool  `json:"includeDuplicates"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	summary, err := service.CommitImport(c.Request.Context(), batch, body.Skip, body.IncludeDuplicates)
+	if errors.Is(err, service.ErrImportClaimed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Import was already committed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error committing import",
+			"detail":  err.Error(),
+			"summary": summary,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+func ImportJournal(c *gin.Context) {
+	tmp, _ := c.Get("journalDataset")
+	ds := tmp.(*model.Dataset)
+
+	summary, err := service.ImportJournal(c.Request.Context(), c.GetString("username"), ds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error importing journal",
+			"detail":  err.Error(),
+			"summary": summary,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+func RestoreDataset(c *gin.Context) {
+	tmp, _ := c.Get("restoreDataset")
+	ds := tmp.(*model.Dataset)
+	tmp, _ = c.Get("restoreStrategy")
+	strategy := tmp.(model.RestoreStrategy)
+
+	summary, err := service.RestoreDataset(c.Request.Context(), c.GetString("username"), ds, strategy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error restoring data",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func AddLoan(c *gin.Context) {
+	tmp, _ := c.Get("loan")
+	loan := tmp.(model.Loan)
+
+	result, err := service.AddLoan(c.Request.Context(), loan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error adding loan",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Loan added successfully",
+		"id":      result,
+	})
+}
+
+// PreviewLoanSchedule returns the amortization schedule without saving.
+func PreviewLoanSchedule(c *gin.Context) {
+	tmp, _ := c.Get("loan")
+	loan := tmp.(model.Loan)
+
+	schedule, err := service.BuildAmortizationSchedule(loan.Principal, loan.Rate, loan.Method, loan.Term, loan.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+func GetLoansSince(c *gin.Context) {
+	sinceTime, err := time.Parse(time.RFC3339, c.Param("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	cursor, err := service.FetchLoansSince(ctx, c.GetString("username"), sinceTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching loans",
+			"detail": err.Error(),
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		if cursor.Next(ctx) {
+			var loan model.Loan
+			if err := cursor.Decode(&loan); err != nil {
+				fmt.Println("Error decoding loan:", err)
+				return false
+			}
+			json.NewEncoder(w).Encode(loan)
+			return true
+		}
+		return false
+	})
+}
+
+func PrepayLoan(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	var body struct {
+		Amount   float64 `json:"amount"`
+		DateTime string  `json:"dateTime"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	at := time.Now()
+	if body.DateTime != "" {
+		at, err = time.Parse(time.RFC3339, body.DateTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format on `dateTime`"})
+			return
+		}
+	}
+
+	loan, err := service.PrepayLoan(c.Request.Context(), id, body.Amount, at)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Error repaying loan",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, loan)
+}
+
+func DeleteLoan(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	err = service.DeleteLoan(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error deleting loan",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Loan deleted successfully"})
+}
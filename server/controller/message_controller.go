@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/parser"
+	"fintrack/server/service"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func AddMessageTemplate(c *gin.Context) {
+	tmp, _ := c.Get("messageTemplate")
+	template := tmp.(model.MessageTemplate)
+
+	result, err := service.AddMessageTemplate(c.Request.Context(), template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error adding message template",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Message template added successfully",
+		"id":      result,
+	})
+}
+
+func GetMessageTemplatesSince(c *gin.Context) {
+	sinceTime, err := time.Parse(time.RFC3339, c.Param("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	cursor, err := service.FetchMessageTemplatesSince(ctx, c.GetString("username"), sinceTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching message templates",
+			"detail": err.Error(),
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		if cursor.Next(ctx) {
+			var template model.MessageTemplate
+			if err := cursor.Decode(&template); err != nil {
+				fmt.Println("Error decoding message template:", err)
+				return false
+			}
+			json.NewEncoder(w).Encode(template)
+			return true
+		}
+		return false
+	})
+}
+
+// GetBuiltinMessageTemplates lists the templates every user has, to start
+// one's own from.
+func GetBuiltinMessageTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, parser.BuiltinTemplates)
+}
+
+func UpdateMessageTemplate(c *gin.Context) {
+	tmp, _ := c.Get("messageTemplate")
+	template := tmp.(model.MessageTemplate)
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message template ID"})
+		return
+	}
+
+	if err := service.UpdateMessageTemplate(c.Request.Context(), id, template); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error updating message template",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message template updated successfully"})
+}
+
+func DeleteMessageTemplate(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message template ID"})
+		return
+	}
+
+	if err := service.DeleteMessageTemplate(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error deleting message template",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message template deleted successfully"})
+}
+
+// TestMessageTemplate shows which unmatched messages a draft template would
+// read.
+func TestMessageTemplate(c *gin.Context) {
+	tmp, _ := c.Get("messageTemplate")
+	template := tmp.(model.MessageTemplate)
+
+	matches, err := service.TestMessageTemplate(c.Request.Context(), template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error testing message template",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":   len(matches),
+		"matches": matches,
+	})
+}
+
+func IngestMessage(c *gin.Context) {
+	tmp, _ := c.Get("incomingMessage")
+	msg := tmp.(service.IncomingMessage)
+
+	result, err := service.IngestMessage(c.Request.Context(), c.GetString("username"), msg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error ingesting message",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func GetUnmatchedMessages(c *gin.Context) {
+	messages, err := service.GetUnmatchedMessages(c.Request.Context(), c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching unmatched messages",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+func DismissUnmatchedMessage(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	err = service.DismissUnmatchedMessage(c.Request.Context(), c.GetString("username"), id)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error dismissing message",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message dismissed"})
+}
@@ -151,3 +151,85 @@ func DeleteNotification(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Notification deleted successfully"})
 }
+
+func GetScheduledNotifications(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	cursor, err := service.FetchScheduledNotifications(ctx, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching scheduled notifications",
+			"detail": err.Error(),
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		if cursor.Next(ctx) {
+			var notification model.Notification
+			if err := cursor.Decode(&notification); err != nil {
+				fmt.Println("Error decoding notification:", err)
+				return false
+			}
+			json.NewEncoder(w).Encode(notification)
+			return true
+		}
+		return false
+	})
+}
+
+func CancelNotification(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	err = service.CancelNotification(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Error cancelling notification",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification cancelled successfully"})
+}
+
+func RescheduleNotification(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	var body struct {
+		ScheduledAt string `json:"scheduledAt"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	scheduledAt, err := time.Parse(time.RFC3339, body.ScheduledAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format on `scheduledAt`"})
+		return
+	}
+
+	err = service.RescheduleNotification(c.Request.Context(), id, scheduledAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Error rescheduling notification",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification rescheduled successfully"})
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"net/http"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+func GetNotificationPreference(c *gin.Context) {
+	pref, err := service.GetNotificationPreference(c.Request.Context(), c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching notification preference",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, pref)
+}
+
+func UpdateNotificationPreference(c *gin.Context) {
+	tmp, _ := c.Get("notificationPreference")
+	pref := tmp.(model.NotificationPreference)
+
+	if err := service.UpdateNotificationPreference(c.Request.Context(), pref); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error updating notification preference",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification preference updated successfully"})
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func AddPayee(c *gin.Context) {
+	tmp, _ := c.Get("payee")
+	payee := tmp.(model.Payee)
+
+	result, err := service.AddPayee(c.Request.Context(), payee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error adding payee",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Payee added successfully",
+		"id":      result,
+	})
+}
+
+func GetPayeesSince(c *gin.Context) {
+	sinceTime, err := time.Parse(time.RFC3339, c.Param("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	cursor, err := service.FetchPayeesSince(ctx, c.GetString("username"), sinceTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching payees",
+			"detail": err.Error(),
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		if cursor.Next(ctx) {
+			var payee model.Payee
+			if err := cursor.Decode(&payee); err != nil {
+				fmt.Println("Error decoding payee:", err)
+				return false
+			}
+			json.NewEncoder(w).Encode(payee)
+			return true
+		}
+		return false
+	})
+}
+
+// MatchPayee tells the client which payee a note or description would be
+// matched to, so the form can prefill category and account.
+func MatchPayee(c *gin.Context) {
+	var body struct {
+		Text string `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	matcher, err := service.LoadPayeeMatcher(c.Request.Context(), c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error matching payee",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	payee, ok := matcher.Match(body.Text)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"payee": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"payee": payee})
+}
+
+func UpdatePayee(c *gin.Context) {
+	tmp, _ := c.Get("payee")
+	payee := tmp.(model.Payee)
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payee ID"})
+		return
+	}
+
+	if err := service.UpdatePayee(c.Request.Context(), id, payee); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error updating payee",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payee updated successfully"})
+}
+
+func MergePayee(c *gin.Context) {
+	tmp, _ := c.Get("payee")
+	from := tmp.(model.Payee)
+
+	var body struct {
+		Into string `json:"into"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	into, err := service.GetPayeeByID(body.Into)
+	if err != nil || into.IsDeleted || into.Owner != from.Owner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target payee not found"})
+		return
+	}
+
+	if err := service.MergePayee(c.Request.Context(), from, into); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Error merging payees",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payees merged successfully"})
+}
+
+func DeletePayee(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payee ID"})
+		return
+	}
+
+	if err := service.DeletePayee(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error deleting payee",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payee deleted successfully"})
+}
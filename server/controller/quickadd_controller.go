@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+func QuickAdd(c *gin.Context) {
+	tmp, _ := c.Get("quickAddLocation")
+	loc := tmp.(*time.Location)
+
+	proposal, err := service.QuickAdd(c.Request.Context(), c.GetString("username"), c.GetString("quickAddText"), loc,
+		c.GetString("quickAddCurrency"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error parsing quick-add text",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, proposal)
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"net/http"
+
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+//////////////////
+// Admin Handlers
+//////////////////
+
+func CheckBalances(c *gin.Context) {
+	report, err := service.ReconcileBalances(c.Request.Context(), c.Query("owner"), false, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error reconciling balances",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func RepairBalances(c *gin.Context) {
+	mode := service.RepairMode(c.DefaultQuery("mode", string(service.RepairBalance)))
+
+	report, err := service.ReconcileBalances(c.Request.Context(), c.Query("owner"), true, mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error repairing balances",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+//////////////////
+// Report Handlers
+//////////////////
+
+func respondReport(c *gin.Context, report func(ctx context.Context, q service.ReportQuery) ([]service.ReportRow, error)) {
+	tmp, _ := c.Get("reportQuery")
+	query := tmp.(service.ReportQuery)
+
+	rows, err := report(c.Request.Context(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error building report",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":     query.From,
+		"to":       query.To,
+		"timezone": query.Location.String(),
+		"rows":     rows,
+	})
+}
+
+func GetReportByPeriod(c *gin.Context) {
+	unit := c.Param("unit")
+	respondReport(c, func(ctx context.Context, q service.ReportQuery) ([]service.ReportRow, error) {
+		return service.ReportByPeriod(ctx, q, unit)
+	})
+}
+
+func GetReportByCategory(c *gin.Context) {
+	respondReport(c, service.ReportByCategory)
+}
+
+func GetReportByPayee(c *gin.Context) {
+	respondReport(c, service.ReportByPayee)
+}
+
+func GetReportByAccount(c *gin.Context) {
+	respondReport(c, service.ReportByAccount)
+}
+
+func GetReportByType(c *gin.Context) {
+	respondReport(c, service.ReportByType)
+}
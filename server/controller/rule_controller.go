@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func AddRule(c *gin.Context) {
+	tmp, _ := c.Get("rule")
+	rule := tmp.(model.Rule)
+
+	result, err := service.AddRule(c.Request.Context(), rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error adding rule",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Rule added successfully",
+		"id":      result,
+	})
+}
+
+func GetRulesSince(c *gin.Context) {
+	sinceTime, err := time.Parse(time.RFC3339, c.Param("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	cursor, err := service.FetchRulesSince(ctx, c.GetString("username"), sinceTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching rules",
+			"detail": err.Error(),
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		if cursor.Next(ctx) {
+			var rule model.Rule
+			if err := cursor.Decode(&rule); err != nil {
+				fmt.Println("Error decoding rule:", err)
+				return false
+			}
+			json.NewEncoder(w).Encode(rule)
+			return true
+		}
+		return false
+	})
+}
+
+func UpdateRule(c *gin.Context) {
+	tmp, _ := c.Get("rule")
+	rule := tmp.(model.Rule)
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	if err := service.UpdateRule(c.Request.Context(), id, rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error updating rule",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rule updated successfully"})
+}
+
+func DeleteRule(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	if err := service.DeleteRule(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error deleting rule",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted successfully"})
+}
+
+// TestRule shows which past transactions a rule, saved or not, would change.
+// Nothing is written.
+func TestRule(c *gin.Context) {
+	tmp, _ := c.Get("rule")
+	rule := tmp.(model.Rule)
+	tmp, _ = c.Get("ruleFrom")
+	from := tmp.(time.Time)
+
+	changes, count, err := service.RunRulesOnHistory(c.Request.Context(), rule.Owner,
+		service.NewRuleSet([]model.Rule{rule}), from, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error testing rule",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":   count,
+		"changes": changes,
+	})
+}
+
+// ApplyRule runs a saved rule over past transactions.
+func ApplyRule(c *gin.Context) {
+	tmp, _ := c.Get("rule")
+	rule := tmp.(model.Rule)
+	tmp, _ = c.Get("ruleFrom")
+	from := tmp.(time.Time)
+
+	skipped, count, err := service.RunRulesOnHistory(c.Request.Context(), rule.Owner,
+		service.NewRuleSet([]model.Rule{rule}), from, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Error applying rule",
+			"detail":   err.Error(),
+			"modified": count,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"modified": count,
+		"skipped":  skipped,
+	})
+}
+
+// ApplyAllRules runs every active rule, in priority order, over past
+// transactions.
+func ApplyAllRules(c *gin.Context) {
+	tmp, _ := c.Get("ruleFrom")
+	from := tmp.(time.Time)
+	ctx := c.Request.Context()
+	username := c.GetString("username")
+
+	rules, err := service.LoadRules(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error applying rules",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	skipped, count, err := service.RunRulesOnHistory(ctx, username, rules, from, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Error applying rules",
+			"detail":   err.Error(),
+			"modified": count,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"modified": count,
+		"skipped":  skipped,
+	})
+}
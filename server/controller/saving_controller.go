@@ -110,3 +110,22 @@ func DeleteSaving(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Saving and related transactions soft deleted successfully"})
 }
+
+func RolloverSaving(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid saving ID"})
+		return
+	}
+
+	saving, err := service.RolloverSaving(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Error rolling over saving",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, saving)
+}
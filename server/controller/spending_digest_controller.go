@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+func PreviewSpendingDigest(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := c.GetString("username")
+
+	pref, err := service.GetNotificationPreference(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching notification preference",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	frequency := model.DigestFrequency(c.DefaultQuery("frequency", string(pref.SpendingDigest.Frequency)))
+	if frequency != model.FrequencyWeekly && frequency != model.FrequencyMonthly {
+		frequency = model.FrequencyWeekly
+	}
+
+	loc, err := time.LoadLocation(pref.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	from, to := service.SpendingDigestPeriod(frequency, time.Now().In(loc))
+
+	digest, err := service.BuildSpendingDigest(ctx, username, frequency, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error building spending digest",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	markdown, err := service.RenderSpendingDigestMarkdown(digest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error rendering spending digest",
+			"detail": err.Error(),
+		})
+		return
+	}
+	html, err := service.RenderSpendingDigestHTML(digest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error rendering spending digest",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"digest":   digest,
+		"markdown": markdown,
+		"html":     html,
+	})
+}
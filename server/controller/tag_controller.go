@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func AddTag(c *gin.Context) {
+	tmp, _ := c.Get("tag")
+	tag := tmp.(model.Tag)
+
+	result, err := service.AddTag(c.Request.Context(), tag)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrTagExists) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error":  "Error adding tag",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tag added successfully",
+		"id":      result,
+	})
+}
+
+func GetTagsSince(c *gin.Context) {
+	sinceTime, err := time.Parse(time.RFC3339, c.Param("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	cursor, err := service.FetchTagsSince(ctx, c.GetString("username"), sinceTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error fetching tags",
+			"detail": err.Error(),
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		if cursor.Next(ctx) {
+			var tag model.Tag
+			if err := cursor.Decode(&tag); err != nil {
+				fmt.Println("Error decoding tag:", err)
+				return false
+			}
+			json.NewEncoder(w).Encode(tag)
+			return true
+		}
+		return false
+	})
+}
+
+func UpdateTag(c *gin.Context) {
+	tmp, _ := c.Get("tag")
+	tag := tmp.(model.Tag)
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+
+	err = service.UpdateTag(c.Request.Context(), id, tag)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrTagExists) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error":  "Error updating tag",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag updated successfully"})
+}
+
+func MergeTag(c *gin.Context) {
+	tmp, _ := c.Get("tag")
+	from := tmp.(model.Tag)
+
+	var body struct {
+		Into string `json:"into"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	into, err := service.GetTagByID(body.Into)
+	if err != nil || into.IsDeleted || into.Owner != from.Owner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target tag not found"})
+		return
+	}
+
+	if err := service.MergeTag(c.Request.Context(), from.ID, into.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Error merging tags",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tags merged successfully"})
+}
+
+func DeleteTag(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+
+	if err := service.DeleteTag(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error deleting tag",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+func bulkTag(c *gin.Context, untag bool) {
+	tmp, _ := c.Get("bulkTransactions")
+	transactions := tmp.([]primitive.ObjectID)
+	tmp, _ = c.Get("bulkTags")
+	tags := tmp.([]primitive.ObjectID)
+
+	count, err := service.TagTransactions(c.Request.Context(), c.GetString("username"), transactions, tags, untag)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Error tagging transactions",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"modified": count})
+}
+
+func TagTransactions(c *gin.Context) {
+	bulkTag(c, false)
+}
+
+func UntagTransactions(c *gin.Context) {
+	bulkTag(c, true)
+}
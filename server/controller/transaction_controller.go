@@ -28,7 +28,10 @@ func GetTransactionsSince(c *gin.Context) {
 
     ctx := c.Request.Context()
 
-    cursor, err := service.FetchTransactionsSince(ctx, c.GetString("username"), sinceTime)
+    tmp, _ := c.Get("tagFilter")
+    tags, _ := tmp.([]primitive.ObjectID)
+
+    cursor, err := service.FetchTransactionsSince(ctx, c.GetString("username"), sinceTime, tags)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{
             "error": "Error fetching transactions",
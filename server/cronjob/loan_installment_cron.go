@@ -0,0 +1,29 @@
+package cronjob
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"fintrack/server/service"
+)
+
+func LoanInstallmentCron() {
+    ticker := time.NewTicker(1 * time.Hour)
+    if os.Getenv("DEV") == "true" {
+        ticker = time.NewTicker(1 * time.Minute)
+    }
+    defer ticker.Stop()
+
+    for {
+        <-ticker.C
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+
+        if err := service.PostDueInstallments(ctx); err != nil {
+            log.Println("Error posting loan installments:", err)
+        }
+
+        cancel()
+    }
+}
@@ -0,0 +1,25 @@
+package cronjob
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"fintrack/server/service"
+)
+
+func DispatchNotificationsCron() {
+    ticker := time.NewTicker(1 * time.Minute)
+    defer ticker.Stop()
+
+    for {
+        <-ticker.C
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+        if err := service.DispatchDueNotifications(ctx); err != nil {
+            log.Println("Error dispatching notifications:", err)
+        }
+
+        cancel()
+    }
+}
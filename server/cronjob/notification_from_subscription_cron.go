@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"fintrack/server/model"
@@ -54,7 +55,7 @@ func CreateSubscriptionNotificationsCron() {
                 Type: model.TypeSubscription,
                 ReferenceId: sub.ID,
                 Title: "Subscription Alert",
-                Message: "Your subscription " + sub.Name + " is about to due in " + string(sub.RemindBefore) + "days.",
+                Message: "Your subscription " + sub.Name + " is about to due in " + strconv.Itoa(sub.RemindBefore) + " days.",
                 ScheduledAt: time.Now(),
             }
 
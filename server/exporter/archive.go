@@ -0,0 +1,194 @@
+// Package exporter writes a user's data out of fintrack. It only formats,
+// loading the data is up to the service.
+package exporter
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"fintrack/server/journal"
+	"fintrack/server/model"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DatasetFile is the lossless dump inside an archive, what a restore reads.
+const DatasetFile = "fintrack.json"
+
+// WriteArchive writes ds as a ZIP: the JSON dump, one CSV per collection,
+// one OFX statement per account or saving and the beancount and ledger
+// journals. balances are the ledger balances
+// at the end of the exported period, current balances stand in for missing
+// ones.
+func WriteArchive(w io.Writer, ds *model.Dataset, balances map[primitive.ObjectID]float64) error {
+	archive := zip.NewWriter(w)
+
+	file, err := archive.Create(DatasetFile)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(ds); err != nil {
+		return err
+	}
+
+	collections := []struct {
+		name string
+		rows interface{}
+	}{
+		{"accounts", ds.Accounts},
+		{"savings", ds.Savings},
+		{"categories", ds.Categories},
+		{"tags", ds.Tags},
+		{"payees", ds.Payees},
+		{"transactions", ds.Transactions},
+		{"subscriptions", ds.Subscriptions},
+		{"loans", ds.Loans},
+		{"rules", ds.Rules},
+		{"import_profiles", ds.ImportProfiles},
+		{"message_templates", ds.MessageTemplates},
+		{"statements", ds.Statements},
+		{"balance_snapshots", ds.BalanceSnapshots},
+		{"notifications", ds.Notifications},
+	}
+	for _, c := range collections {
+		file, err := archive.Create("csv/" + c.name + ".csv")
+		if err != nil {
+			return err
+		}
+		if err := WriteCSV(file, c.rows); err != nil {
+			return err
+		}
+	}
+
+	for _, st := range ofxStatements(ds, balances) {
+		file, err := archive.Create("ofx/" + st.name + ".ofx")
+		if err != nil {
+			return err
+		}
+		if err := WriteOFX(file, st.OFXStatement); err != nil {
+			return err
+		}
+	}
+
+	for _, j := range []struct {
+		name    string
+		dialect journal.Dialect
+	}{{"fintrack.beancount", journal.Beancount}, {"fintrack.ledger", journal.Ledger}} {
+		file, err := archive.Create(j.name)
+		if err != nil {
+			return err
+		}
+		if err := journal.Write(file, ds, j.dialect); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// ReadDataset reads the JSON dump back, from an archive or on its own.
+func ReadDataset(data []byte) (*model.Dataset, error) {
+	if bytes.HasPrefix(data, []byte("PK")) {
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		file, err := archive.Open(DatasetFile)
+		if err != nil {
+			return nil, errors.New("The archive has no " + DatasetFile)
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			return nil, err
+		}
+	}
+
+	var ds model.Dataset
+	if err := json.Unmarshal(data, &ds); err != nil {
+		return nil, err
+	}
+	return &ds, nil
+}
+
+type namedStatement struct {
+	OFXStatement
+	name string
+}
+
+func ofxStatements(ds *model.Dataset, balances map[primitive.ObjectID]float64) []namedStatement {
+	payees := map[primitive.ObjectID]string{}
+	for _, p := range ds.Payees {
+		payees[p.ID] = p.Name
+	}
+
+	start, end := ds.Filter.From, ds.Filter.To
+	if end.IsZero() {
+		end = ds.ExportedAt
+	}
+	if start.IsZero() {
+		start = end
+		for _, tx := range ds.Transactions {
+			if tx.DateTime.Before(start) {
+				start = tx.DateTime
+			}
+		}
+	}
+
+	var statements []namedStatement
+	add := func(id primitive.ObjectID, name, number string, balance float64, creditCard bool) {
+		if b, ok := balances[id]; ok {
+			balance = b
+		}
+		if number == "" {
+			number = id.Hex()
+		}
+		st := namedStatement{
+			OFXStatement: OFXStatement{
+				Account:    id,
+				Number:     number,
+				CreditCard: creditCard,
+				Currency:   ds.Filter.Currency,
+				Start:      start,
+				End:        end,
+				Balance:    balance,
+				Payees:     payees,
+			},
+			name: fileName(name, id),
+		}
+		for _, tx := range ds.Transactions {
+			if tx.SourceAccount == id || tx.DestinationAccount == id {
+				st.Transactions = append(st.Transactions, tx)
+			}
+		}
+		statements = append(statements, st)
+	}
+
+	for _, a := range ds.Accounts {
+		if !a.IsDeleted {
+			add(a.ID, a.Name, a.BankAccountNumber, a.Balance, a.AccountType() == model.AccountCreditCard)
+		}
+	}
+	for _, s := range ds.Savings {
+		if !s.IsDeleted {
+			add(s.ID, s.Name, "", s.Balance, false)
+		}
+	}
+	return statements
+}
+
+// fileName is a readable, unique name for an account's file.
+func fileName(name string, id primitive.ObjectID) string {
+	slug := strings.ReplaceAll(util.NormalizeText(name), " ", "-")
+	hex := id.Hex()
+	if slug == "" {
+		return hex
+	}
+	return slug + "-" + hex[len(hex)-6:]
+}
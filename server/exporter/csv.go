@@ -0,0 +1,111 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// WriteCSV writes a slice of model structs with one column per field, named
+// after its JSON key. Ids are hex, times RFC 3339, lists of ids or strings
+// are joined with ";" and anything nested is a JSON cell.
+func WriteCSV(w io.Writer, rows interface{}) error {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("WriteCSV needs a slice of structs, got %T", rows)
+	}
+	t := v.Type().Elem()
+
+	var fields []int
+	var header []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, i)
+		header = append(header, name)
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(fields))
+	for r := 0; r < v.Len(); r++ {
+		for c, i := range fields {
+			cell, err := csvCell(v.Index(r).Field(i))
+			if err != nil {
+				return fmt.Errorf("row %d, %s: %w", r+1, header[c], err)
+			}
+			record[c] = cell
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func csvCell(v reflect.Value) (string, error) {
+	switch v.Type() {
+	case objectIDType:
+		id := v.Interface().(primitive.ObjectID)
+		if id.IsZero() {
+			return "", nil
+		}
+		return id.Hex(), nil
+	case timeType:
+		at := v.Interface().(time.Time)
+		if at.IsZero() {
+			return "", nil
+		}
+		return at.Format(time.RFC3339), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return "", nil
+		}
+		if elem := v.Type().Elem(); elem == objectIDType || elem.Kind() == reflect.String {
+			parts := make([]string, v.Len())
+			for i := range parts {
+				parts[i], _ = csvCell(v.Index(i))
+			}
+			return strings.Join(parts, ";"), nil
+		}
+	case reflect.Map:
+		if v.Len() == 0 {
+			return "", nil
+		}
+	}
+
+	data, err := json.Marshal(v.Interface())
+	return string(data), err
+}
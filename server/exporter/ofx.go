@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"fintrack/server/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OFXStatement is one account's transactions as an OFX 2.2 bank or credit
+// card statement.
+type OFXStatement struct {
+	Account    primitive.ObjectID
+	Number     string // ACCTID, the bank's number when known
+	CreditCard bool
+	Currency   string
+	Start, End time.Time
+	Balance    float64 // ledger balance at End
+	Payees     map[primitive.ObjectID]string
+	// Every transaction touching Account, deleted ones are left out
+	Transactions []model.Transaction
+}
+
+const ofxTime = "20060102150405"
+
+// WriteOFX writes st as an OFX 2.2 (XML) file.
+func WriteOFX(w io.Writer, st OFXStatement) error {
+	var b bytes.Buffer
+	tag := func(name, value string) {
+		b.WriteString("<" + name + ">")
+		xml.EscapeText(&b, []byte(value))
+		b.WriteString("</" + name + ">\n")
+	}
+	status := "<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n"
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	b.WriteString(`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n")
+	b.WriteString("<OFX>\n<SIGNONMSGSRSV1><SONRS>\n" + status)
+	tag("DTSERVER", time.Now().UTC().Format(ofxTime))
+	tag("LANGUAGE", "ENG")
+	b.WriteString("</SONRS></SIGNONMSGSRSV1>\n")
+
+	if st.CreditCard {
+		b.WriteString("<CREDITCARDMSGSRSV1><CCSTMTTRNRS>\n")
+	} else {
+		b.WriteString("<BANKMSGSRSV1><STMTTRNRS>\n")
+	}
+	tag("TRNUID", "0")
+	b.WriteString(status)
+	if st.CreditCard {
+		b.WriteString("<CCSTMTRS>\n")
+	} else {
+		b.WriteString("<STMTRS>\n")
+	}
+	tag("CURDEF", st.Currency)
+	if st.CreditCard {
+		b.WriteString("<CCACCTFROM>")
+		tag("ACCTID", st.Number)
+		b.WriteString("</CCACCTFROM>\n")
+	} else {
+		b.WriteString("<BANKACCTFROM>")
+		tag("BANKID", "FINTRACK")
+		tag("ACCTID", st.Number)
+		tag("ACCTTYPE", "CHECKING")
+		b.WriteString("</BANKACCTFROM>\n")
+	}
+
+	transactions := append([]model.Transaction(nil), st.Transactions...)
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].DateTime.Before(transactions[j].DateTime)
+	})
+
+	b.WriteString("<BANKTRANLIST>\n")
+	tag("DTSTART", st.Start.UTC().Format(ofxTime))
+	tag("DTEND", st.End.UTC().Format(ofxTime))
+	for _, tx := range transactions {
+		if tx.IsDeleted {
+			continue
+		}
+		amount := 0.0
+		if tx.SourceAccount == st.Account {
+			amount -= tx.Amount
+		}
+		if tx.DestinationAccount == st.Account {
+			amount += tx.Amount
+		}
+
+		trnType := "CREDIT"
+		switch {
+		case tx.Type == "transfer":
+			trnType = "XFER"
+		case amount < 0:
+			trnType = "DEBIT"
+		}
+		fitID := tx.ExternalID
+		if fitID == "" {
+			fitID = tx.ID.Hex()
+		}
+		name := st.Payees[tx.Payee]
+		if name == "" {
+			name = tx.Note
+		}
+		if r := []rune(name); len(r) > 32 {
+			name = string(r[:32])
+		}
+
+		b.WriteString("<STMTTRN>\n")
+		tag("TRNTYPE", trnType)
+		tag("DTPOSTED", tx.DateTime.UTC().Format(ofxTime))
+		if !tx.ValueDate.IsZero() {
+			tag("DTAVAIL", tx.ValueDate.UTC().Format(ofxTime))
+		}
+		tag("TRNAMT", strconv.FormatFloat(amount, 'f', 2, 64))
+		tag("FITID", fitID)
+		if name != "" {
+			tag("NAME", name)
+		}
+		if tx.Note != "" && tx.Note != name {
+			tag("MEMO", tx.Note)
+		}
+		b.WriteString("</STMTTRN>\n")
+	}
+	b.WriteString("</BANKTRANLIST>\n")
+
+	b.WriteString("<LEDGERBAL>")
+	tag("BALAMT", strconv.FormatFloat(st.Balance, 'f', 2, 64))
+	tag("DTASOF", st.End.UTC().Format(ofxTime))
+	b.WriteString("</LEDGERBAL>\n")
+
+	if st.CreditCard {
+		b.WriteString("</CCSTMTRS>\n</CCSTMTTRNRS></CREDITCARDMSGSRSV1>\n")
+	} else {
+		b.WriteString("</STMTRS>\n</STMTTRNRS></BANKMSGSRSV1>\n")
+	}
+	b.WriteString("</OFX>\n")
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("Failed to write OFX: %w", err)
+	}
+	return nil
+}
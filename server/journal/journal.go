@@ -0,0 +1,91 @@
+// Package journal converts fintrack data to and from plain-text accounting
+// journals: beancount, and ledger which hledger reads as well.
+//
+// Accounts and savings live under Assets: (credit cards and loans under
+// Liabilities:), categories under Expenses: and Income:, balance entries
+// against Equity:. Ids and whatever has no journal syntax travel as
+// metadata, so a journal written here reads back into the same data.
+package journal
+
+import (
+	"strings"
+
+	"fintrack/server/model"
+	"fintrack/server/util"
+)
+
+type Dialect string
+
+const (
+	Beancount Dialect = "beancount"
+	Ledger    Dialect = "ledger"
+)
+
+func IsDialect(s string) bool {
+	return s == string(Beancount) || s == string(Ledger)
+}
+
+// Top-level journal accounts
+const (
+	rootAssets      = "Assets"
+	rootLiabilities = "Liabilities"
+	rootExpenses    = "Expenses"
+	rootIncome      = "Income"
+	rootEquity      = "Equity"
+
+	openingAccount     = "Equity:Opening-Balances"
+	adjustmentAccount  = "Equity:Adjustments"
+	uncategorizedLabel = "Uncategorized"
+)
+
+// Metadata kinds of declared accounts
+const (
+	kindAccount  = "account"
+	kindSaving   = "saving"
+	kindCategory = "category"
+)
+
+// accountGroups names the journal group of each account type.
+var accountGroups = map[model.AccountType]string{
+	model.AccountCash:       "Cash",
+	model.AccountChecking:   "Checking",
+	model.AccountEWallet:    "E-Wallet",
+	model.AccountCreditCard: "Credit-Card",
+	model.AccountLoan:       "Loan",
+}
+
+const savingsGroup = "Savings"
+
+// otherGroup holds accounts a transaction points at but the data left out.
+const otherGroup = "Other"
+
+// accountPath is where an account goes in the journal, before its name.
+func accountPath(a model.Account) string {
+	root := rootAssets
+	if a.AccountType().IsLiability() {
+		root = rootLiabilities
+	}
+	return root + ":" + accountGroups[a.AccountType()]
+}
+
+// component turns a name into a journal account component: ASCII words,
+// capitalized and joined by hyphens, as beancount wants them.
+func component(name string) string {
+	words := strings.Fields(util.NormalizeText(name))
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	if len(words) == 0 {
+		return "Unnamed"
+	}
+	return strings.Join(words, "-")
+}
+
+// tagName is a tag as journals write it: lowercase, no spaces.
+func tagName(name string) string {
+	slug := strings.ReplaceAll(util.NormalizeText(name), " ", "-")
+	if slug == "" {
+		return "tag"
+	}
+	return slug
+}
@@ -0,0 +1,687 @@
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"fintrack/server/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A dated line: the date, an optional ledger auxiliary date, the rest
+var datedLine = regexp.MustCompile(`^(\d{4}[-/]\d{2}[-/]\d{2})(?:=(\d{4}[-/]\d{2}[-/]\d{2}))?\s+(.*)$`)
+
+// block is a directive or transaction with its indented lines.
+type block struct {
+	line     int
+	date     time.Time
+	auxDate  time.Time
+	head     string // what follows the date
+	meta     map[string]string
+	tags     []string
+	postings []readPosting
+}
+
+type readPosting struct {
+	account string
+	amount  float64
+	elided  bool
+	meta    map[string]string
+}
+
+// Read parses a beancount or ledger journal, either dialect is recognized
+// line by line. Accounts, tags and payees declared with fintrack metadata
+// keep their ids, the others get new ones.
+func Read(text string) (*model.Dataset, error) {
+	blocks, err := splitBlocks(text)
+	if err != nil {
+		return nil, err
+	}
+
+	r := newReader()
+	var txBlocks []block
+	for _, b := range blocks {
+		switch {
+		case b.date.IsZero():
+			r.directive(b)
+		case strings.HasPrefix(b.head, "open "):
+			r.declareAccount(strings.Fields(b.head)[1], b.meta)
+		case strings.HasPrefix(b.head, "custom "):
+			r.custom(b)
+		case isTransactionHead(b.head):
+			txBlocks = append(txBlocks, b)
+		}
+	}
+
+	for _, b := range txBlocks {
+		tx, err := r.transaction(b)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", b.line, err)
+		}
+		r.ds.Transactions = append(r.ds.Transactions, tx)
+	}
+	return r.ds, nil
+}
+
+// splitBlocks groups lines under the unindented line they follow.
+func splitBlocks(text string) ([]block, error) {
+	var blocks []block
+	var current *block
+	postingIndent := -1
+
+	for n, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := strings.TrimRight(raw, " \t")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+
+		if indent == 0 {
+			current, postingIndent = nil, -1
+			if strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "*") {
+				continue
+			}
+			b := block{line: n + 1, head: trimmed, meta: map[string]string{}}
+			if m := datedLine.FindStringSubmatch(trimmed); m != nil {
+				var err error
+				if b.date, err = parseDate(m[1]); err != nil {
+					return nil, fmt.Errorf("line %d: %w", n+1, err)
+				}
+				if m[2] != "" {
+					if b.auxDate, err = parseDate(m[2]); err != nil {
+						return nil, fmt.Errorf("line %d: %w", n+1, err)
+					}
+				}
+				b.head = m[3]
+			}
+			blocks = append(blocks, b)
+			current = &blocks[len(blocks)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		// Lines deeper than the last posting belong to it
+		target := current.meta
+		last := len(current.postings) - 1
+		if last >= 0 && indent > postingIndent {
+			target = current.postings[last].meta
+		}
+
+		switch {
+		case strings.HasPrefix(trimmed, ";"):
+			comment := strings.TrimSpace(strings.TrimPrefix(trimmed, ";"))
+			if target == nil {
+				continue
+			}
+			if strings.HasPrefix(comment, ":") && strings.HasSuffix(comment, ":") {
+				for _, t := range strings.Split(strings.Trim(comment, ":"), ":") {
+					if t != "" && last < 0 {
+						current.tags = append(current.tags, t)
+					}
+				}
+				continue
+			}
+			if key, value, ok := strings.Cut(comment, ":"); ok && !strings.Contains(key, " ") {
+				target[key] = strings.TrimSpace(value)
+			}
+
+		case trimmed[0] >= 'a' && trimmed[0] <= 'z':
+			// beancount metadata, a ledger sub-directive, or a posting to an
+			// hledger lowercase account, which has no space after its colons
+			key, value, ok := strings.Cut(trimmed, ":")
+			if ok && !strings.ContainsAny(key, " \t") && (value == "" || value[0] == ' ' || value[0] == '\t') {
+				if target != nil {
+					target[key] = unquote(strings.TrimSpace(value))
+				}
+				continue
+			}
+			if !ok || strings.ContainsAny(key, " \t") {
+				continue
+			}
+			fallthrough
+
+		default:
+			p, err := parsePosting(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			current.postings = append(current.postings, p)
+			postingIndent = indent
+		}
+	}
+	return blocks, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	return time.Parse("2006-01-02", strings.ReplaceAll(s, "/", "-"))
+}
+
+func isTransactionHead(head string) bool {
+	return head == "*" || head == "!" || strings.HasPrefix(head, "* ") || strings.HasPrefix(head, "! ") ||
+		strings.HasPrefix(head, "txn") || strings.HasPrefix(head, `"`) ||
+		// ledger allows no flag at all, but never a lowercase directive
+		(head != "" && !isDirectiveWord(head))
+}
+
+var beancountDirectives = map[string]bool{
+	"open": true, "close": true, "balance": true, "pad": true, "note": true, "document": true,
+	"price": true, "event": true, "query": true, "commodity": true, "custom": true,
+}
+
+func isDirectiveWord(head string) bool {
+	word, _, _ := strings.Cut(head, " ")
+	return beancountDirectives[word]
+}
+
+// parsePosting reads "Account  amount [commodity]" with an optional comment.
+// Costs, prices and balance assertions are ignored.
+func parsePosting(line string) (readPosting, error) {
+	p := readPosting{meta: map[string]string{}}
+	if strings.HasPrefix(line, "! ") || strings.HasPrefix(line, "* ") {
+		line = strings.TrimSpace(line[2:])
+	}
+	if body, comment, ok := strings.Cut(line, ";"); ok {
+		line = strings.TrimSpace(body)
+		if key, value, ok := strings.Cut(strings.TrimSpace(comment), ":"); ok && !strings.Contains(key, " ") {
+			p.meta[key] = strings.TrimSpace(value)
+		}
+	}
+
+	// Ledger account names may hold single spaces, the amount starts after
+	// two spaces or a tab. Beancount names never hold any.
+	account, rest := line, ""
+	gap := strings.Index(line, "  ")
+	if tab := strings.Index(line, "\t"); tab >= 0 && (gap < 0 || tab < gap) {
+		gap = tab
+	}
+	if gap >= 0 {
+		account, rest = line[:gap], line[gap:]
+	} else if i := strings.Index(line, " "); i >= 0 && strings.ContainsAny(line[i:], "0123456789") {
+		account, rest = line[:i], line[i:]
+	}
+	p.account = strings.Trim(strings.TrimSpace(account), "[]()")
+
+	rest = strings.TrimSpace(rest)
+	if i := strings.IndexAny(rest, "@{="); i >= 0 {
+		rest = strings.TrimSpace(rest[:i])
+	}
+	if rest == "" {
+		p.elided = true
+		return p, nil
+	}
+	for _, field := range strings.Fields(rest) {
+		number := strings.Map(func(r rune) rune {
+			if (r >= '0' && r <= '9') || r == '-' || r == '+' || r == '.' {
+				return r
+			}
+			if r == ',' {
+				return -1
+			}
+			if strings.ContainsRune("$€£¥₫", r) {
+				return -1
+			}
+			return 'x'
+		}, field)
+		if v, err := strconv.ParseFloat(number, 64); err == nil {
+			p.amount = v
+			return p, nil
+		}
+	}
+	return p, errors.New("Invalid amount `" + rest + "`")
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// quotedStrings splits a beancount transaction head into its strings and
+// #tags.
+func quotedStrings(head string) (strs []string, tags []string) {
+	for i := 0; i < len(head); i++ {
+		switch head[i] {
+		case '"':
+			j := i + 1
+			for j < len(head) && head[j] != '"' {
+				if head[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(head) {
+				j = len(head) - 1
+			}
+			strs = append(strs, unquote(head[i:j+1]))
+			i = j
+		case '#':
+			j := i + 1
+			for j < len(head) && head[j] != ' ' && head[j] != '\t' {
+				j++
+			}
+			tags = append(tags, head[i+1:j])
+			i = j
+		case ';':
+			return strs, tags
+		}
+	}
+	return strs, tags
+}
+
+type reader struct {
+	ds       *model.Dataset
+	accounts map[string]primitive.ObjectID // journal account -> account, saving or category
+	kinds    map[string]string
+	tags     map[string]primitive.ObjectID // journal tag -> tag
+	payees   map[string]primitive.ObjectID // payee name -> payee
+}
+
+func newReader() *reader {
+	return &reader{
+		ds: &model.Dataset{
+			Version:      model.DatasetVersion,
+			Accounts:     []model.Account{},
+			Savings:      []model.Saving{},
+			Categories:   []model.Category{},
+			Tags:         []model.Tag{},
+			Payees:       []model.Payee{},
+			Transactions: []model.Transaction{},
+		},
+		accounts: map[string]primitive.ObjectID{},
+		kinds:    map[string]string{},
+		tags:     map[string]primitive.ObjectID{},
+		payees:   map[string]primitive.ObjectID{},
+	}
+}
+
+func idOf(meta map[string]string) primitive.ObjectID {
+	if id, err := primitive.ObjectIDFromHex(meta["id"]); err == nil {
+		return id
+	}
+	return primitive.NewObjectID()
+}
+
+// directive handles the undated ledger directives.
+func (r *reader) directive(b block) {
+	word, rest, _ := strings.Cut(b.head, " ")
+	rest = strings.TrimSpace(rest)
+	switch word {
+	case "account":
+		r.declareAccount(rest, b.meta)
+	case "payee":
+		r.declarePayee(rest, b.meta)
+	case "tag":
+		r.declareTag(rest, b.meta)
+	}
+}
+
+func (r *reader) custom(b block) {
+	strs, _ := quotedStrings(strings.TrimPrefix(b.head, "custom "))
+	if len(strs) < 2 {
+		return
+	}
+	switch strs[0] {
+	case "fintrack-payee":
+		r.declarePayee(strs[1], b.meta)
+	case "fintrack-tag":
+		r.declareTag(strs[1], b.meta)
+	}
+}
+
+// rootOf is the top-level account of a journal account, in any case. hledger
+// also calls income revenue.
+func rootOf(account string) string {
+	first, _, _ := strings.Cut(account, ":")
+	switch strings.ToLower(first) {
+	case "assets", "asset":
+		return rootAssets
+	case "liabilities", "liability":
+		return rootLiabilities
+	case "expenses", "expense":
+		return rootExpenses
+	case "income", "revenue", "revenues":
+		return rootIncome
+	case "equity":
+		return rootEquity
+	}
+	return first
+}
+
+// nameOf is the readable name of a journal account without metadata.
+func nameOf(account string) string {
+	parts := strings.Split(account, ":")
+	return strings.ReplaceAll(parts[len(parts)-1], "-", " ")
+}
+
+// declareAccount registers a journal account as an account, saving or
+// category, guessing from where it sits when metadata does not say.
+func (r *reader) declareAccount(account string, meta map[string]string) {
+	if _, ok := r.accounts[account]; ok {
+		return
+	}
+	parts := strings.Split(account, ":")
+	root, group := rootOf(account), ""
+	if len(parts) > 2 {
+		group = parts[1]
+	}
+	if root == rootEquity || (len(parts) == 2 && parts[1] == uncategorizedLabel && meta["id"] == "") {
+		return
+	}
+
+	kind := meta["kind"]
+	if kind == "" {
+		switch {
+		case root == rootExpenses || root == rootIncome:
+			kind = kindCategory
+		case root == rootAssets && group == savingsGroup:
+			kind = kindSaving
+		case root == rootAssets || root == rootLiabilities:
+			kind = kindAccount
+		default:
+			return
+		}
+	}
+
+	name := meta["name"]
+	if name == "" {
+		name = nameOf(account)
+	}
+	id := idOf(meta)
+	r.accounts[account], r.kinds[account] = id, kind
+
+	switch kind {
+	case kindAccount:
+		accountType := model.AccountType(meta["type"])
+		if accountType == "" {
+			accountType = model.AccountCash
+			if root == rootLiabilities {
+				accountType = model.AccountCreditCard
+			}
+			for t, g := range accountGroups {
+				if strings.EqualFold(g, group) {
+					accountType = t
+				}
+			}
+		}
+		r.ds.Accounts = append(r.ds.Accounts, model.Account{
+			ID: id, Name: name, Type: accountType, Icon: meta["icon"], BankAccountNumber: meta["number"],
+		})
+	case kindSaving:
+		r.ds.Savings = append(r.ds.Savings, model.Saving{ID: id, Name: name, Icon: meta["icon"]})
+	case kindCategory:
+		categoryType := meta["type"]
+		if categoryType == "" {
+			categoryType = "expense"
+			if root == rootIncome {
+				categoryType = "income"
+			}
+		}
+		r.ds.Categories = append(r.ds.Categories, model.Category{ID: id, Name: name, Type: categoryType, Icon: meta["icon"]})
+	}
+}
+
+func (r *reader) declarePayee(name string, meta map[string]string) primitive.ObjectID {
+	if id, ok := r.payees[name]; ok {
+		return id
+	}
+	payee := model.Payee{ID: idOf(meta), Name: name, Aliases: []string{}}
+	if aliases := meta["aliases"]; aliases != "" {
+		payee.Aliases = strings.Split(aliases, ";")
+	}
+	r.payees[name] = payee.ID
+	r.ds.Payees = append(r.ds.Payees, payee)
+	return payee.ID
+}
+
+func (r *reader) declareTag(name string, meta map[string]string) primitive.ObjectID {
+	if id, ok := r.tags[name]; ok {
+		return id
+	}
+	tag := model.Tag{ID: idOf(meta), Name: meta["name"], Color: meta["color"]}
+	if tag.Name == "" {
+		tag.Name = name
+	}
+	r.tags[name] = tag.ID
+	r.ds.Tags = append(r.ds.Tags, tag)
+	return tag.ID
+}
+
+// side is where a posting lands in fintrack.
+func (r *reader) side(account string) (primitive.ObjectID, string) {
+	r.declareAccount(account, map[string]string{})
+	root := rootOf(account)
+	if root == rootEquity {
+		return primitive.NilObjectID, rootEquity
+	}
+	id, ok := r.accounts[account]
+	if !ok {
+		// the uncategorized account of either side
+		if root == rootIncome {
+			return primitive.NilObjectID, rootIncome
+		}
+		return primitive.NilObjectID, rootExpenses
+	}
+	if r.kinds[account] == kindCategory {
+		if root == rootIncome {
+			return id, rootIncome
+		}
+		return id, rootExpenses
+	}
+	return id, rootAssets
+}
+
+func (r *reader) transaction(b block) (model.Transaction, error) {
+	tx := model.Transaction{ID: idOf(b.meta), DateTime: b.date, ExternalID: b.meta["external-id"]}
+	if clock := b.meta["time"]; clock != "" {
+		t, err := time.Parse("15:04:05.999999999", clock)
+		if err != nil {
+			return tx, errors.New("Invalid time `" + clock + "`")
+		}
+		tx.DateTime = b.date.Add(t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)))
+	}
+	tx.ValueDate = b.auxDate
+	if v := b.meta["value-date"]; v != "" {
+		d, err := parseDate(v)
+		if err != nil {
+			return tx, err
+		}
+		tx.ValueDate = d
+	}
+
+	// Payee, note and tags
+	head := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(b.head, "txn"), "*"), "!"))
+	tags := b.tags
+	payee := ""
+	if strings.HasPrefix(head, `"`) {
+		strs, headTags := quotedStrings(head)
+		tags = append(tags, headTags...)
+		switch len(strs) {
+		case 0:
+		case 1:
+			tx.Note = strs[0]
+		default:
+			payee, tx.Note = strs[0], strs[1]
+		}
+	} else {
+		if i := strings.Index(head, ";"); i >= 0 {
+			head = strings.TrimSpace(head[:i])
+		}
+		if strings.HasPrefix(head, "(") {
+			if i := strings.Index(head, ")"); i >= 0 {
+				head = strings.TrimSpace(head[i+1:])
+			}
+		}
+		if p, note, ok := strings.Cut(head, "|"); ok {
+			payee, tx.Note = strings.TrimSpace(p), strings.TrimSpace(note)
+		} else if _, ok := r.payees[head]; ok {
+			payee = head
+		} else {
+			tx.Note = head
+		}
+	}
+	if payee != "" {
+		tx.Payee = r.declarePayee(payee, map[string]string{})
+	}
+	for _, t := range tags {
+		id := r.declareTag(t, map[string]string{})
+		if !containsID(tx.Tags, id) {
+			tx.Tags = append(tx.Tags, id)
+		}
+	}
+
+	if err := r.postings(&tx, b); err != nil {
+		return tx, err
+	}
+	return tx, nil
+}
+
+// postings works out the type and accounts of tx from its postings.
+func (r *reader) postings(tx *model.Transaction, b block) error {
+	postings := b.postings
+	sum, elided := 0.0, -1
+	for i, p := range postings {
+		if p.elided {
+			if elided >= 0 {
+				return errors.New("More than one posting without an amount")
+			}
+			elided = i
+			continue
+		}
+		sum += p.amount
+	}
+	if elided >= 0 {
+		postings[elided].amount = -sum
+	} else if math.Abs(sum) > 0.005 {
+		return fmt.Errorf("Postings do not balance, off by %v", sum)
+	}
+
+	type leg struct {
+		account string
+		id      primitive.ObjectID
+		amount  float64
+		note    string
+	}
+	var assets, categories, equity []leg
+	var categoryRoot string
+	for _, p := range postings {
+		id, root := r.side(p.account)
+		l := leg{account: p.account, id: id, amount: p.amount, note: p.meta["note"]}
+		switch root {
+		case rootAssets:
+			assets = append(assets, l)
+		case rootEquity:
+			equity = append(equity, l)
+		default:
+			if categoryRoot != "" && categoryRoot != root {
+				return errors.New("A transaction cannot mix income and expense categories")
+			}
+			categoryRoot = root
+			categories = append(categories, l)
+		}
+	}
+
+	switch {
+	case len(assets) == 2 && len(categories) == 0 && len(equity) == 0:
+		from, to := assets[0], assets[1]
+		if from.amount > 0 {
+			from, to = to, from
+		}
+		tx.Type, tx.Amount = "transfer", roundMoney(to.amount)
+		tx.SourceAccount, tx.DestinationAccount = from.id, to.id
+
+	case len(assets) == 1 && len(categories) > 0 && len(equity) == 0:
+		a := assets[0]
+		tx.Amount = roundMoney(math.Abs(a.amount))
+		if a.amount < 0 {
+			tx.Type, tx.SourceAccount = "expense", a.id
+		} else {
+			tx.Type, tx.DestinationAccount = "income", a.id
+		}
+		// Legs of one category net out, so a refund or discount leg lowers
+		// its category. What is left must go the way of the account.
+		sign := 1.0
+		if a.amount > 0 {
+			sign = -1
+		}
+		var splits []model.Split
+		index := map[primitive.ObjectID]int{}
+		for _, c := range categories {
+			i, ok := index[c.id]
+			if !ok {
+				i = len(splits)
+				index[c.id] = i
+				splits = append(splits, model.Split{Category: c.id})
+			}
+			splits[i].Amount += sign * c.amount
+			if c.note != "" {
+				splits[i].Note = strings.TrimSpace(splits[i].Note + " " + c.note)
+			}
+		}
+		tx.Splits = tx.Splits[:0]
+		for _, split := range splits {
+			split.Amount = roundMoney(split.Amount)
+			if split.Amount < 0 {
+				return errors.New("A category leg goes the other way than the account: book the refund as a transaction of its own")
+			}
+			if split.Amount > 0 {
+				tx.Splits = append(tx.Splits, split)
+			}
+		}
+		if len(tx.Splits) == 1 {
+			tx.Category, tx.Splits = tx.Splits[0].Category, nil
+		}
+
+	case len(assets) == 1 && len(categories) == 0 && len(equity) == 1:
+		a := assets[0]
+		switch t := b.meta["type"]; t {
+		case "opening_balance", "adjustment":
+			tx.Type = t
+		case "":
+			tx.Type = "adjustment"
+			if strings.Contains(strings.ToLower(equity[0].account), "opening") {
+				tx.Type = "opening_balance"
+			}
+		default:
+			return fmt.Errorf("Invalid type `%s` against equity, expected {opening_balance|adjustment}", t)
+		}
+		tx.Amount = roundMoney(math.Abs(a.amount))
+		if a.amount >= 0 {
+			tx.DestinationAccount = a.id
+		} else {
+			tx.SourceAccount = a.id
+		}
+
+	default:
+		return errors.New("Cannot map the postings to a fintrack transaction: use one account against categories, two accounts, or one account against equity")
+	}
+	if tx.Amount <= 0 {
+		return errors.New("Amount should be positive")
+	}
+	return nil
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,394 @@
+package journal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fintrack/server/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type writer struct {
+	dialect  Dialect
+	b        bytes.Buffer
+	currency string
+
+	names      map[primitive.ObjectID]string // journal account of accounts, savings and categories
+	used       map[string]bool
+	tags       map[primitive.ObjectID]string
+	payees     map[primitive.ObjectID]string
+	payeeNames map[string]bool
+}
+
+// Write writes ds as a journal. Deleted records are left out unless a live
+// transaction still points at them.
+func Write(w io.Writer, ds *model.Dataset, dialect Dialect) error {
+	jw := &writer{
+		dialect:    dialect,
+		currency:   ds.Filter.Currency,
+		names:      map[primitive.ObjectID]string{},
+		used:       map[string]bool{},
+		tags:       map[primitive.ObjectID]string{},
+		payees:     map[primitive.ObjectID]string{},
+		payeeNames: map[string]bool{},
+	}
+	if jw.currency == "" {
+		jw.currency = "VND"
+	}
+
+	var transactions []model.Transaction
+	referenced := map[primitive.ObjectID]bool{}
+	for _, tx := range ds.Transactions {
+		if tx.IsDeleted {
+			continue
+		}
+		transactions = append(transactions, tx)
+		for _, id := range []primitive.ObjectID{tx.SourceAccount, tx.DestinationAccount, tx.Category, tx.Payee} {
+			referenced[id] = true
+		}
+		for _, s := range tx.Splits {
+			referenced[s.Category] = true
+		}
+		for _, id := range tx.Tags {
+			referenced[id] = true
+		}
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if !transactions[i].DateTime.Equal(transactions[j].DateTime) {
+			return transactions[i].DateTime.Before(transactions[j].DateTime)
+		}
+		return transactions[i].ID.Hex() < transactions[j].ID.Hex()
+	})
+
+	// Everything is opened on the first day
+	opened := ds.ExportedAt
+	if len(transactions) > 0 {
+		opened = transactions[0].DateTime
+	}
+	if opened.IsZero() {
+		opened = time.Now()
+	}
+
+	keep := func(id primitive.ObjectID, deleted bool) bool {
+		return !deleted || referenced[id]
+	}
+
+	// The fixed accounts go first, a category called Uncategorized gets a
+	// numbered name
+	fixed := []string{
+		rootExpenses + ":" + uncategorizedLabel, rootIncome + ":" + uncategorizedLabel,
+		openingAccount, adjustmentAccount,
+	}
+	for _, name := range fixed {
+		jw.used[name] = true
+	}
+
+	jw.header(ds)
+	for _, name := range fixed {
+		jw.open(opened, name, nil)
+	}
+	for _, a := range ds.Accounts {
+		if keep(a.ID, a.IsDeleted) {
+			name := jw.name(a.ID, accountPath(a)+":"+component(a.Name))
+			jw.open(opened, name, [][2]string{
+				{"id", a.ID.Hex()}, {"kind", kindAccount}, {"name", a.Name},
+				{"type", string(a.AccountType())}, {"icon", a.Icon}, {"number", a.BankAccountNumber},
+			})
+		}
+	}
+	for _, s := range ds.Savings {
+		if keep(s.ID, s.IsDeleted) {
+			name := jw.name(s.ID, rootAssets+":"+savingsGroup+":"+component(s.Name))
+			jw.open(opened, name, [][2]string{
+				{"id", s.ID.Hex()}, {"kind", kindSaving}, {"name", s.Name}, {"icon", s.Icon},
+			})
+		}
+	}
+	// Transfers to accounts filtered out of the export still need a side
+	for _, tx := range transactions {
+		for _, id := range []primitive.ObjectID{tx.SourceAccount, tx.DestinationAccount} {
+			if _, ok := jw.names[id]; ok || id.IsZero() {
+				continue
+			}
+			name := jw.name(id, rootAssets+":"+otherGroup+":"+id.Hex()[18:])
+			jw.open(opened, name, [][2]string{{"id", id.Hex()}, {"kind", kindAccount}})
+		}
+	}
+	for _, c := range ds.Categories {
+		if keep(c.ID, c.IsDeleted) {
+			root := rootExpenses
+			if c.Type == "income" {
+				root = rootIncome
+			}
+			name := jw.name(c.ID, root+":"+component(c.Name))
+			jw.open(opened, name, [][2]string{
+				{"id", c.ID.Hex()}, {"kind", kindCategory}, {"name", c.Name},
+				{"type", c.Type}, {"icon", c.Icon},
+			})
+		}
+	}
+
+	usedTags := map[string]bool{}
+	for _, t := range ds.Tags {
+		if !keep(t.ID, t.IsDeleted) {
+			continue
+		}
+		name := tagName(t.Name)
+		for n := 2; usedTags[name]; n++ {
+			name = tagName(t.Name) + "-" + strconv.Itoa(n)
+		}
+		usedTags[name] = true
+		jw.tags[t.ID] = name
+		jw.declare(opened, "tag", name, [][2]string{{"id", t.ID.Hex()}, {"name", t.Name}, {"color", t.Color}})
+	}
+	for _, p := range ds.Payees {
+		if !keep(p.ID, p.IsDeleted) {
+			continue
+		}
+		jw.payees[p.ID] = oneLine(p.Name)
+		jw.payeeNames[oneLine(p.Name)] = true
+		jw.declare(opened, "payee", oneLine(p.Name), [][2]string{
+			{"id", p.ID.Hex()}, {"aliases", strings.Join(p.Aliases, ";")},
+		})
+	}
+	jw.b.WriteString("\n")
+
+	for _, tx := range transactions {
+		if err := jw.transaction(tx); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(jw.b.Bytes())
+	return err
+}
+
+// name reserves a journal account name, numbering clashes.
+func (w *writer) name(id primitive.ObjectID, name string) string {
+	unique := name
+	for n := 2; w.used[unique]; n++ {
+		unique = name + "-" + strconv.Itoa(n)
+	}
+	w.used[unique] = true
+	w.names[id] = unique
+	return unique
+}
+
+func (w *writer) header(ds *model.Dataset) {
+	title := "fintrack export"
+	if ds.Owner != "" {
+		title += " of " + ds.Owner
+	}
+	if w.dialect == Beancount {
+		fmt.Fprintf(&w.b, "option \"title\" %s\n", quote(title))
+		fmt.Fprintf(&w.b, "option \"operating_currency\" %s\n\n", quote(w.currency))
+		return
+	}
+	fmt.Fprintf(&w.b, "; %s\n\ncommodity %s\n\n", title, w.currency)
+}
+
+func (w *writer) meta(indent string, meta [][2]string) {
+	for _, kv := range meta {
+		if kv[1] == "" {
+			continue
+		}
+		if w.dialect == Beancount {
+			fmt.Fprintf(&w.b, "%s%s: %s\n", indent, kv[0], quote(kv[1]))
+		} else {
+			fmt.Fprintf(&w.b, "%s; %s: %s\n", indent, kv[0], oneLine(kv[1]))
+		}
+	}
+}
+
+func (w *writer) open(at time.Time, name string, meta [][2]string) {
+	if w.dialect == Beancount {
+		fmt.Fprintf(&w.b, "%s open %s\n", at.UTC().Format("2006-01-02"), name)
+		w.meta("  ", meta)
+		return
+	}
+	fmt.Fprintf(&w.b, "account %s\n", name)
+	w.meta("    ", meta)
+}
+
+// declare writes a tag or payee declaration: a custom directive in beancount,
+// which has none, the directive of the same name in ledger.
+func (w *writer) declare(at time.Time, what, name string, meta [][2]string) {
+	if w.dialect == Beancount {
+		fmt.Fprintf(&w.b, "%s custom \"fintrack-%s\" %s\n", at.UTC().Format("2006-01-02"), what, quote(name))
+		w.meta("  ", meta)
+		return
+	}
+	fmt.Fprintf(&w.b, "%s %s\n", what, name)
+	w.meta("    ", meta)
+}
+
+type posting struct {
+	account string
+	amount  float64
+	note    string
+}
+
+// postings balances tx: money leaves the source and reaches the destination,
+// the category or equity side makes up the rest.
+func (w *writer) postings(tx model.Transaction) ([]posting, error) {
+	account := func(id primitive.ObjectID) (string, error) {
+		name, ok := w.names[id]
+		if !ok {
+			return "", fmt.Errorf("transaction %s: account %s is not in the export", tx.ID.Hex(), id.Hex())
+		}
+		return name, nil
+	}
+	category := func(id primitive.ObjectID, root string) string {
+		if name, ok := w.names[id]; ok && !id.IsZero() {
+			return name
+		}
+		return root + ":" + uncategorizedLabel
+	}
+
+	var out []posting
+	switch tx.Type {
+	case "transfer":
+		from, err := account(tx.SourceAccount)
+		if err != nil {
+			return nil, err
+		}
+		to, err := account(tx.DestinationAccount)
+		if err != nil {
+			return nil, err
+		}
+		return []posting{{account: from, amount: -tx.Amount}, {account: to, amount: tx.Amount}}, nil
+
+	case "expense", "income":
+		sign, side, root := -1.0, tx.SourceAccount, rootExpenses
+		if tx.Type == "income" {
+			sign, side, root = 1, tx.DestinationAccount, rootIncome
+		}
+		name, err := account(side)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, posting{account: name, amount: sign * tx.Amount})
+		if len(tx.Splits) > 0 {
+			for _, s := range tx.Splits {
+				out = append(out, posting{account: category(s.Category, root), amount: -sign * s.Amount, note: s.Note})
+			}
+			return out, nil
+		}
+		return append(out, posting{account: category(tx.Category, root), amount: -sign * tx.Amount}), nil
+
+	default:
+		// Opening balances and adjustments move one account against equity
+		equity := adjustmentAccount
+		if tx.Type == "opening_balance" {
+			equity = openingAccount
+		}
+		id, sign := tx.DestinationAccount, 1.0
+		if id.IsZero() {
+			id, sign = tx.SourceAccount, -1
+		}
+		name, err := account(id)
+		if err != nil {
+			return nil, err
+		}
+		return []posting{{account: name, amount: sign * tx.Amount}, {account: equity, amount: -sign * tx.Amount}}, nil
+	}
+}
+
+func (w *writer) transaction(tx model.Transaction) error {
+	postings, err := w.postings(tx)
+	if err != nil {
+		return err
+	}
+
+	at := tx.DateTime.UTC()
+	meta := [][2]string{{"id", tx.ID.Hex()}}
+	if clock := at.Format("15:04:05.999999999"); clock != "00:00:00" {
+		meta = append(meta, [2]string{"time", clock})
+	}
+	meta = append(meta, [2]string{"external-id", tx.ExternalID})
+	if tx.Type == "opening_balance" || tx.Type == "adjustment" {
+		meta = append(meta, [2]string{"type", tx.Type})
+	}
+
+	var tags []string
+	for _, id := range tx.Tags {
+		if name, ok := w.tags[id]; ok {
+			tags = append(tags, name)
+		}
+	}
+	payee := w.payees[tx.Payee]
+	note := oneLine(tx.Note)
+	date := at.Format("2006-01-02")
+
+	if w.dialect == Beancount {
+		meta = append(meta, [2]string{"value-date", formatDate(tx.ValueDate)})
+		fmt.Fprintf(&w.b, "%s *", date)
+		if payee != "" {
+			fmt.Fprintf(&w.b, " %s", quote(payee))
+		}
+		fmt.Fprintf(&w.b, " %s", quote(note))
+		for _, t := range tags {
+			fmt.Fprintf(&w.b, " #%s", t)
+		}
+		w.b.WriteString("\n")
+		w.meta("  ", meta)
+		for _, p := range postings {
+			fmt.Fprintf(&w.b, "  %-50s %s %s\n", p.account, formatAmount(p.amount), w.currency)
+			w.meta("    ", [][2]string{{"note", p.note}})
+		}
+		w.b.WriteString("\n")
+		return nil
+	}
+
+	// Ledger: the value date is the auxiliary date, hledger's payee | note
+	if !tx.ValueDate.IsZero() {
+		date += "=" + formatDate(tx.ValueDate)
+	}
+	description := note
+	if payee != "" {
+		description = payee
+		if note != "" {
+			description += " | " + note
+		}
+	} else if w.payeeNames[note] || strings.ContainsAny(note, "|(") {
+		// would read back as a payee or a code
+		description = "| " + note
+	}
+	fmt.Fprintf(&w.b, "%s * %s\n", date, description)
+	if len(tags) > 0 {
+		fmt.Fprintf(&w.b, "    ; :%s:\n", strings.Join(tags, ":"))
+	}
+	w.meta("    ", meta)
+	for _, p := range postings {
+		fmt.Fprintf(&w.b, "    %-50s  %s %s\n", p.account, formatAmount(p.amount), w.currency)
+		w.meta("        ", [][2]string{{"note", p.note}})
+	}
+	w.b.WriteString("\n")
+	return nil
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+// quote is a beancount string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ").Replace(s) + `"`
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fintrack/server/blob"
 	"fintrack/server/controller"
 	"fintrack/server/middleware"
 	"fintrack/server/socket"
 	"fintrack/server/util"
 	"fintrack/server/cronjob"
+	"fintrack/server/service"
 	"fmt"
 	"log"
+	"os"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -44,16 +51,60 @@ func startControllers () {
 			controller.AddTransaction)
 
 		transactions.GET("/get-since/:time",
+			middleware.TagFilterMiddleware(),
 			controller.GetTransactionsSince)
 
+		transactions.POST("/tag",
+			middleware.BulkTagMiddleware(),
+			controller.TagTransactions)
+
+		transactions.POST("/untag",
+			middleware.BulkTagMiddleware(),
+			controller.UntagTransactions)
+
 		transactions.PUT("/update/:id",
-			middleware.TransactionOwnershipMiddleware(),
+			middleware.TransactionOwnershipMiddleware(false),
 			middleware.TransactionFormatMiddleware(),
 			controller.UpdateTransaction)
 
 		transactions.DELETE("/delete/:id",
-			middleware.TransactionOwnershipMiddleware(),
+			middleware.TransactionOwnershipMiddleware(false),
 			controller.DeleteTransaction)
+
+		transactions.GET("/duplicates",
+			middleware.DuplicateCriteriaMiddleware(),
+			controller.GetDuplicates)
+
+		transactions.POST("/merge",
+			middleware.TransactionPairMiddleware(),
+			controller.MergeTransactions)
+
+		transactions.POST("/not-duplicate",
+			middleware.TransactionPairMiddleware(),
+			controller.DismissDuplicate)
+
+		transactions.POST("/quick-add",
+			middleware.QuickAddFormatMiddleware(),
+			controller.QuickAdd)
+
+		transactions.POST("/attachments/:id",
+			middleware.TransactionOwnershipMiddleware(false),
+			middleware.AttachmentUploadMiddleware(),
+			controller.AddAttachment)
+
+		transactions.GET("/attachments/:id/:attachment",
+			middleware.TransactionOwnershipMiddleware(true),
+			middleware.AttachmentMiddleware(),
+			controller.DownloadAttachment)
+
+		transactions.DELETE("/attachments/:id/:attachment",
+			middleware.TransactionOwnershipMiddleware(false),
+			middleware.AttachmentMiddleware(),
+			controller.DeleteAttachment)
+
+		transactions.DELETE("/purge/:id",
+			middleware.TransactionOwnershipMiddleware(true),
+			controller.PurgeTransaction)
 	}
 
 	accounts := api.Group("/accounts")
@@ -92,6 +143,10 @@ func startControllers () {
 		savings.DELETE("/delete/:id",
 			middleware.SavingOwnershipMiddleware(),
 			controller.DeleteSaving)
+
+		savings.POST("/rollover/:id",
+			middleware.SavingOwnershipMiddleware(),
+			controller.RolloverSaving)
 	}
 
 	categories := api.Group("/categories")
@@ -139,8 +194,16 @@ func startControllers () {
             controller.AddNotification)
         notifications.GET("/get-since/:time",
             controller.GetNotificationsSince)
+        notifications.GET("/scheduled",
+            controller.GetScheduledNotifications)
         notifications.PUT("/mark-read",
             controller.MarkNotificationsRead)
+        notifications.PUT("/cancel/:id",
+            middleware.NotificationOwnershipMiddleware(),
+            controller.CancelNotification)
+        notifications.PUT("/reschedule/:id",
+            middleware.NotificationOwnershipMiddleware(),
+            controller.RescheduleNotification)
         notifications.PUT("/update/:id",
             middleware.NotificationOwnershipMiddleware(),
             middleware.NotificationFormatMiddleware(),
@@ -150,6 +213,222 @@ func startControllers () {
             controller.DeleteNotification)
     }
 
+    notificationPreferences := api.Group("/notification-preferences")
+    {
+        notificationPreferences.GET("/get",
+            controller.GetNotificationPreference)
+        notificationPreferences.PUT("/update",
+            middleware.NotificationPreferenceFormatMiddleware(),
+            controller.UpdateNotificationPreference)
+    }
+
+    admin := api.Group("/admin", middleware.AdminMiddleware())
+    {
+        admin.GET("/reconcile",
+            controller.CheckBalances)
+        admin.POST("/reconcile/repair",
+            controller.RepairBalances)
+    }
+
+    reports := api.Group("/reports")
+    {
+        reports.GET("/period/:unit",
+            middleware.ReportQueryMiddleware(middleware.TransfersOptIn),
+            controller.GetReportByPeriod)
+        reports.GET("/category",
+            middleware.ReportQueryMiddleware(middleware.TransfersNever),
+            controller.GetReportByCategory)
+        reports.GET("/payee",
+            middleware.ReportQueryMiddleware(middleware.TransfersNever),
+            controller.GetReportByPayee)
+        reports.GET("/account",
+            middleware.ReportQueryMiddleware(middleware.TransfersIncluded),
+            controller.GetReportByAccount)
+        reports.GET("/type",
+            middleware.ReportQueryMiddleware(middleware.TransfersIncluded),
+            controller.GetReportByType)
+        reports.GET("/net-worth",
+            middleware.ReportQueryMiddleware(middleware.TransfersIncluded),
+            controller.GetNetWorthHistory)
+    }
+
+    tags := api.Group("/tags")
+    {
+        tags.POST("/add",
+            middleware.TagFormatMiddleware(),
+            controller.AddTag)
+        tags.GET("/get-since/:time",
+            controller.GetTagsSince)
+        tags.PUT("/update/:id",
+            middleware.TagOwnershipMiddleware(),
+            middleware.TagFormatMiddleware(),
+            controller.UpdateTag)
+        tags.POST("/merge/:id",
+            middleware.TagOwnershipMiddleware(),
+            controller.MergeTag)
+        tags.DELETE("/delete/:id",
+            middleware.TagOwnershipMiddleware(),
+            controller.DeleteTag)
+    }
+
+    payees := api.Group("/payees")
+    {
+        payees.POST("/add",
+            middleware.PayeeFormatMiddleware(),
+            controller.AddPayee)
+        payees.GET("/get-since/:time",
+            controller.GetPayeesSince)
+        payees.POST("/match",
+            controller.MatchPayee)
+        payees.PUT("/update/:id",
+            middleware.PayeeOwnershipMiddleware(),
+            middleware.PayeeFormatMiddleware(),
+            controller.UpdatePayee)
+        payees.POST("/merge/:id",
+            middleware.PayeeOwnershipMiddleware(),
+            controller.MergePayee)
+        payees.DELETE("/delete/:id",
+            middleware.PayeeOwnershipMiddleware(),
+            controller.DeletePayee)
+    }
+
+    rules := api.Group("/rules")
+    {
+        rules.POST("/add",
+            middleware.RuleFormatMiddleware(),
+            controller.AddRule)
+        rules.GET("/get-since/:time",
+            controller.GetRulesSince)
+        rules.PUT("/update/:id",
+            middleware.RuleOwnershipMiddleware(),
+            middleware.RuleFormatMiddleware(),
+            controller.UpdateRule)
+        rules.DELETE("/delete/:id",
+            middleware.RuleOwnershipMiddleware(),
+            controller.DeleteRule)
+        rules.POST("/test",
+            middleware.RuleRangeMiddleware(),
+            middleware.RuleFormatMiddleware(),
+            controller.TestRule)
+        rules.POST("/apply/:id",
+            middleware.RuleRangeMiddleware(),
+            middleware.RuleOwnershipMiddleware(),
+            controller.ApplyRule)
+        rules.POST("/apply-all",
+            middleware.RuleRangeMiddleware(),
+            controller.ApplyAllRules)
+    }
+
+    imports := api.Group("/imports")
+    {
+        imports.POST("/profiles/add",
+            middleware.ImportProfileFormatMiddleware(),
+            controller.AddImportProfile)
+        imports.GET("/profiles/get-since/:time",
+            controller.GetImportProfilesSince)
+        imports.PUT("/profiles/update/:id",
+            middleware.ImportProfileOwnershipMiddleware(),
+            middleware.ImportProfileFormatMiddleware(),
+            controller.UpdateImportProfile)
+        imports.DELETE("/profiles/delete/:id",
+            middleware.ImportProfileOwnershipMiddleware(),
+            controller.DeleteImportProfile)
+        imports.POST("/preview",
+            middleware.ImportUploadMiddleware(),
+            controller.PreviewImport)
+        imports.GET("/get/:id",
+            middleware.ImportBatchOwnershipMiddleware(),
+            controller.GetImport)
+        imports.POST("/commit/:id",
+            middleware.ImportBatchOwnershipMiddleware(),
+            controller.CommitImport)
+        imports.POST("/journal",
+            middleware.JournalUploadMiddleware(),
+            controller.ImportJournal)
+        imports.POST("/restore",
+            middleware.RestoreUploadMiddleware(),
+            controller.RestoreDataset)
+    }
+
+    exports := api.Group("/exports")
+    {
+        exports.POST("/add",
+            middleware.ExportFormatMiddleware(),
+            controller.CreateExport)
+        exports.GET("/list",
+            controller.GetExports)
+        exports.GET("/get/:id",
+            middleware.ExportJobOwnershipMiddleware(),
+            controller.GetExport)
+        exports.GET("/download/:id",
+            middleware.ExportJobOwnershipMiddleware(),
+            controller.DownloadExport)
+        exports.DELETE("/delete/:id",
+            middleware.ExportJobOwnershipMiddleware(),
+            controller.DeleteExport)
+        exports.POST("/journal",
+            middleware.ExportFormatMiddleware(),
+            controller.ExportJournal)
+    }
+
+    messages := api.Group("/messages")
+    {
+        messages.POST("/ingest",
+            middleware.MessageIngestMiddleware(),
+            controller.IngestMessage)
+        messages.GET("/unmatched",
+            controller.GetUnmatchedMessages)
+        messages.DELETE("/unmatched/delete/:id",
+            controller.DismissUnmatchedMessage)
+        messages.POST("/templates/add",
+            middleware.MessageTemplateFormatMiddleware(),
+            controller.AddMessageTemplate)
+        messages.GET("/templates/get-since/:time",
+            controller.GetMessageTemplatesSince)
+        messages.GET("/templates/builtin",
+            controller.GetBuiltinMessageTemplates)
+        messages.PUT("/templates/update/:id",
+            middleware.MessageTemplateOwnershipMiddleware(),
+            middleware.MessageTemplateFormatMiddleware(),
+            controller.UpdateMessageTemplate)
+        messages.DELETE("/templates/delete/:id",
+            middleware.MessageTemplateOwnershipMiddleware(),
+            controller.DeleteMessageTemplate)
+        messages.POST("/templates/test",
+            middleware.MessageTemplateFormatMiddleware(),
+            controller.TestMessageTemplate)
+    }
+
+    loans := api.Group("/loans")
+    {
+        loans.POST("/add",
+            middleware.LoanFormatMiddleware(),
+            controller.AddLoan)
+        loans.POST("/preview",
+            middleware.LoanFormatMiddleware(),
+            controller.PreviewLoanSchedule)
+        loans.GET("/get-since/:time",
+            controller.GetLoansSince)
+        loans.POST("/prepay/:id",
+            middleware.LoanOwnershipMiddleware(),
+            controller.PrepayLoan)
+        loans.DELETE("/delete/:id",
+            middleware.LoanOwnershipMiddleware(),
+            controller.DeleteLoan)
+    }
+
+    statements := api.Group("/statements")
+    {
+        statements.GET("/get-since/:time",
+            controller.GetStatementsSince)
+    }
+
+    digests := api.Group("/digests")
+    {
+        digests.GET("/preview",
+            controller.PreviewSpendingDigest)
+    }
+
 	fmt.Println("Server running on http://localhost:8080")
 	log.Fatal(r.Run(":8080"))
 }
@@ -157,11 +436,77 @@ func startControllers () {
 func startCronJobs() {
     go cronjob.CreateSubscriptionNotificationsCron()
     go cronjob.CreateSubscriptionTransactionCron()
+    go cronjob.DispatchNotificationsCron()
+    go cronjob.SpendingDigestCron()
+    go cronjob.BalanceSnapshotCron()
+    go cronjob.StatementCron()
+    go cronjob.LoanInstallmentCron()
+    go cronjob.SavingInterestCron()
+    go cronjob.ExportCleanupCron()
+}
+
+// runCommand handles `server <command> [flags]` and returns the exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "reconcile":
+		return reconcileCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, available: reconcile\n", args[0])
+		return 2
+	}
+}
+
+func reconcileCommand(args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	owner := fs.String("owner", "", "only check this user (default: every user)")
+	repair := fs.Bool("repair", false, "fix the discrepancies found")
+	mode := fs.String("mode", string(service.RepairBalance), "repair mode: balance|opening")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	report, err := service.ReconcileBalances(ctx, *owner, *repair, service.RepairMode(*mode))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reconcile failed:", err)
+		return 1
+	}
+
+	fmt.Printf("Checked %d accounts and savings, %d discrepancies\n", report.Checked, len(report.Discrepancies))
+	for _, d := range report.Discrepancies {
+		fmt.Printf("%-7s %s %-24s owner=%s stored=%.2f computed=%.2f diff=%.2f\n",
+			d.Kind, d.ID.Hex(), d.Name, d.Owner, d.Balance, d.Computed, d.Difference)
+	}
+	if report.Repaired {
+		fmt.Printf("Repaired using mode %q\n", report.Mode)
+	}
+
+	return 0
+}
+
+// initAttachmentStore picks where attachment files live: GridFS unless
+// ATTACHMENT_STORE=local, then under ATTACHMENT_DIR.
+func initAttachmentStore() {
+	if os.Getenv("ATTACHMENT_STORE") != "local" {
+		service.SetAttachmentStore(blob.NewGridFSStore(util.AttachmentBucket))
+		return
+	}
+	dir := os.Getenv("ATTACHMENT_DIR")
+	if dir == "" {
+		dir = "data/attachments"
+	}
+	service.SetAttachmentStore(blob.NewLocalStore(dir))
 }
 
 func main() {
 	util.InitDB()
     godotenv.Load()
+    initAttachmentStore()
+    if len(os.Args) > 1 {
+        os.Exit(runCommand(os.Args[1:]))
+    }
     startCronJobs()
     startControllers()
 }
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+    "strings"
     "net/http"
     "github.com/gin-gonic/gin"
     "fintrack/server/service"
@@ -30,10 +31,17 @@ func AccountOwnershipMiddleware() gin.HandlerFunc {
 func AccountFormatMiddleware() gin.HandlerFunc {
     return func(c *gin.Context) {
         type Account struct {
-            Owner   string  `json:"owner"`
-            Balance float64 `json:"balance"`
-            Icon    string  `json:"icon"`
-            Name    string  `json:"name"`
+            Owner              string            `json:"owner"`
+            Type               model.AccountType `json:"type"`
+            Balance            float64           `json:"balance"`
+            CreditLimit        float64           `json:"creditLimit"`
+            StatementDay       int               `json:"statementDay"`
+            DueDay             int               `json:"dueDay"`
+            NoOverdraft        bool              `json:"noOverdraft"`
+            EnforceCreditLimit bool              `json:"enforceCreditLimit"`
+            Icon               string            `json:"icon"`
+            Name               string            `json:"name"`
+            BankAccountNumber  string            `json:"bankAccountNumber"`
         }
         var _account Account
 
@@ -42,15 +50,71 @@ func AccountFormatMiddleware() gin.HandlerFunc {
             return
         }
 
-        if _account.Balance < 0 {
-            c.JSON(http.StatusBadRequest, gin.H{
+        // Type
+        if _account.Type == "" {
+            _account.Type = model.AccountCash
+        }
+        known := false
+        for _, t := range model.AccountTypes {
+            if t == _account.Type {
+                known = true
+            }
+        }
+        if !known {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                "error": "Invalid account type: expected " +
+                "{cash|checking|credit_card|loan|e_wallet}, but got `" +
+                string(_account.Type) + "`",
+            })
+            return
+        }
+
+        // Liabilities go negative while money is owed
+        if _account.Balance < 0 && !_account.Type.IsLiability() {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
                 "error": "Balance cannot be negative",
             })
             return
         }
 
+        if _account.Type.IsLiability() {
+            if _account.CreditLimit <= 0 {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": "Credit limit should be positive",
+                })
+                return
+            }
+            if _account.StatementDay < 1 || _account.StatementDay > 28 {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": "Statement day should be between 1 and 28",
+                })
+                return
+            }
+            if _account.DueDay < 1 || _account.DueDay > 28 {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": "Due day should be between 1 and 28",
+                })
+                return
+            }
+            if _account.NoOverdraft {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": "No overdraft only applies to asset accounts, use `enforceCreditLimit`",
+                })
+                return
+            }
+            if _account.EnforceCreditLimit && _account.Balance < -_account.CreditLimit {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": "Balance is already over the credit limit",
+                })
+                return
+            }
+        } else {
+            _account.CreditLimit, _account.StatementDay, _account.DueDay = 0, 0, 0
+            _account.EnforceCreditLimit = false
+        }
+
         if _account.Name == "" {
-            c.JSON(http.StatusBadRequest, gin.H{
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
                 "error": "Name cannot be empty",
             })
             return
@@ -58,10 +122,17 @@ func AccountFormatMiddleware() gin.HandlerFunc {
 
 
         account := model.Account{
-            Owner:   _account.Owner,
-            Balance: _account.Balance,
-            Icon:    _account.Icon,
-            Name:    _account.Name,
+            Owner:              _account.Owner,
+            Type:               _account.Type,
+            Balance:            _account.Balance,
+            CreditLimit:        _account.CreditLimit,
+            StatementDay:       _account.StatementDay,
+            DueDay:             _account.DueDay,
+            NoOverdraft:        _account.NoOverdraft,
+            EnforceCreditLimit: _account.EnforceCreditLimit,
+            Icon:               _account.Icon,
+            Name:               _account.Name,
+            BankAccountNumber:  strings.TrimSpace(_account.BankAccountNumber),
         }
 
         c.Set("account", account)
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxAttachmentSize caps one file, a phone photo of a receipt is far
+// smaller.
+const maxAttachmentSize = 10 << 20
+
+// attachmentTypes are the files kept, by the type their content shows.
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// AttachmentMiddleware sets "attachment" to the attachment `attachment`
+// names on the owned transaction.
+func AttachmentMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tmp, _ := c.Get("ownedTransaction")
+		transaction := tmp.(model.Transaction)
+
+		attachment, ok := service.FindAttachment(transaction, c.Param("attachment"))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+
+		c.Set("attachment", attachment)
+		c.Next()
+	}
+}
+
+// AttachmentUploadMiddleware reads the multipart `file` and sets
+// "attachmentFile", "attachmentName" and "attachmentType". The type comes
+// from the content, not from what the client claims.
+func AttachmentUploadMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		abort := func(status int, msg string) {
+			c.AbortWithStatusJSON(status, gin.H{"error": msg})
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			abort(http.StatusBadRequest, "Missing `file`")
+			return
+		}
+		if header.Size > maxAttachmentSize {
+			abort(http.StatusRequestEntityTooLarge, "File is larger than 10 MB")
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			abort(http.StatusBadRequest, err.Error())
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize))
+		if err != nil {
+			abort(http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(data) == 0 {
+			abort(http.StatusBadRequest, "File is empty")
+			return
+		}
+
+		contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+		if !attachmentTypes[contentType] {
+			abort(http.StatusUnsupportedMediaType, "Unsupported file type `"+contentType+"`, expected an image or a PDF")
+			return
+		}
+
+		name := strings.TrimSpace(filepath.Base(header.Filename))
+		if name == "" || name == "." || name == string(filepath.Separator) {
+			name = "attachment"
+		}
+
+		c.Set("attachmentFile", data)
+		c.Set("attachmentName", name)
+		c.Set("attachmentType", contentType)
+		c.Next()
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"os"
+	"strings"
 	"time"
     "fintrack/server/util"
 )
@@ -58,3 +59,20 @@ func ContextInjectorMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminMiddleware lets through the users listed in ADMIN_USERS, a comma
+// separated list of user ids.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.GetString("username")
+
+		for _, admin := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+			if admin = strings.TrimSpace(admin); admin != "" && admin == username {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin only"})
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DuplicateCriteriaMiddleware sets "duplicateCriteria" from the optional
+// `tolerance`, `days` and `similarity` query parameters, and "duplicateFrom"
+// from `from`.
+func DuplicateCriteriaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		abort := func(msg string) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+		}
+
+		criteria := service.DefaultDuplicateCriteria
+		if q := c.Query("tolerance"); q != "" {
+			v, err := strconv.ParseFloat(q, 64)
+			if err != nil || v < 0 || v >= 1 {
+				abort("`tolerance` should be a fraction between 0 and 1")
+				return
+			}
+			criteria.Tolerance = v
+		}
+		if q := c.Query("days"); q != "" {
+			v, err := strconv.Atoi(q)
+			if err != nil || v < 0 || v > 31 {
+				abort("`days` should be between 0 and 31")
+				return
+			}
+			criteria.Days = v
+		}
+		if q := c.Query("similarity"); q != "" {
+			v, err := strconv.ParseFloat(q, 64)
+			if err != nil || v < 0 || v > 1 {
+				abort("`similarity` should be between 0 and 1")
+				return
+			}
+			criteria.Similarity = v
+		}
+
+		var from time.Time
+		if q := c.Query("from"); q != "" {
+			t, err := time.Parse(time.RFC3339, q)
+			if err != nil {
+				abort("Invalid date format on `from`")
+				return
+			}
+			from = t
+		}
+
+		c.Set("duplicateCriteria", criteria)
+		c.Set("duplicateFrom", from)
+		c.Next()
+	}
+}
+
+// TransactionPairMiddleware reads the `keep` and `remove` transaction ids of
+// a merge or dismissal and sets both transactions.
+func TransactionPairMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Keep   string `json:"keep"`
+			Remove string `json:"remove"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if body.Keep == body.Remove {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "`keep` and `remove` should be two transactions"})
+			return
+		}
+
+		username := c.GetString("username")
+		var pair [2]model.Transaction
+		for i, id := range []string{body.Keep, body.Remove} {
+			transaction, err := service.GetTransactionByID(id)
+			if err != nil || transaction.IsDeleted {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Transaction `" + id + "` not found"})
+				return
+			}
+			if transaction.Creator != username {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the creator of transaction `" + id + "`"})
+				return
+			}
+			pair[i] = transaction
+		}
+
+		c.Set("keepTransaction", pair[0])
+		c.Set("removeTransaction", pair[1])
+		c.Next()
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func ExportFormatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var _filter struct {
+			From           string   `json:"from"`
+			To             string   `json:"to"`
+			Accounts       []string `json:"accounts"`
+			IncludeDeleted bool     `json:"includeDeleted"`
+			Currency       string   `json:"currency"`
+		}
+
+		// An empty body exports everything
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&_filter); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		abort := func(msg string) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+		}
+
+		username := c.GetString("username")
+		filter := model.ExportFilter{
+			IncludeDeleted: _filter.IncludeDeleted,
+			Currency:       strings.ToUpper(strings.TrimSpace(_filter.Currency)),
+		}
+		if filter.Currency == "" {
+			filter.Currency = "VND"
+		}
+		if len(filter.Currency) != 3 {
+			abort("Currency should be a 3 letter ISO code")
+			return
+		}
+
+		for _, field := range []struct {
+			name  string
+			value string
+			out   *time.Time
+		}{{"from", _filter.From, &filter.From}, {"to", _filter.To, &filter.To}} {
+			if field.value == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, field.value)
+			if err != nil {
+				abort("Invalid date format on `" + field.name + "`")
+				return
+			}
+			*field.out = t
+		}
+		if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+			abort("`to` cannot be before `from`")
+			return
+		}
+
+		for _, id := range _filter.Accounts {
+			account, msg := ownedAccount(id, username)
+			if msg != "" {
+				abort(msg)
+				return
+			}
+			filter.Accounts = append(filter.Accounts, account)
+		}
+
+		c.Set("exportJob", model.ExportJob{
+			Owner:  username,
+			Filter: filter,
+		})
+		c.Next()
+	}
+}
+
+func ExportJobOwnershipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := service.GetExportJobByID(c.Param("id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+			return
+		}
+
+		if job.Owner != c.GetString("username") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this export"})
+			return
+		}
+
+		c.Set("exportJob", job)
+		c.Next()
+	}
+}
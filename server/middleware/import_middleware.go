@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"fintrack/server/journal"
+	"fintrack/server/model"
+	"fintrack/server/parser"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxImportSize caps uploaded statements, bank exports are far smaller.
+const maxImportSize = 5 << 20
+
+// importFormats maps file extensions to the format they are read as.
+var importFormats = map[string]string{
+	".csv": "csv",
+	".txt": "csv",
+	".ofx": "ofx",
+	".qfx": "ofx",
+	".qif": "qif",
+	".xml": "camt053",
+	".053": "camt053",
+	".sta": "mt940",
+	".940": "mt940",
+	".mt940": "mt940",
+}
+
+func ImportProfileOwnershipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profile, err := service.GetImportProfileByID(c.Param("id"))
+		if err != nil || profile.IsDeleted {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+			return
+		}
+
+		if profile.Owner != c.GetString("username") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this import profile"})
+			return
+		}
+
+		c.Set("importProfile", profile)
+		c.Next()
+	}
+}
+
+func ImportProfileFormatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var _profile struct {
+			Name         string              `json:"name"`
+			Account      string              `json:"account"`
+			Delimiter    string              `json:"delimiter"`
+			Encoding     string              `json:"encoding"`
+			SkipRows     int                 `json:"skipRows"`
+			HasHeader    bool                `json:"hasHeader"`
+			DateFormat   string              `json:"dateFormat"`
+			Timezone     string              `json:"timezone"`
+			DecimalComma bool                `json:"decimalComma"`
+			Sign         string              `json:"sign"`
+			Columns      model.ColumnMapping `json:"columns"`
+		}
+
+		if err := c.ShouldBindJSON(&_profile); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		abort := func(msg string) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+		}
+
+		username := c.GetString("username")
+		profile := model.ImportProfile{
+			Owner:        username,
+			Name:         strings.TrimSpace(_profile.Name),
+			Delimiter:    _profile.Delimiter,
+			Encoding:     strings.ToLower(_profile.Encoding),
+			SkipRows:     _profile.SkipRows,
+			HasHeader:    _profile.HasHeader,
+			DateFormat:   _profile.DateFormat,
+			Timezone:     _profile.Timezone,
+			DecimalComma: _profile.DecimalComma,
+			Sign:         _profile.Sign,
+			Columns:      _profile.Columns,
+		}
+
+		if profile.Name == "" {
+			abort("Name cannot be empty")
+			return
+		}
+		if len([]rune(profile.Delimiter)) > 1 && profile.Delimiter != `\t` {
+			abort("Delimiter should be a single character")
+			return
+		}
+		if profile.Encoding != "" && !parser.IsEncoding(profile.Encoding) {
+			abort("Unsupported encoding `" + profile.Encoding + "`")
+			return
+		}
+		if profile.SkipRows < 0 {
+			abort("`skipRows` cannot be negative")
+			return
+		}
+		if profile.Timezone == "" {
+			profile.Timezone = "UTC"
+		}
+		if _, err := time.LoadLocation(profile.Timezone); err != nil {
+			abort("Invalid timezone `" + profile.Timezone + "`")
+			return
+		}
+		if profile.Sign == "" {
+			profile.Sign = model.SignNormal
+		}
+		if profile.Sign != model.SignNormal && profile.Sign != model.SignInverted {
+			abort("Invalid sign: expected {normal|inverted}, but got `" + profile.Sign + "`")
+			return
+		}
+
+		cols := profile.Columns
+		if cols.Date == "" {
+			abort("The date column is required")
+			return
+		}
+		if cols.Amount == "" && (cols.Debit == "" || cols.Credit == "") {
+			abort("Map either an amount column or both debit and credit columns")
+			return
+		}
+
+		if _profile.Account != "" {
+			account, msg := ownedAccount(_profile.Account, username)
+			if msg != "" {
+				abort(msg)
+				return
+			}
+			profile.Account = account
+		}
+
+		c.Set("importProfile", profile)
+		c.Next()
+	}
+}
+
+// ImportUploadMiddleware reads a multipart upload: the `file`, an optional
+// `profile` id, an optional `account` id overriding the profile's, and an
+// optional `format` when the extension does not tell.
+func ImportUploadMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		abort := func(status int, msg string) {
+			c.AbortWithStatusJSON(status, gin.H{"error": msg})
+		}
+		username := c.GetString("username")
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			abort(http.StatusBadRequest, "Missing `file`")
+			return
+		}
+		if header.Size > maxImportSize {
+			abort(http.StatusRequestEntityTooLarge, "File is larger than 5 MB")
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			abort(http.StatusBadRequest, err.Error())
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+		if err != nil {
+			abort(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		format := strings.ToLower(c.PostForm("format"))
+		if format == "" {
+			format = importFormats[strings.ToLower(filepath.Ext(header.Filename))]
+		}
+		if format == "" {
+			abort(http.StatusBadRequest, "Unknown file format, pass `format`")
+			return
+		}
+
+		var profile model.ImportProfile
+		if id := c.PostForm("profile"); id != "" {
+			profile, err = service.GetImportProfileByID(id)
+			if err != nil || profile.IsDeleted {
+				abort(http.StatusBadRequest, "Import profile not found")
+				return
+			}
+			if profile.Owner != username {
+				abort(http.StatusForbidden, "You are not the owner of the import profile")
+				return
+			}
+		} else if format == "csv" {
+			abort(http.StatusBadRequest, "CSV files need a `profile`")
+			return
+		}
+
+		account := profile.Account
+		if id := c.PostForm("account"); id != "" {
+			var msg string
+			if account, msg = ownedAccount(id, username); msg != "" {
+				abort(http.StatusBadRequest, msg)
+				return
+			}
+		}
+		// Statement formats name their accounts, CSV rows need a target
+		if account.IsZero() && format == "csv" {
+			abort(http.StatusBadRequest, "No target account: set one on the profile or pass `account`")
+			return
+		}
+
+		c.Set("importFile", data)
+		c.Set("importProfile", profile)
+		c.Set("importBatch", model.ImportBatch{
+			Owner:    username,
+			Profile:  profile.ID,
+			Account:  account,
+			Format:   format,
+			FileName: header.Filename,
+		})
+		c.Next()
+	}
+}
+
+func ImportBatchOwnershipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		batch, err := service.GetImportBatchByID(c.Param("id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+			return
+		}
+
+		if batch.Owner != c.GetString("username") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this import"})
+			return
+		}
+
+		c.Set("importBatch", batch)
+		c.Next()
+	}
+}
+
+// JournalUploadMiddleware reads a beancount or ledger journal from the
+// multipart `file`.
+func JournalUploadMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Missing `file`"})
+			return
+		}
+		if header.Size > maxImportSize {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is larger than 5 MB"})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ds, err := journal.Read(string(data))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":  "Invalid journal",
+				"detail": err.Error(),
+			})
+			return
+		}
+
+		c.Set("journalDataset", ds)
+		c.Next()
+	}
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"time"
+)
+
+func LoanOwnershipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loan, err := service.GetLoanById(c.Param("id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+			return
+		}
+
+		if loan.Creator != c.GetString("username") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the creator of this loan"})
+			return
+		}
+
+		c.Set("loan", loan)
+		c.Next()
+	}
+}
+
+func LoanFormatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var _loan struct {
+			Name             string               `json:"name"`
+			Icon             string               `json:"icon"`
+			Account          string               `json:"account"`
+			SourceAccount    string               `json:"sourceAccount"`
+			InterestCategory string               `json:"interestCategory"`
+			Principal        float64              `json:"principal"`
+			Rate             float64              `json:"rate"`
+			Method           model.InterestMethod `json:"method"`
+			Term             int                  `json:"term"`
+			StartDate        string               `json:"startDate"`
+		}
+
+		if err := c.ShouldBindJSON(&_loan); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		username := c.GetString("username")
+
+		if _loan.Name == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
+			return
+		}
+		if _loan.Principal <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Principal should be positive"})
+			return
+		}
+		if _loan.Rate < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Rate cannot be negative"})
+			return
+		}
+		if _loan.Method != model.InterestFlat && _loan.Method != model.InterestReducing {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid interest method: expected {flat|reducing}, but got `" + string(_loan.Method) + "`",
+			})
+			return
+		}
+		if _loan.Term < 1 || _loan.Term > 600 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Term should be between 1 and 600 months"})
+			return
+		}
+
+		startDate, err := time.Parse(time.RFC3339, _loan.StartDate)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid date format on `startDate`"})
+			return
+		}
+
+		// The loan itself lives in a liability account
+		account, err := service.GetAccountByID(_loan.Account)
+		if err != nil || account.IsDeleted {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Loan account not found"})
+			return
+		}
+		if account.Owner != username {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "You are not the owner of the loan account"})
+			return
+		}
+		if !account.AccountType().IsLiability() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Loan account should be a loan or credit card account"})
+			return
+		}
+
+		source, err := service.GetAccountByID(_loan.SourceAccount)
+		if err != nil || source.IsDeleted {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Source account not found"})
+			return
+		}
+		if source.Owner != username {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "You are not the owner of the source account"})
+			return
+		}
+		if source.ID == account.ID {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Source and loan accounts cannot be the same"})
+			return
+		}
+
+		var categoryID primitive.ObjectID
+		if _loan.Rate > 0 {
+			category, err := service.GetCategoryByID(_loan.InterestCategory)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Interest category not found"})
+				return
+			}
+			if category.Owner != username {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "You are not the owner of the interest category"})
+				return
+			}
+			categoryID = category.ID
+		}
+
+		loan := model.Loan{
+			Name:             _loan.Name,
+			Icon:             _loan.Icon,
+			Creator:          username,
+			Account:          account.ID,
+			SourceAccount:    source.ID,
+			InterestCategory: categoryID,
+			Principal:        _loan.Principal,
+			Rate:             _loan.Rate,
+			Method:           _loan.Method,
+			Term:             _loan.Term,
+			StartDate:        startDate,
+		}
+
+		c.Set("loan", loan)
+		c.Next()
+	}
+}
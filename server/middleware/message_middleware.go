@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"fintrack/server/model"
+	"fintrack/server/parser"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxMessageLength is well above a multi-part SMS or a push notification.
+const maxMessageLength = 2000
+
+func MessageTemplateOwnershipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		template, err := service.GetMessageTemplateByID(c.Param("id"))
+		if err != nil || template.IsDeleted {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Message template not found"})
+			return
+		}
+
+		if template.Owner != c.GetString("username") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this message template"})
+			return
+		}
+
+		c.Set("messageTemplate", template)
+		c.Next()
+	}
+}
+
+func MessageTemplateFormatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var _template struct {
+			Name         string `json:"name"`
+			Provider     string `json:"provider"`
+			Sender       string `json:"sender"`
+			Pattern      string `json:"pattern"`
+			Direction    string `json:"direction"`
+			DateFormat   string `json:"dateFormat"`
+			Timezone     string `json:"timezone"`
+			DecimalComma bool   `json:"decimalComma"`
+			Account      string `json:"account"`
+		}
+
+		if err := c.ShouldBindJSON(&_template); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		abort := func(msg string) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+		}
+
+		username := c.GetString("username")
+		template := model.MessageTemplate{
+			Owner:        username,
+			Name:         strings.TrimSpace(_template.Name),
+			Provider:     strings.TrimSpace(_template.Provider),
+			Sender:       strings.TrimSpace(_template.Sender),
+			Pattern:      _template.Pattern,
+			Direction:    _template.Direction,
+			DateFormat:   _template.DateFormat,
+			Timezone:     _template.Timezone,
+			DecimalComma: _template.DecimalComma,
+		}
+
+		if template.Name == "" {
+			abort("Name cannot be empty")
+			return
+		}
+		if template.Direction != "" && template.Direction != model.DirectionIn && template.Direction != model.DirectionOut {
+			abort("Invalid direction: expected {in|out}, but got `" + template.Direction + "`")
+			return
+		}
+		if template.Timezone == "" {
+			template.Timezone = "UTC"
+		}
+		if _, err := time.LoadLocation(template.Timezone); err != nil {
+			abort("Invalid timezone `" + template.Timezone + "`")
+			return
+		}
+		if _, err := parser.CompileTemplate(template); err != nil {
+			abort("Invalid pattern: " + err.Error())
+			return
+		}
+
+		if _template.Account != "" {
+			account, msg := ownedAccount(_template.Account, username)
+			if msg != "" {
+				abort(msg)
+				return
+			}
+			template.Account = account
+		}
+
+		c.Set("messageTemplate", template)
+		c.Next()
+	}
+}
+
+// MessageIngestMiddleware reads a received message: its `text`, the
+// optional `sender`, `receivedAt` (now when absent), fallback `account` and
+// whether to `commit` it, and sets "incomingMessage".
+func MessageIngestMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Sender     string `json:"sender"`
+			Text       string `json:"text"`
+			ReceivedAt string `json:"receivedAt"`
+			Account    string `json:"account"`
+			Commit     bool   `json:"commit"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		abort := func(msg string) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+		}
+
+		msg := service.IncomingMessage{
+			Sender:     strings.TrimSpace(body.Sender),
+			Text:       strings.TrimSpace(body.Text),
+			ReceivedAt: time.Now(),
+			Commit:     body.Commit,
+		}
+		if msg.Text == "" {
+			abort("Missing `text`")
+			return
+		}
+		if utf8.RuneCountInString(msg.Text) > maxMessageLength {
+			abort("`text` should be at most 2000 characters")
+			return
+		}
+		if body.ReceivedAt != "" {
+			t, err := time.Parse(time.RFC3339, body.ReceivedAt)
+			if err != nil {
+				abort("Invalid date format on `receivedAt`")
+				return
+			}
+			msg.ReceivedAt = t
+		}
+		if body.Account != "" {
+			account, errMsg := ownedAccount(body.Account, c.GetString("username"))
+			if errMsg != "" {
+				abort(errMsg)
+				return
+			}
+			msg.Account = account
+		}
+
+		c.Set("incomingMessage", msg)
+		c.Next()
+	}
+}
@@ -15,12 +15,12 @@ func NotificationOwnershipMiddleware() gin.HandlerFunc {
 		notif, err := service.GetNotificationById(c.Param("id"))
 
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
 			return
 		}
 
 		if string(notif.Owner) != username {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You are not the creator of this Notification"})
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the creator of this Notification"})
 			return
 		}
 
@@ -31,7 +31,6 @@ func NotificationOwnershipMiddleware() gin.HandlerFunc {
 func NotificationFormatMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		type Notification struct {
-            Owner       string                      `json:"owner"`
             Type        model.NotificationType      `json:"type"`
             ReferenceId string                      `json:"referenceId"`
             Title       string                      `json:"title"`
@@ -39,55 +38,66 @@ func NotificationFormatMiddleware() gin.HandlerFunc {
             ScheduledAt string                      `json:"scheduledAt"`
 		}
 		var _notification Notification
+		// Notifications only ever go to the user asking
+		owner := c.GetString("username")
 
 		// Overall format
 		if err := c.ShouldBindJSON(&_notification); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-        if _notification.Type != model.TypeTransaction {
-            c.JSON(http.StatusBadRequest, gin.H{
-                "error": "New notification insertion via http can only be transactional",
+        if _notification.Type != model.TypeTransaction &&
+           _notification.Type != model.TypeReminder {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                "error": "New notification insertion via http can only be transactional or a reminder",
             })
             return
         }
 
-        referenceId, err := primitive.ObjectIDFromHex(_notification.ReferenceId)
-        if err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{
-                "error": "Invalid referenceId",
-                "detail": err.Error(),
-            })
-            return
+        // Reminders may stand on their own, transactional ones always point
+        // at a transaction of the owner.
+        var referenceId primitive.ObjectID
+        if _notification.Type == model.TypeTransaction || _notification.ReferenceId != "" {
+            var err error
+            referenceId, err = primitive.ObjectIDFromHex(_notification.ReferenceId)
+            if err != nil {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": "Invalid referenceId",
+                    "detail": err.Error(),
+                })
+                return
+            }
         }
 
-        transaction, err := service.GetTransactionByID(_notification.ReferenceId)
-        if err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{
-                "error": "Transaction not found",
-                "detail": err.Error(),
-            })
-            return
-        }
-        if transaction.Creator != _notification.Owner {
-            c.JSON(http.StatusBadRequest, gin.H{
-                "error": "Youare not the owner of the transaction",
-            })
-            return
+        if _notification.Type == model.TypeTransaction {
+            transaction, err := service.GetTransactionByID(_notification.ReferenceId)
+            if err != nil {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": "Transaction not found",
+                    "detail": err.Error(),
+                })
+                return
+            }
+            if transaction.Creator != owner {
+                c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+                    "error": "You are not the owner of the transaction",
+                })
+                return
+            }
         }
 
 		// StartDate
 		ScheduledAt, err := time.Parse(time.RFC3339, _notification.ScheduledAt)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 				"error": "Invalid date format on `scheduledAt`",
 			})
 			return
 		}
 
 		notification := model.Notification{
-            Owner:          _notification.Owner,
+            Owner:          owner,
             Type:           _notification.Type,
             ReferenceId:    referenceId,
             Title:          _notification.Title,
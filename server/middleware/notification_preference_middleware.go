@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/mail"
+	"time"
+)
+
+func NotificationPreferenceFormatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var _pref struct {
+			Channels   map[model.NotificationType]map[model.NotificationChannel]bool `json:"channels"`
+			Timezone   string                                                        `json:"timezone"`
+			QuietHours model.QuietHours                                              `json:"quietHours"`
+			Digest     model.DigestSettings                                          `json:"digest"`
+			Spending   model.SpendingDigestSettings                                  `json:"spendingDigest"`
+			Email      string                                                        `json:"email"`
+			PushTokens []string                                                      `json:"pushTokens"`
+			WebhookURL string                                                        `json:"webhookUrl"`
+		}
+
+		if err := c.ShouldBindJSON(&_pref); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		knownType := func(t model.NotificationType) bool {
+			for _, known := range model.NotificationTypes {
+				if known == t {
+					return true
+				}
+			}
+			return false
+		}
+		knownChannel := func(ch model.NotificationChannel) bool {
+			for _, known := range model.NotificationChannels {
+				if known == ch {
+					return true
+				}
+			}
+			return false
+		}
+
+		for t, byChannel := range _pref.Channels {
+			if !knownType(t) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error": "Unknown notification type `" + string(t) + "`",
+				})
+				return
+			}
+			for ch := range byChannel {
+				if !knownChannel(ch) {
+					c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+						"error": "Unknown notification channel `" + string(ch) + "`",
+					})
+					return
+				}
+			}
+		}
+
+		if _pref.Timezone == "" {
+			_pref.Timezone = "UTC"
+		}
+		if _, err := time.LoadLocation(_pref.Timezone); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid timezone `" + _pref.Timezone + "`",
+			})
+			return
+		}
+
+		if _pref.QuietHours.Enabled {
+			if _, err := service.ParseClock(_pref.QuietHours.Start); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid `quietHours.start`: " + err.Error()})
+				return
+			}
+			if _, err := service.ParseClock(_pref.QuietHours.End); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid `quietHours.end`: " + err.Error()})
+				return
+			}
+		}
+
+		if _pref.Digest.Hour < 0 || _pref.Digest.Hour > 23 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Digest hour should be between 0 and 23",
+			})
+			return
+		}
+		for _, t := range _pref.Digest.Types {
+			if !knownType(t) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error": "Unknown notification type `" + string(t) + "`",
+				})
+				return
+			}
+			if t.IsUrgent() || t == model.TypeDigest || t == model.TypeSpendingDigest {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error": "Notification type `" + string(t) + "` cannot be collapsed into a digest",
+				})
+				return
+			}
+		}
+
+		switch _pref.Spending.Frequency {
+		case "":
+			_pref.Spending.Frequency = model.FrequencyOff
+		case model.FrequencyOff:
+		case model.FrequencyWeekly:
+			if _pref.Spending.Day < 0 || _pref.Spending.Day > 6 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error": "Weekly digest day should be a weekday between 0 (Sunday) and 6",
+				})
+				return
+			}
+		case model.FrequencyMonthly:
+			if _pref.Spending.Day < 1 || _pref.Spending.Day > 28 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error": "Monthly digest day should be between 1 and 28",
+				})
+				return
+			}
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid digest frequency: expected {off|weekly|monthly}, but got `" +
+					string(_pref.Spending.Frequency) + "`",
+			})
+			return
+		}
+		if _pref.Spending.Hour < 0 || _pref.Spending.Hour > 23 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Spending digest hour should be between 0 and 23",
+			})
+			return
+		}
+
+		if _pref.WebhookURL != "" {
+			if err := service.CheckWebhookURL(c.Request.Context(), _pref.WebhookURL); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error":  "Invalid `webhookUrl`",
+					"detail": err.Error(),
+				})
+				return
+			}
+		}
+		if _pref.Email != "" {
+			if addr, err := mail.ParseAddress(_pref.Email); err != nil || addr.Address != _pref.Email {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid `email`",
+				})
+				return
+			}
+		}
+
+		if _pref.Channels == nil {
+			_pref.Channels = map[model.NotificationType]map[model.NotificationChannel]bool{}
+		}
+
+		pref := model.NotificationPreference{
+			Owner:      c.GetString("username"),
+			Channels:   _pref.Channels,
+			Timezone:   _pref.Timezone,
+			QuietHours: _pref.QuietHours,
+			Digest:     _pref.Digest,
+			SpendingDigest: model.SpendingDigestSettings{
+				Frequency: _pref.Spending.Frequency,
+				Day:       _pref.Spending.Day,
+				Hour:      _pref.Spending.Hour,
+			},
+			Email:      _pref.Email,
+			PushTokens: _pref.PushTokens,
+			WebhookURL: _pref.WebhookURL,
+		}
+
+		c.Set("notificationPreference", pref)
+		c.Next()
+	}
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strings"
+)
+
+func PayeeOwnershipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		payee, err := service.GetPayeeByID(c.Param("id"))
+		if err != nil || payee.IsDeleted {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Payee not found"})
+			return
+		}
+
+		if payee.Owner != c.GetString("username") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this payee"})
+			return
+		}
+
+		c.Set("payee", payee)
+		c.Next()
+	}
+}
+
+func PayeeFormatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var _payee struct {
+			Name            string   `json:"name"`
+			Aliases         []string `json:"aliases"`
+			IBANs           []string `json:"ibans"`
+			DefaultCategory string   `json:"defaultCategory"`
+			DefaultAccount  string   `json:"defaultAccount"`
+		}
+
+		if err := c.ShouldBindJSON(&_payee); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		username := c.GetString("username")
+		payee := model.Payee{
+			Owner:   username,
+			Name:    strings.TrimSpace(_payee.Name),
+			Aliases: []string{},
+		}
+		if payee.Name == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
+			return
+		}
+
+		seen := map[string]bool{}
+		for _, alias := range _payee.Aliases {
+			alias = strings.TrimSpace(alias)
+			if alias == "" || seen[strings.ToLower(alias)] {
+				continue
+			}
+			seen[strings.ToLower(alias)] = true
+			payee.Aliases = append(payee.Aliases, alias)
+		}
+
+		for _, iban := range _payee.IBANs {
+			if iban = service.NormalizeIBAN(iban); iban != "" {
+				payee.IBANs = append(payee.IBANs, iban)
+			}
+		}
+
+		if _payee.DefaultCategory != "" {
+			category, err := service.GetCategoryByID(_payee.DefaultCategory)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Default category not found"})
+				return
+			}
+			if category.Owner != username {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "You are not the owner of the default category"})
+				return
+			}
+			payee.DefaultCategory = category.ID
+		}
+
+		if _payee.DefaultAccount != "" {
+			account, err := service.GetAccountByID(_payee.DefaultAccount)
+			if err != nil || account.IsDeleted {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Default account not found"})
+				return
+			}
+			if account.Owner != username {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "You are not the owner of the default account"})
+				return
+			}
+			payee.DefaultAccount = account.ID
+		}
+
+		c.Set("payee", payee)
+		c.Next()
+	}
+}
+
+// resolvePayee returns the payee given by id, or when id is empty the payee
+// matched from note. A zero payee means none applies.
+func resolvePayee(ctx context.Context, id, note, owner string) (model.Payee, string) {
+	if id == "" {
+		matcher, err := service.LoadPayeeMatcher(ctx, owner)
+		if err != nil {
+			return model.Payee{}, ""
+		}
+		payee, _ := matcher.Match(note)
+		return payee, ""
+	}
+
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return model.Payee{}, "Invalid payee ID"
+	}
+	payee, err := service.GetPayeeByID(id)
+	if err != nil || payee.IsDeleted {
+		return model.Payee{}, "Payee not found"
+	}
+	if payee.Owner != owner {
+		return model.Payee{}, "You are not the owner of the payee"
+	}
+	return payee, ""
+}
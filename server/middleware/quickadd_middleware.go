@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxQuickAddLength keeps phrases to what a person types or says at once.
+const maxQuickAddLength = 500
+
+// QuickAddFormatMiddleware reads the `text` to parse, the optional IANA
+// `timezone` relative dates are read in and the optional ISO `currency`
+// amounts are in, and sets "quickAddText", "quickAddLocation" and
+// "quickAddCurrency".
+func QuickAddFormatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Text     string `json:"text"`
+			Timezone string `json:"timezone"`
+			Currency string `json:"currency"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		text := strings.TrimSpace(body.Text)
+		if text == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Missing `text`"})
+			return
+		}
+		if utf8.RuneCountInString(text) > maxQuickAddLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "`text` should be at most 500 characters"})
+			return
+		}
+
+		if body.Timezone == "" {
+			body.Timezone = "UTC"
+		}
+		loc, err := time.LoadLocation(body.Timezone)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone `" + body.Timezone + "`"})
+			return
+		}
+
+		currency := strings.ToUpper(strings.TrimSpace(body.Currency))
+		if currency == "" {
+			currency = "VND"
+		}
+		if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid currency `" + body.Currency + "`, expected an ISO code"})
+			return
+		}
+
+		c.Set("quickAddText", text)
+		c.Set("quickAddLocation", loc)
+		c.Set("quickAddCurrency", currency)
+		c.Next()
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// loadTimezone loads an IANA zone name. time.LoadLocation also takes "" and
+// "Local", which mean the server's zone, not the client's, and which Mongo
+// date operators do not understand.
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.New("expected an IANA timezone name")
+	}
+	return time.LoadLocation(name)
+}
+
+// TransferMode is how a report treats transfers between accounts.
+type TransferMode int
+
+const (
+	TransfersNever    TransferMode = iota // they have no category or payee
+	TransfersOptIn                        // with `includeTransfers=true`
+	TransfersIncluded                     // unless `includeTransfers=false`
+)
+
+// ReportQueryMiddleware reads `from`, `to` (RFC3339), `tz`, `type`, `tags`
+// and `includeTransfers` from the query string. The range defaults to the last 30
+// days.
+func ReportQueryMiddleware(mode TransferMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loc, err := loadTimezone(c.DefaultQuery("tz", "UTC"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid timezone `" + c.Query("tz") + "`",
+			})
+			return
+		}
+
+		to := time.Now()
+		if toStr := c.Query("to"); toStr != "" {
+			to, err = time.Parse(time.RFC3339, toStr)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid date format on `to`"})
+				return
+			}
+		}
+
+		from := to.AddDate(0, 0, -30)
+		if fromStr := c.Query("from"); fromStr != "" {
+			from, err = time.Parse(time.RFC3339, fromStr)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid date format on `from`"})
+				return
+			}
+		}
+
+		if !from.Before(to) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "`from` should be before `to`"})
+			return
+		}
+
+		txType := c.Query("type")
+		if txType != "" && txType != "income" && txType != "expense" && txType != "transfer" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid transaction type: expected " +
+					"{income|expense|transfer}, but got `" + txType + "`",
+			})
+			return
+		}
+
+		tags, err := tagQuery(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID on `tags`"})
+			return
+		}
+
+		includeTransfers := mode == TransfersIncluded
+		if includeStr := c.Query("includeTransfers"); includeStr != "" && mode != TransfersNever {
+			includeTransfers, err = strconv.ParseBool(includeStr)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid value on `includeTransfers`"})
+				return
+			}
+		}
+		if txType == "transfer" && mode == TransfersNever {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "This report does not cover transfers"})
+			return
+		}
+		if txType == "transfer" && !includeTransfers {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Transfers are left out, set `includeTransfers=true` to report them",
+			})
+			return
+		}
+
+		query := service.ReportQuery{
+			Owner:            c.GetString("username"),
+			From:             from,
+			To:               to,
+			Location:         loc,
+			Type:             txType,
+			Tags:             tags,
+			IncludeTransfers: includeTransfers,
+		}
+
+		c.Set("reportQuery", query)
+		c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"fintrack/server/exporter"
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+)
+
+// maxRestoreSize caps uploaded exports, which carry a user's whole history.
+const maxRestoreSize = 100 << 20
+
+// RestoreUploadMiddleware reads an export from the multipart `file`, the ZIP
+// archive or its JSON dump, and the `strategy` for data the user already
+// has, merge by default.
+func RestoreUploadMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		abort := func(status int, msg string) {
+			c.AbortWithStatusJSON(status, gin.H{"error": msg})
+		}
+
+		strategy := model.RestoreStrategy(c.DefaultPostForm("strategy", string(model.RestoreMerge)))
+		valid := false
+		for _, s := range model.RestoreStrategies {
+			valid = valid || s == strategy
+		}
+		if !valid {
+			abort(http.StatusBadRequest, "Invalid `strategy`, use merge, replace or keep_both")
+			return
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			abort(http.StatusBadRequest, "Missing `file`")
+			return
+		}
+		if header.Size > maxRestoreSize {
+			abort(http.StatusRequestEntityTooLarge, "File is larger than 100 MB")
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			abort(http.StatusBadRequest, err.Error())
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxRestoreSize))
+		if err != nil {
+			abort(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ds, err := exporter.ReadDataset(data)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":  "Invalid export",
+				"detail": err.Error(),
+			})
+			return
+		}
+		// Broken references fail here rather than half way into the restore
+		if _, err := service.RemapDataset(ds, c.GetString("username"), model.RestoreKeepBoth, nil); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":  "Invalid export",
+				"detail": err.Error(),
+			})
+			return
+		}
+
+		c.Set("restoreDataset", ds)
+		c.Set("restoreStrategy", strategy)
+		c.Next()
+	}
+}
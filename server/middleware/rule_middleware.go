@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func RuleOwnershipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule, err := service.GetRuleByID(c.Param("id"))
+		if err != nil || rule.IsDeleted {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+
+		if rule.Owner != c.GetString("username") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this rule"})
+			return
+		}
+
+		c.Set("rule", rule)
+		c.Next()
+	}
+}
+
+func RuleFormatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var _rule struct {
+			Name       string `json:"name"`
+			Priority   int    `json:"priority"`
+			Conditions struct {
+				NoteContains string  `json:"noteContains"`
+				Payee        string  `json:"payee"`
+				Type         string  `json:"type"`
+				Account      string  `json:"account"`
+				MinAmount    float64 `json:"minAmount"`
+				MaxAmount    float64 `json:"maxAmount"`
+				Weekdays     []int   `json:"weekdays"`
+				TimeFrom     string  `json:"timeFrom"`
+				TimeTo       string  `json:"timeTo"`
+			} `json:"conditions"`
+			Actions struct {
+				Category        string   `json:"category"`
+				Tags            []string `json:"tags"`
+				Payee           string   `json:"payee"`
+				TransferAccount string   `json:"transferAccount"`
+			} `json:"actions"`
+			Timezone       string `json:"timezone"`
+			StopProcessing bool   `json:"stopProcessing"`
+			IsActive       *bool  `json:"isActive"`
+		}
+
+		if err := c.ShouldBindJSON(&_rule); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		abort := func(msg string) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+		}
+
+		username := c.GetString("username")
+		rule := model.Rule{
+			Owner:          username,
+			Name:           strings.TrimSpace(_rule.Name),
+			Priority:       _rule.Priority,
+			Timezone:       _rule.Timezone,
+			StopProcessing: _rule.StopProcessing,
+			IsActive:       _rule.IsActive == nil || *_rule.IsActive,
+		}
+		if rule.Name == "" {
+			abort("Name cannot be empty")
+			return
+		}
+		if rule.Timezone == "" {
+			rule.Timezone = "UTC"
+		}
+		if _, err := time.LoadLocation(rule.Timezone); err != nil {
+			abort("Invalid timezone `" + rule.Timezone + "`")
+			return
+		}
+
+		// Conditions
+		cond := _rule.Conditions
+		rule.Conditions = model.RuleConditions{
+			NoteContains: strings.TrimSpace(cond.NoteContains),
+			Type:         cond.Type,
+			MinAmount:    cond.MinAmount,
+			MaxAmount:    cond.MaxAmount,
+			TimeFrom:     cond.TimeFrom,
+			TimeTo:       cond.TimeTo,
+		}
+		if cond.Type != "" && cond.Type != "income" && cond.Type != "expense" && cond.Type != "transfer" {
+			abort("Invalid condition type: expected {income|expense|transfer}, but got `" + cond.Type + "`")
+			return
+		}
+		if cond.MinAmount < 0 || cond.MaxAmount < 0 {
+			abort("Amounts cannot be negative")
+			return
+		}
+		if cond.MaxAmount > 0 && cond.MinAmount > cond.MaxAmount {
+			abort("`minAmount` cannot be greater than `maxAmount`")
+			return
+		}
+		for _, day := range cond.Weekdays {
+			if day < 0 || day > 6 {
+				abort("Weekdays go from 0 (Sunday) to 6 (Saturday)")
+				return
+			}
+			rule.Conditions.Weekdays = append(rule.Conditions.Weekdays, time.Weekday(day))
+		}
+		if (cond.TimeFrom == "") != (cond.TimeTo == "") {
+			abort("`timeFrom` and `timeTo` go together")
+			return
+		}
+		for _, hm := range []string{cond.TimeFrom, cond.TimeTo} {
+			if _, err := time.Parse("15:04", hm); hm != "" && (err != nil || len(hm) != 5) {
+				abort("Invalid time `" + hm + "`, expected HH:MM")
+				return
+			}
+		}
+		if cond.Payee != "" {
+			payee, msg := resolvePayee(c.Request.Context(), cond.Payee, "", username)
+			if msg != "" {
+				abort(msg)
+				return
+			}
+			rule.Conditions.Payee = payee.ID
+		}
+		if cond.Account != "" {
+			account, msg := ownedAccount(cond.Account, username)
+			if msg != "" {
+				abort(msg)
+				return
+			}
+			rule.Conditions.Account = account
+		}
+		if rule.Conditions.NoteContains == "" && rule.Conditions.Payee.IsZero() && rule.Conditions.Type == "" &&
+			rule.Conditions.Account.IsZero() && cond.MinAmount == 0 && cond.MaxAmount == 0 &&
+			len(cond.Weekdays) == 0 && cond.TimeFrom == "" {
+			abort("A rule needs at least one condition")
+			return
+		}
+
+		// Actions
+		act := _rule.Actions
+		if act.Category != "" && act.TransferAccount != "" {
+			abort("A rule either sets a category or marks a transfer, not both")
+			return
+		}
+		if act.Category != "" {
+			category, err := service.GetCategoryByID(act.Category)
+			if err != nil {
+				abort("Category not found")
+				return
+			}
+			if category.Owner != username {
+				abort("You are not the owner of the category")
+				return
+			}
+			rule.Actions.Category = category.ID
+		}
+		if act.Payee != "" {
+			payee, msg := resolvePayee(c.Request.Context(), act.Payee, "", username)
+			if msg != "" {
+				abort(msg)
+				return
+			}
+			rule.Actions.Payee = payee.ID
+		}
+		if act.TransferAccount != "" {
+			account, msg := ownedAccount(act.TransferAccount, username)
+			if msg != "" {
+				abort(msg)
+				return
+			}
+			rule.Actions.TransferAccount = account
+		}
+		if len(act.Tags) > 0 {
+			tags, msg := ownedTags(act.Tags, username)
+			if msg != "" {
+				abort(msg)
+				return
+			}
+			rule.Actions.Tags = tags
+		}
+		if rule.Actions.Category.IsZero() && rule.Actions.Payee.IsZero() &&
+			rule.Actions.TransferAccount.IsZero() && len(rule.Actions.Tags) == 0 {
+			abort("A rule needs at least one action")
+			return
+		}
+
+		c.Set("rule", rule)
+		c.Next()
+	}
+}
+
+// ownedAccount checks id is an account or saving of owner.
+func ownedAccount(id, owner string) (primitive.ObjectID, string) {
+	if account, err := service.GetAccountByID(id); err == nil && !account.IsDeleted {
+		if account.Owner != owner {
+			return primitive.NilObjectID, "You are not the owner of account `" + id + "`"
+		}
+		return account.ID, ""
+	}
+	if saving, err := service.GetSavingByID(id); err == nil && !saving.IsDeleted {
+		if saving.Owner != owner {
+			return primitive.NilObjectID, "You are not the owner of account `" + id + "`"
+		}
+		return saving.ID, ""
+	}
+	return primitive.NilObjectID, "Account `" + id + "` not found"
+}
+
+// RuleRangeMiddleware sets "ruleFrom" from the optional `from` query
+// parameter, the oldest transactions a rule run looks at.
+func RuleRangeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var from time.Time
+		if q := c.Query("from"); q != "" {
+			t, err := time.Parse(time.RFC3339, q)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid date format on `from`"})
+				return
+			}
+			from = t
+		}
+
+		c.Set("ruleFrom", from)
+		c.Next()
+	}
+}
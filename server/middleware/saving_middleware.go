@@ -38,6 +38,9 @@ func SavingFormatMiddleware() gin.HandlerFunc {
             Goal        float64 `json:"goal"`
             CreatedDate string  `json:"createdDate"`
             GoalDate    string  `json:"goalDate"`
+            Rate        float64 `json:"rate"`
+            Compounding string  `json:"compounding"`
+            TermMonths  int     `json:"termMonths"`
         }
         var _saving Saving
 
@@ -74,6 +77,41 @@ func SavingFormatMiddleware() gin.HandlerFunc {
             })
         }
 
+        // Interest
+        if _saving.Rate < 0 || _saving.Rate > 100 {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                "error": "Rate should be between 0 and 100",
+            })
+            return
+        }
+        compounding := model.Compounding(_saving.Compounding)
+        if _saving.Rate == 0 {
+            compounding = ""
+        }
+        if _saving.Rate > 0 &&
+           compounding != model.CompoundDaily &&
+           compounding != model.CompoundMonthly &&
+           compounding != model.CompoundMaturity {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                "error": "Invalid compounding: expected " +
+                "{daily|monthly|maturity}, but got `" +
+                _saving.Compounding + "`",
+            })
+            return
+        }
+        if _saving.TermMonths < 0 || _saving.TermMonths > 600 {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                "error": "Term should be between 0 and 600 months",
+            })
+            return
+        }
+        if compounding == model.CompoundMaturity && _saving.TermMonths == 0 {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                "error": "Interest at maturity needs a term",
+            })
+            return
+        }
+
         saving := model.Saving{
             Owner:       _saving.Owner,
             Balance:     _saving.Balance,
@@ -82,6 +120,9 @@ func SavingFormatMiddleware() gin.HandlerFunc {
             Goal:        _saving.Goal,
             CreatedDate: CreatedDate,
             GoalDate:    GoalDate,
+            Rate:        _saving.Rate,
+            Compounding: compounding,
+            TermMonths:  _saving.TermMonths,
         }
 
         c.Set("saving", saving)
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"fintrack/server/model"
+	"fintrack/server/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strings"
+)
+
+func TagOwnershipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tag, err := service.GetTagByID(c.Param("id"))
+		if err != nil || tag.IsDeleted {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+
+		if tag.Owner != c.GetString("username") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the owner of this tag"})
+			return
+		}
+
+		c.Set("tag", tag)
+		c.Next()
+	}
+}
+
+func TagFormatMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var _tag struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		}
+
+		if err := c.ShouldBindJSON(&_tag); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		name := strings.TrimSpace(_tag.Name)
+		if name == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
+			return
+		}
+
+		tag := model.Tag{
+			Owner: c.GetString("username"),
+			Name:  name,
+			Color: _tag.Color,
+		}
+
+		c.Set("tag", tag)
+		c.Next()
+	}
+}
+
+// ownedTags resolves tag ids and checks they are live tags of owner.
+func ownedTags(ids []string, owner string) ([]primitive.ObjectID, string) {
+	tags := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		tag, err := service.GetTagByID(id)
+		if err != nil || tag.IsDeleted {
+			return nil, "Tag `" + id + "` not found"
+		}
+		if tag.Owner != owner {
+			return nil, "You are not the owner of tag `" + id + "`"
+		}
+		tags = append(tags, tag.ID)
+	}
+	return tags, ""
+}
+
+// tagQuery reads comma separated tag ids from the `tags` query parameter.
+func tagQuery(c *gin.Context) ([]primitive.ObjectID, error) {
+	var tags []primitive.ObjectID
+	for _, id := range strings.Split(c.Query("tags"), ",") {
+		if id == "" {
+			continue
+		}
+		tagID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tagID)
+	}
+	return tags, nil
+}
+
+// TagFilterMiddleware sets "tagFilter" from the `tags` query parameter, only
+// transactions carrying every listed tag match.
+func TagFilterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tags, err := tagQuery(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID on `tags`"})
+			return
+		}
+
+		c.Set("tagFilter", tags)
+		c.Next()
+	}
+}
+
+func BulkTagMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Transactions []string `json:"transactions"`
+			Tags         []string `json:"tags"`
+		}
+
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(body.Transactions) == 0 || len(body.Tags) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Both `transactions` and `tags` are required"})
+			return
+		}
+
+		tags, msg := ownedTags(body.Tags, c.GetString("username"))
+		if msg != "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		transactions := make([]primitive.ObjectID, 0, len(body.Transactions))
+		for _, id := range body.Transactions {
+			txID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID `" + id + "`"})
+				return
+			}
+			transactions = append(transactions, txID)
+		}
+
+		c.Set("bulkTransactions", transactions)
+		c.Set("bulkTags", tags)
+		c.Next()
+	}
+}
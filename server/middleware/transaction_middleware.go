@@ -10,21 +10,25 @@ import (
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func TransactionOwnershipMiddleware() gin.HandlerFunc {
+// TransactionOwnershipMiddleware sets "ownedTransaction" to the transaction
+// `id` names when the user created it. Deleted ones are only let through
+// with allowDeleted.
+func TransactionOwnershipMiddleware(allowDeleted bool) gin.HandlerFunc {
     return func(c *gin.Context) {
         username := c.GetString("username")
         transaction, err := service.GetTransactionByID(c.Param("id"))
 
-        if err != nil {
-            c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+        if err != nil || (transaction.IsDeleted && !allowDeleted) {
+            c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
             return
         }
 
         if transaction.Creator != username {
-            c.JSON(http.StatusForbidden, gin.H{"error": "You are not the creator of this transaction"})
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not the creator of this transaction"})
             return
         }
 
+        c.Set("ownedTransaction", transaction)
         c.Next()
     }
 }
@@ -39,6 +43,13 @@ func TransactionFormatMiddleware() gin.HandlerFunc {
             SourceAccount   string             `json:"sourceAccount"`
             DestinationAccount string          `json:"destinationAccount"`
             Category        string             `json:"category"`
+            Splits          []struct {
+                Category string  `json:"category"`
+                Amount   float64 `json:"amount"`
+                Note     string  `json:"note"`
+            } `json:"splits"`
+            Tags            []string           `json:"tags"`
+            Payee           string             `json:"payee"`
             Note            string             `json:"note"`
             IsDeleted       bool            `json:"isDeleted"`
         }
@@ -80,6 +91,27 @@ func TransactionFormatMiddleware() gin.HandlerFunc {
             return
         }
 
+        // Payee, given or matched from the note, fills in what the
+        // request left out
+        payee, msg := resolvePayee(c.Request.Context(), _transaction.Payee, _transaction.Note, _transaction.Creator)
+        if msg != "" {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                "error": msg,
+            })
+            return
+        }
+        if !payee.DefaultAccount.IsZero() {
+            if _transaction.Type == "expense" && _transaction.SourceAccount == "" {
+                _transaction.SourceAccount = payee.DefaultAccount.Hex()
+            }
+            if _transaction.Type == "income" && _transaction.DestinationAccount == "" {
+                _transaction.DestinationAccount = payee.DefaultAccount.Hex()
+            }
+        }
+        if !payee.DefaultCategory.IsZero() && _transaction.Category == "" && len(_transaction.Splits) == 0 {
+            _transaction.Category = payee.DefaultCategory.Hex()
+        }
+
         getOwner := func(id string) (string, error) {
             account, accErr := service.GetAccountByID(id)
             if accErr == nil {
@@ -108,6 +140,16 @@ func TransactionFormatMiddleware() gin.HandlerFunc {
                 })
                 return
             }
+
+            // Overdraft / credit limit, savings have no rules
+            if account, err := service.GetAccountByID(_transaction.SourceAccount); err == nil {
+                if err := service.CheckSpendingRule(account, _transaction.Amount, c.Param("id")); err != nil {
+                    c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                        "error": err.Error(),
+                    })
+                    return
+                }
+            }
         }
 
         // Destination account
@@ -128,20 +170,52 @@ func TransactionFormatMiddleware() gin.HandlerFunc {
         }
 
         var category model.Category
-        if _transaction.Type == "income" || _transaction.Type == "expense" {
-            category, err = service.GetCategoryByID(_transaction.Category)
-            if err != nil {
-                c.JSON(http.StatusBadRequest, gin.H{
-                    "error": "Category not found",
+        var splits []model.Split
+        if len(_transaction.Splits) > 0 {
+            for i, line := range _transaction.Splits {
+                splitCategory, err := service.GetCategoryByID(line.Category)
+                if err != nil {
+                    c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                        "error": fmt.Sprintf("Split %d: category not found", i+1),
+                    })
+                    return
+                }
+                if splitCategory.Owner != _transaction.Creator {
+                    c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                        "error": fmt.Sprintf("Split %d: you are not the owner of the category", i+1),
+                    })
+                    return
+                }
+                splits = append(splits, model.Split{
+                    Category: splitCategory.ID,
+                    Amount:   line.Amount,
+                    Note:     line.Note,
                 })
-                return
             }
-            if category.Owner != _transaction.Creator {
-                c.JSON(http.StatusBadRequest, gin.H{
-                    "error": "You are not the owner of the category",
+
+            if err := service.CheckSplits(_transaction.Type, _transaction.Amount, splits); err != nil {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": err.Error(),
                 })
                 return
             }
+        } else if _transaction.Type == "income" || _transaction.Type == "expense" {
+            // A new transaction may leave the category to the rules below
+            if _transaction.Category != "" || c.Param("id") != "" {
+                category, err = service.GetCategoryByID(_transaction.Category)
+                if err != nil {
+                    c.JSON(http.StatusBadRequest, gin.H{
+                        "error": "Category not found",
+                    })
+                    return
+                }
+                if category.Owner != _transaction.Creator {
+                    c.JSON(http.StatusBadRequest, gin.H{
+                        "error": "You are not the owner of the category",
+                    })
+                    return
+                }
+            }
 
         } else {
             if _transaction.SourceAccount == _transaction.DestinationAccount {
@@ -152,6 +226,15 @@ func TransactionFormatMiddleware() gin.HandlerFunc {
             }
         }
 
+        // Tags
+        tags, msg := ownedTags(_transaction.Tags, _transaction.Creator)
+        if msg != "" {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                "error": msg,
+            })
+            return
+        }
+
         srcID, err := primitive.ObjectIDFromHex(_transaction.SourceAccount)
         if err != nil {
             c.JSON(http.StatusBadRequest, gin.H{
@@ -176,10 +259,40 @@ func TransactionFormatMiddleware() gin.HandlerFunc {
             SourceAccount:      srcID,
             DestinationAccount: dstID,
             Category:           category.ID,
+            Splits:             splits,
+            Tags:               tags,
+            Payee:              payee.ID,
             Note:               _transaction.Note,
         }
 
 
+        // Rules fill in what a new transaction left out
+        if c.Param("id") == "" {
+            rules, err := service.LoadRules(c.Request.Context(), transaction.Creator)
+            if err != nil {
+                c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+                    "error":  "Error loading rules",
+                    "detail": err.Error(),
+                })
+                return
+            }
+            before := transaction
+            rules.Apply(&transaction, false)
+            // A rule may have made it a transfer out of another account
+            if err := service.CheckRuleSource(before, transaction); err != nil {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": err.Error(),
+                })
+                return
+            }
+            if transaction.Type != "transfer" && transaction.Category.IsZero() && len(transaction.Splits) == 0 {
+                c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+                    "error": "Category not found: choose one or add a rule that sets it",
+                })
+                return
+            }
+        }
+
         c.Set("transaction", transaction)
         c.Next()
 
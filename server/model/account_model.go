@@ -5,13 +5,71 @@ import (
 	"time"
 )
 
+type AccountType string
+
+const (
+	AccountCash       AccountType = "cash"
+	AccountChecking   AccountType = "checking"
+	AccountCreditCard AccountType = "credit_card"
+	AccountLoan       AccountType = "loan"
+	AccountEWallet    AccountType = "e_wallet"
+)
+
+var AccountTypes = []AccountType{
+	AccountCash,
+	AccountChecking,
+	AccountCreditCard,
+	AccountLoan,
+	AccountEWallet,
+}
+
+// IsLiability is true for accounts that hold debt. Their balance is negative
+// while money is owed.
+func (t AccountType) IsLiability() bool {
+	return t == AccountCreditCard || t == AccountLoan
+}
+
 type Account struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-	Owner      string             `bson:"owner" json:"owner"`
-	Balance    float64            `bson:"balance" json:"balance"`
-	Icon       string             `bson:"icon" json:"icon"`
-	Name       string             `bson:"name" json:"name"`
-	LastUpdate time.Time          `bson:"last_update" json:"lastUpdate,omitempty"`
-	IsDeleted  bool               `bson:"is_deleted" json:"isDeleted"`
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner   string             `bson:"owner" json:"owner"`
+	Type    AccountType        `bson:"type,omitempty" json:"type,omitempty"`
+	Balance float64            `bson:"balance" json:"balance"`
+	// Balance before the first recorded transaction, see service.ReconcileBalances.
+	OpeningBalance float64 `bson:"opening_balance,omitempty" json:"openingBalance,omitempty"`
+	// Credit cards and loans only.
+	CreditLimit  float64 `bson:"credit_limit,omitempty" json:"creditLimit,omitempty"`
+	StatementDay int     `bson:"statement_day,omitempty" json:"statementDay,omitempty"`
+	DueDay       int     `bson:"due_day,omitempty" json:"dueDay,omitempty"`
+	// Spending rules checked by middleware.TransactionFormatMiddleware.
+	NoOverdraft        bool   `bson:"no_overdraft" json:"noOverdraft"`
+	EnforceCreditLimit bool   `bson:"enforce_credit_limit" json:"enforceCreditLimit"`
+	Icon               string `bson:"icon" json:"icon"`
+	Name               string `bson:"name" json:"name"`
+	// The bank's account id, maps statement imports to this account.
+	BankAccountNumber string    `bson:"bank_account_number" json:"bankAccountNumber"`
+	LastUpdate        time.Time `bson:"last_update" json:"lastUpdate,omitempty"`
+	IsDeleted         bool      `bson:"is_deleted" json:"isDeleted"`
 }
 
+// AccountType falls back to cash for accounts created before types existed.
+func (a Account) AccountType() AccountType {
+	if a.Type == "" {
+		return AccountCash
+	}
+	return a.Type
+}
+
+// BalanceFloor is the lowest balance the account's rules allow, ok is false
+// when nothing is enforced.
+func (a Account) BalanceFloor() (floor float64, ok bool) {
+	if a.AccountType().IsLiability() {
+		if a.EnforceCreditLimit {
+			return -a.CreditLimit, true
+		}
+		return 0, false
+	}
+	if a.NoOverdraft {
+		return 0, true
+	}
+	return 0, false
+}
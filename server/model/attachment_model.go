@@ -0,0 +1,18 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Attachment is a file kept with a transaction, a receipt or an invoice.
+// The file itself is in the blob store under Key.
+type Attachment struct {
+	ID           primitive.ObjectID `bson:"_id" json:"_id"`
+	FileName     string             `bson:"file_name" json:"fileName"`
+	ContentType  string             `bson:"content_type" json:"contentType"`
+	Size         int64              `bson:"size" json:"size"`
+	Key          string             `bson:"key" json:"-"`
+	HasThumbnail bool               `bson:"has_thumbnail" json:"hasThumbnail"` // images get a JPEG preview
+	UploadedAt   time.Time          `bson:"uploaded_at" json:"uploadedAt"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// BalanceSnapshot materializes the balance of an account or saving at a point
+// in time, so history does not have to be replayed from today.
+type BalanceSnapshot struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner   string             `bson:"owner" json:"owner"`
+	Account primitive.ObjectID `bson:"account" json:"account"`
+	Kind    string             `bson:"kind" json:"kind"` // account, saving
+	Balance float64            `bson:"balance" json:"balance"`
+	TakenAt time.Time          `bson:"taken_at" json:"takenAt"`
+}
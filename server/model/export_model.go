@@ -0,0 +1,87 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// DatasetVersion is bumped when Dataset changes in a way a restore has to
+// know about.
+const DatasetVersion = 1
+
+// Dataset is everything a user owns, the lossless JSON dump of an export.
+type Dataset struct {
+	Version    int          `json:"version"`
+	Owner      string       `json:"owner"`
+	ExportedAt time.Time    `json:"exportedAt"`
+	Filter     ExportFilter `json:"filter"`
+
+	Accounts                []Account                `json:"accounts"`
+	Savings                 []Saving                 `json:"savings"`
+	Categories              []Category               `json:"categories"`
+	Tags                    []Tag                    `json:"tags"`
+	Payees                  []Payee                  `json:"payees"`
+	Transactions            []Transaction            `json:"transactions"`
+	Subscriptions           []Subscription           `json:"subscriptions"`
+	Loans                   []Loan                   `json:"loans"`
+	Rules                   []Rule                   `json:"rules"`
+	ImportProfiles          []ImportProfile          `json:"importProfiles"`
+	MessageTemplates        []MessageTemplate        `json:"messageTemplates"`
+	Statements              []Statement              `json:"statements"`
+	BalanceSnapshots        []BalanceSnapshot        `json:"balanceSnapshots"`
+	Notifications           []Notification           `json:"notifications"`
+	NotificationPreferences []NotificationPreference `json:"notificationPreferences"`
+}
+
+// ExportFilter narrows an export. Zero values mean everything.
+type ExportFilter struct {
+	From           time.Time            `bson:"from,omitempty" json:"from,omitempty"`
+	To             time.Time            `bson:"to,omitempty" json:"to,omitempty"`
+	Accounts       []primitive.ObjectID `bson:"accounts,omitempty" json:"accounts,omitempty"` // accounts or savings
+	IncludeDeleted bool                 `bson:"include_deleted" json:"includeDeleted"`
+	Currency       string               `bson:"currency" json:"currency"` // for OFX, amounts carry none
+}
+
+// Export job status values
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// ExportJob builds an export archive in the background. The archive is kept
+// until ExpireAt.
+type ExportJob struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner      string             `bson:"owner" json:"owner"`
+	Filter     ExportFilter       `bson:"filter" json:"filter"`
+	Status     string             `bson:"status" json:"status"`
+	FileName   string             `bson:"file_name" json:"fileName"`
+	File       primitive.ObjectID `bson:"file,omitempty" json:"-"` // GridFS id of the archive
+	Size       int64              `bson:"size" json:"size"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"createdAt"`
+	FinishedAt time.Time          `bson:"finished_at,omitempty" json:"finishedAt,omitempty"`
+	ExpireAt   time.Time          `bson:"expire_at" json:"expireAt"`
+}
+
+// RestoreStrategy says what a restore does with data the target user
+// already has.
+type RestoreStrategy string
+
+const (
+	// Records named like one the user has are folded into it, transactions
+	// the user already has are skipped.
+	RestoreMerge RestoreStrategy = "merge"
+	// The user's data is deleted first.
+	RestoreReplace RestoreStrategy = "replace"
+	// Everything is added, clashing names get a number.
+	RestoreKeepBoth RestoreStrategy = "keep_both"
+)
+
+var RestoreStrategies = []RestoreStrategy{
+	RestoreMerge,
+	RestoreReplace,
+	RestoreKeepBoth,
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Sign conventions of a single amount column.
+const (
+	SignNormal   = "normal"   // negative is money out
+	SignInverted = "inverted" // positive is money out, as on most card exports
+)
+
+// ColumnMapping names the columns of a CSV export, by header or by 1-based
+// position ("3"). Debit and Credit replace Amount on banks that split them.
+type ColumnMapping struct {
+	Date        string `bson:"date" json:"date"`
+	Description string `bson:"description" json:"description"`
+	Amount      string `bson:"amount,omitempty" json:"amount,omitempty"`
+	Debit       string `bson:"debit,omitempty" json:"debit,omitempty"`
+	Credit      string `bson:"credit,omitempty" json:"credit,omitempty"`
+	Payee       string `bson:"payee,omitempty" json:"payee,omitempty"`
+	Reference   string `bson:"reference,omitempty" json:"reference,omitempty"`
+}
+
+// ImportProfile remembers how to read one bank's export.
+type ImportProfile struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner        string             `bson:"owner" json:"owner"`
+	Name         string             `bson:"name" json:"name"`
+	Account      primitive.ObjectID `bson:"account,omitempty" json:"account,omitempty"`     // default target
+	Delimiter    string             `bson:"delimiter,omitempty" json:"delimiter,omitempty"` // detected when empty
+	Encoding     string             `bson:"encoding,omitempty" json:"encoding,omitempty"`   // detected when empty
+	SkipRows     int                `bson:"skip_rows" json:"skipRows"`                      // before the header
+	HasHeader    bool               `bson:"has_header" json:"hasHeader"`
+	DateFormat   string             `bson:"date_format" json:"dateFormat"` // e.g. DD/MM/YYYY
+	Timezone     string             `bson:"timezone" json:"timezone"`
+	DecimalComma bool               `bson:"decimal_comma" json:"decimalComma"` // 1.234,56
+	Sign         string             `bson:"sign" json:"sign"`
+	Columns      ColumnMapping      `bson:"columns" json:"columns"`
+	LastUpdate   time.Time          `bson:"last_update" json:"lastUpdate,omitempty"`
+	IsDeleted    bool               `bson:"is_deleted" json:"isDeleted"`
+}
+
+// Import batch status values
+const (
+	ImportPreview    = "preview"
+	ImportCommitting = "committing" // claimed by a commit in progress
+	ImportCommitted  = "committed"
+)
+
+// ImportRow is one parsed line and the transaction it would become.
+type ImportRow struct {
+	Line        int                `bson:"line" json:"line"`
+	Account     primitive.ObjectID `bson:"account,omitempty" json:"account,omitempty"`
+	Transaction Transaction        `bson:"transaction" json:"transaction"`
+	Duplicate   primitive.ObjectID `bson:"duplicate,omitempty" json:"duplicate,omitempty"` // existing transaction it likely repeats
+	Rules       []string           `bson:"rules,omitempty" json:"rules,omitempty"`         // names of the rules that fired
+	// The other side as the bank reports it, becomes a payee on commit
+	CounterpartyName string `bson:"counterparty_name,omitempty" json:"counterpartyName,omitempty"`
+	CounterpartyIBAN string `bson:"counterparty_iban,omitempty" json:"counterpartyIban,omitempty"`
+	Error            string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// ImportBalance is what a statement says the account held before and after
+// it. The commit fills in what the ledger says at the same moments.
+type ImportBalance struct {
+	Account       primitive.ObjectID `bson:"account,omitempty" json:"account,omitempty"`
+	BankAccount   string             `bson:"bank_account" json:"bankAccount"`
+	Currency      string             `bson:"currency,omitempty" json:"currency,omitempty"`
+	Opening       float64            `bson:"opening" json:"opening"`
+	OpeningDate   time.Time          `bson:"opening_date" json:"openingDate"`
+	Closing       float64            `bson:"closing" json:"closing"`
+	ClosingDate   time.Time          `bson:"closing_date" json:"closingDate"`
+	OpeningLedger *float64           `bson:"opening_ledger,omitempty" json:"openingLedger,omitempty"`
+	ClosingLedger *float64           `bson:"closing_ledger,omitempty" json:"closingLedger,omitempty"`
+	Reconciled    bool               `bson:"reconciled" json:"reconciled"`
+}
+
+// ImportBatch holds a previewed file until it is committed. Previews expire.
+type ImportBatch struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner       string             `bson:"owner" json:"owner"`
+	Profile     primitive.ObjectID `bson:"profile,omitempty" json:"profile,omitempty"`
+	Account     primitive.ObjectID `bson:"account,omitempty" json:"account,omitempty"` // for rows naming no known account
+	Format      string             `bson:"format" json:"format"`
+	FileName    string             `bson:"file_name" json:"fileName"`
+	Status      string             `bson:"status" json:"status"`
+	Rows        []ImportRow        `bson:"rows" json:"rows"`
+	Balances    []ImportBalance    `bson:"balances,omitempty" json:"balances,omitempty"`
+	Imported    int                `bson:"imported" json:"imported"`
+	CreatedAt   time.Time          `bson:"created_at" json:"createdAt"`
+	ExpireAt    time.Time          `bson:"expire_at,omitempty" json:"expireAt,omitempty"`
+	CommittedAt time.Time          `bson:"committed_at,omitempty" json:"committedAt,omitempty"`
+}
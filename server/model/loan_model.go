@@ -0,0 +1,54 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type InterestMethod string
+
+const (
+	// Interest on the original principal every period.
+	InterestFlat InterestMethod = "flat"
+	// Interest on the remaining principal, equal payments (annuity).
+	InterestReducing InterestMethod = "reducing"
+)
+
+type Installment struct {
+	Number    int       `bson:"number" json:"number"`
+	DueDate   time.Time `bson:"due_date" json:"dueDate"`
+	Payment   float64   `bson:"payment" json:"payment"`
+	Principal float64   `bson:"principal" json:"principal"`
+	Interest  float64   `bson:"interest" json:"interest"`
+	Remaining float64   `bson:"remaining" json:"remaining"` // principal left after this payment
+
+	Paid                 bool               `bson:"paid" json:"paid"`
+	PrincipalTransaction primitive.ObjectID `bson:"principal_transaction,omitempty" json:"principalTransaction,omitempty"`
+	InterestTransaction  primitive.ObjectID `bson:"interest_transaction,omitempty" json:"interestTransaction,omitempty"`
+}
+
+// Loan pays itself off monthly: the principal part is a transfer from
+// SourceAccount to the liability Account, the interest part an expense in
+// InterestCategory.
+type Loan struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Name             string             `bson:"name" json:"name"`
+	Icon             string             `bson:"icon" json:"icon"`
+	Creator          string             `bson:"creator" json:"creator"`
+	Account          primitive.ObjectID `bson:"account" json:"account"`
+	SourceAccount    primitive.ObjectID `bson:"source_account" json:"sourceAccount"`
+	InterestCategory primitive.ObjectID `bson:"interest_category,omitempty" json:"interestCategory,omitempty"`
+
+	Principal float64        `bson:"principal" json:"principal"`
+	Rate      float64        `bson:"rate" json:"rate"` // yearly, in percent
+	Method    InterestMethod `bson:"method" json:"method"`
+	Term      int            `bson:"term" json:"term"` // months
+	StartDate time.Time      `bson:"start_date" json:"startDate"`
+	Schedule  []Installment  `bson:"schedule" json:"schedule"`
+
+	IsActive   bool      `bson:"is_active" json:"isActive"`
+	NextDue    time.Time `bson:"next_due,omitempty" json:"nextDue,omitempty"` // for indexing
+	PaidOffAt  time.Time `bson:"paid_off_at,omitempty" json:"paidOffAt,omitempty"`
+	LastUpdate time.Time `bson:"last_update" json:"lastUpdate,omitempty"`
+	IsDeleted  bool      `bson:"is_deleted" json:"isDeleted"`
+}
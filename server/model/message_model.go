@@ -0,0 +1,54 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Which way money moved, for templates that do not capture a sign
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// MessageTemplate reads one kind of bank SMS or e-wallet notification.
+// Pattern is a regular expression with named groups: amount is required,
+// sign (+ or -), balance, reference, date, account, payee and description
+// are read when the pattern has them.
+type MessageTemplate struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner    string             `bson:"owner" json:"owner"` // empty on built-in templates
+	Name     string             `bson:"name" json:"name"`
+	Provider string             `bson:"provider" json:"provider"`                 // the bank or wallet
+	Sender   string             `bson:"sender,omitempty" json:"sender,omitempty"` // matched against the sender, case-insensitive, when set
+	Pattern  string             `bson:"pattern" json:"pattern"`
+	// Used when the message has no sign
+	Direction    string             `bson:"direction,omitempty" json:"direction,omitempty"`
+	DateFormat   string             `bson:"date_format,omitempty" json:"dateFormat,omitempty"` // e.g. DD/MM/YYYY HH:mm
+	Timezone     string             `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	DecimalComma bool               `bson:"decimal_comma" json:"decimalComma"` // 1.234,56
+	Account      primitive.ObjectID `bson:"account,omitempty" json:"account,omitempty"`
+	LastUpdate   time.Time          `bson:"last_update" json:"lastUpdate,omitempty"`
+	IsDeleted    bool               `bson:"is_deleted" json:"isDeleted"`
+}
+
+// What became of an ingested message
+const (
+	MessageCreated   = "created"
+	MessageProposed  = "proposed"
+	MessageDuplicate = "duplicate"
+	MessageUnmatched = "unmatched"
+)
+
+// UnmatchedMessage is a message no template could read, kept to write one
+// for it. The same text received again counts up instead of piling up.
+type UnmatchedMessage struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner     string             `bson:"owner" json:"owner"`
+	Sender    string             `bson:"sender,omitempty" json:"sender,omitempty"`
+	Text      string             `bson:"text" json:"text"`
+	Hash      string             `bson:"hash" json:"-"`
+	Count     int                `bson:"count" json:"count"`
+	FirstSeen time.Time          `bson:"first_seen" json:"firstSeen"`
+	LastSeen  time.Time          `bson:"last_seen" json:"lastSeen"`
+}
@@ -12,6 +12,39 @@ const (
     TypeOverBudget      NotificationType = "over_budget"
     TypeFinishIncome    NotificationType = "finish_income"
     TypeSubscription    NotificationType = "subscription"
+    TypeDigest          NotificationType = "digest"
+    TypeReminder        NotificationType = "reminder"
+    TypeSpendingDigest  NotificationType = "spending_digest"
+    TypeStatementDue    NotificationType = "statement_due"
+    TypeSavingMatured   NotificationType = "saving_matured"
+)
+
+var NotificationTypes = []NotificationType{
+    TypeTransaction,
+    TypeOverBudget,
+    TypeFinishIncome,
+    TypeSubscription,
+    TypeDigest,
+    TypeReminder,
+    TypeSpendingDigest,
+    TypeStatementDue,
+    TypeSavingMatured,
+}
+
+// Urgent notifications are never collapsed into a digest.
+func (t NotificationType) IsUrgent() bool {
+    return t == TypeOverBudget || t == TypeSubscription || t == TypeStatementDue
+}
+
+type NotificationStatus string
+
+const (
+    StatusPending       NotificationStatus = "pending"  // scheduled in the future
+    StatusCancelled     NotificationStatus = "cancelled"
+    StatusDelivered     NotificationStatus = "delivered"
+    StatusHeld          NotificationStatus = "held"     // waiting for quiet hours to end
+    StatusQueued        NotificationStatus = "queued"   // waiting for the next digest
+    StatusDigested      NotificationStatus = "digested" // collapsed into a digest
 )
 
 type Notification struct {
@@ -23,7 +56,17 @@ type Notification struct {
 	Message            string             `bson:"message" json:"message"`
     Read               bool               `bson:"read" json:"read"`
     ScheduledAt        time.Time          `bson:"scheduled_at" json:"scheduledAt"`
+
+    // Rich bodies for channels that can render them, Message stays plain.
+    Markdown           string             `bson:"markdown,omitempty" json:"markdown,omitempty"`
+    HTML               string             `bson:"html,omitempty" json:"html,omitempty"`
+
+    // Delivery state, see service.DeliverNotification. Empty status on old
+    // documents means delivered.
+    Status             NotificationStatus    `bson:"status,omitempty" json:"status,omitempty"`
+    Channels           []NotificationChannel `bson:"channels,omitempty" json:"channels,omitempty"`
+    DeliverAt          time.Time             `bson:"deliver_at,omitempty" json:"deliverAt,omitempty"`
+
 	LastUpdate         time.Time          `bson:"last_update" json:"lastUpdate,omitempty"`
 	IsDeleted          bool               `bson:"is_deleted" json:"isDeleted"`
 }
-
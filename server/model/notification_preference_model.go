@@ -0,0 +1,84 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type NotificationChannel string
+
+const (
+	ChannelInApp   NotificationChannel = "in_app"
+	ChannelEmail   NotificationChannel = "email"
+	ChannelPush    NotificationChannel = "push"
+	ChannelWebhook NotificationChannel = "webhook"
+)
+
+var NotificationChannels = []NotificationChannel{
+	ChannelInApp,
+	ChannelEmail,
+	ChannelPush,
+	ChannelWebhook,
+}
+
+type QuietHours struct {
+	Enabled bool   `bson:"enabled" json:"enabled"`
+	Start   string `bson:"start" json:"start"` // "22:00", user's timezone
+	End     string `bson:"end" json:"end"`     // "07:00", may be on the next day
+}
+
+type DigestSettings struct {
+	Enabled bool               `bson:"enabled" json:"enabled"`
+	Types   []NotificationType `bson:"types" json:"types"` // non-urgent types to collapse
+	Hour    int                `bson:"hour" json:"hour"`   // local hour the digest is sent
+}
+
+type DigestFrequency string
+
+const (
+	FrequencyOff     DigestFrequency = "off"
+	FrequencyWeekly  DigestFrequency = "weekly"
+	FrequencyMonthly DigestFrequency = "monthly"
+)
+
+type SpendingDigestSettings struct {
+	Frequency DigestFrequency `bson:"frequency" json:"frequency"`
+	Day       int             `bson:"day" json:"day"`   // weekday (0 = Sunday) or day of month (1-28)
+	Hour      int             `bson:"hour" json:"hour"` // local hour
+	NextRun   time.Time       `bson:"next_run,omitempty" json:"nextRun,omitempty"`
+}
+
+type NotificationPreference struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner string             `bson:"owner" json:"owner"`
+
+	// Channels[type][channel] tells whether a type is delivered on a channel.
+	// Missing entries fall back to DefaultChannels.
+	Channels map[NotificationType]map[NotificationChannel]bool `bson:"channels" json:"channels"`
+
+	Timezone   string         `bson:"timezone" json:"timezone"`
+	QuietHours QuietHours     `bson:"quiet_hours" json:"quietHours"`
+	Digest     DigestSettings `bson:"digest" json:"digest"`
+
+	SpendingDigest SpendingDigestSettings `bson:"spending_digest" json:"spendingDigest"`
+
+	Email      string   `bson:"email,omitempty" json:"email,omitempty"`
+	PushTokens []string `bson:"push_tokens,omitempty" json:"pushTokens,omitempty"`
+	WebhookURL string   `bson:"webhook_url,omitempty" json:"webhookUrl,omitempty"`
+
+	LastUpdate time.Time `bson:"last_update" json:"lastUpdate,omitempty"`
+}
+
+// Only in-app delivery is on until the user opts into other channels.
+var DefaultChannels = map[NotificationChannel]bool{
+	ChannelInApp: true,
+}
+
+func (p NotificationPreference) Enabled(t NotificationType, ch NotificationChannel) bool {
+	if byChannel, ok := p.Channels[t]; ok {
+		if enabled, ok := byChannel[ch]; ok {
+			return enabled
+		}
+	}
+	return DefaultChannels[ch]
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Payee struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner           string             `bson:"owner" json:"owner"`
+	Name            string             `bson:"name" json:"name"`
+	Aliases         []string           `bson:"aliases" json:"aliases"`
+	IBANs           []string           `bson:"ibans,omitempty" json:"ibans,omitempty"` // counterparty accounts seen on statements
+	DefaultCategory primitive.ObjectID `bson:"default_category,omitempty" json:"defaultCategory,omitempty"`
+	DefaultAccount  primitive.ObjectID `bson:"default_account,omitempty" json:"defaultAccount,omitempty"`
+	LastUpdate      time.Time          `bson:"last_update" json:"lastUpdate,omitempty"`
+	IsDeleted       bool               `bson:"is_deleted" json:"isDeleted"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// RuleConditions must all hold for a rule to fire. Zero values are ignored.
+type RuleConditions struct {
+	NoteContains string             `bson:"note_contains,omitempty" json:"noteContains,omitempty"` // whole words, accents and case ignored
+	Payee        primitive.ObjectID `bson:"payee,omitempty" json:"payee,omitempty"`
+	Type         string             `bson:"type,omitempty" json:"type,omitempty"`
+	Account      primitive.ObjectID `bson:"account,omitempty" json:"account,omitempty"` // source or destination
+	MinAmount    float64            `bson:"min_amount,omitempty" json:"minAmount,omitempty"`
+	MaxAmount    float64            `bson:"max_amount,omitempty" json:"maxAmount,omitempty"`
+	Weekdays     []time.Weekday     `bson:"weekdays,omitempty" json:"weekdays,omitempty"`
+	TimeFrom     string             `bson:"time_from,omitempty" json:"timeFrom,omitempty"` // "HH:MM", may wrap past midnight
+	TimeTo       string             `bson:"time_to,omitempty" json:"timeTo,omitempty"`
+}
+
+type RuleActions struct {
+	Category primitive.ObjectID   `bson:"category,omitempty" json:"category,omitempty"`
+	Tags     []primitive.ObjectID `bson:"tags,omitempty" json:"tags,omitempty"`
+	Payee    primitive.ObjectID   `bson:"payee,omitempty" json:"payee,omitempty"`
+	// Turns an expense or income into a transfer with this account on the
+	// other side, e.g. card payments recorded as spending.
+	TransferAccount primitive.ObjectID `bson:"transfer_account,omitempty" json:"transferAccount,omitempty"`
+}
+
+// Rules run by ascending priority. The first rule that sets a field wins,
+// tags add up.
+type Rule struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner          string             `bson:"owner" json:"owner"`
+	Name           string             `bson:"name" json:"name"`
+	Priority       int                `bson:"priority" json:"priority"`
+	Conditions     RuleConditions     `bson:"conditions" json:"conditions"`
+	Actions        RuleActions        `bson:"actions" json:"actions"`
+	Timezone       string             `bson:"timezone" json:"timezone"` // for weekday and time conditions
+	StopProcessing bool               `bson:"stop_processing" json:"stopProcessing"`
+	IsActive       bool               `bson:"is_active" json:"isActive"`
+	LastUpdate     time.Time          `bson:"last_update" json:"lastUpdate,omitempty"`
+	IsDeleted      bool               `bson:"is_deleted" json:"isDeleted"`
+}
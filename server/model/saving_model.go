@@ -5,15 +5,37 @@ import (
 	"time"
 )
 
+type Compounding string
+
+const (
+	CompoundDaily    Compounding = "daily"
+	CompoundMonthly  Compounding = "monthly"
+	CompoundMaturity Compounding = "maturity" // simple interest paid at maturity
+)
+
 type Saving struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-	Owner       string             `bson:"owner" json:"owner"`
-	Balance     float64            `bson:"balance" json:"balance"`
-	Icon        string             `bson:"icon" json:"icon"`
-	Name        string             `bson:"name" json:"name"`
-	Goal        float64            `bson:"goal,omitempty" json:"goal,omitempty"`
-	CreatedDate time.Time          `bson:"created_date" json:"createdDate"`
-	GoalDate    time.Time          `bson:"goal_date" json:"goalDate"`
-	LastUpdate  time.Time          `bson:"last_update" json:"lastUpdate,omitempty"`
-	IsDeleted   bool               `bson:"is_deleted" json:"isDeleted"`
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner   string             `bson:"owner" json:"owner"`
+	Balance float64            `bson:"balance" json:"balance"`
+	// Balance before the first recorded transaction, see service.ReconcileBalances.
+	OpeningBalance float64   `bson:"opening_balance,omitempty" json:"openingBalance,omitempty"`
+	Icon           string    `bson:"icon" json:"icon"`
+	Name           string    `bson:"name" json:"name"`
+	Goal           float64   `bson:"goal,omitempty" json:"goal,omitempty"`
+	CreatedDate    time.Time `bson:"created_date" json:"createdDate"`
+	GoalDate       time.Time `bson:"goal_date" json:"goalDate"`
+
+	// Interest, see service.AccrueSavingInterest. Rate is yearly, in percent.
+	Rate        float64     `bson:"rate" json:"rate"`
+	Compounding Compounding `bson:"compounding" json:"compounding,omitempty"`
+	TermMonths  int         `bson:"term_months" json:"termMonths,omitempty"` // 0 for an open-ended saving
+
+	TermStart        time.Time `bson:"term_start,omitempty" json:"termStart,omitempty"`
+	MaturityDate     time.Time `bson:"maturity_date,omitempty" json:"maturityDate,omitempty"`
+	LastAccrual      time.Time `bson:"last_accrual,omitempty" json:"lastAccrual,omitempty"`
+	NextAccrual      time.Time `bson:"next_accrual,omitempty" json:"nextAccrual,omitempty"` // for indexing
+	MaturityNotified bool      `bson:"maturity_notified,omitempty" json:"maturityNotified,omitempty"`
+
+	LastUpdate time.Time `bson:"last_update" json:"lastUpdate,omitempty"`
+	IsDeleted  bool      `bson:"is_deleted" json:"isDeleted"`
 }
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type StatementStatus string
+
+const (
+	StatementDue     StatementStatus = "due"
+	StatementPartial StatementStatus = "partial"
+	StatementPaid    StatementStatus = "paid"
+)
+
+// Statement is one closed billing cycle of a credit card account.
+type Statement struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner       string             `bson:"owner" json:"owner"`
+	Account     primitive.ObjectID `bson:"account" json:"account"`
+	PeriodStart time.Time          `bson:"period_start" json:"periodStart"`
+	PeriodEnd   time.Time          `bson:"period_end" json:"periodEnd"`
+	DueDate     time.Time          `bson:"due_date" json:"dueDate"`
+
+	// Money out of and into the card during the period.
+	Charges  float64 `bson:"charges" json:"charges"`
+	Payments float64 `bson:"payments" json:"payments"`
+	// Amount owed at PeriodEnd, positive.
+	Balance        float64 `bson:"balance" json:"balance"`
+	MinimumPayment float64 `bson:"minimum_payment" json:"minimumPayment"`
+
+	// Transfers into the card after PeriodEnd count towards the statement.
+	PaidAmount   float64            `bson:"paid_amount" json:"paidAmount"`
+	Status       StatementStatus    `bson:"status" json:"status"`
+	PaidAt       time.Time          `bson:"paid_at,omitempty" json:"paidAt,omitempty"`
+	Notification primitive.ObjectID `bson:"notification,omitempty" json:"notification,omitempty"`
+
+	LastUpdate time.Time `bson:"last_update" json:"lastUpdate,omitempty"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Transactions reference tags by id, so a rename never touches them.
+type Tag struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Owner      string             `bson:"owner" json:"owner"`
+	Name       string             `bson:"name" json:"name"`
+	Color      string             `bson:"color" json:"color"`
+	LastUpdate time.Time          `bson:"last_update" json:"lastUpdate,omitempty"`
+	IsDeleted  bool               `bson:"is_deleted" json:"isDeleted"`
+}
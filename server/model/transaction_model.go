@@ -5,17 +5,32 @@ import (
 	"time"
 )
 
-type Transaction struct {
-	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-	Creator            string             `bson:"creator" json:"creator"`
-	Amount             float64            `bson:"amount" json:"amount"`
-	DateTime           time.Time          `bson:"date_time" json:"dateTime"`
-	Type               string             `bson:"type" json:"type"`
-	SourceAccount      primitive.ObjectID `bson:"source_account,omitempty" json:"sourceAccount,omitempty"`
-	DestinationAccount primitive.ObjectID `bson:"destination_account,omitempty" json:"destinationAccount,omitempty"`
-	Category           primitive.ObjectID `bson:"category,omitempty" json:"category,omitempty"`
-	Note               string             `bson:"note" json:"note"`
-	LastUpdate         time.Time          `bson:"last_update" json:"lastUpdate,omitempty"`
-	IsDeleted          bool               `bson:"is_deleted" json:"isDeleted"`
+// Split is one line of a transaction spread over several categories.
+type Split struct {
+	Category primitive.ObjectID `bson:"category" json:"category"`
+	Amount   float64            `bson:"amount" json:"amount"`
+	Note     string             `bson:"note,omitempty" json:"note,omitempty"`
 }
 
+type Transaction struct {
+	ID                 primitive.ObjectID   `bson:"_id,omitempty" json:"_id,omitempty"`
+	Creator            string               `bson:"creator" json:"creator"`
+	Amount             float64              `bson:"amount" json:"amount"`
+	DateTime           time.Time            `bson:"date_time" json:"dateTime"`
+	ValueDate          time.Time            `bson:"value_date,omitempty" json:"valueDate,omitempty"` // when the bank moved the money, if it differs
+	Type               string               `bson:"type" json:"type"`
+	SourceAccount      primitive.ObjectID   `bson:"source_account,omitempty" json:"sourceAccount,omitempty"`
+	DestinationAccount primitive.ObjectID   `bson:"destination_account,omitempty" json:"destinationAccount,omitempty"`
+	Category           primitive.ObjectID   `bson:"category,omitempty" json:"category,omitempty"`
+	Splits             []Split              `bson:"splits,omitempty" json:"splits,omitempty"` // replaces Category, adds up to Amount
+	Tags               []primitive.ObjectID `bson:"tags,omitempty" json:"tags,omitempty"`
+	Payee              primitive.ObjectID   `bson:"payee,omitempty" json:"payee,omitempty"`
+	Note               string               `bson:"note" json:"note"`
+	ExternalID         string               `bson:"external_id,omitempty" json:"externalId,omitempty"` // the bank's own id, for re-imports
+	ImportBatch        primitive.ObjectID   `bson:"import_batch,omitempty" json:"importBatch,omitempty"`
+	MergedInto         primitive.ObjectID   `bson:"merged_into,omitempty" json:"mergedInto,omitempty"`       // the duplicate this was folded into
+	NotDuplicates      []primitive.ObjectID `bson:"not_duplicates,omitempty" json:"notDuplicates,omitempty"` // look-alikes the user kept apart
+	Attachments        []Attachment         `bson:"attachments,omitempty" json:"attachments,omitempty"`
+	LastUpdate         time.Time            `bson:"last_update" json:"lastUpdate,omitempty"`
+	IsDeleted          bool                 `bson:"is_deleted" json:"isDeleted"`
+}
@@ -0,0 +1,264 @@
+package parser
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Balance is an opening or closing balance a statement reports, signed the
+// way Row amounts are: negative is owed to the bank.
+type Balance struct {
+	Account string
+	Opening float64
+	Closing float64
+	// OpeningDate is the start of the first booking day, ClosingDate the end
+	// of the day the closing balance was taken.
+	OpeningDate time.Time
+	ClosingDate time.Time
+	Currency    string
+}
+
+// openingDate is the start of the earliest booking day among rows, or of the
+// closing day when the statement has no movements.
+func openingDate(rows []Row, closing time.Time) time.Time {
+	first := closing
+	for _, r := range rows {
+		if r.Err == "" && r.Date.Before(first) {
+			first = r.Date
+		}
+	}
+	return time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, first.Location())
+}
+
+// camt.053 from version 02 on. Tags are matched by local name so every
+// namespace version reads the same.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	IBAN     string        `xml:"Acct>Id>IBAN"`
+	Other    string        `xml:"Acct>Id>Othr>Id"`
+	Currency string        `xml:"Acct>Ccy"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      camtDate   `xml:"Dt"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtEntry struct {
+	Reference   string          `xml:"NtryRef"`
+	Amount      camtAmount      `xml:"Amt"`
+	Indicator   string          `xml:"CdtDbtInd"`
+	Reversal    bool            `xml:"RvslInd"`
+	BookingDate camtDate        `xml:"BookgDt"`
+	ValueDate   camtDate        `xml:"ValDt"`
+	ServicerRef string          `xml:"AcctSvcrRef"`
+	Details     []camtTxDetails `xml:"NtryDtls>TxDtls"`
+	Info        string          `xml:"AddtlNtryInf"`
+}
+
+type camtTxDetails struct {
+	ServicerRef string     `xml:"Refs>AcctSvcrRef"`
+	EndToEndID  string     `xml:"Refs>EndToEndId"`
+	Amount      camtAmount `xml:"Amt"`
+	TxAmount    camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	Indicator   string     `xml:"CdtDbtInd"`
+	Parties     struct {
+		Debtor          camtParty `xml:"Dbtr"`
+		DebtorIBAN      string    `xml:"DbtrAcct>Id>IBAN"`
+		DebtorOther     string    `xml:"DbtrAcct>Id>Othr>Id"`
+		Creditor        camtParty `xml:"Cdtr"`
+		CreditorIBAN    string    `xml:"CdtrAcct>Id>IBAN"`
+		CreditorOther   string    `xml:"CdtrAcct>Id>Othr>Id"`
+		UltimateDebtor  camtParty `xml:"UltmtDbtr"`
+		UltimateCredtor camtParty `xml:"UltmtCdtr"`
+	} `xml:"RltdPties"`
+	Unstructured []string `xml:"RmtInf>Ustrd"`
+	Structured   []string `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Info         string   `xml:"AddtlTxInf"`
+}
+
+// camtParty has the name directly up to version 07 and under Pty after.
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+func (p camtParty) name() string {
+	return firstNonEmpty(p.Name, p.PartyName)
+}
+
+func (d camtDate) time() (time.Time, error) {
+	if d.DateTime != "" {
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+			if t, err := time.Parse(layout, d.DateTime); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, errors.New("Invalid date `" + d.DateTime + "`")
+	}
+	t, err := time.Parse("2006-01-02", strings.TrimSpace(d.Date))
+	if err != nil {
+		return time.Time{}, errors.New("Invalid date `" + d.Date + "`")
+	}
+	return t, nil
+}
+
+func camtSigned(amount camtAmount, indicator string) (float64, error) {
+	value, err := ParseAmount(amount.Value, false)
+	if err != nil {
+		return 0, err
+	}
+	if indicator == "DBIT" {
+		value = -value
+	}
+	return value, nil
+}
+
+// ParseCamt053 reads an ISO 20022 bank to customer statement. Each entry
+// becomes a row, batch entries one row per transaction detail. Opening
+// (OPBD or PRCD) and closing (CLBD) balances are returned per statement.
+func ParseCamt053(text string) ([]Row, []Balance, error) {
+	var doc camtDocument
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	// DecodeText already made it UTF-8, whatever the prolog says
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Statements) == 0 {
+		return nil, nil, errors.New("not a camt.053 statement")
+	}
+
+	var rows []Row
+	var balances []Balance
+	for _, stmt := range doc.Statements {
+		account := firstNonEmpty(stmt.IBAN, stmt.Other)
+
+		balance := Balance{Account: account, Currency: stmt.Currency}
+		var hasOpening, hasClosing bool
+		for _, bal := range stmt.Balances {
+			amount, err := camtSigned(bal.Amount, bal.Indicator)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch bal.Code {
+			case "OPBD", "PRCD":
+				if !hasOpening {
+					balance.Opening, hasOpening = amount, true
+				}
+			case "CLBD":
+				date, err := bal.Date.time()
+				if err != nil {
+					return nil, nil, err
+				}
+				balance.Closing, hasClosing = amount, true
+				balance.ClosingDate = endOfDay(date, bal.Date.DateTime == "")
+			}
+		}
+		start := len(rows)
+		for _, entry := range stmt.Entries {
+			rows = append(rows, camtRows(entry, account, len(rows))...)
+		}
+
+		if hasOpening && hasClosing {
+			balance.OpeningDate = openingDate(rows[start:], balance.ClosingDate)
+			balances = append(balances, balance)
+		}
+	}
+
+	return rows, balances, nil
+}
+
+func camtRows(entry camtEntry, account string, n int) []Row {
+	base := Row{Account: account, Reference: entry.ServicerRef}
+	if base.Reference == "" {
+		base.Reference = entry.Reference
+	}
+
+	var err error
+	base.Date, err = entry.BookingDate.time()
+	if err == nil && (entry.ValueDate.Date != "" || entry.ValueDate.DateTime != "") {
+		base.ValueDate, err = entry.ValueDate.time()
+	}
+	if err == nil {
+		base.Amount, err = camtSigned(entry.Amount, entry.Indicator)
+	}
+	if err != nil {
+		base.Line, base.Err = n+1, err.Error()
+		return []Row{base}
+	}
+
+	if len(entry.Details) == 0 {
+		base.Line, base.Description = n+1, entry.Info
+		return []Row{base}
+	}
+
+	var rows []Row
+	for i, tx := range entry.Details {
+		row := base
+		row.Line = n + len(rows) + 1
+
+		// A batch splits the entry, a single detail shares its amount
+		if len(entry.Details) > 1 {
+			amount := firstNonEmpty(tx.Amount.Value, tx.TxAmount.Value)
+			indicator := firstNonEmpty(tx.Indicator, entry.Indicator)
+			if row.Amount, err = camtSigned(camtAmount{Value: amount}, indicator); err != nil || amount == "" {
+				row.Err = "Missing amount on detail " + strconv.Itoa(i+1)
+			}
+			if tx.ServicerRef != "" {
+				row.Reference = tx.ServicerRef
+			} else if base.Reference != "" {
+				row.Reference = base.Reference + "/" + strconv.Itoa(i+1)
+			}
+		} else if tx.ServicerRef != "" && row.Reference == "" {
+			row.Reference = tx.ServicerRef
+		}
+
+		// The other side: who paid us, or whom we paid
+		p := tx.Parties
+		if row.Amount >= 0 {
+			row.Payee = firstNonEmpty(p.UltimateDebtor.name(), p.Debtor.name())
+			row.CounterpartyIBAN = firstNonEmpty(p.DebtorIBAN, p.DebtorOther)
+		} else {
+			row.Payee = firstNonEmpty(p.UltimateCredtor.name(), p.Creditor.name())
+			row.CounterpartyIBAN = firstNonEmpty(p.CreditorIBAN, p.CreditorOther)
+		}
+
+		remittance := strings.Join(append(tx.Unstructured, tx.Structured...), " ")
+		row.Description = ofxDescription(row.Payee, firstNonEmpty(remittance, tx.Info, entry.Info))
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// endOfDay moves a plain date to the last instant of that day, when the
+// balance was taken.
+func endOfDay(t time.Time, dateOnly bool) time.Time {
+	if !dateOnly {
+		return t
+	}
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+}
@@ -0,0 +1,269 @@
+package parser
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"fintrack/server/model"
+)
+
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// DetectDelimiter picks the separator that splits the first lines into the
+// same number of fields most often.
+func DetectDelimiter(text string) rune {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+		if len(lines) == 20 {
+			break
+		}
+	}
+
+	best, bestScore, bestFields := ',', 0, 0
+	for _, d := range delimiters {
+		counts := map[int]int{}
+		for _, line := range lines {
+			if n := countOutsideQuotes(line, d); n > 0 {
+				counts[n]++
+			}
+		}
+		for fields, score := range counts {
+			if score > bestScore || (score == bestScore && fields > bestFields) {
+				best, bestScore, bestFields = d, score, fields
+			}
+		}
+	}
+	return best
+}
+
+func countOutsideQuotes(line string, d rune) int {
+	n, quoted := 0, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == d && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// ParseCSV reads decoded CSV text with the layout a profile describes.
+// Lines that cannot be read come back with Err set instead of failing the
+// whole file.
+func ParseCSV(text string, profile model.ImportProfile) ([]Row, error) {
+	delimiter := DetectDelimiter(text)
+	if profile.Delimiter != "" {
+		delimiter = []rune(profile.Delimiter)[0]
+		if profile.Delimiter == `\t` {
+			delimiter = '\t'
+		}
+	}
+
+	loc, err := time.LoadLocation(profile.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	for i := 0; i < profile.SkipRows; i++ {
+		if _, err := reader.Read(); err != nil {
+			return nil, fmt.Errorf("file ends before the %d rows to skip", profile.SkipRows)
+		}
+	}
+
+	var header []string
+	if profile.HasHeader {
+		if header, err = reader.Read(); err != nil {
+			return nil, errors.New("missing header row")
+		}
+	}
+
+	cols, err := resolveColumns(profile.Columns, header)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := DateLayout(profile.DateFormat)
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if blank(record) {
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := Row{
+			Line:        line,
+			Description: field(record, cols["description"]),
+			Payee:       field(record, cols["payee"]),
+			Reference:   field(record, cols["reference"]),
+		}
+
+		row.Date, err = parseDate(field(record, cols["date"]), layout, loc)
+		if err != nil {
+			row.Err = "Invalid date `" + field(record, cols["date"]) + "`"
+			rows = append(rows, row)
+			continue
+		}
+
+		if cols["amount"] >= 0 {
+			row.Amount, err = ParseAmount(field(record, cols["amount"]), profile.DecimalComma)
+		} else {
+			var debit, credit float64
+			debit, err = ParseAmount(field(record, cols["debit"]), profile.DecimalComma)
+			if err == nil {
+				credit, err = ParseAmount(field(record, cols["credit"]), profile.DecimalComma)
+			}
+			row.Amount = math.Abs(credit) - math.Abs(debit)
+		}
+		if err != nil {
+			row.Err = err.Error()
+			rows = append(rows, row)
+			continue
+		}
+		if profile.Sign == model.SignInverted {
+			row.Amount = -row.Amount
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// resolveColumns maps each mapped column to its index, -1 when unmapped.
+func resolveColumns(mapping model.ColumnMapping, header []string) (map[string]int, error) {
+	names := map[string]string{
+		"date":        mapping.Date,
+		"description": mapping.Description,
+		"amount":      mapping.Amount,
+		"debit":       mapping.Debit,
+		"credit":      mapping.Credit,
+		"payee":       mapping.Payee,
+		"reference":   mapping.Reference,
+	}
+
+	cols := map[string]int{}
+	for key, name := range names {
+		cols[key] = -1
+		if name == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(name); err == nil && n > 0 {
+			cols[key] = n - 1
+			continue
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(name)) {
+				cols[key] = i
+				break
+			}
+		}
+		if cols[key] < 0 {
+			return nil, fmt.Errorf("column %q not found", name)
+		}
+	}
+
+	if cols["date"] < 0 {
+		return nil, errors.New("the date column is not mapped")
+	}
+	if cols["amount"] < 0 && (cols["debit"] < 0 || cols["credit"] < 0) {
+		return nil, errors.New("map either an amount column or both debit and credit columns")
+	}
+	return cols, nil
+}
+
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func blank(record []string) bool {
+	for _, f := range record {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Layouts tried when a profile has no date format
+var dateLayouts = []string{
+	"2006-01-02", "2006-01-02 15:04:05", time.RFC3339,
+	"02/01/2006", "02/01/2006 15:04:05", "02-01-2006", "02.01.2006",
+}
+
+func parseDate(s, layout string, loc *time.Location) (time.Time, error) {
+	if layout != "" {
+		return time.ParseInLocation(layout, s, loc)
+	}
+	for _, l := range dateLayouts {
+		if t, err := time.ParseInLocation(l, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("unknown date format")
+}
+
+// ParseAmount reads amounts the way banks print them: currency symbols,
+// thousands separators, "(12.00)" or "12.00-" for negatives. An empty cell is
+// zero.
+func ParseAmount(s string, decimalComma bool) (float64, error) {
+	raw := s
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative, s = true, s[1:len(s)-1]
+	}
+	if strings.HasSuffix(s, "-") {
+		negative, s = true, strings.TrimSuffix(s, "-")
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-' && b.Len() == 0:
+			negative = !negative
+		case r == ',' && decimalComma, r == '.' && !decimalComma:
+			b.WriteRune('.')
+		}
+	}
+	if b.Len() == 0 {
+		return 0, nil
+	}
+
+	amount, err := strconv.ParseFloat(b.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid amount `%s`", raw)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"fintrack/server/model"
+)
+
+// Message is a bank SMS or e-wallet notification read by a template.
+type Message struct {
+	Row
+	Balance  *float64 // what the account holds after it, when the message tells
+	Template model.MessageTemplate
+}
+
+// BuiltinTemplates read the notifications of common Vietnamese banks and
+// wallets. A user's own templates are tried before them.
+var BuiltinTemplates = []model.MessageTemplate{
+	{
+		Name:       "Vietcombank balance change",
+		Provider:   "Vietcombank",
+		Pattern:    `(?i)SD TK (?P<account>\d+) (?P<sign>[+-])(?P<amount>[\d,]+) ?VND luc (?P<date>\d{2}-\d{2}-\d{4} \d{2}:\d{2}:\d{2})\.? SD (?P<balance>[\d,]+) ?VND\.? Ref (?P<description>(?P<reference>[A-Z0-9]+\.\d+(?:\.\d+)?)?.*)`,
+		DateFormat: "DD-MM-YYYY HH:mm:ss",
+		Timezone:   "Asia/Ho_Chi_Minh",
+	},
+	{
+		Name:     "Techcombank balance change",
+		Provider: "Techcombank",
+		Pattern:  `(?i)TK (?P<account>\S+) So tien GD: ?(?P<sign>[+-])(?P<amount>[\d,]+) So du: ?(?P<balance>[\d,]+) (?P<description>.*)`,
+		Timezone: "Asia/Ho_Chi_Minh",
+	},
+	{
+		Name:       "MB Bank balance change",
+		Provider:   "MB Bank",
+		Pattern:    `(?i)TK (?P<account>\S+)\|GD: ?(?P<sign>[+-])(?P<amount>[\d,]+) ?VND (?P<date>\d{2}/\d{2}/\d{2} \d{2}:\d{2}) ?\|SD: ?(?P<balance>[\d,]+) ?VND\|ND: ?(?P<description>.*)`,
+		DateFormat: "DD/MM/YY HH:mm",
+		Timezone:   "Asia/Ho_Chi_Minh",
+	},
+	{
+		Name:         "MoMo money received",
+		Provider:     "MoMo",
+		Pattern:      `(?i)nhận được (?:tiền )?(?P<amount>[\d.]+) ?(?:đ|VND) từ (?P<payee>[^.]+)\.(?: Lời nhắn: (?P<description>[^.]*)\.)?.*?Mã giao dịch: (?P<reference>\d+)`,
+		Direction:    model.DirectionIn,
+		DecimalComma: true,
+		Timezone:     "Asia/Ho_Chi_Minh",
+	},
+	{
+		Name:         "MoMo payment",
+		Provider:     "MoMo",
+		Pattern:      `(?i)(?:thanh toán thành công|chuyển tiền thành công) (?P<amount>[\d.]+) ?(?:đ|VND) (?:cho|tới|đến) (?P<payee>[^.]+)\..*?Mã giao dịch: (?P<reference>\d+)`,
+		Direction:    model.DirectionOut,
+		DecimalComma: true,
+		Timezone:     "Asia/Ho_Chi_Minh",
+	},
+	{
+		Name:         "ZaloPay payment",
+		Provider:     "ZaloPay",
+		Pattern:      `(?i)thanh to[aá]n th[aà]nh c[oô]ng (?P<amount>[\d.]+) ?(?:đ|d|VND) cho (?P<payee>[^.]+)\.(?: S[oố] d[uư](?: v[ií])?: (?P<balance>[\d.]+) ?(?:đ|d|VND)\.)? M[aã] GD: (?P<reference>\d+)`,
+		Direction:    model.DirectionOut,
+		DecimalComma: true,
+		Timezone:     "Asia/Ho_Chi_Minh",
+	},
+}
+
+var templateCache sync.Map // pattern -> *regexp.Regexp
+
+// CompileTemplate checks a template and compiles its pattern.
+func CompileTemplate(t model.MessageTemplate) (*regexp.Regexp, error) {
+	var re *regexp.Regexp
+	if cached, ok := templateCache.Load(t.Pattern); ok {
+		re = cached.(*regexp.Regexp)
+	} else {
+		compiled, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		templateCache.Store(t.Pattern, compiled)
+		re = compiled
+	}
+
+	if re.SubexpIndex("amount") < 0 {
+		return nil, errors.New("the pattern has no `amount` group")
+	}
+	if re.SubexpIndex("sign") < 0 && t.Direction == "" {
+		return nil, errors.New("the pattern has no `sign` group, set a direction")
+	}
+	if re.SubexpIndex("date") >= 0 && t.DateFormat == "" {
+		return nil, errors.New("the pattern has a `date` group, set a date format")
+	}
+	return re, nil
+}
+
+// ParseMessage reads text with the first template whose sender and pattern
+// match. Messages without a date of their own happen when received.
+func ParseMessage(templates []model.MessageTemplate, sender, text string, received time.Time) (Message, bool) {
+	// SMS wrap lines wherever they like
+	text = strings.Join(strings.Fields(text), " ")
+	for _, t := range templates {
+		if t.Sender != "" && !strings.Contains(strings.ToLower(sender), strings.ToLower(t.Sender)) {
+			continue
+		}
+		if msg, ok := readMessage(t, text, received); ok {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+func readMessage(t model.MessageTemplate, text string, received time.Time) (Message, bool) {
+	re, err := CompileTemplate(t)
+	if err != nil {
+		return Message{}, false
+	}
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return Message{}, false
+	}
+	group := func(name string) string {
+		if i := re.SubexpIndex(name); i >= 0 {
+			return strings.TrimSpace(m[i])
+		}
+		return ""
+	}
+
+	amount, err := ParseAmount(group("amount"), t.DecimalComma)
+	if err != nil || amount == 0 {
+		return Message{}, false
+	}
+	switch {
+	case group("sign") == "-":
+		amount = -math.Abs(amount)
+	case group("sign") == "+":
+		amount = math.Abs(amount)
+	case amount < 0:
+		// the amount carried its own sign
+	case t.Direction == model.DirectionOut:
+		amount = -amount
+	}
+
+	msg := Message{
+		Row: Row{
+			Date:        received,
+			Amount:      amount,
+			Description: group("description"),
+			Payee:       group("payee"),
+			Reference:   group("reference"),
+			Account:     group("account"),
+		},
+		Template: t,
+	}
+	if msg.Description == "" {
+		msg.Description = msg.Payee
+	}
+
+	if s := group("balance"); s != "" {
+		if balance, err := ParseAmount(s, t.DecimalComma); err == nil {
+			msg.Balance = &balance
+		}
+	}
+
+	if s := group("date"); s != "" {
+		loc, err := time.LoadLocation(t.Timezone)
+		if err != nil {
+			loc = received.Location()
+		}
+		if date, err := time.ParseInLocation(DateLayout(t.DateFormat), s, loc); err == nil {
+			msg.Date = date
+		}
+	}
+	return msg, true
+}
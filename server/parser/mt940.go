@@ -0,0 +1,254 @@
+package parser
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// :61: value date, optional entry date, mark, funds code, amount, type,
+// customer reference and optional //bank reference
+var mt940Line = regexp.MustCompile(`^(\d{6})(\d{4})?(C|D|RC|RD)[A-Z]?([\d,]+)([A-Z][A-Z0-9]{3})([^/]*?)(?://(.*))?$`)
+
+// :60F:, :62F: and their M variants: mark, date, currency, amount
+var mt940Balance = regexp.MustCompile(`^(C|D)(\d{6})([A-Z]{3})([\d,]+)`)
+
+// ParseMT940 reads SWIFT MT940 customer statements, with or without the
+// {1:}{2:}{4: block envelope. Each :61: line becomes a row, described by
+// the :86: that follows it. Structured :86: fields (the /NAME/IBAN/REMI/
+// codes of Dutch banks, the ?20-?33 subfields of German ones) fill in the
+// counterparty.
+func ParseMT940(text string) ([]Row, []Balance, error) {
+	fields := mt940Fields(text)
+	if len(fields) == 0 {
+		return nil, nil, errors.New("not an MT940 statement")
+	}
+
+	var (
+		rows     []Row
+		balances []Balance
+		account  string
+		balance  Balance
+		current  *Row
+		start    int // first row of the current statement
+	)
+
+	for _, f := range fields {
+		switch f.tag {
+		case "20":
+			account, balance, current, start = "", Balance{}, nil, len(rows)
+
+		case "25":
+			account = strings.TrimSpace(f.value)
+			balance.Account = account
+
+		case "60F", "60M":
+			amount, _, currency, err := mt940ParseBalance(f.value)
+			if err != nil {
+				return nil, nil, err
+			}
+			balance.Opening, balance.Currency = amount, currency
+
+		case "62F", "62M":
+			amount, date, _, err := mt940ParseBalance(f.value)
+			if err != nil {
+				return nil, nil, err
+			}
+			// Only the final closing balance of a statement counts
+			if f.tag == "62F" {
+				balance.Closing, balance.ClosingDate = amount, endOfDay(date, true)
+				balance.OpeningDate = openingDate(rows[start:], balance.ClosingDate)
+				balances = append(balances, balance)
+			}
+
+		case "61":
+			row := mt940Row(f.value)
+			row.Line, row.Account = f.line, account
+			rows = append(rows, row)
+			current = &rows[len(rows)-1]
+
+		case "86":
+			if current != nil {
+				mt940Details(current, f.value)
+				current = nil
+			}
+		}
+	}
+
+	return rows, balances, nil
+}
+
+type mt940Field struct {
+	tag   string
+	value string
+	line  int
+}
+
+var mt940Tag = regexp.MustCompile(`^:(\d{2}[A-Z]?):(.*)$`)
+
+// mt940Fields splits the text into tagged fields, continuation lines joined
+// with newlines.
+func mt940Fields(text string) []mt940Field {
+	if i := strings.Index(text, "{4:"); i >= 0 {
+		text = text[i+3:]
+	}
+
+	var fields []mt940Field
+	for n, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if m := mt940Tag.FindStringSubmatch(line); m != nil {
+			fields = append(fields, mt940Field{tag: m[1], value: m[2], line: n + 1})
+			continue
+		}
+		if line == "-" || line == "-}" || strings.HasPrefix(line, "-}") || strings.HasPrefix(line, "{") {
+			continue
+		}
+		if len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + line
+		}
+	}
+	return fields
+}
+
+func mt940ParseBalance(value string) (float64, time.Time, string, error) {
+	m := mt940Balance.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, time.Time{}, "", errors.New("Invalid balance `" + value + "`")
+	}
+	date, err := time.Parse("060102", m[2])
+	if err != nil {
+		return 0, time.Time{}, "", err
+	}
+	amount, err := ParseAmount(m[4], true)
+	if err != nil {
+		return 0, time.Time{}, "", err
+	}
+	if m[1] == "D" {
+		amount = -amount
+	}
+	return amount, date, m[3], nil
+}
+
+func mt940Row(value string) Row {
+	first, rest, _ := strings.Cut(value, "\n")
+	m := mt940Line.FindStringSubmatch(strings.TrimSpace(first))
+	if m == nil {
+		return Row{Err: "Invalid statement line `" + first + "`"}
+	}
+
+	row := Row{Description: strings.TrimSpace(rest)}
+	valueDate, err := time.Parse("060102", m[1])
+	if err != nil {
+		return Row{Err: "Invalid date `" + m[1] + "`"}
+	}
+	row.ValueDate, row.Date = valueDate, valueDate
+
+	// The entry date has no year, it may fall in the year around the value date
+	if m[2] != "" {
+		month, _ := strconv.Atoi(m[2][:2])
+		day, _ := strconv.Atoi(m[2][2:])
+		booked := time.Date(valueDate.Year(), time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if booked.Sub(valueDate) > 180*24*time.Hour {
+			booked = booked.AddDate(-1, 0, 0)
+		} else if valueDate.Sub(booked) > 180*24*time.Hour {
+			booked = booked.AddDate(1, 0, 0)
+		}
+		row.Date = booked
+	}
+
+	row.Amount, err = ParseAmount(m[4], true)
+	if err != nil {
+		row.Err = err.Error()
+	}
+	// RC and RD reverse a credit or debit
+	if m[3] == "D" || m[3] == "RC" {
+		row.Amount = -row.Amount
+	}
+
+	if ref := strings.TrimSpace(m[7]); ref != "" {
+		row.Reference = ref
+	} else if ref := strings.TrimSpace(m[6]); ref != "" && ref != "NONREF" {
+		row.Reference = ref
+	}
+	return row
+}
+
+// mt940Details reads the :86: information to the account owner.
+func mt940Details(row *Row, value string) {
+	info := strings.ReplaceAll(value, "\n", "")
+
+	switch {
+	case strings.HasPrefix(info, "/"):
+		codes := mt940SlashCodes(info)
+		row.Payee = codes["NAME"]
+		row.CounterpartyIBAN = codes["IBAN"]
+		if cntp := codes["CNTP"]; cntp != "" {
+			// CNTP/account/bic/name/city
+			parts := strings.Split(cntp, "/")
+			if len(parts) > 0 && row.CounterpartyIBAN == "" {
+				row.CounterpartyIBAN = parts[0]
+			}
+			if len(parts) > 2 && row.Payee == "" {
+				row.Payee = parts[2]
+			}
+		}
+		remittance := strings.TrimPrefix(codes["REMI"], "USTD//")
+		row.Description = ofxDescription(row.Payee, firstNonEmpty(remittance, row.Description))
+
+	case len(info) > 4 && info[3] == '?':
+		sub := map[string]string{}
+		for _, part := range strings.Split(info[3:], "?")[1:] {
+			if len(part) >= 2 {
+				sub[part[:2]] += part[2:]
+			}
+		}
+		var remittance []string
+		for i := 20; i <= 29; i++ {
+			if v := sub[strconv.Itoa(i)]; v != "" {
+				remittance = append(remittance, v)
+			}
+		}
+		for i := 60; i <= 63; i++ {
+			if v := sub[strconv.Itoa(i)]; v != "" {
+				remittance = append(remittance, v)
+			}
+		}
+		row.Payee = strings.TrimSpace(sub["32"] + sub["33"])
+		row.CounterpartyIBAN = sub["31"]
+		row.Description = ofxDescription(row.Payee, strings.Join(remittance, ""))
+
+	default:
+		row.Description = ofxDescription(row.Description, strings.TrimSpace(strings.ReplaceAll(value, "\n", " ")))
+	}
+}
+
+// mt940SlashCodes splits "/TRTP/SEPA/NAME/ACME/REMI/x" into codes. Only
+// known codes start a new field, so slashes inside values survive.
+func mt940SlashCodes(info string) map[string]string {
+	known := map[string]bool{
+		"TRTP": true, "IBAN": true, "BIC": true, "NAME": true, "REMI": true, "EREF": true,
+		"MARF": true, "CSID": true, "CNTP": true, "ORDP": true, "BENM": true, "ADDR": true,
+		"ISDT": true, "RTRN": true, "PREF": true, "SVCL": true,
+	}
+
+	values := map[string][]string{}
+	key := ""
+	for _, part := range strings.Split(strings.TrimPrefix(info, "/"), "/") {
+		if known[part] {
+			key = part
+			values[key] = nil
+			continue
+		}
+		if key != "" {
+			values[key] = append(values[key], part)
+		}
+	}
+
+	codes := map[string]string{}
+	for k, v := range values {
+		codes[k] = strings.TrimSpace(strings.Trim(strings.Join(v, "/"), "/"))
+	}
+	return codes
+}
@@ -0,0 +1,220 @@
+package parser
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ofxNode is an OFX element: aggregates have children, leaves a value.
+type ofxNode struct {
+	name     string
+	value    string
+	children []*ofxNode
+}
+
+func (n *ofxNode) child(name string) *ofxNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// get follows a path of child names and returns the leaf's value.
+func (n *ofxNode) get(path ...string) string {
+	for _, name := range path {
+		if n = n.child(name); n == nil {
+			return ""
+		}
+	}
+	return n.value
+}
+
+// walk calls fn for n and every element below it, parents first.
+func (n *ofxNode) walk(fn func(n *ofxNode, parents []*ofxNode)) {
+	var visit func(n *ofxNode, parents []*ofxNode)
+	visit = func(n *ofxNode, parents []*ofxNode) {
+		fn(n, parents)
+		parents = append(parents, n)
+		for _, c := range n.children {
+			visit(c, parents)
+		}
+	}
+	visit(n, nil)
+}
+
+var ofxTag = regexp.MustCompile(`<(/?)([A-Za-z0-9_.]+)[^>]*>([^<]*)`)
+
+// parseOFXTree reads both OFX 1.x (SGML, leaves are not closed) and 2.x
+// (XML). Unbalanced closing tags are tolerated.
+func parseOFXTree(text string) (*ofxNode, error) {
+	start := strings.Index(strings.ToUpper(text), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("not an OFX file")
+	}
+
+	root := &ofxNode{name: "ROOT"}
+	stack := []*ofxNode{root}
+	for _, m := range ofxTag.FindAllStringSubmatch(text[start:], -1) {
+		closing, name, value := m[1] == "/", strings.ToUpper(m[2]), strings.TrimSpace(m[3])
+		top := stack[len(stack)-1]
+
+		if closing {
+			// XML closes leaves too, those are not on the stack
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+			continue
+		}
+
+		node := &ofxNode{name: name, value: unescapeOFX(value)}
+		top.children = append(top.children, node)
+		if value == "" {
+			stack = append(stack, node)
+		}
+	}
+	return root, nil
+}
+
+func unescapeOFX(s string) string {
+	return strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&nbsp;", " ").Replace(s)
+}
+
+var ofxDate = regexp.MustCompile(`^(\d{8})(\d{6})?(?:\.\d+)?(?:\[([+-]?\d+(?:\.\d+)?)(?::[A-Za-z]+)?\])?`)
+
+// parseOFXDate reads YYYYMMDD[HHMMSS[.XXX]][[offset:TZ]], GMT when no offset
+// is given.
+func parseOFXDate(s string) (time.Time, error) {
+	m := ofxDate.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return time.Time{}, errors.New("Invalid date `" + s + "`")
+	}
+	layout, value := "20060102", m[1]
+	if m[2] != "" {
+		layout, value = layout+"150405", value+m[2]
+	}
+
+	loc := time.UTC
+	if m[3] != "" {
+		hours, _ := strconv.ParseFloat(m[3], 64)
+		loc = time.FixedZone("", int(hours*3600))
+	}
+	return time.ParseInLocation(layout, value, loc)
+}
+
+// Investment transactions that move cash, and the aggregate holding it
+var ofxTrades = map[string]bool{
+	"BUYDEBT": true, "BUYMF": true, "BUYOPT": true, "BUYOTHER": true, "BUYSTOCK": true,
+	"SELLDEBT": true, "SELLMF": true, "SELLOPT": true, "SELLOTHER": true, "SELLSTOCK": true,
+	"INCOME": true, "INVEXPENSE": true, "RETOFCAP": true,
+}
+
+// ParseOFX reads bank, credit card and investment statements from an OFX or
+// QFX file. Rows carry the FITID as Reference and the statement's ACCTID as
+// Account. Investment trades are reduced to their cash effect.
+func ParseOFX(text string) ([]Row, error) {
+	root, err := parseOFXTree(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	root.walk(func(n *ofxNode, parents []*ofxNode) {
+		var row Row
+		switch {
+		case n.name == "STMTTRN":
+			row = Row{
+				Reference:   n.get("FITID"),
+				Description: ofxDescription(n.get("NAME"), n.get("PAYEE", "NAME"), n.get("MEMO")),
+				Payee:       firstNonEmpty(n.get("NAME"), n.get("PAYEE", "NAME")),
+			}
+			row.Date, err = parseOFXDate(n.get("DTPOSTED"))
+			if err == nil {
+				row.Amount, err = ParseAmount(n.get("TRNAMT"), strings.Contains(n.get("TRNAMT"), ","))
+			}
+
+		case ofxTrades[n.name]:
+			inv := n
+			if n.child("INVBUY") != nil {
+				inv = n.child("INVBUY")
+			} else if n.child("INVSELL") != nil {
+				inv = n.child("INVSELL")
+			}
+			row = Row{
+				Reference:   inv.get("INVTRAN", "FITID"),
+				Description: ofxDescription(strings.ToLower(n.name), inv.get("SECID", "UNIQUEID"), inv.get("INVTRAN", "MEMO")),
+			}
+			date := inv.get("INVTRAN", "DTSETTLE")
+			if date == "" {
+				date = inv.get("INVTRAN", "DTTRADE")
+			}
+			row.Date, err = parseOFXDate(date)
+			if err == nil {
+				row.Amount, err = ParseAmount(firstNonEmpty(inv.get("TOTAL"), n.get("TOTAL")), false)
+			}
+
+		default:
+			return
+		}
+
+		if err != nil {
+			row.Err = err.Error()
+			err = nil
+		}
+		row.Account = ofxAccount(parents)
+		row.Line = len(rows) + 1
+		rows = append(rows, row)
+	})
+
+	if len(rows) == 0 && root.child("OFX") == nil {
+		return nil, errors.New("not an OFX file")
+	}
+	return rows, nil
+}
+
+// ofxAccount finds the ACCTID of the statement a transaction belongs to.
+func ofxAccount(parents []*ofxNode) string {
+	for i := len(parents) - 1; i >= 0; i-- {
+		for _, from := range []string{"BANKACCTFROM", "CCACCTFROM", "INVACCTFROM"} {
+			if id := parents[i].get(from, "ACCTID"); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+func ofxDescription(parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" && !containsFold(out, p) {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, " - ")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
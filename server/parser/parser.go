@@ -0,0 +1,89 @@
+// Package parser reads bank exports into rows the import pipeline turns into
+// transactions.
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Row is one statement line. Amount is signed from the account's point of
+// view: negative is money out.
+type Row struct {
+	Line             int
+	Date             time.Time // booking date
+	ValueDate        time.Time // when the money moved, if the bank tells
+	Amount           float64
+	Description      string
+	Payee            string
+	CounterpartyIBAN string
+	Reference        string // the bank's transaction id, when it has one
+	Account          string // the bank's account id or name, for multi-account files
+	Err              string // set when the line could not be read
+}
+
+// Encodings a profile can ask for.
+var encodings = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8,
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"windows-1252": charmap.Windows1252,
+	"windows-1258": charmap.Windows1258,
+}
+
+func IsEncoding(name string) bool {
+	_, ok := encodings[strings.ToLower(name)]
+	return ok
+}
+
+// DecodeText turns an uploaded file into text. An empty name detects the
+// encoding from the byte order mark, then UTF-8 validity, and falls back to
+// Windows-1252. It returns the encoding it used.
+func DecodeText(data []byte, name string) (string, string, error) {
+	name = strings.ToLower(name)
+	if name == "" {
+		switch {
+		case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+			name, data = "utf-8", data[3:]
+		case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+			name, data = "utf-16le", data[2:]
+		case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+			name, data = "utf-16be", data[2:]
+		case utf8.Valid(data):
+			name = "utf-8"
+		default:
+			name = "windows-1252"
+		}
+	}
+
+	enc, ok := encodings[name]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported encoding %q", name)
+	}
+	if name == "utf-8" {
+		return string(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})), name, nil
+	}
+
+	text, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", "", fmt.Errorf("decoding %s: %w", name, err)
+	}
+	return string(text), name, nil
+}
+
+// DateLayout turns a format like DD/MM/YYYY HH:mm into a Go layout. Go
+// layouts are passed through.
+func DateLayout(format string) string {
+	return strings.NewReplacer(
+		"YYYY", "2006", "YY", "06",
+		"MM", "01", "DD", "02",
+		"HH", "15", "mm", "04", "ss", "05",
+	).Replace(format)
+}
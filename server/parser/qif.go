@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"time"
+)
+
+// QIF has no standard date format, US exports are month first and may use
+// an apostrophe before two digit years after 2000.
+var qifDateLayouts = []string{
+	"1/2/2006", "1/2/06", "1/2'06", "1/2'2006", "2006-01-02", "1-2-2006", "1.2.2006",
+}
+
+// Investment actions and which way their total moves cash
+var qifInvestmentCash = map[string]float64{
+	"buy": -1, "buyx": -1, "sell": 1, "sellx": 1,
+	"div": 1, "divx": 1, "intinc": 1, "intincx": 1,
+	"cglong": 1, "cglongx": 1, "cgshort": 1, "cgshortx": 1, "cgmid": 1, "cgmidx": 1,
+	"miscinc": 1, "miscincx": 1, "rtrncap": 1, "rtrncapx": 1,
+	"miscexp": -1, "miscexpx": -1, "margint": -1, "margintx": -1,
+	"xin": 1, "xout": -1, "contribx": 1, "withdrwx": -1,
+}
+
+// ParseQIF reads Bank, Cash, CCard, Oth A/L and Invst sections of a QIF
+// file. dateFormat, like the CSV one, overrides the date guessing. Account
+// names from !Account blocks end up in Row.Account. Investment entries
+// without cash effect (reinvestments, share moves) are left out.
+func ParseQIF(text, dateFormat string, decimalComma bool) ([]Row, error) {
+	layouts := qifDateLayouts
+	if dateFormat != "" {
+		layouts = []string{DateLayout(dateFormat)}
+	}
+
+	var (
+		rows        []Row
+		section     string
+		account     string
+		inAccount   bool
+		row         Row
+		action      string
+		security    string
+		memo        string
+		started     bool
+		hasSections bool
+	)
+
+	reset := func(line int) {
+		row, action, security, memo, started = Row{Line: line}, "", "", "", false
+	}
+
+	flush := func() {
+		defer reset(0)
+		if !started || inAccount {
+			return
+		}
+
+		row.Account = account
+		if section == "invst" {
+			sign, ok := qifInvestmentCash[strings.ToLower(action)]
+			if !ok {
+				return
+			}
+			row.Amount = sign * abs(row.Amount)
+			row.Description = ofxDescription(action, security, row.Payee, memo)
+		} else {
+			row.Description = ofxDescription(row.Payee, memo)
+		}
+		rows = append(rows, row)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	lineNo := 0
+	reset(1)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "!") {
+			flush()
+			header := strings.ToLower(strings.TrimSpace(line))
+			switch {
+			case header == "!account":
+				inAccount = true
+			case strings.HasPrefix(header, "!type:"):
+				inAccount = false
+				hasSections = true
+				section = strings.TrimSpace(strings.TrimPrefix(header, "!type:"))
+			case strings.HasPrefix(header, "!option") || strings.HasPrefix(header, "!clear"):
+			default:
+				inAccount = false
+				section = ""
+			}
+			continue
+		}
+
+		code, value := line[0], strings.TrimSpace(line[1:])
+		if code == '^' {
+			flush()
+			continue
+		}
+		if !started {
+			row.Line = lineNo
+			started = true
+		}
+
+		if inAccount {
+			if code == 'N' {
+				account = value
+			}
+			continue
+		}
+		if section != "bank" && section != "cash" && section != "ccard" &&
+			section != "oth a" && section != "oth l" && section != "invst" {
+			continue
+		}
+
+		switch code {
+		case 'D':
+			t, err := parseQIFDate(value, layouts)
+			if err != nil && row.Err == "" {
+				row.Err = err.Error()
+			}
+			row.Date = t
+		case 'T', 'U':
+			if code == 'U' && row.Amount != 0 {
+				break
+			}
+			amount, err := ParseAmount(value, decimalComma)
+			if err != nil && row.Err == "" {
+				row.Err = err.Error()
+			}
+			row.Amount = amount
+		case 'P':
+			row.Payee = value
+		case 'M':
+			memo = value
+		case 'N':
+			// Check numbers and "ATM" style codes are no ids to dedup on
+			if section == "invst" {
+				action = value
+			}
+		case 'Y':
+			security = value
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !hasSections {
+		return nil, errors.New("not a QIF file")
+	}
+	return rows, nil
+}
+
+func parseQIFDate(s string, layouts []string) (time.Time, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("Invalid date `" + s + "`")
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,157 @@
+package quickadd
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Multipliers, written after the number or as the next word
+var units = map[string]float64{
+	"k": 1e3, "nghin": 1e3, "ngan": 1e3, "ng": 1e3, "thousand": 1e3,
+	"tr": 1e6, "trieu": 1e6, "cu": 1e6, "m": 1e6, "mil": 1e6, "million": 1e6,
+	"ty": 1e9, "ti": 1e9, "b": 1e9, "bn": 1e9, "billion": 1e9,
+}
+
+// Currency marks and the currency they name
+var currencies = map[string]string{
+	"d": "VND", "đ": "VND", "₫": "VND", "vnd": "VND", "dong": "VND", "$": "USD", "usd": "USD",
+}
+
+var (
+	// 45k, 45.000đ, 1,5tr, $12
+	amountToken = regexp.MustCompile(`^[$₫]?(\d[\d.,]*)([\p{L}₫$]*)$`)
+	// 1tr5 is 1.5 million, 2k5 is 2500
+	compactAmount = regexp.MustCompile(`^(\d+)(k|tr|m|ty|b)(\d{1,3})$`)
+)
+
+// parseNumber reads digits with thousands separators or a decimal mark in
+// either convention: a separator followed by three digits groups
+// thousands, unless both marks appear, then the last one is decimal.
+func parseNumber(s string) (float64, bool) {
+	s = strings.TrimRight(s, ".,")
+	dots, commas := strings.Count(s, "."), strings.Count(s, ",")
+	last := strings.LastIndexAny(s, ".,")
+
+	switch {
+	case last < 0:
+	case dots > 0 && commas > 0:
+		decimal := s[last]
+		s = strings.Map(func(r rune) rune {
+			if r == '.' || r == ',' {
+				if byte(r) == decimal {
+					return '.'
+				}
+				return -1
+			}
+			return r
+		}, s)
+		if strings.Count(s, ".") > 1 {
+			return 0, false
+		}
+	case dots+commas > 1 || len(s)-last-1 == 3:
+		s = strings.NewReplacer(".", "", ",", "").Replace(s)
+	default:
+		s = strings.Replace(s, ",", ".", 1)
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
+
+type amountMatch struct {
+	value      float64
+	confidence float64
+	tokens     []int
+}
+
+// findAmount picks the amount among the unused tokens: one with a unit or
+// currency beats a bare number. In VND a bare number under 1000 is read as
+// thousands, as people say "cà phê 45". An amount marked in another currency
+// than the user's is kept as written but left uncertain, nothing converts it.
+func (s *scan) findAmount(currency string) (amountMatch, bool) {
+	var best amountMatch
+	found := false
+	for i := range s.tokens {
+		m, ok := s.amountAt(i, currency)
+		if ok && (!found || m.confidence > best.confidence) {
+			best, found = m, true
+		}
+	}
+	return best, found
+}
+
+func (s *scan) amountAt(i int, currency string) (amountMatch, bool) {
+	t := s.tokens[i]
+	if t.used {
+		return amountMatch{}, false
+	}
+
+	if m := compactAmount.FindStringSubmatch(t.lower); m != nil {
+		whole, _ := strconv.ParseFloat(m[1], 64)
+		frac, _ := strconv.ParseFloat(m[3], 64)
+		value := (whole + frac/math.Pow(10, float64(len(m[3])))) * units[m[2]]
+		return amountMatch{value: value, confidence: 1, tokens: []int{i}}, true
+	}
+
+	m := amountToken.FindStringSubmatch(t.lower)
+	if m == nil {
+		return amountMatch{}, false
+	}
+	value, ok := parseNumber(m[1])
+	if !ok || value <= 0 {
+		return amountMatch{}, false
+	}
+	suffix := m[2]
+	written := currencies[t.lower[:strings.IndexAny(t.lower, "0123456789")]]
+	marked := written != ""
+	tokens := []int{i}
+
+	if suffix == "" {
+		// the unit or currency may be the next word
+		if next := s.next(i); next >= 0 {
+			word := s.tokens[next].norm
+			if _, ok := units[word]; ok {
+				suffix = word
+				tokens = append(tokens, next)
+			} else if code := currencyOf(s.tokens[next].lower, word); code != "" {
+				written, marked = code, true
+				tokens = append(tokens, next)
+			}
+		}
+	}
+
+	switch {
+	case suffix == "":
+	case units[normalizeWord(suffix)] > 0:
+		value *= units[normalizeWord(suffix)]
+		marked = true
+	case currencyOf(suffix, normalizeWord(suffix)) != "":
+		written, marked = currencyOf(suffix, normalizeWord(suffix)), true
+	default:
+		// 8h, 3rd, 2x: not an amount
+		return amountMatch{}, false
+	}
+
+	value = math.Round(value*100) / 100
+	switch {
+	case written != "" && written != currency:
+		return amountMatch{value: value, confidence: 0.5, tokens: tokens}, true
+	case marked:
+		return amountMatch{value: value, confidence: 1, tokens: tokens}, true
+	case value < 1000 && currency == "VND":
+		return amountMatch{value: value * 1000, confidence: 0.5, tokens: tokens}, true
+	default:
+		return amountMatch{value: value, confidence: 0.85, tokens: tokens}, true
+	}
+}
+
+func currencyOf(words ...string) string {
+	for _, w := range words {
+		if code := currencies[w]; code != "" {
+			return code
+		}
+	}
+	return ""
+}
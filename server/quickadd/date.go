@@ -0,0 +1,242 @@
+package quickadd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Days before today, by phrase
+var relativeDays = []struct {
+	phrase string
+	days   int
+}{
+	{"hom nay", 0}, {"sang nay", 0}, {"trua nay", 0}, {"chieu nay", 0}, {"toi nay", 0}, {"today", 0}, {"tonight", 0},
+	{"hom qua", 1}, {"toi qua", 1}, {"dem qua", 1}, {"sang qua", 1}, {"yesterday", 1}, {"last night", 1},
+	{"hom kia", 2}, {"day before yesterday", 2},
+}
+
+var weekdays = map[string]time.Weekday{
+	"chu nhat": time.Sunday, "cn": time.Sunday, "sunday": time.Sunday,
+	"thu 2": time.Monday, "thu hai": time.Monday, "t2": time.Monday, "monday": time.Monday, "mon": time.Monday,
+	"thu 3": time.Tuesday, "thu ba": time.Tuesday, "t3": time.Tuesday, "tuesday": time.Tuesday, "tue": time.Tuesday,
+	"thu 4": time.Wednesday, "thu tu": time.Wednesday, "t4": time.Wednesday, "wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thu 5": time.Thursday, "thu nam": time.Thursday, "t5": time.Thursday, "thursday": time.Thursday,
+	"thu 6": time.Friday, "thu sau": time.Friday, "t6": time.Friday, "friday": time.Friday, "fri": time.Friday,
+	"thu 7": time.Saturday, "thu bay": time.Saturday, "t7": time.Saturday, "saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var (
+	// 12/5, 12-05-2024
+	dayMonth = regexp.MustCompile(`^(\d{1,2})[/-](\d{1,2})(?:[/-](\d{2}|\d{4}))?$`)
+	isoDate  = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+	// 8h, 8h30, 20:15, 8pm, 8:30am
+	clockTime = regexp.MustCompile(`^(\d{1,2})(?:h(\d{2})?|:(\d{2})(am|pm)?|(am|pm))$`)
+)
+
+type dateMatch struct {
+	day        time.Time // midnight
+	confidence float64
+}
+
+// findDate reads the date and time of day from the unused tokens. Without
+// one the transaction happens now.
+func (s *scan) findDate(now time.Time) (time.Time, float64) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	date, dated := s.findDay(today)
+
+	clock, timed := s.findClock()
+	switch {
+	case timed && dated:
+		return date.day.Add(clock), date.confidence
+	case timed:
+		return today.Add(clock), 0.9
+	case dated:
+		// keep the clock of now so the day sorts naturally
+		return date.day.Add(now.Sub(today)), date.confidence
+	default:
+		return now, 0.75
+	}
+}
+
+func (s *scan) findDay(today time.Time) (dateMatch, bool) {
+	for i := range s.tokens {
+		if s.tokens[i].used {
+			continue
+		}
+
+		for _, r := range relativeDays {
+			if n := s.phraseAt(i, r.phrase); n > 0 {
+				s.use(i, n)
+				return dateMatch{today.AddDate(0, 0, -r.days), 1}, true
+			}
+		}
+
+		// N ngày trước, N days ago
+		if n, err := strconv.Atoi(s.tokens[i].norm); err == nil && n < 400 {
+			for _, suffix := range []string{"ngay truoc", "hom truoc", "days ago", "day ago"} {
+				if k := s.phraseAt(s.next(i), suffix); k > 0 {
+					s.use(i, 1)
+					s.use(s.next(i), k)
+					return dateMatch{today.AddDate(0, 0, -n), 1}, true
+				}
+			}
+		}
+
+		for _, phrase := range []string{"tuan truoc", "last week"} {
+			if n := s.phraseAt(i, phrase); n > 0 {
+				s.use(i, n)
+				return dateMatch{today.AddDate(0, 0, -7), 0.6}, true
+			}
+		}
+
+		// the most recent such day, "last monday" the one before
+		for phrase, weekday := range weekdays {
+			n := s.phraseAt(i, phrase)
+			if n == 0 {
+				continue
+			}
+			back := (int(today.Weekday()) - int(weekday) + 7) % 7
+			if prev := s.prev(i); prev >= 0 && s.tokens[prev].norm == "last" {
+				s.use(prev, 1)
+				if back == 0 {
+					back = 7
+				}
+			}
+			s.use(i, n)
+			if next := s.phraseAt(s.next(i), "tuan truoc"); next > 0 {
+				s.use(s.next(i), next)
+				back += 7
+			}
+			return dateMatch{today.AddDate(0, 0, -back), 0.8}, true
+		}
+
+		if m, ok := s.explicitDate(i, today); ok {
+			return m, true
+		}
+	}
+	return dateMatch{}, false
+}
+
+// explicitDate reads 12/5, 2024-05-12 and "ngày 12".
+func (s *scan) explicitDate(i int, today time.Time) (dateMatch, bool) {
+	t := s.tokens[i]
+	if m := isoDate.FindStringSubmatch(t.lower); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		if day, ok := validDate(y, mo, d, today.Location()); ok {
+			s.use(i, 1)
+			return dateMatch{day, 1}, true
+		}
+	}
+
+	if m := dayMonth.FindStringSubmatch(t.lower); m != nil {
+		a, _ := strconv.Atoi(m[1])
+		b, _ := strconv.Atoi(m[2])
+		// day first in Vietnamese, month first in English unless it cannot be
+		confidence := 1.0
+		d, mo := a, b
+		if !s.vietnamese {
+			switch {
+			case a > 12:
+			case b > 12:
+				d, mo = b, a
+			default:
+				d, mo = b, a
+				confidence = 0.6
+			}
+		}
+		year, yearSaid := today.Year(), m[3] != ""
+		if yearSaid {
+			year, _ = strconv.Atoi(m[3])
+			if year < 100 {
+				year += 2000
+			}
+		}
+		day, ok := validDate(year, mo, d, today.Location())
+		if ok && !yearSaid && day.After(today) {
+			day = day.AddDate(-1, 0, 0)
+		}
+		if ok {
+			s.use(i, 1)
+			if prev := s.prev(i); prev >= 0 && (s.tokens[prev].norm == "ngay" || s.tokens[prev].norm == "on") {
+				s.use(prev, 1)
+			}
+			return dateMatch{day, confidence}, true
+		}
+	}
+
+	// ngày 12: this month, or the last one when the 12th is still ahead
+	if t.norm == "ngay" || t.norm == "on" {
+		next := s.next(i)
+		if next < 0 {
+			return dateMatch{}, false
+		}
+		word := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(s.tokens[next].norm, "th"), "st"), "nd"), "rd")
+		d, err := strconv.Atoi(word)
+		if err != nil {
+			return dateMatch{}, false
+		}
+		day, ok := validDate(today.Year(), int(today.Month()), d, today.Location())
+		if ok && day.After(today) {
+			last := today.AddDate(0, 0, -today.Day())
+			day, ok = validDate(last.Year(), int(last.Month()), d, today.Location())
+		}
+		if ok {
+			s.use(i, 1)
+			s.use(next, 1)
+			return dateMatch{day, 0.9}, true
+		}
+	}
+	return dateMatch{}, false
+}
+
+func validDate(y, m, d int, loc *time.Location) (time.Time, bool) {
+	if m < 1 || m > 12 || d < 1 || d > 31 {
+		return time.Time{}, false
+	}
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, loc)
+	// time.Date normalizes the 31st of a short month into the next
+	return t, t.Day() == d
+}
+
+// findClock reads a time of day.
+func (s *scan) findClock() (time.Duration, bool) {
+	for i, t := range s.tokens {
+		if t.used {
+			continue
+		}
+		m := clockTime.FindStringSubmatch(t.lower)
+		if m == nil {
+			continue
+		}
+		h, _ := strconv.Atoi(m[1])
+		min := 0
+		if m[2] != "" {
+			min, _ = strconv.Atoi(m[2])
+		} else if m[3] != "" {
+			min, _ = strconv.Atoi(m[3])
+		}
+		switch m[4] + m[5] {
+		case "pm":
+			if h < 12 {
+				h += 12
+			}
+		case "am":
+			if h == 12 {
+				h = 0
+			}
+		}
+		if h > 23 || min > 59 {
+			continue
+		}
+		s.use(i, 1)
+		if prev := s.prev(i); prev >= 0 && (s.tokens[prev].norm == "luc" || s.tokens[prev].norm == "at") {
+			s.use(prev, 1)
+		}
+		return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute, true
+	}
+	return 0, false
+}
@@ -0,0 +1,70 @@
+// Package quickadd turns a short phrase, typed or dictated, into a proposed
+// transaction: "cà phê 45k tiền mặt hôm qua", "salary 25tr to VCB". Nothing
+// is saved, the client shows the proposal and the user confirms it.
+package quickadd
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"fintrack/server/model"
+)
+
+// Parser reads a phrase against the user's data. RuleParser is the
+// deterministic one, a model-backed parser can replace it.
+type Parser interface {
+	Parse(ctx context.Context, text string, vocab Vocabulary) (Proposal, error)
+}
+
+// Vocabulary is what a phrase is matched against.
+type Vocabulary struct {
+	Accounts   []model.Account
+	Savings    []model.Saving
+	Categories []model.Category
+	Payees     []model.Payee
+	Now        time.Time // in the user's timezone, relative dates count from it
+	Currency   string    // ISO code amounts are in, VND when empty
+}
+
+// Fields a proposal rates
+const (
+	FieldAmount      = "amount"
+	FieldType        = "type"
+	FieldDate        = "date"
+	FieldAccount     = "account"
+	FieldDestination = "destination" // the receiving account of a transfer
+	FieldCategory    = "category"
+	FieldPayee       = "payee"
+)
+
+// UncertainBelow is the confidence under which a field should be checked.
+const UncertainBelow = 0.7
+
+// Proposal is the transaction a phrase most likely means. Confidence rates
+// each field from 0 (not found) to 1 (said explicitly).
+type Proposal struct {
+	Transaction model.Transaction  `json:"transaction"`
+	Confidence  map[string]float64 `json:"confidence"`
+	Uncertain   []string           `json:"uncertain"`
+	Score       float64            `json:"score"` // the least confident field
+	Parser      string             `json:"parser"`
+}
+
+func newProposal(parser string) Proposal {
+	return Proposal{Confidence: map[string]float64{}, Uncertain: []string{}, Parser: parser}
+}
+
+// finish fills in Uncertain and Score from Confidence.
+func (p *Proposal) finish() {
+	p.Score = 1
+	for field, c := range p.Confidence {
+		if c < UncertainBelow {
+			p.Uncertain = append(p.Uncertain, field)
+		}
+		if c < p.Score {
+			p.Score = c
+		}
+	}
+	sort.Strings(p.Uncertain)
+}
@@ -0,0 +1,550 @@
+package quickadd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"fintrack/server/model"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RuleParser reads Vietnamese and English phrases with fixed rules: the
+// same phrase always gives the same proposal.
+type RuleParser struct{}
+
+type token struct {
+	raw   string // as typed, for the note
+	lower string // lowercased, surrounding punctuation trimmed
+	norm  string // util.NormalizeText
+	used  bool
+}
+
+// scan is a phrase being taken apart, each finder marks what it reads.
+type scan struct {
+	tokens     []token
+	vietnamese bool
+}
+
+// Words that only appear in Vietnamese phrases typed without accents
+var vietnameseWords = map[string]bool{
+	"hom": true, "nay": true, "qua": true, "tien": true, "mat": true, "luong": true, "tr": true,
+	"trieu": true, "nghin": true, "cho": true, "sang": true, "vao": true, "tu": true, "mua": true, "ngay": true,
+}
+
+func newScan(text string) *scan {
+	s := &scan{}
+	for _, raw := range strings.Fields(text) {
+		lower := strings.TrimRight(strings.TrimLeft(strings.ToLower(raw), `"'(`), `.,;:!?"')`)
+		s.tokens = append(s.tokens, token{raw: raw, lower: lower, norm: util.NormalizeText(raw)})
+		if vietnameseWords[util.NormalizeText(raw)] {
+			s.vietnamese = true
+		}
+	}
+	for _, r := range text {
+		if r > unicode.MaxASCII && unicode.IsLetter(r) {
+			s.vietnamese = true
+		}
+	}
+	return s
+}
+
+// next is the first unused token after i, -1 when there is none.
+func (s *scan) next(i int) int {
+	for j := i + 1; i >= 0 && j < len(s.tokens); j++ {
+		if !s.tokens[j].used {
+			return j
+		}
+	}
+	return -1
+}
+
+func (s *scan) prev(i int) int {
+	for j := i - 1; j >= 0; j-- {
+		if !s.tokens[j].used {
+			return j
+		}
+	}
+	return -1
+}
+
+// phraseAt is the number of tokens phrase spans from i, 0 when it is not
+// there.
+func (s *scan) phraseAt(i int, phrase string) int {
+	words := strings.Fields(phrase)
+	if i < 0 || i+len(words) > len(s.tokens) {
+		return 0
+	}
+	for k, w := range words {
+		if t := s.tokens[i+k]; t.used || t.norm != w {
+			return 0
+		}
+	}
+	return len(words)
+}
+
+// contains finds phrase anywhere among the unused tokens.
+func (s *scan) contains(phrase string) (int, int) {
+	for i := range s.tokens {
+		if n := s.phraseAt(i, phrase); n > 0 {
+			return i, n
+		}
+	}
+	return -1, 0
+}
+
+func (s *scan) use(i, n int) {
+	for k := i; k >= 0 && k < i+n && k < len(s.tokens); k++ {
+		s.tokens[k].used = true
+	}
+}
+
+// note is what is left once amounts, dates and accounts are read.
+func (s *scan) note() string {
+	var words []string
+	for _, t := range s.tokens {
+		if !t.used {
+			words = append(words, t.raw)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Words that say what kind of thing a name is rather than which one
+var genericWords = map[string]bool{
+	"tai": true, "khoan": true, "tk": true, "the": true, "vi": true, "account": true, "card": true,
+	"bank": true, "ngan": true, "hang": true, "wallet": true, "my": true, "cua": true,
+}
+
+func normalizeWord(s string) string {
+	return util.NormalizeText(s)
+}
+
+// wordMatch rates a typed word against a word of a name: the same word, its
+// beginning or one typo away.
+func wordMatch(word, name string) float64 {
+	switch {
+	case word == "":
+		return 0
+	case word == name:
+		return 1
+	case len(word) >= 3 && len(name) >= 4 && strings.HasPrefix(name, word):
+		return 0.8
+	case len(word) >= 4 && len(name) >= 4 && oneEditApart(word, name):
+		return 0.8
+	}
+	return 0
+}
+
+func oneEditApart(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(b)-len(a) > 1 {
+		return false
+	}
+	i := 0
+	for i < len(a) && a[i] == b[i] {
+		i++
+	}
+	if len(a) == len(b) {
+		return a[i+1:] == b[i+1:]
+	}
+	return a[i:] == b[i+1:]
+}
+
+// findName looks for name among the unused tokens. The score is 1 when
+// every specific word of it is there in a row, less for part of it or near
+// spellings.
+func (s *scan) findName(name string) (score float64, from, n int) {
+	words := strings.Fields(util.NormalizeText(name))
+	specific := 0
+	for _, w := range words {
+		if !genericWords[w] {
+			specific++
+		}
+	}
+	denominator := specific
+	if denominator == 0 {
+		denominator = len(words)
+	}
+	if denominator == 0 {
+		return 0, -1, 0
+	}
+
+	from = -1
+	for i := range s.tokens {
+		matched := make([]bool, len(words))
+		total, j := 0.0, i
+		for ; j < len(s.tokens) && !s.tokens[j].used; j++ {
+			best, bestK := 0.0, -1
+			for k, w := range words {
+				if m := wordMatch(s.tokens[j].norm, w); !matched[k] && m > best {
+					best, bestK = m, k
+				}
+			}
+			if bestK < 0 {
+				break
+			}
+			matched[bestK] = true
+			if specific == 0 || !genericWords[words[bestK]] {
+				total += best
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		if sc := total / float64(denominator); sc > score || (sc == score && j-i > n) {
+			score, from, n = sc, i, j-i
+		}
+	}
+	return score, from, n
+}
+
+// minNameScore is how much of a name has to be there to count.
+const minNameScore = 0.5
+
+type holder struct {
+	id          primitive.ObjectID
+	name        string
+	accountType model.AccountType // empty for savings
+}
+
+type accountMatch struct {
+	holder
+	confidence float64
+	// what the word before it says: source, destination or nothing
+	side string
+}
+
+var (
+	sourceWords      = map[string]bool{"tu": true, "from": true, "bang": true, "by": true, "with": true, "via": true, "using": true, "on": true}
+	destinationWords = map[string]bool{"sang": true, "vao": true, "qua": true, "to": true, "den": true, "into": true}
+)
+
+// Words that name an account by its type
+var accountTypeWords = []struct {
+	phrase      string
+	accountType model.AccountType
+}{
+	{"tien mat", model.AccountCash}, {"cash", model.AccountCash},
+	{"the tin dung", model.AccountCreditCard}, {"credit card", model.AccountCreditCard},
+	{"the", model.AccountCreditCard}, {"card", model.AccountCreditCard},
+	{"vi dien tu", model.AccountEWallet}, {"e wallet", model.AccountEWallet},
+}
+
+// findAccounts reads up to two accounts or savings, by name, then by type.
+func (s *scan) findAccounts(holders []holder) []accountMatch {
+	var found []accountMatch
+	taken := map[primitive.ObjectID]bool{}
+
+	for len(found) < 2 {
+		best, bestScore, bestFrom, bestN := -1, 0.0, -1, 0
+		for i, h := range holders {
+			if taken[h.id] {
+				continue
+			}
+			if score, from, n := s.findName(h.name); score >= minNameScore && (score > bestScore || (score == bestScore && n > bestN)) {
+				best, bestScore, bestFrom, bestN = i, score, from, n
+			}
+		}
+		if best < 0 {
+			break
+		}
+		taken[holders[best].id] = true
+		found = append(found, s.claimAccount(holders[best], bestScore, bestFrom, bestN))
+	}
+
+	for _, w := range accountTypeWords {
+		if len(found) == 2 {
+			break
+		}
+		from, n := s.contains(w.phrase)
+		if from < 0 {
+			continue
+		}
+		var candidates []holder
+		for _, h := range holders {
+			if h.accountType == w.accountType && !taken[h.id] {
+				candidates = append(candidates, h)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		confidence := 0.75
+		if len(candidates) > 1 {
+			confidence = 0.5
+		}
+		taken[candidates[0].id] = true
+		found = append(found, s.claimAccount(candidates[0], confidence, from, n))
+	}
+
+	return found
+}
+
+func (s *scan) claimAccount(h holder, confidence float64, from, n int) accountMatch {
+	m := accountMatch{holder: h, confidence: confidence}
+	if prev := s.prev(from); prev >= 0 && prev == from-1 {
+		switch word := s.tokens[prev].norm; {
+		case sourceWords[word]:
+			m.side = "source"
+			s.use(prev, 1)
+		case destinationWords[word]:
+			m.side = "destination"
+			s.use(prev, 1)
+		}
+	}
+	s.use(from, n)
+	return m
+}
+
+// Words that give the type away
+var typeWords = map[string][]string{
+	"income": {
+		"luong", "nhan luong", "salary", "thuong", "bonus", "nhan", "nhan duoc", "received", "receive",
+		"income", "hoan tien", "refund", "tien lai", "interest", "ban duoc", "sold", "got paid", "earned",
+	},
+	"transfer": {
+		"chuyen tien", "transfer", "rut", "rut tien", "withdraw", "nap", "nap tien", "top up", "topup",
+		"gui tiet kiem", "deposit", "tra the", "tra no the", "pay off",
+	},
+	"expense": {
+		"mua", "tra", "chi", "tieu", "spent", "spend", "paid", "pay", "bought", "buy", "het",
+	},
+}
+
+func (s *scan) typeWord() string {
+	for _, kind := range []string{"income", "transfer", "expense"} {
+		for _, phrase := range typeWords[kind] {
+			if from, _ := s.contains(phrase); from >= 0 {
+				return kind
+			}
+		}
+	}
+	return ""
+}
+
+// categoryHints point at a kind of category when the phrase does not name
+// one: the words said, and words the category's name may hold.
+var categoryHints = []struct {
+	words []string
+	names []string
+}{
+	{
+		words: []string{"ca phe", "cafe", "coffee", "tra sua", "com", "pho", "bun", "banh mi", "an sang", "an trua", "an toi",
+			"breakfast", "lunch", "dinner", "nha hang", "restaurant", "an", "uong"},
+		names: []string{"an uong", "an", "do an", "food", "dining", "eat", "coffee", "ca phe"},
+	},
+	{
+		words: []string{"grab", "taxi", "xang", "xe om", "gui xe", "bus", "parking", "gas", "petrol", "uber"},
+		names: []string{"di chuyen", "di lai", "xang xe", "transport", "transportation", "travel"},
+	},
+	{
+		words: []string{"tien dien", "tien nuoc", "dien", "nuoc", "internet", "wifi", "electricity", "water"},
+		names: []string{"hoa don", "bills", "utilities", "nha cua", "housing"},
+	},
+	{
+		words: []string{"quan ao", "giay", "shopee", "lazada", "tiki", "clothes", "shoes"},
+		names: []string{"mua sam", "shopping"},
+	},
+	{
+		words: []string{"thuoc", "kham", "benh vien", "pharmacy", "doctor", "hospital"},
+		names: []string{"suc khoe", "y te", "health"},
+	},
+	{
+		words: []string{"phim", "movie", "netflix", "spotify", "game", "karaoke"},
+		names: []string{"giai tri", "entertainment"},
+	},
+	{
+		words: []string{"luong", "salary", "paycheck"},
+		names: []string{"luong", "salary", "thu nhap", "income"},
+	},
+}
+
+func hasPhrase(text, phrase string) bool {
+	return strings.Contains(" "+text+" ", " "+phrase+" ")
+}
+
+// findCategory picks a category of kind: by name, then by hint.
+func (s *scan) findCategory(categories []model.Category, kind string) (model.Category, float64) {
+	best, bestScore, bestN := -1, 0.0, 0
+	for i, c := range categories {
+		if c.Type != kind {
+			continue
+		}
+		if score, _, n := s.findName(c.Name); score >= minNameScore && (score > bestScore || (score == bestScore && n > bestN)) {
+			best, bestScore, bestN = i, score, n
+		}
+	}
+	if best >= 0 {
+		return categories[best], bestScore
+	}
+
+	for _, hint := range categoryHints {
+		said := false
+		for _, w := range hint.words {
+			if from, _ := s.contains(w); from >= 0 {
+				said = true
+				break
+			}
+		}
+		if !said {
+			continue
+		}
+		for _, name := range hint.names {
+			for _, c := range categories {
+				if c.Type == kind && hasPhrase(util.NormalizeText(c.Name), name) {
+					return c, 0.65
+				}
+			}
+		}
+	}
+	return model.Category{}, 0
+}
+
+// findPayee picks the payee whose name or alias is said. Its words stay in
+// the note.
+func (s *scan) findPayee(payees []model.Payee) (model.Payee, float64) {
+	best, bestScore := -1, 0.0
+	for i, p := range payees {
+		for _, name := range append([]string{p.Name}, p.Aliases...) {
+			if score, _, _ := s.findName(name); score >= 0.8 && score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+	}
+	if best < 0 {
+		return model.Payee{}, 0
+	}
+	return payees[best], bestScore * 0.9
+}
+
+func (RuleParser) Parse(ctx context.Context, text string, vocab Vocabulary) (Proposal, error) {
+	p := newProposal("rules")
+	if strings.TrimSpace(text) == "" {
+		return p, errors.New("Nothing to parse")
+	}
+	s := newScan(text)
+	tx := &p.Transaction
+
+	tx.DateTime, p.Confidence[FieldDate] = s.findDate(vocab.Now)
+
+	currency := vocab.Currency
+	if currency == "" {
+		currency = "VND"
+	}
+	if amount, ok := s.findAmount(currency); ok {
+		tx.Amount = amount.value
+		p.Confidence[FieldAmount] = amount.confidence
+		for _, i := range amount.tokens {
+			s.use(i, 1)
+		}
+	} else {
+		p.Confidence[FieldAmount] = 0
+	}
+
+	var holders []holder
+	for _, a := range vocab.Accounts {
+		holders = append(holders, holder{id: a.ID, name: a.Name, accountType: a.AccountType()})
+	}
+	for _, sv := range vocab.Savings {
+		holders = append(holders, holder{id: sv.ID, name: sv.Name})
+	}
+	accounts := s.findAccounts(holders)
+
+	payee, payeeConfidence := s.findPayee(vocab.Payees)
+	if payeeConfidence > 0 {
+		tx.Payee = payee.ID
+		p.Confidence[FieldPayee] = payeeConfidence
+	}
+
+	// Type: two accounts make a transfer, then what the words say, then the
+	// category
+	said := s.typeWord()
+	switch {
+	case len(accounts) == 2:
+		tx.Type, p.Confidence[FieldType] = "transfer", 0.75
+		if said == "transfer" {
+			p.Confidence[FieldType] = 0.9
+		}
+	case said == "transfer":
+		tx.Type, p.Confidence[FieldType] = "transfer", 0.6
+	case len(accounts) == 1 && accounts[0].accountType == "":
+		// money only moves in and out of savings by transfer
+		tx.Type, p.Confidence[FieldType] = "transfer", 0.8
+	case said != "":
+		tx.Type, p.Confidence[FieldType] = said, 0.9
+	default:
+		tx.Type, p.Confidence[FieldType] = "expense", 0.7
+		_, income := s.findCategory(vocab.Categories, "income")
+		if _, expense := s.findCategory(vocab.Categories, "expense"); income >= 0.8 && income > expense {
+			tx.Type, p.Confidence[FieldType] = "income", 0.85
+		}
+	}
+
+	switch tx.Type {
+	case "transfer":
+		s.transferSides(tx, p.Confidence, accounts)
+	default:
+		field := &tx.SourceAccount
+		if tx.Type == "income" {
+			field = &tx.DestinationAccount
+		}
+		switch {
+		case len(accounts) > 0:
+			*field, p.Confidence[FieldAccount] = accounts[0].id, accounts[0].confidence
+		case !payee.DefaultAccount.IsZero():
+			*field, p.Confidence[FieldAccount] = payee.DefaultAccount, 0.7
+		case len(holders) == 1:
+			*field, p.Confidence[FieldAccount] = holders[0].id, 0.5
+		default:
+			p.Confidence[FieldAccount] = 0
+		}
+
+		category, score := s.findCategory(vocab.Categories, tx.Type)
+		if score == 0 && !payee.DefaultCategory.IsZero() {
+			category.ID, score = payee.DefaultCategory, 0.8
+		}
+		tx.Category, p.Confidence[FieldCategory] = category.ID, score
+	}
+
+	tx.Note = s.note()
+	p.finish()
+	return p, nil
+}
+
+// transferSides puts the accounts of a transfer on the side their words
+// say, in the order they were said otherwise.
+func (s *scan) transferSides(tx *model.Transaction, confidence map[string]float64, accounts []accountMatch) {
+	confidence[FieldAccount], confidence[FieldDestination] = 0, 0
+	var source, destination *accountMatch
+	var rest []*accountMatch
+	for i := range accounts {
+		a := &accounts[i]
+		switch {
+		case a.side == "source" && source == nil:
+			source = a
+		case a.side == "destination" && destination == nil:
+			destination = a
+		default:
+			rest = append(rest, a)
+		}
+	}
+	for _, a := range rest {
+		if source == nil {
+			source = a
+		} else if destination == nil {
+			destination = a
+		}
+	}
+	if source != nil {
+		tx.SourceAccount, confidence[FieldAccount] = source.id, source.confidence
+	}
+	if destination != nil {
+		tx.DestinationAccount, confidence[FieldDestination] = destination.id, destination.confidence
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"fintrack/server/model"
@@ -38,6 +39,31 @@ func GetAccountByID(id string) (model.Account, error) {
 	return account, nil
 }
 
+// CheckSpendingRule tells whether taking amount out of the account would break
+// its no-overdraft or credit-limit rule. When a transaction is being edited,
+// pass its id as replacing so its current effect is undone first.
+func CheckSpendingRule(account model.Account, amount float64, replacing string) error {
+	floor, ok := account.BalanceFloor()
+	if !ok {
+		return nil
+	}
+
+	balance := account.Balance
+	if replacing != "" {
+		if old, err := GetTransactionByID(replacing); err == nil && !old.IsDeleted {
+			balance -= transactionEffect(old, account.ID)
+		}
+	}
+
+	if balance-amount < floor-balanceEpsilon {
+		if account.AccountType().IsLiability() {
+			return fmt.Errorf("Transaction exceeds the credit limit of `%s` (available %.2f)", account.Name, balance-floor)
+		}
+		return fmt.Errorf("Transaction would overdraw `%s` (available %.2f)", account.Name, balance-floor)
+	}
+	return nil
+}
+
 func FetchAccountsSince(ctx context.Context, username string, since time.Time) (*mongo.Cursor, error) {
 	filter := bson.M{
 		"last_update": bson.M{
@@ -53,29 +79,94 @@ func FetchAccountsSince(ctx context.Context, username string, since time.Time) (
 	return util.AccountCollection.Find(ctx, filter, opts)
 }
 
+// AddAccount records a non-zero starting balance as an opening_balance
+// transaction, so the ledger explains the balance from day one.
 func AddAccount(ctx context.Context, account model.Account) (interface{}, error) {
 	account.LastUpdate = time.Now()
-	result, err := util.AccountCollection.InsertOne(ctx, account)
+	opening := account.Balance
+	account.Balance = 0
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		res, err := util.AccountCollection.InsertOne(sc, account)
+		if err != nil {
+			return nil, err
+		}
 
+		if opening != 0 {
+			id := res.InsertedID.(primitive.ObjectID)
+			txn := BalanceTransaction(account.Owner, id, "opening_balance", opening, "Opening balance")
+			if _, err := insertTransaction(sc, txn); err != nil {
+				return nil, err
+			}
+		}
+
+		return res.InsertedID, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	account.ID = result.(primitive.ObjectID)
+	account.Balance = opening
+
 	socket.BroadcastFromContext(ctx, map[string]interface{}{
 		"collection": "accounts",
 		"action":     "create",
 		"detail":     account,
 	})
+	if opening != 0 {
+		socket.BroadcastFromContext(ctx, map[string]interface{}{
+			"collection": "transactions",
+			"action":     "create",
+			"detail":     "bulk",
+		})
+	}
 
-	return result.InsertedID, nil
+	return result, nil
 }
 
+// UpdateAccount never overwrites the balance directly, a different balance is
+// turned into an adjustment transaction for the difference.
 func UpdateAccount(ctx context.Context, id primitive.ObjectID, account model.Account) error {
 	filter := bson.M{"_id": id}
 	account.LastUpdate = time.Now()
-	updateAccount := bson.M{"$set": account}
 
-	_, err := util.AccountCollection.UpdateOne(ctx, filter, updateAccount)
+	adjusted := false
+	err := util.MongoClient.UseSession(ctx, func(sc mongo.SessionContext) error {
+		if err := sc.StartTransaction(); err != nil {
+			return err
+		}
+
+		var old model.Account
+		if err := util.AccountCollection.FindOne(sc, filter).Decode(&old); err != nil {
+			_ = sc.AbortTransaction(sc)
+			return err
+		}
+
+		if delta := account.Balance - old.Balance; math.Abs(delta) > balanceEpsilon {
+			txn := BalanceTransaction(old.Owner, id, "adjustment", delta, "Balance adjustment")
+			if _, err := insertTransaction(sc, txn); err != nil {
+				_ = sc.AbortTransaction(sc)
+				return err
+			}
+			adjusted = true
+		} else {
+			account.Balance = old.Balance
+		}
+
+		if _, err := util.AccountCollection.UpdateOne(sc, filter, bson.M{"$set": account}); err != nil {
+			_ = sc.AbortTransaction(sc)
+			return err
+		}
+
+		return sc.CommitTransaction(sc)
+	})
 	if err != nil {
 		return err
 	}
@@ -85,6 +176,13 @@ func UpdateAccount(ctx context.Context, id primitive.ObjectID, account model.Acc
 		"action":     "update",
 		"detail":     account,
 	})
+	if adjusted {
+		socket.BroadcastFromContext(ctx, map[string]interface{}{
+			"collection": "transactions",
+			"action":     "create",
+			"detail":     "bulk",
+		})
+	}
 
 	return nil
 }
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"fintrack/server/blob"
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// attachmentStore holds attachment files, main picks the backend.
+var attachmentStore blob.Store
+
+func SetAttachmentStore(store blob.Store) {
+	attachmentStore = store
+}
+
+// MaxAttachments is how many files one transaction keeps.
+const MaxAttachments = 20
+
+var ErrTooManyAttachments = fmt.Errorf("a transaction keeps at most %d attachments", MaxAttachments)
+
+func attachmentKey(owner string, tx, id primitive.ObjectID) string {
+	return owner + "/" + tx.Hex() + "/" + id.Hex()
+}
+
+func thumbnailKey(a model.Attachment) string {
+	return a.Key + ".thumb.jpg"
+}
+
+// AddAttachment stores data with tx, with a thumbnail when it is an image
+// blob.Thumbnail can read. contentType is trusted, the caller checked it.
+func AddAttachment(ctx context.Context, tx model.Transaction, fileName, contentType string, data []byte) (model.Attachment, error) {
+	if len(tx.Attachments) >= MaxAttachments {
+		return model.Attachment{}, ErrTooManyAttachments
+	}
+
+	a := model.Attachment{
+		ID:          primitive.NewObjectID(),
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		UploadedAt:  time.Now(),
+	}
+	a.Key = attachmentKey(tx.Creator, tx.ID, a.ID)
+
+	if err := attachmentStore.Put(ctx, a.Key, bytes.NewReader(data)); err != nil {
+		return a, fmt.Errorf("Failed to store attachment: %w", err)
+	}
+	if thumb, ok := blob.Thumbnail(data); ok {
+		if err := attachmentStore.Put(ctx, thumbnailKey(a), bytes.NewReader(thumb)); err != nil {
+			log.Printf("Failed to store thumbnail of %s: %v", a.Key, err)
+		} else {
+			a.HasThumbnail = true
+		}
+	}
+
+	// The count is checked again, two uploads may race
+	var updated model.Transaction
+	err := util.TransactionCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": tx.ID, fmt.Sprintf("attachments.%d", MaxAttachments-1): bson.M{"$exists": false}},
+		bson.M{
+			"$push": bson.M{"attachments": a},
+			"$set":  bson.M{"last_update": a.UploadedAt},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		deleteAttachmentFiles(ctx, []model.Attachment{a})
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return a, ErrTooManyAttachments
+		}
+		return a, err
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "update",
+		"detail":     updated,
+	})
+
+	return a, nil
+}
+
+func FindAttachment(tx model.Transaction, id string) (model.Attachment, bool) {
+	for _, a := range tx.Attachments {
+		if a.ID.Hex() == id {
+			return a, true
+		}
+	}
+	return model.Attachment{}, false
+}
+
+// OpenAttachment reads an attachment, or its thumbnail.
+func OpenAttachment(ctx context.Context, a model.Attachment, thumbnail bool) (io.ReadCloser, error) {
+	if thumbnail {
+		if !a.HasThumbnail {
+			return nil, blob.ErrNotFound
+		}
+		return attachmentStore.Get(ctx, thumbnailKey(a))
+	}
+	return attachmentStore.Get(ctx, a.Key)
+}
+
+func DeleteAttachment(ctx context.Context, tx model.Transaction, a model.Attachment) error {
+	var updated model.Transaction
+	err := util.TransactionCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": tx.ID},
+		bson.M{
+			"$pull": bson.M{"attachments": bson.M{"_id": a.ID}},
+			"$set":  bson.M{"last_update": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return fmt.Errorf("Error deleting attachment: %w", err)
+	}
+
+	deleteAttachmentFiles(ctx, []model.Attachment{a})
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "update",
+		"detail":     updated,
+	})
+	return nil
+}
+
+// deleteAttachmentFiles removes the files of attachments whose records are
+// gone. Failures are only logged: the record is what users see, a file left
+// behind costs space, not correctness.
+func deleteAttachmentFiles(ctx context.Context, attachments []model.Attachment) {
+	for _, a := range attachments {
+		keys := []string{a.Key}
+		if a.HasThumbnail {
+			keys = append(keys, thumbnailKey(a))
+		}
+		for _, key := range keys {
+			if err := attachmentStore.Delete(ctx, key); err != nil {
+				log.Printf("Failed to delete attachment file %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// PurgeTransaction removes a deleted transaction for good, with its
+// attachments. Its balance effect was reversed when it was deleted.
+func PurgeTransaction(ctx context.Context, tx model.Transaction) error {
+	if !tx.IsDeleted {
+		return errors.New("only deleted transactions can be purged")
+	}
+
+	res, err := util.TransactionCollection.DeleteOne(ctx, bson.M{"_id": tx.ID, "is_deleted": true})
+	if err != nil {
+		return fmt.Errorf("Error purging transaction: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	deleteAttachmentFiles(ctx, tx.Attachments)
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "purge",
+		"detail":     tx.ID,
+	})
+	return nil
+}
+
+// ownerAttachments lists the attachments on all of owner's transactions.
+func ownerAttachments(ctx context.Context, owner string) ([]model.Attachment, error) {
+	cursor, err := util.TransactionCollection.Find(ctx,
+		bson.M{"creator": owner, "attachments.0": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"attachments": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch attachments: %w", err)
+	}
+	var txs []model.Transaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, err
+	}
+
+	var attachments []model.Attachment
+	for _, tx := range txs {
+		attachments = append(attachments, tx.Attachments...)
+	}
+	return attachments, nil
+}
@@ -0,0 +1,463 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BalanceHolder is anything a transaction can move money in or out of.
+type BalanceHolder struct {
+	ID      primitive.ObjectID `json:"id"`
+	Owner   string             `json:"owner"`
+	Kind    string             `json:"kind"` // account, saving
+	Name    string             `json:"name"`
+	Balance float64            `json:"balance"`
+	Opening float64            `json:"opening"`
+	// Liabilities carry a negative balance while money is owed.
+	Liability bool `json:"liability,omitempty"`
+}
+
+type BalancePoint struct {
+	Date     time.Time          `json:"date"`
+	At       time.Time          `json:"at"`
+	Balances map[string]float64 `json:"balances"`
+	// NetWorth is Assets minus Liabilities, the latter counted as amount owed.
+	Assets      float64 `json:"assets"`
+	Liabilities float64 `json:"liabilities"`
+	NetWorth    float64 `json:"netWorth"`
+}
+
+type BalanceInconsistency struct {
+	Account    primitive.ObjectID `json:"account"`
+	Name       string             `json:"name"`
+	TakenAt    time.Time          `json:"takenAt"`
+	Snapshot   float64            `json:"snapshot"`
+	Expected   float64            `json:"expected"`
+	Difference float64            `json:"difference"`
+}
+
+type BalanceHistory struct {
+	From            time.Time              `json:"from"`
+	To              time.Time              `json:"to"`
+	Interval        string                 `json:"interval"`
+	Holders         []BalanceHolder        `json:"holders"`
+	Points          []BalancePoint         `json:"points"`
+	Inconsistencies []BalanceInconsistency `json:"inconsistencies"`
+}
+
+const balanceEpsilon = 0.005
+
+// FetchBalanceHolders returns the owner's accounts and savings. An empty owner
+// returns every user's.
+func FetchBalanceHolders(ctx context.Context, owner string) ([]BalanceHolder, error) {
+	filter := bson.M{"is_deleted": false}
+	if owner != "" {
+		filter["owner"] = owner
+	}
+
+	cursor, err := util.AccountCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch accounts: %w", err)
+	}
+	var accounts []model.Account
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+
+	cursor, err = util.SavingCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch savings: %w", err)
+	}
+	var savings []model.Saving
+	if err := cursor.All(ctx, &savings); err != nil {
+		return nil, err
+	}
+
+	holders := make([]BalanceHolder, 0, len(accounts)+len(savings))
+	for _, account := range accounts {
+		holders = append(holders, BalanceHolder{
+			ID:      account.ID,
+			Owner:   account.Owner,
+			Kind:    "account",
+			Name:    account.Name,
+			Balance: account.Balance,
+			Opening: account.OpeningBalance,
+
+			Liability: account.AccountType().IsLiability(),
+		})
+	}
+	for _, saving := range savings {
+		holders = append(holders, BalanceHolder{
+			ID:      saving.ID,
+			Owner:   saving.Owner,
+			Kind:    "saving",
+			Name:    saving.Name,
+			Balance: saving.Balance,
+			Opening: saving.OpeningBalance,
+		})
+	}
+
+	return holders, nil
+}
+
+// transactionEffect is how much a transaction moved the balance of id.
+func transactionEffect(tx model.Transaction, id primitive.ObjectID) float64 {
+	effect := 0.0
+	if tx.SourceAccount == id {
+		effect -= tx.Amount
+	}
+	if tx.DestinationAccount == id {
+		effect += tx.Amount
+	}
+	return effect
+}
+
+// BalanceAt is the balance of an account or saving at a past moment: its
+// current balance less everything booked after.
+func BalanceAt(ctx context.Context, id primitive.ObjectID, at time.Time) (float64, error) {
+	var holder struct {
+		Balance float64 `bson:"balance"`
+	}
+	err := util.AccountCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&holder)
+	if err == mongo.ErrNoDocuments {
+		err = util.SavingCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&holder)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := util.TransactionCollection.Find(ctx, bson.M{
+		"is_deleted": false,
+		"date_time":  bson.M{"$gt": at},
+		"$or": []bson.M{
+			{"source_account": id},
+			{"destination_account": id},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	balance := holder.Balance
+	for cursor.Next(ctx) {
+		var tx model.Transaction
+		if err := cursor.Decode(&tx); err != nil {
+			return 0, err
+		}
+		balance -= transactionEffect(tx, id)
+	}
+	return roundMoney(balance), cursor.Err()
+}
+
+// balancePeriods cuts [from, to) into days or months in loc. Each period is
+// measured at its end, never later than now.
+func balancePeriods(from, to time.Time, interval string, loc *time.Location) ([]BalancePoint, error) {
+	if interval != "day" && interval != "month" {
+		return nil, fmt.Errorf("invalid interval `%s`, expected {day|month}", interval)
+	}
+
+	now := time.Now()
+	f := from.In(loc)
+	start := time.Date(f.Year(), f.Month(), f.Day(), 0, 0, 0, 0, loc)
+	if interval == "month" {
+		start = time.Date(f.Year(), f.Month(), 1, 0, 0, 0, 0, loc)
+	}
+
+	points := []BalancePoint{}
+	for start.Before(to) {
+		end := start.AddDate(0, 0, 1)
+		if interval == "month" {
+			end = start.AddDate(0, 1, 0)
+		}
+
+		at := end
+		if at.After(to) {
+			at = to
+		}
+		if at.After(now) {
+			at = now
+		}
+
+		points = append(points, BalancePoint{
+			Date:     start,
+			At:       at,
+			Balances: map[string]float64{},
+		})
+		start = end
+	}
+
+	return points, nil
+}
+
+// staleSnapshots finds the snapshots the transaction log no longer agrees
+// with: one of their holder's transactions was changed or deleted after the
+// snapshot was taken, or was added after it but dated before. New
+// transactions dated after a snapshot leave it valid.
+func staleSnapshots(ctx context.Context, owner string, snapshots []model.BalanceSnapshot) (map[primitive.ObjectID]bool, error) {
+	stale := map[primitive.ObjectID]bool{}
+	if len(snapshots) == 0 {
+		return stale, nil
+	}
+
+	byHolder := map[primitive.ObjectID][]model.BalanceSnapshot{}
+	ids := []primitive.ObjectID{}
+	since := snapshots[0].TakenAt
+	for _, snapshot := range snapshots {
+		if _, ok := byHolder[snapshot.Account]; !ok {
+			ids = append(ids, snapshot.Account)
+		}
+		byHolder[snapshot.Account] = append(byHolder[snapshot.Account], snapshot)
+		if snapshot.TakenAt.Before(since) {
+			since = snapshot.TakenAt
+		}
+	}
+
+	// Deleted transactions count too, their deletion moved the balance
+	cursor, err := util.TransactionCollection.Find(ctx, bson.M{
+		"creator":     owner,
+		"last_update": bson.M{"$gt": since},
+		"$or": []bson.M{
+			{"source_account": bson.M{"$in": ids}},
+			{"destination_account": bson.M{"$in": ids}},
+		},
+	}, options.Find().SetProjection(bson.M{
+		"date_time": 1, "last_update": 1, "source_account": 1, "destination_account": 1,
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch changed transactions: %w", err)
+	}
+	var changed []model.Transaction
+	if err := cursor.All(ctx, &changed); err != nil {
+		return nil, err
+	}
+
+	for _, tx := range changed {
+		for _, id := range []primitive.ObjectID{tx.SourceAccount, tx.DestinationAccount} {
+			for _, snapshot := range byHolder[id] {
+				if !tx.LastUpdate.After(snapshot.TakenAt) {
+					continue
+				}
+				// The id tells when the transaction was created
+				existed := !tx.ID.Timestamp().After(snapshot.TakenAt)
+				if existed || !tx.DateTime.After(snapshot.TakenAt) {
+					stale[snapshot.ID] = true
+				}
+			}
+		}
+	}
+	return stale, nil
+}
+
+// BuildBalanceHistory reconstructs balances per account and the total net
+// worth by replaying transactions backwards. The replay starts from the first
+// snapshot taken after `to`, or from the current balance when there is none.
+// Snapshots met along the way are compared against the transaction log.
+// Snapshots the log has changed under since are neither used nor compared.
+func BuildBalanceHistory(ctx context.Context, owner string, from, to time.Time, interval string, loc *time.Location) (BalanceHistory, error) {
+	history := BalanceHistory{
+		From:            from,
+		To:              to,
+		Interval:        interval,
+		Inconsistencies: []BalanceInconsistency{},
+	}
+
+	points, err := balancePeriods(from, to, interval, loc)
+	if err != nil {
+		return history, err
+	}
+	history.Points = points
+	if len(points) == 0 {
+		return history, nil
+	}
+
+	holders, err := FetchBalanceHolders(ctx, owner)
+	if err != nil {
+		return history, err
+	}
+	history.Holders = holders
+
+	start := points[0].At
+
+	cursor, err := util.BalanceSnapshotCollection.Find(ctx, bson.M{
+		"owner":    owner,
+		"taken_at": bson.M{"$gte": start},
+	}, options.Find().SetSort(bson.D{{Key: "taken_at", Value: 1}}))
+	if err != nil {
+		return history, fmt.Errorf("Failed to fetch snapshots: %w", err)
+	}
+	var snapshots []model.BalanceSnapshot
+	if err := cursor.All(ctx, &snapshots); err != nil {
+		return history, err
+	}
+
+	stale, err := staleSnapshots(ctx, owner, snapshots)
+	if err != nil {
+		return history, err
+	}
+
+	// Anchor every holder on its first snapshot after `to`, keep the ones in
+	// range for verification.
+	anchors := map[primitive.ObjectID]model.BalanceSnapshot{}
+	inRange := map[primitive.ObjectID][]model.BalanceSnapshot{}
+	for _, snapshot := range snapshots {
+		if stale[snapshot.ID] {
+			continue
+		}
+		if snapshot.TakenAt.Before(to) {
+			inRange[snapshot.Account] = append(inRange[snapshot.Account], snapshot)
+			continue
+		}
+		if _, ok := anchors[snapshot.Account]; !ok {
+			anchors[snapshot.Account] = snapshot
+		}
+	}
+
+	// Transactions after the latest anchor are only needed when some holder
+	// replays from its current balance.
+	ids := make([]primitive.ObjectID, 0, len(holders))
+	replayUntil := time.Time{}
+	anchored := true
+	for _, holder := range holders {
+		ids = append(ids, holder.ID)
+		anchor, ok := anchors[holder.ID]
+		if !ok {
+			anchored = false
+		} else if anchor.TakenAt.After(replayUntil) {
+			replayUntil = anchor.TakenAt
+		}
+	}
+
+	dateFilter := bson.M{"$gt": start}
+	if anchored {
+		dateFilter["$lte"] = replayUntil
+	}
+	cursor, err = util.TransactionCollection.Find(ctx, bson.M{
+		"creator":    owner,
+		"is_deleted": false,
+		"date_time":  dateFilter,
+		"$or": []bson.M{
+			{"source_account": bson.M{"$in": ids}},
+			{"destination_account": bson.M{"$in": ids}},
+		},
+	}, options.Find().SetSort(bson.D{{Key: "date_time", Value: -1}}))
+	if err != nil {
+		return history, fmt.Errorf("Failed to fetch transactions: %w", err)
+	}
+	var transactions []model.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return history, err
+	}
+
+	history.Inconsistencies = ReplayBalanceHistory(points, holders, transactions, anchors, inRange)
+	return history, nil
+}
+
+// ReplayBalanceHistory fills in the balances of points, each measured at its
+// At, by undoing transactions newest first from each holder's anchor
+// snapshot, or from its current balance when it has none. Snapshots taken in
+// range are checked against the replay on the way, the ones that disagree
+// are returned.
+func ReplayBalanceHistory(points []BalancePoint, holders []BalanceHolder, transactions []model.Transaction,
+	anchors map[primitive.ObjectID]model.BalanceSnapshot, inRange map[primitive.ObjectID][]model.BalanceSnapshot) []BalanceInconsistency {
+	inconsistencies := []BalanceInconsistency{}
+	for _, holder := range holders {
+		balance := holder.Balance
+		anchorAt := time.Time{}
+		if anchor, ok := anchors[holder.ID]; ok {
+			balance = anchor.Balance
+			anchorAt = anchor.TakenAt
+		}
+
+		var events []model.Transaction
+		for _, tx := range transactions {
+			if transactionEffect(tx, holder.ID) == 0 {
+				continue
+			}
+			if !anchorAt.IsZero() && tx.DateTime.After(anchorAt) {
+				continue
+			}
+			events = append(events, tx)
+		}
+
+		snaps := inRange[holder.ID]
+		sort.Slice(snaps, func(i, j int) bool { return snaps[i].TakenAt.After(snaps[j].TakenAt) })
+
+		i, j := 0, 0
+		rewind := func(t time.Time) {
+			for {
+				if j < len(snaps) && !snaps[j].TakenAt.Before(t) &&
+					(i >= len(events) || !snaps[j].TakenAt.Before(events[i].DateTime)) {
+					if diff := snaps[j].Balance - balance; math.Abs(diff) > balanceEpsilon {
+						inconsistencies = append(inconsistencies, BalanceInconsistency{
+							Account:    holder.ID,
+							Name:       holder.Name,
+							TakenAt:    snaps[j].TakenAt,
+							Snapshot:   snaps[j].Balance,
+							Expected:   balance,
+							Difference: diff,
+						})
+					}
+					j++
+					continue
+				}
+				if i < len(events) && events[i].DateTime.After(t) {
+					balance -= transactionEffect(events[i], holder.ID)
+					i++
+					continue
+				}
+				return
+			}
+		}
+
+		for p := len(points) - 1; p >= 0; p-- {
+			rewind(points[p].At)
+			points[p].Balances[holder.ID.Hex()] = balance
+			points[p].NetWorth += balance
+			if holder.Liability {
+				points[p].Liabilities -= balance
+			} else {
+				points[p].Assets += balance
+			}
+		}
+	}
+
+	return inconsistencies
+}
+
+// TakeBalanceSnapshots stores the current balance of every account and saving.
+func TakeBalanceSnapshots(ctx context.Context) error {
+	holders, err := FetchBalanceHolders(ctx, "")
+	if err != nil {
+		return err
+	}
+	if len(holders) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	docs := make([]interface{}, 0, len(holders))
+	for _, holder := range holders {
+		docs = append(docs, model.BalanceSnapshot{
+			Owner:   holder.Owner,
+			Account: holder.ID,
+			Kind:    holder.Kind,
+			Balance: holder.Balance,
+			TakenAt: now,
+		})
+	}
+
+	_, err = util.BalanceSnapshotCollection.InsertMany(ctx, docs)
+	return err
+}
@@ -111,6 +111,20 @@ func DeleteCategory(ctx context.Context, id primitive.ObjectID) error {
 		return fmt.Errorf("Error deleting related transactions: %w", err)
 	}
 
+	// A split line only loses its category, the rest of the transaction
+	// stays where it was
+	splitUpdate := bson.M{
+		"$unset": bson.M{"splits.$[s].category": ""},
+		"$set":   bson.M{"last_update": time.Now()},
+	}
+	splitOpts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"s.category": id}},
+	})
+	_, err = util.TransactionCollection.UpdateMany(ctx, bson.M{"splits.category": id}, splitUpdate, splitOpts)
+	if err != nil {
+		return fmt.Errorf("Error updating split transactions: %w", err)
+	}
+
 	socket.BroadcastFromContext(ctx, map[string]interface{}{
 		"collection": "categories",
 		"action":     "delete",
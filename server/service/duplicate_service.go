@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DuplicateCriteria says how alike two transactions must be to be reported.
+type DuplicateCriteria struct {
+	Tolerance  float64 // amount difference, as a fraction of the larger amount
+	Days       int     // days between the two dates
+	Similarity float64 // note or payee likeness, from 0 to 1
+}
+
+var DefaultDuplicateCriteria = DuplicateCriteria{
+	Tolerance:  0.01,
+	Days:       3,
+	Similarity: 0.5,
+}
+
+// DuplicatePair is two transactions that likely record the same payment.
+// Keep is the one worth keeping: the one the bank knows, else the older.
+type DuplicatePair struct {
+	Keep       model.Transaction `json:"keep"`
+	Remove     model.Transaction `json:"remove"`
+	Similarity float64           `json:"similarity"`
+}
+
+// duplicateLimit caps how many pairs one request reports.
+const duplicateLimit = 500
+
+// FindDuplicates looks for likely duplicates among the owner's transactions
+// dated from onwards.
+func FindDuplicates(ctx context.Context, owner string, criteria DuplicateCriteria, from time.Time) ([]DuplicatePair, error) {
+	filter := bson.M{
+		"creator":    owner,
+		"is_deleted": false,
+		"type":       bson.M{"$in": ruleTypes},
+	}
+	if !from.IsZero() {
+		filter["date_time"] = bson.M{"$gte": from}
+	}
+
+	cursor, err := util.TransactionCollection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "date_time", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch transactions: %w", err)
+	}
+	var transactions []model.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+
+	pairs := DetectDuplicates(transactions, criteria)
+	if len(pairs) > duplicateLimit {
+		pairs = pairs[:duplicateLimit]
+	}
+	return pairs, nil
+}
+
+// DetectDuplicates pairs up look-alike transactions. transactions must be
+// sorted by date. The most recent pairs come first.
+func DetectDuplicates(transactions []model.Transaction, criteria DuplicateCriteria) []DuplicatePair {
+	window := time.Duration(criteria.Days) * 24 * time.Hour
+
+	pairs := []DuplicatePair{}
+	for i, a := range transactions {
+		for _, b := range transactions[i+1:] {
+			if b.DateTime.Sub(a.DateTime) > window {
+				break
+			}
+			if !mayBeDuplicates(a, b, criteria.Tolerance) {
+				continue
+			}
+			similarity := noteSimilarity(a, b)
+			if similarity < criteria.Similarity {
+				continue
+			}
+
+			keep, remove := a, b
+			if (remove.ExternalID != "" && keep.ExternalID == "") ||
+				((remove.ExternalID == "") == (keep.ExternalID == "") && remove.ID.Hex() < keep.ID.Hex()) {
+				keep, remove = remove, keep
+			}
+			pairs = append(pairs, DuplicatePair{Keep: keep, Remove: remove, Similarity: similarity})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Keep.DateTime.After(pairs[j].Keep.DateTime)
+	})
+	return pairs
+}
+
+// mayBeDuplicates checks everything but the notes: the same money leaving or
+// entering the same account, and nothing saying they are distinct.
+func mayBeDuplicates(a, b model.Transaction, tolerance float64) bool {
+	sameSide := (!a.SourceAccount.IsZero() && a.SourceAccount == b.SourceAccount) ||
+		(!a.DestinationAccount.IsZero() && a.DestinationAccount == b.DestinationAccount)
+	if !sameSide {
+		return false
+	}
+	if math.Abs(a.Amount-b.Amount) > tolerance*math.Max(a.Amount, b.Amount)+balanceEpsilon {
+		return false
+	}
+
+	// The bank listed both, or the user said so
+	if a.ExternalID != "" && b.ExternalID != "" && a.ExternalID != b.ExternalID {
+		return false
+	}
+	if !a.ImportBatch.IsZero() && a.ImportBatch == b.ImportBatch {
+		return false
+	}
+	return !containsID(a.NotDuplicates, b.ID) && !containsID(b.NotDuplicates, a.ID)
+}
+
+// noteSimilarity compares payees when both have one, notes otherwise. Notes
+// score the share of words of the shorter one found in the other, so a
+// typed "highlands" matches the bank's "CARD 1234 HIGHLANDS COFFEE". An
+// empty note says nothing either way and scores 0.5.
+func noteSimilarity(a, b model.Transaction) float64 {
+	if !a.Payee.IsZero() && !b.Payee.IsZero() {
+		if a.Payee == b.Payee {
+			return 1
+		}
+		return 0
+	}
+
+	wordsA := strings.Fields(util.NormalizeText(a.Note))
+	wordsB := strings.Fields(util.NormalizeText(b.Note))
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0.5
+	}
+	if len(wordsA) > len(wordsB) {
+		wordsA, wordsB = wordsB, wordsA
+	}
+
+	seen := map[string]bool{}
+	for _, w := range wordsB {
+		seen[w] = true
+	}
+	shared := 0
+	for _, w := range wordsA {
+		if seen[w] {
+			shared++
+			seen[w] = false
+		}
+	}
+	return float64(shared) / float64(len(wordsA))
+}
+
+// MergedTransaction is keep with whatever remove knows that keep does not:
+// its tags, payee, category, note, attachments and import links.
+func MergedTransaction(keep, remove model.Transaction) model.Transaction {
+	merged := keep
+	merged.Tags = append([]primitive.ObjectID(nil), keep.Tags...)
+	for _, tag := range remove.Tags {
+		if !containsID(merged.Tags, tag) {
+			merged.Tags = append(merged.Tags, tag)
+		}
+	}
+
+	if merged.Payee.IsZero() {
+		merged.Payee = remove.Payee
+	}
+	if merged.Category.IsZero() && len(merged.Splits) == 0 && merged.Type != "transfer" && merged.Type == remove.Type {
+		merged.Category, merged.Splits = remove.Category, remove.Splits
+	}
+	if strings.TrimSpace(merged.Note) == "" {
+		merged.Note = remove.Note
+	}
+	if merged.ExternalID == "" {
+		merged.ExternalID = remove.ExternalID
+	}
+	if merged.ImportBatch.IsZero() {
+		merged.ImportBatch = remove.ImportBatch
+	}
+	if merged.ValueDate.IsZero() {
+		merged.ValueDate = remove.ValueDate
+	}
+
+	merged.Attachments = append(append([]model.Attachment(nil), keep.Attachments...), remove.Attachments...)
+
+	merged.NotDuplicates = nil
+	for _, id := range append(append([]primitive.ObjectID(nil), keep.NotDuplicates...), remove.NotDuplicates...) {
+		if id != keep.ID && id != remove.ID && !containsID(merged.NotDuplicates, id) {
+			merged.NotDuplicates = append(merged.NotDuplicates, id)
+		}
+	}
+	return merged
+}
+
+// ErrMergeConflict means keep or remove was deleted since they were read.
+var ErrMergeConflict = errors.New("one of the transactions was deleted or merged already")
+
+// MergeTransactions folds remove into keep: remove is deleted and its balance
+// effect reversed, keep takes over its links, loan installments paid by
+// remove point at keep.
+func MergeTransactions(ctx context.Context, keep, remove model.Transaction) (model.Transaction, error) {
+	if keep.ID == remove.ID {
+		return model.Transaction{}, errors.New("cannot merge a transaction into itself")
+	}
+
+	merged := MergedTransaction(keep, remove)
+	merged.LastUpdate = time.Now()
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return model.Transaction{}, fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	loansChanged := false
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		loansChanged = false
+
+		// Both are checked again here, a merge sent twice or racing a delete
+		// must not reverse remove's balance effect twice. remove's
+		// attachments now belong to keep, purging it must not take them.
+		var current model.Transaction
+		err := util.TransactionCollection.FindOneAndUpdate(sc,
+			bson.M{"_id": remove.ID, "is_deleted": false},
+			bson.M{
+				"$set": bson.M{
+					"is_deleted":  true,
+					"merged_into": keep.ID,
+					"last_update": merged.LastUpdate,
+				},
+				"$unset": bson.M{"attachments": ""},
+			}).Decode(&current)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrMergeConflict
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		set := merged
+		set.ID = primitive.NilObjectID
+		res, err := util.TransactionCollection.UpdateOne(sc, bson.M{"_id": keep.ID, "is_deleted": false}, bson.M{"$set": set})
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 0 {
+			return nil, ErrMergeConflict
+		}
+
+		if _, err := util.AdjustBalance(sc, current.SourceAccount, current.Amount); err != nil {
+			return nil, fmt.Errorf("Failed to adjust source account balance: %w", err)
+		}
+		if _, err := util.AdjustBalance(sc, current.DestinationAccount, -current.Amount); err != nil {
+			return nil, fmt.Errorf("Failed to adjust destination account balance: %w", err)
+		}
+
+		for _, field := range []string{"principal_transaction", "interest_transaction"} {
+			res, err := util.LoanCollection.UpdateMany(sc,
+				bson.M{"schedule." + field: remove.ID},
+				bson.M{"$set": bson.M{
+					"schedule.$[i]." + field: keep.ID,
+					"last_update":            merged.LastUpdate,
+				}},
+				options.Update().SetArrayFilters(options.ArrayFilters{
+					Filters: []interface{}{bson.M{"i." + field: remove.ID}},
+				}))
+			if err != nil {
+				return nil, fmt.Errorf("Failed to relink loan installments: %w", err)
+			}
+			loansChanged = loansChanged || res.ModifiedCount > 0
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return model.Transaction{}, err
+	}
+
+	refreshStatementsFor(ctx, remove, merged)
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "delete",
+		"detail":     remove.ID,
+	})
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "update",
+		"detail":     merged,
+	})
+	if loansChanged {
+		socket.BroadcastFromContext(ctx, map[string]interface{}{
+			"collection": "loans",
+			"action":     "update",
+			"detail":     "bulk",
+		})
+	}
+
+	return merged, nil
+}
+
+// DismissDuplicate remembers that a and b are two payments, so they are no
+// longer reported together.
+func DismissDuplicate(ctx context.Context, a, b model.Transaction) error {
+	now := time.Now()
+	for _, pair := range [][2]primitive.ObjectID{{a.ID, b.ID}, {b.ID, a.ID}} {
+		if _, err := util.TransactionCollection.UpdateByID(ctx, pair[0], bson.M{
+			"$addToSet": bson.M{"not_duplicates": pair[1]},
+			"$set":      bson.M{"last_update": now},
+		}); err != nil {
+			return err
+		}
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "update",
+		"detail":     "bulk",
+	})
+	return nil
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"fintrack/server/exporter"
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Exports with more transactions than this are built in the background.
+	exportInlineLimit = 2000
+	// How long an archive can be downloaded.
+	exportRetention = 7 * 24 * time.Hour
+	exportTimeout   = 30 * time.Minute
+)
+
+func GetExportJobByID(id string) (model.ExportJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.ExportJob{}, err
+	}
+
+	var job model.ExportJob
+
+	err = util.ExportJobCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.ExportJob{}, errors.New("export not found")
+		}
+		return model.ExportJob{}, err
+	}
+
+	return job, nil
+}
+
+// FetchExportJobs lists the owner's exports still kept, newest first.
+func FetchExportJobs(ctx context.Context, owner string) ([]model.ExportJob, error) {
+	cursor, err := util.ExportJobCollection.Find(ctx, bson.M{"owner": owner},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(50))
+	if err != nil {
+		return nil, err
+	}
+	jobs := []model.ExportJob{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// exportScope is the part of the filter every owned collection shares.
+func exportScope(field, owner string, filter model.ExportFilter) bson.M {
+	scope := bson.M{field: owner}
+	if !filter.IncludeDeleted {
+		scope["is_deleted"] = bson.M{"$ne": true}
+	}
+	return scope
+}
+
+// exportPeriod adds the date range of filter on field to scope.
+func exportPeriod(scope bson.M, field string, filter model.ExportFilter) bson.M {
+	period := bson.M{}
+	if !filter.From.IsZero() {
+		period["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		period["$lte"] = filter.To
+	}
+	if len(period) > 0 {
+		scope[field] = period
+	}
+	return scope
+}
+
+func exportTransactionFilter(owner string, filter model.ExportFilter) bson.M {
+	query := exportPeriod(exportScope("creator", owner, filter), "date_time", filter)
+	if len(filter.Accounts) > 0 {
+		query["$or"] = []bson.M{
+			{"source_account": bson.M{"$in": filter.Accounts}},
+			{"destination_account": bson.M{"$in": filter.Accounts}},
+		}
+	}
+	return query
+}
+
+// LoadDataset reads what the owner has, narrowed by filter. The date range
+// applies to dated records (transactions, statements, snapshots,
+// notifications), the account list to accounts, savings and whatever hangs
+// off a single account.
+func LoadDataset(ctx context.Context, owner string, filter model.ExportFilter) (*model.Dataset, error) {
+	ds := &model.Dataset{
+		Version:    model.DatasetVersion,
+		Owner:      owner,
+		ExportedAt: time.Now(),
+		Filter:     filter,
+	}
+
+	byAccount := func(scope bson.M, field string) bson.M {
+		if len(filter.Accounts) > 0 {
+			scope[field] = bson.M{"$in": filter.Accounts}
+		}
+		return scope
+	}
+
+	// Snapshots and statements are derived and never soft-deleted
+	owned := bson.M{"owner": owner}
+
+	queries := []struct {
+		name       string
+		collection *mongo.Collection
+		filter     bson.M
+		out        interface{}
+	}{
+		{"accounts", util.AccountCollection, byAccount(exportScope("owner", owner, filter), "_id"), &ds.Accounts},
+		{"savings", util.SavingCollection, byAccount(exportScope("owner", owner, filter), "_id"), &ds.Savings},
+		{"categories", util.CategoryCollection, exportScope("owner", owner, filter), &ds.Categories},
+		{"tags", util.TagCollection, exportScope("owner", owner, filter), &ds.Tags},
+		{"payees", util.PayeeCollection, exportScope("owner", owner, filter), &ds.Payees},
+		{"transactions", util.TransactionCollection, exportTransactionFilter(owner, filter), &ds.Transactions},
+		{"subscriptions", util.SubscriptionCollection, byAccount(exportScope("creator", owner, filter), "source_account"), &ds.Subscriptions},
+		{"loans", util.LoanCollection, byAccount(exportScope("creator", owner, filter), "account"), &ds.Loans},
+		{"rules", util.RuleCollection, exportScope("owner", owner, filter), &ds.Rules},
+		{"import profiles", util.ImportProfileCollection, exportScope("owner", owner, filter), &ds.ImportProfiles},
+		{"message templates", util.MessageTemplateCollection, exportScope("owner", owner, filter), &ds.MessageTemplates},
+		{"statements", util.StatementCollection, byAccount(exportPeriod(bson.M{"owner": owner}, "period_end", filter), "account"), &ds.Statements},
+		{"balance snapshots", util.BalanceSnapshotCollection, byAccount(exportPeriod(bson.M{"owner": owner}, "taken_at", filter), "account"), &ds.BalanceSnapshots},
+		{"notifications", util.NotificationCollection, exportPeriod(exportScope("owner", owner, filter), "scheduled_at", filter), &ds.Notifications},
+		{"notification preferences", util.NotificationPreferenceCollection, owned, &ds.NotificationPreferences},
+	}
+
+	for _, q := range queries {
+		cursor, err := q.collection.Find(ctx, q.filter)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to fetch %s: %w", q.name, err)
+		}
+		if err := cursor.All(ctx, q.out); err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", q.name, err)
+		}
+	}
+
+	return ds, nil
+}
+
+// CreateExport stores job and builds its archive. Small exports are done
+// when it returns, larger ones finish in the background and are announced
+// over the socket.
+func CreateExport(ctx context.Context, job model.ExportJob) (model.ExportJob, error) {
+	now := time.Now()
+	job.Status = model.ExportPending
+	job.CreatedAt = now
+	job.ExpireAt = now.Add(exportRetention)
+	job.FileName = "fintrack-export-" + now.UTC().Format("20060102-150405") + ".zip"
+
+	count, err := util.TransactionCollection.CountDocuments(ctx, exportTransactionFilter(job.Owner, job.Filter))
+	if err != nil {
+		return job, fmt.Errorf("Failed to count transactions: %w", err)
+	}
+
+	res, err := util.ExportJobCollection.InsertOne(ctx, job)
+	if err != nil {
+		return job, err
+	}
+	job.ID = res.InsertedID.(primitive.ObjectID)
+
+	if count <= exportInlineLimit {
+		return runExport(ctx, job), nil
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(userContext(context.Background(), job.Owner), exportTimeout)
+		defer cancel()
+		runExport(ctx, job)
+	}()
+	return job, nil
+}
+
+// runExport builds the archive of job into GridFS and records the outcome.
+func runExport(ctx context.Context, job model.ExportJob) model.ExportJob {
+	_, _ = util.ExportJobCollection.UpdateByID(ctx, job.ID, bson.M{"$set": bson.M{"status": model.ExportRunning}})
+
+	file, size, err := buildExport(ctx, job)
+
+	job.FinishedAt = time.Now()
+	set := bson.M{"finished_at": job.FinishedAt}
+	if err != nil {
+		log.Printf("Export %s failed: %v", job.ID.Hex(), err)
+		job.Status, job.Error = model.ExportFailed, err.Error()
+		set["error"] = job.Error
+	} else {
+		job.Status, job.File, job.Size = model.ExportDone, file, size
+		set["file"], set["size"] = file, size
+	}
+	set["status"] = job.Status
+
+	if _, err := util.ExportJobCollection.UpdateByID(ctx, job.ID, bson.M{"$set": set}); err != nil {
+		log.Printf("Failed to record export %s: %v", job.ID.Hex(), err)
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "exports",
+		"action":     "update",
+		"detail":     job,
+	})
+	return job
+}
+
+// countingWriter tells how many bytes went through.
+type countingWriter struct {
+	w *gridfs.UploadStream
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func buildExport(ctx context.Context, job model.ExportJob) (primitive.ObjectID, int64, error) {
+	ds, err := LoadDataset(ctx, job.Owner, job.Filter)
+	if err != nil {
+		return primitive.NilObjectID, 0, err
+	}
+
+	// OFX statements end at the end of the range, not today
+	balances := map[primitive.ObjectID]float64{}
+	if !job.Filter.To.IsZero() {
+		for _, a := range ds.Accounts {
+			if balances[a.ID], err = BalanceAt(ctx, a.ID, job.Filter.To); err != nil {
+				return primitive.NilObjectID, 0, err
+			}
+		}
+		for _, s := range ds.Savings {
+			if balances[s.ID], err = BalanceAt(ctx, s.ID, job.Filter.To); err != nil {
+				return primitive.NilObjectID, 0, err
+			}
+		}
+	}
+
+	upload, err := util.ExportBucket.OpenUploadStream(job.FileName)
+	if err != nil {
+		return primitive.NilObjectID, 0, err
+	}
+	out := &countingWriter{w: upload}
+	if err := exporter.WriteArchive(out, ds, balances); err != nil {
+		_ = upload.Abort()
+		return primitive.NilObjectID, 0, err
+	}
+	if err := upload.Close(); err != nil {
+		return primitive.NilObjectID, 0, err
+	}
+
+	return upload.FileID.(primitive.ObjectID), out.n, nil
+}
+
+func OpenExportArchive(job model.ExportJob) (*gridfs.DownloadStream, error) {
+	if job.Status != model.ExportDone {
+		return nil, errors.New("export is not ready")
+	}
+	return util.ExportBucket.OpenDownloadStream(job.File)
+}
+
+func DeleteExport(ctx context.Context, job model.ExportJob) error {
+	if !job.File.IsZero() {
+		if err := util.ExportBucket.DeleteContext(ctx, job.File); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return fmt.Errorf("Failed to delete archive: %w", err)
+		}
+	}
+	if _, err := util.ExportJobCollection.DeleteOne(ctx, bson.M{"_id": job.ID}); err != nil {
+		return err
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "exports",
+		"action":     "delete",
+		"detail":     job.ID,
+	})
+	return nil
+}
+
+// PurgeExpiredExports removes exports past their retention with their
+// archives.
+func PurgeExpiredExports(ctx context.Context) error {
+	cursor, err := util.ExportJobCollection.Find(ctx, bson.M{"expire_at": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		return err
+	}
+	var jobs []model.ExportJob
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if err := DeleteExport(userContext(ctx, job.Owner), job); err != nil {
+			log.Printf("Failed to purge export %s: %v", job.ID.Hex(), err)
+		}
+	}
+	return nil
+}
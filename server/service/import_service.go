@@ -0,0 +1,747 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/parser"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// importChunkSize is how many rows one database transaction inserts.
+	importChunkSize = 200
+	// importPreviewTTL is how long a preview waits to be committed.
+	importPreviewTTL = 24 * time.Hour
+	// MaxImportRows caps one file, a preview is stored in a single document.
+	MaxImportRows = 5000
+	// maxImportBatchBytes keeps a preview clear of the 16 MB document limit.
+	maxImportBatchBytes = 14 << 20
+)
+
+// ErrImportClaimed is returned when the batch was already committed or is
+// being committed by another request.
+var ErrImportClaimed = errors.New("import was already committed")
+
+var ErrImportTooLarge = fmt.Errorf("the file is too large to import at once, split it into files of at most %d rows", MaxImportRows)
+
+func GetImportProfileByID(id string) (model.ImportProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.ImportProfile{}, err
+	}
+
+	var profile model.ImportProfile
+
+	err = util.ImportProfileCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&profile)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.ImportProfile{}, errors.New("import profile not found")
+		}
+		return model.ImportProfile{}, err
+	}
+
+	return profile, nil
+}
+
+func FetchImportProfilesSince(ctx context.Context, username string, since time.Time) (*mongo.Cursor, error) {
+	filter := bson.M{
+		"last_update": bson.M{
+			"$gt": since,
+		},
+		"owner": username,
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "last_update", Value: -1},
+	})
+
+	return util.ImportProfileCollection.Find(ctx, filter, opts)
+}
+
+func AddImportProfile(ctx context.Context, profile model.ImportProfile) (interface{}, error) {
+	profile.LastUpdate = time.Now()
+
+	result, err := util.ImportProfileCollection.InsertOne(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	profile.ID = result.InsertedID.(primitive.ObjectID)
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "import_profiles",
+		"action":     "create",
+		"detail":     profile,
+	})
+
+	return result.InsertedID, nil
+}
+
+func UpdateImportProfile(ctx context.Context, id primitive.ObjectID, profile model.ImportProfile) error {
+	profile.LastUpdate = time.Now()
+
+	update := bson.M{"$set": profile}
+	if profile.Account.IsZero() {
+		update["$unset"] = bson.M{"account": ""}
+	}
+	if _, err := util.ImportProfileCollection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return err
+	}
+
+	profile.ID = id
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "import_profiles",
+		"action":     "update",
+		"detail":     profile,
+	})
+
+	return nil
+}
+
+func DeleteImportProfile(ctx context.Context, id primitive.ObjectID) error {
+	_, err := util.ImportProfileCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"is_deleted":  true,
+		"last_update": time.Now(),
+	}})
+	if err != nil {
+		return fmt.Errorf("Error deleting import profile: %w", err)
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "import_profiles",
+		"action":     "delete",
+		"detail":     id,
+	})
+
+	return nil
+}
+
+func GetImportBatchByID(id string) (model.ImportBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.ImportBatch{}, err
+	}
+
+	var batch model.ImportBatch
+	err = util.ImportBatchCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&batch)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.ImportBatch{}, errors.New("import not found")
+		}
+		return model.ImportBatch{}, err
+	}
+
+	return batch, nil
+}
+
+// ParseImportFile reads an uploaded file in the given format. Statement
+// formats also return the balances they report.
+func ParseImportFile(format string, data []byte, profile model.ImportProfile) ([]parser.Row, []parser.Balance, error) {
+	text, _, err := parser.DecodeText(data, profile.Encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []parser.Row
+	switch format {
+	case "csv":
+		rows, err = parser.ParseCSV(text, profile)
+	case "ofx":
+		rows, err = parser.ParseOFX(text)
+	case "qif":
+		rows, err = parser.ParseQIF(text, profile.DateFormat, profile.DecimalComma)
+	case "camt053":
+		return parser.ParseCamt053(text)
+	case "mt940":
+		return parser.ParseMT940(text)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	return rows, nil, err
+}
+
+// PreviewImport turns parsed rows into transactions on account the way they
+// would be committed: payees matched, rules applied and likely duplicates
+// flagged. The preview is stored so the commit inserts exactly what was
+// shown.
+func PreviewImport(ctx context.Context, batch model.ImportBatch, rows []parser.Row, balances []parser.Balance) (model.ImportBatch, error) {
+	if len(rows) > MaxImportRows {
+		return batch, ErrImportTooLarge
+	}
+
+	payees, err := LoadPayeeMatcher(ctx, batch.Owner)
+	if err != nil {
+		return batch, err
+	}
+	rules, err := LoadRules(ctx, batch.Owner)
+	if err != nil {
+		return batch, err
+	}
+	accounts, err := loadBankAccountMap(ctx, batch.Owner)
+	if err != nil {
+		return batch, err
+	}
+
+	now := time.Now()
+	batch.ID = primitive.NewObjectID()
+	batch.Status = model.ImportPreview
+	batch.CreatedAt = now
+	batch.ExpireAt = now.Add(importPreviewTTL)
+	batch.Rows = make([]model.ImportRow, 0, len(rows))
+
+	for _, r := range rows {
+		row := model.ImportRow{Line: r.Line, Error: r.Err}
+		if row.Error == "" && math.Abs(r.Amount) < 0.005 {
+			row.Error = "Amount is zero"
+		}
+
+		row.Account = resolveAccount(accounts, r.Account, batch.Account)
+		if row.Error == "" && row.Account.IsZero() {
+			row.Error = "No account matches `" + r.Account + "`, set it as the bank account number of one"
+		}
+		if row.Error != "" {
+			batch.Rows = append(batch.Rows, row)
+			continue
+		}
+
+		// Ids are fixed now so a commit that is retried skips what it
+		// already inserted
+		tx := model.Transaction{
+			ID:          primitive.NewObjectID(),
+			Creator:     batch.Owner,
+			Amount:      roundMoney(math.Abs(r.Amount)),
+			DateTime:    r.Date,
+			ValueDate:   r.ValueDate,
+			Type:        "income",
+			Note:        r.Description,
+			ExternalID:  r.Reference,
+			ImportBatch: batch.ID,
+		}
+		if tx.ValueDate.Equal(tx.DateTime) {
+			tx.ValueDate = time.Time{}
+		}
+		if r.Amount < 0 {
+			tx.Type = "expense"
+			tx.SourceAccount = row.Account
+		} else {
+			tx.DestinationAccount = row.Account
+		}
+
+		row.CounterpartyName, row.CounterpartyIBAN = r.Payee, NormalizeIBAN(r.CounterpartyIBAN)
+		payee, ok := payees.MatchIBAN(r.CounterpartyIBAN)
+		if !ok {
+			payee, ok = payees.Match(r.Payee)
+		}
+		if !ok {
+			payee, ok = payees.Match(r.Description)
+		}
+		if ok {
+			tx.Payee = payee.ID
+			tx.Category = payee.DefaultCategory
+		}
+
+		for _, rule := range rules.Apply(&tx, false) {
+			row.Rules = append(row.Rules, rule.Name)
+		}
+
+		row.Transaction = tx
+		batch.Rows = append(batch.Rows, row)
+	}
+
+	for _, b := range balances {
+		batch.Balances = append(batch.Balances, model.ImportBalance{
+			Account:     resolveAccount(accounts, b.Account, batch.Account),
+			BankAccount: b.Account,
+			Currency:    b.Currency,
+			Opening:     b.Opening,
+			OpeningDate: b.OpeningDate,
+			Closing:     b.Closing,
+			ClosingDate: b.ClosingDate,
+		})
+	}
+
+	if err := flagDuplicates(ctx, &batch); err != nil {
+		return batch, err
+	}
+
+	// Long notes can still make a file within the row cap too large
+	doc, err := bson.Marshal(batch)
+	if err != nil {
+		return batch, err
+	}
+	if len(doc) > maxImportBatchBytes {
+		return batch, ErrImportTooLarge
+	}
+
+	if _, err := util.ImportBatchCollection.InsertOne(ctx, bson.Raw(doc)); err != nil {
+		return batch, err
+	}
+	return batch, nil
+}
+
+// flagDuplicates marks rows that repeat an existing transaction on their
+// account: the same bank id, or else the same type and amount within a day.
+// Each existing transaction accounts for one row at most.
+func flagDuplicates(ctx context.Context, batch *model.ImportBatch) error {
+	var first, last time.Time
+	var accounts []primitive.ObjectID
+	for _, row := range batch.Rows {
+		if row.Error != "" {
+			continue
+		}
+		if !containsID(accounts, row.Account) {
+			accounts = append(accounts, row.Account)
+		}
+		d := row.Transaction.DateTime
+		if first.IsZero() || d.Before(first) {
+			first = d
+		}
+		if d.After(last) {
+			last = d
+		}
+	}
+	if first.IsZero() {
+		return nil
+	}
+
+	cursor, err := util.TransactionCollection.Find(ctx, bson.M{
+		"creator":    batch.Owner,
+		"is_deleted": false,
+		"$or": []bson.M{
+			{"source_account": bson.M{"$in": accounts}},
+			{"destination_account": bson.M{"$in": accounts}},
+		},
+		"date_time": bson.M{
+			"$gte": first.AddDate(0, 0, -1),
+			"$lte": last.AddDate(0, 0, 1),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to fetch existing transactions: %w", err)
+	}
+	var existing []model.Transaction
+	if err := cursor.All(ctx, &existing); err != nil {
+		return err
+	}
+
+	used := map[primitive.ObjectID]bool{}
+	match := func(same func(old model.Transaction) bool) primitive.ObjectID {
+		for _, old := range existing {
+			if !used[old.ID] && same(old) {
+				used[old.ID] = true
+				return old.ID
+			}
+		}
+		return primitive.NilObjectID
+	}
+
+	// Bank ids first, they are certain
+	for i := range batch.Rows {
+		tx := batch.Rows[i].Transaction
+		if batch.Rows[i].Error != "" || tx.ExternalID == "" {
+			continue
+		}
+		batch.Rows[i].Duplicate = match(func(old model.Transaction) bool {
+			return old.ExternalID == tx.ExternalID && transactionEffect(old, batch.Rows[i].Account) != 0
+		})
+	}
+	for i := range batch.Rows {
+		tx := batch.Rows[i].Transaction
+		if batch.Rows[i].Error != "" || !batch.Rows[i].Duplicate.IsZero() {
+			continue
+		}
+		batch.Rows[i].Duplicate = match(func(old model.Transaction) bool {
+			if old.ExternalID != "" && tx.ExternalID != "" {
+				return false
+			}
+			account := batch.Rows[i].Account
+			return math.Abs(transactionEffect(old, account)-transactionEffect(tx, account)) < balanceEpsilon &&
+				math.Abs(old.DateTime.Sub(tx.DateTime).Hours()) <= 24
+		})
+	}
+
+	return nil
+}
+
+type ImportSummary struct {
+	Batch      primitive.ObjectID `json:"batch"`
+	Imported   int                `json:"imported"`
+	Duplicates int                `json:"duplicates"`
+	Skipped    int                `json:"skipped"`
+	Errors     int                `json:"errors"`
+	// Rows kept out because they break an account's spending rule
+	Refused []ImportRefusal `json:"refused,omitempty"`
+	// Statement balances against the ledger after the import
+	Balances []model.ImportBalance `json:"balances,omitempty"`
+}
+
+type ImportRefusal struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// CommitImport inserts a previewed batch in chunks, each chunk in its own
+// database transaction. Rows listed in skip, rows with errors, rows that
+// break an account's spending rule and, unless includeDuplicates, flagged
+// duplicates are left out. The batch is claimed first so it is committed
+// once, a commit that failed half way releases it to be run again.
+func CommitImport(ctx context.Context, batch model.ImportBatch, skip []int, includeDuplicates bool) (ImportSummary, error) {
+	summary := ImportSummary{Batch: batch.ID}
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return summary, fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, util.ImportBatchCollection.FindOneAndUpdate(sc,
+			bson.M{"_id": batch.ID, "status": model.ImportPreview},
+			bson.M{"$set": bson.M{"status": model.ImportCommitting}},
+		).Err()
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return summary, ErrImportClaimed
+	}
+	if err != nil {
+		return summary, err
+	}
+
+	summary, err = commitImportRows(ctx, session, batch, skip, includeDuplicates)
+	if err != nil {
+		_, releaseErr := util.ImportBatchCollection.UpdateOne(ctx,
+			bson.M{"_id": batch.ID, "status": model.ImportCommitting},
+			bson.M{"$set": bson.M{"status": model.ImportPreview}})
+		if releaseErr != nil {
+			log.Printf("Failed to release import %s: %v", batch.ID.Hex(), releaseErr)
+		}
+	}
+	return summary, err
+}
+
+func commitImportRows(ctx context.Context, session mongo.Session, batch model.ImportBatch, skip []int, includeDuplicates bool) (ImportSummary, error) {
+	summary := ImportSummary{Batch: batch.ID}
+
+	skipped := map[int]bool{}
+	for _, line := range skip {
+		skipped[line] = true
+	}
+
+	var rows []model.ImportRow
+	for _, row := range batch.Rows {
+		switch {
+		case row.Error != "":
+			summary.Errors++
+		case skipped[row.Line]:
+			summary.Skipped++
+		case !row.Duplicate.IsZero() && !includeDuplicates:
+			summary.Duplicates++
+		default:
+			rows = append(rows, row)
+		}
+	}
+
+	rows, refused, err := checkImportSpending(ctx, rows)
+	if err != nil {
+		return summary, err
+	}
+	summary.Refused = refused
+	summary.Errors += len(refused)
+
+	if err := linkCounterparties(ctx, batch.Owner, rows); err != nil {
+		return summary, err
+	}
+	pending := make([]model.Transaction, len(rows))
+	for i, row := range rows {
+		pending[i] = row.Transaction
+	}
+
+	now := time.Now()
+	var inserted []model.Transaction
+	for start := 0; start < len(pending); start += importChunkSize {
+		chunk := pending[start:min(start+importChunkSize, len(pending))]
+
+		_, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			ids := make([]primitive.ObjectID, len(chunk))
+			for i, tx := range chunk {
+				ids[i] = tx.ID
+			}
+			done, err := util.TransactionCollection.Distinct(sc, "_id", bson.M{"_id": bson.M{"$in": ids}})
+			if err != nil {
+				return nil, err
+			}
+			exists := map[primitive.ObjectID]bool{}
+			for _, id := range done {
+				exists[id.(primitive.ObjectID)] = true
+			}
+
+			for _, tx := range chunk {
+				if exists[tx.ID] {
+					continue
+				}
+				tx.LastUpdate = now
+				if _, err := insertTransaction(sc, tx); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		})
+		if err != nil {
+			summary.Imported = len(inserted)
+			return summary, fmt.Errorf("Failed to import rows %d-%d: %w", start+1, start+len(chunk), err)
+		}
+		inserted = append(inserted, chunk...)
+	}
+	summary.Imported = len(inserted)
+
+	refreshStatementsFor(ctx, inserted...)
+
+	summary.Balances = reconcileImportBalances(ctx, batch.Balances)
+
+	_, err = util.ImportBatchCollection.UpdateByID(ctx, batch.ID, bson.M{
+		"$set": bson.M{
+			"status":       model.ImportCommitted,
+			"imported":     summary.Imported,
+			"committed_at": now,
+			"balances":     summary.Balances,
+		},
+		"$unset": bson.M{"expire_at": ""},
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "import",
+		"detail":     summary,
+	})
+
+	return summary, nil
+}
+
+// checkImportSpending keeps out rows that would break the spending rule of
+// the account they take money from, in file order, each row counted against
+// the balance the rows before it left. Rows inserted by an earlier attempt
+// are already in the balance and pass.
+func checkImportSpending(ctx context.Context, rows []model.ImportRow) ([]model.ImportRow, []ImportRefusal, error) {
+	ids := make([]primitive.ObjectID, len(rows))
+	for i, row := range rows {
+		ids[i] = row.Transaction.ID
+	}
+	done, err := util.TransactionCollection.Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, nil, err
+	}
+	inserted := map[primitive.ObjectID]bool{}
+	for _, id := range done {
+		inserted[id.(primitive.ObjectID)] = true
+	}
+
+	// Savings have no rules and stay nil
+	accounts := map[primitive.ObjectID]*model.Account{}
+	account := func(id primitive.ObjectID) *model.Account {
+		if a, ok := accounts[id]; ok {
+			return a
+		}
+		accounts[id] = nil
+		if a, err := GetAccountByID(id.Hex()); err == nil {
+			accounts[id] = &a
+		}
+		return accounts[id]
+	}
+
+	var kept []model.ImportRow
+	var refused []ImportRefusal
+	for _, row := range rows {
+		tx := row.Transaction
+		if !inserted[tx.ID] && !tx.SourceAccount.IsZero() {
+			var err error
+			if tx.SourceAccount != row.Account {
+				// A rule moved the money out of another account
+				before := tx
+				before.SourceAccount = primitive.NilObjectID
+				err = CheckRuleSource(before, tx)
+			} else if source := account(tx.SourceAccount); source != nil {
+				err = CheckSpendingRule(*source, tx.Amount, "")
+			}
+			if err != nil {
+				refused = append(refused, ImportRefusal{Line: row.Line, Error: err.Error()})
+				continue
+			}
+		}
+
+		kept = append(kept, row)
+		if !inserted[tx.ID] {
+			for id, a := range accounts {
+				if a != nil {
+					a.Balance += transactionEffect(tx, id)
+				}
+			}
+		}
+	}
+	return kept, refused, nil
+}
+
+// linkCounterparties gives rows without a payee the payee of the counterparty
+// the bank reported, creating payees for counterparties seen the first time.
+func linkCounterparties(ctx context.Context, owner string, rows []model.ImportRow) error {
+	payees, err := LoadPayeeMatcher(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	// Counterparties created in this commit, by IBAN or name
+	created := map[string]primitive.ObjectID{}
+	var newPayees []interface{}
+	now := time.Now()
+
+	for i := range rows {
+		row := &rows[i]
+		if !row.Transaction.Payee.IsZero() || row.CounterpartyName == "" {
+			continue
+		}
+
+		payee, ok := payees.MatchIBAN(row.CounterpartyIBAN)
+		if !ok {
+			payee, ok = payees.Match(row.CounterpartyName)
+		}
+		if ok {
+			row.Transaction.Payee = payee.ID
+			if row.Transaction.Category.IsZero() && row.Transaction.Type != "transfer" {
+				row.Transaction.Category = payee.DefaultCategory
+			}
+			if row.CounterpartyIBAN != "" {
+				if _, err := util.PayeeCollection.UpdateByID(ctx, payee.ID, bson.M{
+					"$addToSet": bson.M{"ibans": row.CounterpartyIBAN},
+				}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		key := row.CounterpartyIBAN
+		if key == "" {
+			key = util.NormalizeText(row.CounterpartyName)
+		}
+		if id, ok := created[key]; ok {
+			row.Transaction.Payee = id
+			continue
+		}
+
+		payee = model.Payee{
+			ID:         primitive.NewObjectID(),
+			Owner:      owner,
+			Name:       row.CounterpartyName,
+			Aliases:    []string{},
+			LastUpdate: now,
+		}
+		if row.CounterpartyIBAN != "" {
+			payee.IBANs = []string{row.CounterpartyIBAN}
+		}
+		created[key] = payee.ID
+		newPayees = append(newPayees, payee)
+		row.Transaction.Payee = payee.ID
+	}
+
+	if len(newPayees) == 0 {
+		return nil
+	}
+	if _, err := util.PayeeCollection.InsertMany(ctx, newPayees); err != nil {
+		return fmt.Errorf("Failed to create payees: %w", err)
+	}
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "payees",
+		"action":     "create",
+		"detail":     "bulk",
+	})
+	return nil
+}
+
+// reconcileImportBalances compares statement balances with the ledger at the
+// same moments. A statement whose account was not resolved stays
+// unreconciled.
+func reconcileImportBalances(ctx context.Context, balances []model.ImportBalance) []model.ImportBalance {
+	for i := range balances {
+		b := &balances[i]
+		if b.Account.IsZero() {
+			continue
+		}
+
+		opening, err := BalanceAt(ctx, b.Account, b.OpeningDate.Add(-time.Nanosecond))
+		if err != nil {
+			log.Printf("Failed to reconcile opening balance of %s: %v", b.Account.Hex(), err)
+			continue
+		}
+		closing, err := BalanceAt(ctx, b.Account, b.ClosingDate)
+		if err != nil {
+			log.Printf("Failed to reconcile closing balance of %s: %v", b.Account.Hex(), err)
+			continue
+		}
+
+		b.OpeningLedger, b.ClosingLedger = &opening, &closing
+		b.Reconciled = math.Abs(opening-b.Opening) < balanceEpsilon && math.Abs(closing-b.Closing) < balanceEpsilon
+	}
+	return balances
+}
+
+// resolveAccount maps the account a file names to one of the owner's. The
+// account the file names wins over the one picked on upload.
+func resolveAccount(accounts map[string]primitive.ObjectID, bankAccount string, fallback primitive.ObjectID) primitive.ObjectID {
+	if id, ok := accounts[normalizeBankAccount(bankAccount)]; ok && bankAccount != "" {
+		return id
+	}
+	return fallback
+}
+
+// loadBankAccountMap indexes the owner's accounts by bank account number and
+// by name, the two ways statement files refer to them.
+func loadBankAccountMap(ctx context.Context, owner string) (map[string]primitive.ObjectID, error) {
+	cursor, err := util.AccountCollection.Find(ctx, bson.M{"owner": owner, "is_deleted": false})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch accounts: %w", err)
+	}
+	var accounts []model.Account
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]primitive.ObjectID{}
+	for _, account := range accounts {
+		if key := normalizeBankAccount(account.Name); key != "" {
+			byKey[key] = account.ID
+		}
+	}
+	// Numbers are more specific than names, they win a clash
+	for _, account := range accounts {
+		if key := normalizeBankAccount(account.BankAccountNumber); key != "" {
+			byKey[key] = account.ID
+		}
+	}
+	return byKey, nil
+}
+
+// normalizeBankAccount drops spaces, dashes and case: "0071 000-123" and
+// "0071000123" are the same account.
+func normalizeBankAccount(s string) string {
+	return strings.ReplaceAll(util.NormalizeText(s), " ", "")
+}
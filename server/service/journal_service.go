@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type JournalImportSummary struct {
+	Accounts     int `json:"accounts"`
+	Savings      int `json:"savings"`
+	Categories   int `json:"categories"`
+	Tags         int `json:"tags"`
+	Payees       int `json:"payees"`
+	Transactions int `json:"transactions"`
+	Duplicates   int `json:"duplicates"`
+}
+
+// journalRefs maps the ids of a read journal to the owner's records.
+type journalRefs map[primitive.ObjectID]primitive.ObjectID
+
+func (r journalRefs) get(id primitive.ObjectID) primitive.ObjectID {
+	if id.IsZero() {
+		return id
+	}
+	return r[id]
+}
+
+// ownedIDs returns the owner's live records of collection by id and by key,
+// key being whatever identifies a record by name.
+func ownedIDs(ctx context.Context, collection *mongo.Collection, owner string, key func(bson.M) string) (map[primitive.ObjectID]bool, map[string]primitive.ObjectID, error) {
+	cursor, err := collection.Find(ctx, bson.M{"owner": owner, "is_deleted": bson.M{"$ne": true}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, nil, err
+	}
+	ids := map[primitive.ObjectID]bool{}
+	keys := map[string]primitive.ObjectID{}
+	for _, doc := range docs {
+		id, _ := doc["_id"].(primitive.ObjectID)
+		ids[id] = true
+		keys[key(doc)] = id
+	}
+	return ids, keys, nil
+}
+
+func nameKey(doc bson.M) string {
+	name, _ := doc["name"].(string)
+	return util.NormalizeText(name)
+}
+
+func categoryKey(doc bson.M) string {
+	kind, _ := doc["type"].(string)
+	return kind + ":" + nameKey(doc)
+}
+
+// matchJournalRecords links each record of a journal to the owner's: the
+// same id when the owner has it, else the same name, else a new record that
+// create builds with the id it is given.
+func matchJournalRecords(ctx context.Context, collection *mongo.Collection, owner string, refs journalRefs,
+	ids []primitive.ObjectID, keys []string, key func(bson.M) string, create func(i int, id primitive.ObjectID) interface{}) (int, error) {
+	owned, byKey, err := ownedIDs(ctx, collection, owner, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var created []interface{}
+	for i, id := range ids {
+		switch existing, ok := byKey[keys[i]]; {
+		case owned[id]:
+			refs[id] = id
+		case ok:
+			refs[id] = existing
+		default:
+			newID := primitive.NewObjectID()
+			refs[id] = newID
+			byKey[keys[i]] = newID
+			created = append(created, create(i, newID))
+		}
+	}
+	if len(created) == 0 {
+		return 0, nil
+	}
+	if _, err := collection.InsertMany(ctx, created); err != nil {
+		return 0, err
+	}
+	return len(created), nil
+}
+
+// ImportJournal adds what a plain-text journal holds to the owner's data.
+// Accounts, categories, tags and payees are matched by id, then by name, and
+// created when missing. Transactions the owner already has are skipped, so
+// a journal exported from fintrack can be imported again.
+func ImportJournal(ctx context.Context, owner string, ds *model.Dataset) (JournalImportSummary, error) {
+	var summary JournalImportSummary
+	refs := journalRefs{}
+	now := time.Now()
+
+	steps := []struct {
+		name       string
+		collection *mongo.Collection
+		count      *int
+		ids        []primitive.ObjectID
+		keys       []string
+		key        func(bson.M) string
+		create     func(i int, id primitive.ObjectID) interface{}
+	}{
+		{name: "accounts", collection: util.AccountCollection, count: &summary.Accounts, key: nameKey,
+			create: func(i int, id primitive.ObjectID) interface{} {
+				a := ds.Accounts[i]
+				return model.Account{
+					ID: id, Owner: owner, Type: a.AccountType(), Name: a.Name, Icon: a.Icon,
+					BankAccountNumber: a.BankAccountNumber, LastUpdate: now,
+				}
+			}},
+		{name: "savings", collection: util.SavingCollection, count: &summary.Savings, key: nameKey,
+			create: func(i int, id primitive.ObjectID) interface{} {
+				s := ds.Savings[i]
+				return model.Saving{ID: id, Owner: owner, Name: s.Name, Icon: s.Icon, CreatedDate: now}
+			}},
+		{name: "categories", collection: util.CategoryCollection, count: &summary.Categories, key: categoryKey,
+			create: func(i int, id primitive.ObjectID) interface{} {
+				c := ds.Categories[i]
+				return model.Category{ID: id, Owner: owner, Type: c.Type, Name: c.Name, Icon: c.Icon, LastUpdate: now}
+			}},
+		{name: "tags", collection: util.TagCollection, count: &summary.Tags, key: nameKey,
+			create: func(i int, id primitive.ObjectID) interface{} {
+				t := ds.Tags[i]
+				return model.Tag{ID: id, Owner: owner, Name: t.Name, Color: t.Color, LastUpdate: now}
+			}},
+		{name: "payees", collection: util.PayeeCollection, count: &summary.Payees, key: nameKey,
+			create: func(i int, id primitive.ObjectID) interface{} {
+				p := ds.Payees[i]
+				aliases := p.Aliases
+				if aliases == nil {
+					aliases = []string{}
+				}
+				return model.Payee{ID: id, Owner: owner, Name: p.Name, Aliases: aliases, LastUpdate: now}
+			}},
+	}
+	for _, a := range ds.Accounts {
+		steps[0].ids, steps[0].keys = append(steps[0].ids, a.ID), append(steps[0].keys, util.NormalizeText(a.Name))
+	}
+	for _, s := range ds.Savings {
+		steps[1].ids, steps[1].keys = append(steps[1].ids, s.ID), append(steps[1].keys, util.NormalizeText(s.Name))
+	}
+	for _, c := range ds.Categories {
+		steps[2].ids, steps[2].keys = append(steps[2].ids, c.ID), append(steps[2].keys, c.Type+":"+util.NormalizeText(c.Name))
+	}
+	for _, t := range ds.Tags {
+		steps[3].ids, steps[3].keys = append(steps[3].ids, t.ID), append(steps[3].keys, util.NormalizeText(t.Name))
+	}
+	for _, p := range ds.Payees {
+		steps[4].ids, steps[4].keys = append(steps[4].ids, p.ID), append(steps[4].keys, util.NormalizeText(p.Name))
+	}
+
+	for _, step := range steps {
+		n, err := matchJournalRecords(ctx, step.collection, owner, refs, step.ids, step.keys, step.key, step.create)
+		if err != nil {
+			return summary, fmt.Errorf("Failed to import %s: %w", step.name, err)
+		}
+		*step.count = n
+		if n > 0 {
+			socket.BroadcastFromContext(ctx, map[string]interface{}{
+				"collection": step.name,
+				"action":     "create",
+				"detail":     "bulk",
+			})
+		}
+	}
+
+	// Transactions already imported keep their ids, others get new ones
+	ids := make([]primitive.ObjectID, len(ds.Transactions))
+	for i, tx := range ds.Transactions {
+		ids[i] = tx.ID
+	}
+	existing, err := util.TransactionCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return summary, err
+	}
+	var found []model.Transaction
+	if err := existing.All(ctx, &found); err != nil {
+		return summary, err
+	}
+	taken := map[primitive.ObjectID]bool{}
+	mine := map[primitive.ObjectID]bool{}
+	for _, tx := range found {
+		taken[tx.ID] = true
+		mine[tx.ID] = tx.Creator == owner
+	}
+
+	var pending []model.Transaction
+	for _, tx := range ds.Transactions {
+		if mine[tx.ID] {
+			summary.Duplicates++
+			continue
+		}
+		if taken[tx.ID] || tx.ID.IsZero() {
+			tx.ID = primitive.NewObjectID()
+		}
+		tx.Creator = owner
+		tx.LastUpdate = now
+		tx.SourceAccount = refs.get(tx.SourceAccount)
+		tx.DestinationAccount = refs.get(tx.DestinationAccount)
+		tx.Category = refs.get(tx.Category)
+		tx.Payee = refs.get(tx.Payee)
+		for i := range tx.Splits {
+			tx.Splits[i].Category = refs.get(tx.Splits[i].Category)
+		}
+		for i := range tx.Tags {
+			tx.Tags[i] = refs.get(tx.Tags[i])
+		}
+		pending = append(pending, tx)
+	}
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return summary, fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	var inserted []model.Transaction
+	for start := 0; start < len(pending); start += importChunkSize {
+		chunk := pending[start:min(start+importChunkSize, len(pending))]
+		_, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			for _, tx := range chunk {
+				if _, err := insertTransaction(sc, tx); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		})
+		if err != nil {
+			summary.Transactions = len(inserted)
+			return summary, fmt.Errorf("Failed to import transactions %d-%d: %w", start+1, start+len(chunk), err)
+		}
+		inserted = append(inserted, chunk...)
+	}
+	summary.Transactions = len(inserted)
+
+	refreshStatementsFor(ctx, inserted...)
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "import",
+		"detail":     summary,
+	})
+
+	return summary, nil
+}
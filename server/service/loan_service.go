@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// BuildAmortizationSchedule splits a loan into term monthly installments, the
+// first one due a month after start. Rounding leftovers go to the last one so
+// the principal parts always add up to principal.
+func BuildAmortizationSchedule(principal, rate float64, method model.InterestMethod, term int, start time.Time) ([]model.Installment, error) {
+	if principal <= 0 {
+		return nil, errors.New("principal should be positive")
+	}
+	if rate < 0 {
+		return nil, errors.New("rate cannot be negative")
+	}
+	if term <= 0 {
+		return nil, errors.New("term should be at least one month")
+	}
+
+	monthly := rate / 12 / 100
+
+	var payment float64
+	switch method {
+	case model.InterestFlat:
+		payment = roundMoney(principal/float64(term)) + roundMoney(principal*monthly)
+	case model.InterestReducing:
+		if monthly == 0 {
+			payment = roundMoney(principal / float64(term))
+		} else {
+			payment = roundMoney(principal * monthly / (1 - math.Pow(1+monthly, -float64(term))))
+		}
+	default:
+		return nil, fmt.Errorf("invalid interest method `%s`, expected {flat|reducing}", method)
+	}
+
+	schedule := make([]model.Installment, 0, term)
+	remaining := principal
+	for n := 1; n <= term; n++ {
+		interest := roundMoney(principal * monthly)
+		if method == model.InterestReducing {
+			interest = roundMoney(remaining * monthly)
+		}
+
+		part := roundMoney(payment - interest)
+		if n == term || part > remaining {
+			part = roundMoney(remaining)
+		}
+		remaining = roundMoney(remaining - part)
+
+		schedule = append(schedule, model.Installment{
+			Number:    n,
+			DueDate:   addMonths(start, n),
+			Payment:   roundMoney(part + interest),
+			Principal: part,
+			Interest:  interest,
+			Remaining: remaining,
+		})
+	}
+
+	return schedule, nil
+}
+
+// addMonths moves t n months on, to the last day of the month when it is
+// shorter: a loan taken on Jan 31 is due Feb 29, then Mar 31.
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := min(t.Day(), first.AddDate(0, 1, -1).Day())
+	return first.AddDate(0, 0, day-1)
+}
+
+// loanProgress returns the principal still owed and the index of the first
+// unpaid installment.
+func loanProgress(loan model.Loan) (remaining float64, next int) {
+	remaining = loan.Principal
+	for i, inst := range loan.Schedule {
+		if !inst.Paid {
+			return remaining, i
+		}
+		remaining = inst.Remaining
+	}
+	return remaining, len(loan.Schedule)
+}
+
+func GetLoanById(id string) (model.Loan, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Loan{}, err
+	}
+
+	var loan model.Loan
+
+	err = util.LoanCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&loan)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.Loan{}, errors.New("Loan not found")
+		}
+		return model.Loan{}, err
+	}
+
+	return loan, nil
+}
+
+func FetchLoansSince(ctx context.Context, username string, since time.Time) (*mongo.Cursor, error) {
+	filter := bson.M{
+		"last_update": bson.M{
+			"$gt": since,
+		},
+		"creator": username,
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "last_update", Value: -1},
+	})
+
+	return util.LoanCollection.Find(ctx, filter, opts)
+}
+
+func AddLoan(ctx context.Context, loan model.Loan) (interface{}, error) {
+	schedule, err := BuildAmortizationSchedule(loan.Principal, loan.Rate, loan.Method, loan.Term, loan.StartDate)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Schedule = schedule
+	loan.NextDue = schedule[0].DueDate
+	loan.IsActive = true
+	loan.LastUpdate = time.Now()
+
+	res, err := util.LoanCollection.InsertOne(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+	loan.ID = res.InsertedID.(primitive.ObjectID)
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "loans",
+		"action":     "create",
+		"detail":     loan,
+	})
+
+	return res.InsertedID, nil
+}
+
+func DeleteLoan(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$set": bson.M{
+			"is_deleted":  true,
+			"is_active":   false,
+			"last_update": time.Now(),
+		},
+	}
+
+	_, err := util.LoanCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "loans",
+		"action":     "delete",
+		"detail":     id,
+	})
+
+	return nil
+}
+
+// saveLoanProgress writes the schedule back and moves next_due to the first
+// unpaid installment, deactivating the loan once everything is paid.
+func saveLoanProgress(sc mongo.SessionContext, loan *model.Loan, now time.Time) error {
+	_, next := loanProgress(*loan)
+	loan.LastUpdate = now
+	if next < len(loan.Schedule) {
+		loan.NextDue = loan.Schedule[next].DueDate
+	} else {
+		loan.IsActive = false
+		loan.PaidOffAt = now
+	}
+
+	set := bson.M{
+		"schedule":    loan.Schedule,
+		"is_active":   loan.IsActive,
+		"next_due":    loan.NextDue,
+		"last_update": loan.LastUpdate,
+	}
+	if !loan.IsActive {
+		set["paid_off_at"] = loan.PaidOffAt
+	}
+
+	_, err := util.LoanCollection.UpdateByID(sc, loan.ID, bson.M{"$set": set})
+	return err
+}
+
+// PostDueInstallments books every installment that fell due, each one with
+// its transactions and schedule update in a single database transaction.
+func PostDueInstallments(ctx context.Context) error {
+	now := time.Now()
+
+	cursor, err := util.LoanCollection.Find(ctx, bson.M{
+		"is_active":  true,
+		"is_deleted": false,
+		"next_due":   bson.M{"$lte": now},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to fetch due loans: %w", err)
+	}
+	var loans []model.Loan
+	if err := cursor.All(ctx, &loans); err != nil {
+		return err
+	}
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	for _, loan := range loans {
+		userCtx := userContext(ctx, loan.Creator)
+		posted := false
+
+		for {
+			_, next := loanProgress(loan)
+			if next >= len(loan.Schedule) || loan.Schedule[next].DueDate.After(now) {
+				break
+			}
+			inst := &loan.Schedule[next]
+
+			_, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+				principal := model.Transaction{
+					Creator:            loan.Creator,
+					Amount:             inst.Principal,
+					DateTime:           inst.DueDate,
+					Type:               "transfer",
+					SourceAccount:      loan.SourceAccount,
+					DestinationAccount: loan.Account,
+					Note:               fmt.Sprintf("Installment %d/%d for %s", inst.Number, len(loan.Schedule), loan.Name),
+					LastUpdate:         now,
+				}
+				id, err := insertTransaction(sc, principal)
+				if err != nil {
+					return nil, err
+				}
+				inst.PrincipalTransaction = id.(primitive.ObjectID)
+
+				if inst.Interest > 0 {
+					interest := model.Transaction{
+						Creator:       loan.Creator,
+						Amount:        inst.Interest,
+						DateTime:      inst.DueDate,
+						Type:          "expense",
+						SourceAccount: loan.SourceAccount,
+						Category:      loan.InterestCategory,
+						Note:          fmt.Sprintf("Interest %d/%d for %s", inst.Number, len(loan.Schedule), loan.Name),
+						LastUpdate:    now,
+					}
+					id, err := insertTransaction(sc, interest)
+					if err != nil {
+						return nil, err
+					}
+					inst.InterestTransaction = id.(primitive.ObjectID)
+				}
+
+				inst.Paid = true
+				return nil, saveLoanProgress(sc, &loan, now)
+			})
+			if err != nil {
+				inst.Paid = false
+				log.Printf("Failed to post installment %d of loan %s: %v", inst.Number, loan.ID.Hex(), err)
+				break
+			}
+			posted = true
+		}
+
+		if !posted {
+			continue
+		}
+		socket.BroadcastFromContext(userCtx, map[string]interface{}{
+			"collection": "transactions",
+			"action":     "create",
+			"detail":     "bulk",
+		})
+		socket.BroadcastFromContext(userCtx, map[string]interface{}{
+			"collection": "loans",
+			"action":     "update",
+			"detail":     loan,
+		})
+	}
+
+	return nil
+}
+
+// PrepayLoan books an early repayment of principal and recalculates the
+// unpaid installments over the same remaining term, so each later payment
+// gets smaller. Repaying everything that is left pays the loan off.
+func PrepayLoan(ctx context.Context, id primitive.ObjectID, amount float64, at time.Time) (model.Loan, error) {
+	var loan model.Loan
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return loan, fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := util.LoanCollection.FindOne(sc, bson.M{"_id": id}).Decode(&loan); err != nil {
+			return nil, err
+		}
+		if !loan.IsActive {
+			return nil, errors.New("loan is already paid off")
+		}
+
+		remaining, next := loanProgress(loan)
+		if amount <= 0 {
+			return nil, errors.New("amount should be positive")
+		}
+		if amount > remaining+balanceEpsilon {
+			return nil, fmt.Errorf("amount exceeds the remaining principal of %.2f", remaining)
+		}
+
+		_, err := insertTransaction(sc, model.Transaction{
+			Creator:            loan.Creator,
+			Amount:             amount,
+			DateTime:           at,
+			Type:               "transfer",
+			SourceAccount:      loan.SourceAccount,
+			DestinationAccount: loan.Account,
+			Note:               "Early repayment for " + loan.Name,
+			LastUpdate:         time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		paid := loan.Schedule[:next]
+		left := roundMoney(remaining - amount)
+		if left <= balanceEpsilon {
+			loan.Schedule = paid
+			return nil, saveLoanProgress(sc, &loan, time.Now())
+		}
+
+		tail, err := BuildAmortizationSchedule(left, loan.Rate, loan.Method, len(loan.Schedule)-next, loan.StartDate)
+		if err != nil {
+			return nil, err
+		}
+		// Due dates count from the start, a clamped Feb 29 must not move
+		// the rest of the schedule to the 29th
+		for i := range tail {
+			tail[i].Number += next
+			tail[i].DueDate = addMonths(loan.StartDate, tail[i].Number)
+		}
+
+		loan.Schedule = append(paid, tail...)
+		return nil, saveLoanProgress(sc, &loan, time.Now())
+	})
+	if err != nil {
+		return loan, err
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "create",
+		"detail":     "bulk",
+	})
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "loans",
+		"action":     "update",
+		"detail":     loan,
+	})
+
+	return loan, nil
+}
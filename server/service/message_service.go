@@ -0,0 +1,441 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/parser"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func GetMessageTemplateByID(id string) (model.MessageTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.MessageTemplate{}, err
+	}
+
+	var template model.MessageTemplate
+
+	err = util.MessageTemplateCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&template)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.MessageTemplate{}, errors.New("message template not found")
+		}
+		return model.MessageTemplate{}, err
+	}
+
+	return template, nil
+}
+
+func FetchMessageTemplatesSince(ctx context.Context, username string, since time.Time) (*mongo.Cursor, error) {
+	filter := bson.M{
+		"last_update": bson.M{
+			"$gt": since,
+		},
+		"owner": username,
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "last_update", Value: -1},
+	})
+
+	return util.MessageTemplateCollection.Find(ctx, filter, opts)
+}
+
+func AddMessageTemplate(ctx context.Context, template model.MessageTemplate) (interface{}, error) {
+	template.LastUpdate = time.Now()
+
+	result, err := util.MessageTemplateCollection.InsertOne(ctx, template)
+	if err != nil {
+		return nil, err
+	}
+	template.ID = result.InsertedID.(primitive.ObjectID)
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "message_templates",
+		"action":     "create",
+		"detail":     template,
+	})
+
+	return result.InsertedID, nil
+}
+
+func UpdateMessageTemplate(ctx context.Context, id primitive.ObjectID, template model.MessageTemplate) error {
+	template.LastUpdate = time.Now()
+
+	update := bson.M{"$set": template}
+	if template.Account.IsZero() {
+		update["$unset"] = bson.M{"account": ""}
+	}
+	if _, err := util.MessageTemplateCollection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return err
+	}
+
+	template.ID = id
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "message_templates",
+		"action":     "update",
+		"detail":     template,
+	})
+
+	return nil
+}
+
+func DeleteMessageTemplate(ctx context.Context, id primitive.ObjectID) error {
+	_, err := util.MessageTemplateCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"is_deleted":  true,
+		"last_update": time.Now(),
+	}})
+	if err != nil {
+		return fmt.Errorf("Error deleting message template: %w", err)
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "message_templates",
+		"action":     "delete",
+		"detail":     id,
+	})
+
+	return nil
+}
+
+// loadMessageTemplates lists the templates tried on owner's messages: their
+// own, most recently edited first, then the built-in ones.
+func loadMessageTemplates(ctx context.Context, owner string) ([]model.MessageTemplate, error) {
+	cursor, err := util.MessageTemplateCollection.Find(ctx,
+		bson.M{"owner": owner, "is_deleted": false},
+		options.Find().SetSort(bson.D{{Key: "last_update", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch message templates: %w", err)
+	}
+	var templates []model.MessageTemplate
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+	return append(templates, parser.BuiltinTemplates...), nil
+}
+
+// IncomingMessage is a notification as the phone received it. Account is
+// where its money goes when neither the template nor the message says.
+type IncomingMessage struct {
+	Sender     string
+	Text       string
+	ReceivedAt time.Time
+	Account    primitive.ObjectID
+	Commit     bool // book it, rather than only propose it
+}
+
+// MessageResult is what became of an ingested message, see the Message*
+// statuses.
+type MessageResult struct {
+	Status      string             `json:"status"`
+	Template    string             `json:"template,omitempty"`
+	Provider    string             `json:"provider,omitempty"`
+	Transaction *model.Transaction `json:"transaction,omitempty"`
+	Duplicate   primitive.ObjectID `json:"duplicate,omitempty"` // the transaction it repeats
+	// What the message says the account holds, and what the ledger does
+	Balance   *float64           `json:"balance,omitempty"`
+	Ledger    *float64           `json:"ledger,omitempty"`
+	Unmatched primitive.ObjectID `json:"unmatched,omitempty"`
+	Error     string             `json:"error,omitempty"` // why a read message was only proposed
+}
+
+// messageHash identifies a message by its sender and text, however the
+// lines were wrapped.
+func messageHash(sender, text string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(sender)) + "\n" + strings.Join(strings.Fields(text), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// IngestMessage reads a bank or wallet notification into a transaction. It
+// is booked when msg.Commit is set, the account is known, it repeats no
+// existing transaction and passes the checks of a new transaction, proposed
+// otherwise. A message no template reads is kept for writing one, until a
+// transaction is booked or proposed from it.
+func IngestMessage(ctx context.Context, owner string, msg IncomingMessage) (MessageResult, error) {
+	templates, err := loadMessageTemplates(ctx, owner)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	hash := messageHash(msg.Sender, msg.Text)
+
+	parsed, ok := parser.ParseMessage(templates, msg.Sender, msg.Text, msg.ReceivedAt)
+	if !ok {
+		return keepUnmatchedMessage(ctx, owner, msg, hash)
+	}
+
+	result := MessageResult{
+		Status:   model.MessageProposed,
+		Template: parsed.Template.Name,
+		Provider: parsed.Template.Provider,
+		Balance:  parsed.Balance,
+	}
+
+	accounts, err := loadBankAccountMap(ctx, owner)
+	if err != nil {
+		return result, err
+	}
+	account := parsed.Template.Account
+	if account.IsZero() {
+		account = resolveMessageAccount(accounts, parsed.Account, msg.Account)
+	}
+
+	tx := model.Transaction{
+		ID:         primitive.NewObjectID(),
+		Creator:    owner,
+		Amount:     roundMoney(math.Abs(parsed.Amount)),
+		DateTime:   parsed.Date,
+		Type:       "income",
+		Note:       parsed.Description,
+		ExternalID: parsed.Reference,
+	}
+	if parsed.Amount < 0 {
+		tx.Type = "expense"
+		tx.SourceAccount = account
+	} else {
+		tx.DestinationAccount = account
+	}
+
+	payees, err := LoadPayeeMatcher(ctx, owner)
+	if err != nil {
+		return result, err
+	}
+	payee, ok := payees.Match(parsed.Payee)
+	if !ok {
+		payee, ok = payees.Match(parsed.Description)
+	}
+	if ok {
+		tx.Payee = payee.ID
+		tx.Category = payee.DefaultCategory
+	}
+	rules, err := LoadRules(ctx, owner)
+	if err != nil {
+		return result, err
+	}
+	rules.Apply(&tx, false)
+	result.Transaction = &tx
+
+	if account.IsZero() {
+		result.Error = "No account matches `" + parsed.Account + "`, set it as the bank account number of one or pick an account"
+		return result, nil
+	}
+
+	// The same checks as a statement import: the bank's id, else the same
+	// amount on the account within a day
+	batch := model.ImportBatch{
+		Owner: owner,
+		Rows:  []model.ImportRow{{Account: account, Transaction: tx}},
+	}
+	if err := flagDuplicates(ctx, &batch); err != nil {
+		return result, err
+	}
+	if duplicate := batch.Rows[0].Duplicate; !duplicate.IsZero() {
+		result.Status, result.Duplicate = model.MessageDuplicate, duplicate
+	} else if msg.Commit {
+		// Booked only when it passes what POST /transactions/add checks,
+		// proposed otherwise
+		if err := checkMessageTransaction(tx); err != nil {
+			result.Error = err.Error()
+		} else {
+			if _, err := AddTransaction(ctx, tx); err != nil {
+				return result, err
+			}
+			result.Status = model.MessageCreated
+		}
+	}
+
+	// Read now, so no longer waiting for a template
+	if err := forgetUnmatchedMessage(ctx, owner, hash); err != nil {
+		return result, err
+	}
+
+	if result.Balance != nil {
+		var held model.Account
+		if err := util.AccountCollection.FindOne(ctx, bson.M{"_id": account}).Decode(&held); err == nil {
+			result.Ledger = &held.Balance
+		}
+	}
+	return result, nil
+}
+
+// checkMessageTransaction checks a transaction read from a message the way
+// the transaction form is checked: it needs a category unless a transfer, and
+// must not break its source account's spending rule.
+func checkMessageTransaction(tx model.Transaction) error {
+	if tx.Type != "transfer" && tx.Category.IsZero() && len(tx.Splits) == 0 {
+		return errors.New("No category: choose one or add a rule that sets it")
+	}
+	if tx.SourceAccount.IsZero() {
+		return nil
+	}
+	// Savings have no rules
+	account, err := GetAccountByID(tx.SourceAccount.Hex())
+	if err != nil {
+		return nil
+	}
+	return CheckSpendingRule(account, tx.Amount, "")
+}
+
+// forgetUnmatchedMessage drops the copy of a message kept while no template
+// read it.
+func forgetUnmatchedMessage(ctx context.Context, owner, hash string) error {
+	var waiting model.UnmatchedMessage
+	err := util.UnmatchedMessageCollection.FindOneAndDelete(ctx, bson.M{"owner": owner, "hash": hash}).Decode(&waiting)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "unmatched_messages",
+		"action":     "delete",
+		"detail":     waiting.ID,
+	})
+	return nil
+}
+
+// resolveMessageAccount maps the account a message names to one of the
+// owner's. Messages often mask the number ("1903xxxx1234"), the visible
+// digits then have to fit exactly one account.
+func resolveMessageAccount(accounts map[string]primitive.ObjectID, bankAccount string, fallback primitive.ObjectID) primitive.ObjectID {
+	masked := normalizeBankAccount(strings.NewReplacer("*", "x", ".", "x").Replace(bankAccount))
+	if !strings.Contains(masked, "x") || strings.Trim(masked, "x") == "" {
+		return resolveAccount(accounts, bankAccount, fallback)
+	}
+
+	prefix := masked[:strings.Index(masked, "x")]
+	suffix := masked[strings.LastIndex(masked, "x")+1:]
+	var found primitive.ObjectID
+	for key, id := range accounts {
+		if len(key) >= len(prefix)+len(suffix) && strings.HasPrefix(key, prefix) && strings.HasSuffix(key, suffix) {
+			if !found.IsZero() && found != id {
+				return fallback
+			}
+			found = id
+		}
+	}
+	if found.IsZero() {
+		return fallback
+	}
+	return found
+}
+
+func keepUnmatchedMessage(ctx context.Context, owner string, msg IncomingMessage, hash string) (MessageResult, error) {
+	var kept model.UnmatchedMessage
+	err := util.UnmatchedMessageCollection.FindOneAndUpdate(ctx,
+		bson.M{"owner": owner, "hash": hash},
+		bson.M{
+			"$setOnInsert": bson.M{"sender": msg.Sender, "text": msg.Text, "first_seen": msg.ReceivedAt},
+			"$set":         bson.M{"last_seen": msg.ReceivedAt},
+			"$inc":         bson.M{"count": 1},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&kept)
+	if err != nil {
+		return MessageResult{}, fmt.Errorf("Failed to keep unmatched message: %w", err)
+	}
+
+	action := "update"
+	if kept.Count == 1 {
+		action = "create"
+	}
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "unmatched_messages",
+		"action":     action,
+		"detail":     kept,
+	})
+
+	return MessageResult{Status: model.MessageUnmatched, Unmatched: kept.ID}, nil
+}
+
+func GetUnmatchedMessages(ctx context.Context, owner string) ([]model.UnmatchedMessage, error) {
+	cursor, err := util.UnmatchedMessageCollection.Find(ctx, bson.M{"owner": owner},
+		options.Find().SetSort(bson.D{{Key: "last_seen", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch unmatched messages: %w", err)
+	}
+	messages := []model.UnmatchedMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// DismissUnmatchedMessage forgets a message nobody will write a template
+// for.
+func DismissUnmatchedMessage(ctx context.Context, owner string, id primitive.ObjectID) error {
+	res, err := util.UnmatchedMessageCollection.DeleteOne(ctx, bson.M{"_id": id, "owner": owner})
+	if err != nil {
+		return fmt.Errorf("Error dismissing message: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "unmatched_messages",
+		"action":     "delete",
+		"detail":     id,
+	})
+	return nil
+}
+
+// TemplateMatch is a kept message a draft template reads, and what it
+// reads from it.
+type TemplateMatch struct {
+	Message     primitive.ObjectID `json:"message"`
+	Text        string             `json:"text"`
+	Amount      float64            `json:"amount"` // negative is money out
+	Date        time.Time          `json:"date"`
+	Balance     *float64           `json:"balance,omitempty"`
+	Reference   string             `json:"reference,omitempty"`
+	Account     string             `json:"account,omitempty"`
+	Payee       string             `json:"payee,omitempty"`
+	Description string             `json:"description,omitempty"`
+}
+
+// TestMessageTemplate tries a template on the owner's unmatched messages
+// without saving anything.
+func TestMessageTemplate(ctx context.Context, template model.MessageTemplate) ([]TemplateMatch, error) {
+	messages, err := GetUnmatchedMessages(ctx, template.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []TemplateMatch{}
+	for _, m := range messages {
+		parsed, ok := parser.ParseMessage([]model.MessageTemplate{template}, m.Sender, m.Text, m.LastSeen)
+		if !ok {
+			continue
+		}
+		matches = append(matches, TemplateMatch{
+			Message:     m.ID,
+			Text:        m.Text,
+			Amount:      parsed.Amount,
+			Date:        parsed.Date,
+			Balance:     parsed.Balance,
+			Reference:   parsed.Reference,
+			Account:     parsed.Account,
+			Payee:       parsed.Payee,
+			Description: parsed.Description,
+		})
+	}
+	return matches, nil
+}
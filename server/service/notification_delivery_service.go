@@ -0,0 +1,537 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type NotificationSender interface {
+	Send(ctx context.Context, pref model.NotificationPreference, notif model.Notification) error
+}
+
+// In-app delivery is the notification document itself plus the websocket
+// broadcast, every other channel goes through a sender.
+var notificationSenders = map[model.NotificationChannel]NotificationSender{
+	model.ChannelEmail:   emailSender{},
+	model.ChannelPush:    pushSender{},
+	model.ChannelWebhook: webhookSender{},
+}
+
+func RegisterNotificationSender(channel model.NotificationChannel, sender NotificationSender) {
+	notificationSenders[channel] = sender
+}
+
+// DeliverNotification is the single entry point for every notification. It
+// resolves the owner's preferences, decides whether the notification goes out
+// now, after quiet hours or with the next digest, stores it and dispatches it.
+// Notifications scheduled in the future are stored as pending and routed by
+// DispatchDueNotifications once they are due.
+func DeliverNotification(ctx context.Context, notif model.Notification) (interface{}, error) {
+	now := time.Now()
+	notif.LastUpdate = now
+
+	if ScheduleNotification(&notif, now) {
+		result, err := util.NotificationCollection.InsertOne(ctx, notif)
+		if err != nil {
+			return nil, err
+		}
+		return result.InsertedID, nil
+	}
+
+	pref, err := GetNotificationPreference(ctx, notif.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load notification preference: %w", err)
+	}
+
+	if !RouteNotification(pref, &notif, now) {
+		log.Printf("Notification %q for %s dropped: every channel is disabled", notif.Type, notif.Owner)
+		return nil, nil
+	}
+
+	result, err := util.NotificationCollection.InsertOne(ctx, notif)
+	if err != nil {
+		return nil, err
+	}
+	notif.ID = result.InsertedID.(primitive.ObjectID)
+
+	if notif.Status == model.StatusDelivered {
+		dispatchNotification(ctx, pref, notif)
+	}
+
+	return result.InsertedID, nil
+}
+
+// ScheduleNotification keeps a notification scheduled later than now pending
+// until its ScheduledAt, when the dispatcher routes it. It returns false for
+// a notification that is due now.
+func ScheduleNotification(notif *model.Notification, now time.Time) bool {
+	if !notif.ScheduledAt.After(now) {
+		return false
+	}
+	notif.Status = model.StatusPending
+	notif.DeliverAt = notif.ScheduledAt
+	return true
+}
+
+// RouteNotification fills in the channels, status and delivery time of a
+// notification. It returns false when every channel is disabled for its type.
+func RouteNotification(pref model.NotificationPreference, notif *model.Notification, now time.Time) bool {
+	notif.Channels = enabledChannels(pref, notif.Type)
+	if len(notif.Channels) == 0 {
+		return false
+	}
+
+	loc := loadLocation(pref.Timezone)
+
+	notif.Status = model.StatusDelivered
+	notif.DeliverAt = now
+	if isDigested(pref, notif.Type) {
+		notif.Status = model.StatusQueued
+		notif.DeliverAt = nextDigestAt(now.In(loc), pref.Digest.Hour)
+	} else if end, quiet := quietHoursEnd(pref.QuietHours, now.In(loc)); quiet {
+		notif.Status = model.StatusHeld
+		notif.DeliverAt = end
+	}
+
+	return true
+}
+
+// DispatchDueNotifications routes scheduled notifications that became due,
+// delivers held notifications whose quiet hours are over and collapses queued
+// ones into one digest per user.
+func DispatchDueNotifications(ctx context.Context) error {
+	now := time.Now()
+
+	pending, err := findDueNotifications(ctx, model.StatusPending, now)
+	if err != nil {
+		return err
+	}
+	for _, notif := range pending {
+		pref, err := GetNotificationPreference(ctx, notif.Owner)
+		if err != nil {
+			log.Println("Failed to load notification preference:", err)
+			continue
+		}
+
+		read := notif
+		set := bson.M{"last_update": time.Now()}
+		if RouteNotification(pref, &notif, now) {
+			set["status"] = notif.Status
+			set["channels"] = notif.Channels
+			set["deliver_at"] = notif.DeliverAt
+		} else {
+			set["is_deleted"] = true
+		}
+
+		claimed, err := claimNotification(ctx, read, model.StatusPending, bson.M{"$set": set})
+		if err != nil {
+			log.Println("Failed to route scheduled notification:", err)
+			continue
+		}
+		if claimed && notif.Status == model.StatusDelivered {
+			dispatchNotification(userContext(ctx, notif.Owner), pref, notif)
+		}
+	}
+
+	held, err := findDueNotifications(ctx, model.StatusHeld, now)
+	if err != nil {
+		return err
+	}
+	for _, notif := range held {
+		update := bson.M{
+			"$set": bson.M{
+				"status":      model.StatusDelivered,
+				"last_update": time.Now(),
+			},
+		}
+		claimed, err := claimNotification(ctx, notif, model.StatusHeld, update)
+		if err != nil {
+			log.Println("Failed to release notification:", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		pref, err := GetNotificationPreference(ctx, notif.Owner)
+		if err != nil {
+			log.Println("Failed to load notification preference:", err)
+			continue
+		}
+		notif.Status = model.StatusDelivered
+		dispatchNotification(userContext(ctx, notif.Owner), pref, notif)
+	}
+
+	queued, err := findDueNotifications(ctx, model.StatusQueued, now)
+	if err != nil {
+		return err
+	}
+	byOwner := map[string][]model.Notification{}
+	for _, notif := range queued {
+		byOwner[notif.Owner] = append(byOwner[notif.Owner], notif)
+	}
+	for owner, notifs := range byOwner {
+		if err := sendDigest(userContext(ctx, owner), owner, notifs); err != nil {
+			log.Println("Failed to send notification digest:", err)
+		}
+	}
+
+	return nil
+}
+
+// claimNotification applies update to notif only while it still is as it
+// was read: a cancel or reschedule in between, or another server instance
+// dispatching it first, leaves it alone and reports false.
+func claimNotification(ctx context.Context, notif model.Notification, status model.NotificationStatus, update bson.M) (bool, error) {
+	res, err := util.NotificationCollection.UpdateOne(ctx, bson.M{
+		"_id":        notif.ID,
+		"status":     status,
+		"deliver_at": notif.DeliverAt,
+		"is_deleted": false,
+	}, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func findDueNotifications(ctx context.Context, status model.NotificationStatus, now time.Time) ([]model.Notification, error) {
+	filter := bson.M{
+		"status":     status,
+		"deliver_at": bson.M{"$lte": now},
+		"is_deleted": false,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "deliver_at", Value: 1}})
+
+	cursor, err := util.NotificationCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch %s notifications: %w", status, err)
+	}
+
+	var notifs []model.Notification
+	if err := cursor.All(ctx, &notifs); err != nil {
+		return nil, fmt.Errorf("Failed to decode %s notifications: %w", status, err)
+	}
+	return notifs, nil
+}
+
+func sendDigest(ctx context.Context, owner string, notifs []model.Notification) error {
+	ids := make([]primitive.ObjectID, 0, len(notifs))
+	lines := make([]string, 0, len(notifs))
+	for _, notif := range notifs {
+		ids = append(ids, notif.ID)
+		lines = append(lines, "- "+notif.Title+": "+notif.Message)
+	}
+
+	digest := model.Notification{
+		Owner:       owner,
+		Type:        model.TypeDigest,
+		Title:       fmt.Sprintf("You have %d new updates", len(notifs)),
+		Message:     strings.Join(lines, "\n"),
+		ScheduledAt: time.Now(),
+	}
+	if _, err := DeliverNotification(ctx, digest); err != nil {
+		return err
+	}
+
+	// The collapsed notifications show up in the in-app list without being
+	// pushed one by one.
+	update := bson.M{
+		"$set": bson.M{
+			"status":      model.StatusDigested,
+			"last_update": time.Now(),
+		},
+	}
+	_, err := util.NotificationCollection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, update)
+	return err
+}
+
+func dispatchNotification(ctx context.Context, pref model.NotificationPreference, notif model.Notification) {
+	for _, channel := range notif.Channels {
+		if channel == model.ChannelInApp {
+			socket.BroadcastFromContext(ctx, map[string]interface{}{
+				"collection": "notifications",
+				"action":     "create",
+				"detail":     notif,
+			})
+			continue
+		}
+
+		sender, ok := notificationSenders[channel]
+		if !ok {
+			log.Printf("No sender registered for channel %q", channel)
+			continue
+		}
+		if err := sender.Send(ctx, pref, notif); err != nil {
+			log.Printf("Failed to send notification over %s: %v", channel, err)
+		}
+	}
+}
+
+func enabledChannels(pref model.NotificationPreference, t model.NotificationType) []model.NotificationChannel {
+	channels := []model.NotificationChannel{}
+	for _, channel := range model.NotificationChannels {
+		if pref.Enabled(t, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+func isDigested(pref model.NotificationPreference, t model.NotificationType) bool {
+	if !pref.Digest.Enabled || t.IsUrgent() || t == model.TypeDigest || t == model.TypeSpendingDigest {
+		return false
+	}
+	for _, digestType := range pref.Digest.Types {
+		if digestType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// quietHoursEnd reports whether t falls into the quiet hours window and when
+// that window ends. The window may wrap around midnight.
+func quietHoursEnd(q model.QuietHours, t time.Time) (time.Time, bool) {
+	if !q.Enabled {
+		return time.Time{}, false
+	}
+	start, err := ParseClock(q.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := ParseClock(q.End)
+	if err != nil || start == end {
+		return time.Time{}, false
+	}
+
+	current := t.Hour()*60 + t.Minute()
+	endToday := time.Date(t.Year(), t.Month(), t.Day(), end/60, end%60, 0, 0, t.Location())
+
+	if start < end {
+		if current >= start && current < end {
+			return endToday, true
+		}
+		return time.Time{}, false
+	}
+
+	if current >= start {
+		return endToday.AddDate(0, 0, 1), true
+	}
+	if current < end {
+		return endToday, true
+	}
+	return time.Time{}, false
+}
+
+func nextDigestAt(t time.Time, hour int) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, t.Location())
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// ParseClock turns "HH:MM" into minutes since midnight.
+func ParseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func loadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// userContext lets background jobs broadcast to every client of a user.
+func userContext(ctx context.Context, owner string) context.Context {
+	ctx = context.WithValue(ctx, util.UserIdKey, owner)
+	return context.WithValue(ctx, util.ClientIdKey, "")
+}
+
+//////////////////
+// Senders
+//////////////////
+
+type emailSender struct{}
+
+func (emailSender) Send(ctx context.Context, pref model.NotificationPreference, notif model.Notification) error {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return errors.New("email channel is not configured")
+	}
+	if pref.Email == "" {
+		return errors.New("no email address set")
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+
+	var auth smtp.Auth
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	contentType, body := "text/plain", notif.Message
+	if notif.HTML != "" {
+		contentType, body = "text/html", notif.HTML
+	}
+
+	msg := "From: " + from + "\r\n" +
+		"To: " + headerValue(pref.Email) + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("UTF-8", headerValue(notif.Title)) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: " + contentType + "; charset=UTF-8\r\n" +
+		"\r\n" + body + "\r\n"
+
+	return smtp.SendMail(host+":"+port, auth, from, []string{pref.Email}, []byte(msg))
+}
+
+// headerValue keeps s on one header line, a CR or LF in it would start a
+// header of its own.
+func headerValue(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '\r' || r == '\n' }), " ")
+}
+
+type pushSender struct{}
+
+func (pushSender) Send(ctx context.Context, pref model.NotificationPreference, notif model.Notification) error {
+	gateway := os.Getenv("PUSH_GATEWAY_URL")
+	if gateway == "" {
+		return errors.New("push channel is not configured")
+	}
+	if len(pref.PushTokens) == 0 {
+		return errors.New("no push token registered")
+	}
+
+	return postJSON(ctx, gateway, map[string]interface{}{
+		"tokens":  pref.PushTokens,
+		"title":   notif.Title,
+		"message": notif.Message,
+		"data": map[string]interface{}{
+			"id":          notif.ID,
+			"type":        notif.Type,
+			"referenceId": notif.ReferenceId,
+		},
+	})
+}
+
+type webhookSender struct{}
+
+func (webhookSender) Send(ctx context.Context, pref model.NotificationPreference, notif model.Notification) error {
+	if pref.WebhookURL == "" {
+		return errors.New("no webhook url set")
+	}
+	if err := CheckWebhookURL(ctx, pref.WebhookURL); err != nil {
+		return err
+	}
+	return postJSONWith(ctx, webhookClient, pref.WebhookURL, notif)
+}
+
+// CheckWebhookURL accepts http(s) urls whose host resolves to public
+// addresses only, a webhook must not reach the server's own network.
+func CheckWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("invalid webhook url")
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("cannot resolve webhook host: %w", err)
+	}
+	for _, ip := range ips {
+		if !publicIP(ip.IP) {
+			return fmt.Errorf("webhook host %s is not a public address", u.Hostname())
+		}
+	}
+	return nil
+}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// webhookClient checks the address it actually dials, so neither a DNS
+// answer changed since CheckWebhookURL nor a redirect reaches a private host.
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return fmt.Errorf("webhook address %s is not public", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+func postJSON(ctx context.Context, url string, payload interface{}) error {
+	return postJSONWith(ctx, http.DefaultClient, url, payload)
+}
+
+func postJSONWith(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with status %d", url, resp.StatusCode)
+	}
+	return nil
+}
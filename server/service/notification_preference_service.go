@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func DefaultNotificationPreference(owner string) model.NotificationPreference {
+	return model.NotificationPreference{
+		Owner:    owner,
+		Channels: map[model.NotificationType]map[model.NotificationChannel]bool{},
+		Timezone: "UTC",
+		QuietHours: model.QuietHours{
+			Enabled: false,
+			Start:   "22:00",
+			End:     "07:00",
+		},
+		Digest: model.DigestSettings{
+			Enabled: false,
+			Types:   []model.NotificationType{model.TypeTransaction, model.TypeFinishIncome},
+			Hour:    8,
+		},
+		SpendingDigest: model.SpendingDigestSettings{
+			Frequency: model.FrequencyOff,
+			Day:       1,
+			Hour:      8,
+		},
+	}
+}
+
+// GetNotificationPreference never fails on a missing document, users who
+// never touched their settings get the defaults.
+func GetNotificationPreference(ctx context.Context, owner string) (model.NotificationPreference, error) {
+	var pref model.NotificationPreference
+
+	err := util.NotificationPreferenceCollection.FindOne(ctx, bson.M{"owner": owner}).Decode(&pref)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return DefaultNotificationPreference(owner), nil
+		}
+		return model.NotificationPreference{}, err
+	}
+
+	return pref, nil
+}
+
+func UpdateNotificationPreference(ctx context.Context, pref model.NotificationPreference) error {
+	pref.LastUpdate = time.Now()
+	pref.SpendingDigest.NextRun = NextSpendingDigestRun(pref.SpendingDigest, pref.LastUpdate, loadLocation(pref.Timezone))
+
+	opts := options.Update().SetUpsert(true)
+	_, err := util.NotificationPreferenceCollection.UpdateOne(
+		ctx,
+		bson.M{"owner": pref.Owner},
+		bson.M{"$set": pref},
+		opts,
+	)
+	if err != nil {
+		return err
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "notification_preferences",
+		"action":     "update",
+		"detail":     pref,
+	})
+
+	return nil
+}
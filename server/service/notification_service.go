@@ -43,6 +43,18 @@ func FetchNotificationSince(ctx context.Context, username string, since time.Tim
 			"$gt": since,
 		},
 		"owner": username,
+		"status": bson.M{
+			"$nin": []model.NotificationStatus{
+				model.StatusPending,
+				model.StatusCancelled,
+				model.StatusHeld,
+				model.StatusQueued,
+			},
+		},
+		"$or": []bson.M{
+			{"channels": bson.M{"$exists": false}},
+			{"channels": model.ChannelInApp},
+		},
 	}
 
 	opts := options.Find().SetSort(bson.D{
@@ -52,21 +64,24 @@ func FetchNotificationSince(ctx context.Context, username string, since time.Tim
 	return util.NotificationCollection.Find(ctx, filter, opts)
 }
 
-func AddNotification(ctx context.Context, notif model.Notification) (interface{}, error) {
-	notif.LastUpdate = time.Now()
-	result, err := util.NotificationCollection.InsertOne(ctx, notif)
-
-	if err != nil {
-		return nil, err
+func FetchScheduledNotifications(ctx context.Context, username string) (*mongo.Cursor, error) {
+	filter := bson.M{
+		"owner":      username,
+		"status":     model.StatusPending,
+		"is_deleted": false,
 	}
 
-	socket.BroadcastFromContext(ctx, map[string]interface{}{
-		"collection": "notifications",
-		"action":     "create",
-		"detail":     notif,
+	opts := options.Find().SetSort(bson.D{
+		{Key: "deliver_at", Value: 1},
 	})
 
-	return result.InsertedID, nil
+	return util.NotificationCollection.Find(ctx, filter, opts)
+}
+
+// AddNotification honours the owner's notification preferences, see
+// DeliverNotification.
+func AddNotification(ctx context.Context, notif model.Notification) (interface{}, error) {
+	return DeliverNotification(ctx, notif)
 }
 
 func MarkAsRead(ctx context.Context, notifIDs []primitive.ObjectID) error {
@@ -102,7 +117,16 @@ func UpdateNotification(ctx context.Context, id primitive.ObjectID, notif model.
 	notif.LastUpdate = time.Now()
 	update := bson.M{"$set": notif}
 
-	_, err := util.NotificationCollection.UpdateOne(ctx, filter, update)
+	// Editing a scheduled notification moves its delivery along with it.
+	pendingFilter := bson.M{"_id": id, "status": model.StatusPending}
+	_, err := util.NotificationCollection.UpdateOne(ctx, pendingFilter, bson.M{
+		"$set": bson.M{"deliver_at": notif.ScheduledAt},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = util.NotificationCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
@@ -116,6 +140,59 @@ func UpdateNotification(ctx context.Context, id primitive.ObjectID, notif model.
 	return nil
 }
 
+func CancelNotification(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "status": model.StatusPending}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      model.StatusCancelled,
+			"last_update": time.Now(),
+		},
+	}
+
+	res, err := util.NotificationCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("only scheduled notifications can be cancelled")
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "notifications",
+		"action":     "cancel",
+		"detail":     id,
+	})
+
+	return nil
+}
+
+func RescheduleNotification(ctx context.Context, id primitive.ObjectID, scheduledAt time.Time) error {
+	filter := bson.M{"_id": id, "status": model.StatusPending}
+	update := bson.M{
+		"$set": bson.M{
+			"scheduled_at": scheduledAt,
+			"deliver_at":   scheduledAt,
+			"last_update":  time.Now(),
+		},
+	}
+
+	res, err := util.NotificationCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("only scheduled notifications can be rescheduled")
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "notifications",
+		"action":     "reschedule",
+		"detail":     id,
+	})
+
+	return nil
+}
+
 func DeleteNotification(ctx context.Context, id primitive.ObjectID) error {
 	filter := bson.M{"_id": id}
 	update := bson.M{
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func GetPayeeByID(id string) (model.Payee, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Payee{}, err
+	}
+
+	var payee model.Payee
+
+	err = util.PayeeCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&payee)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.Payee{}, errors.New("payee not found")
+		}
+		return model.Payee{}, err
+	}
+
+	return payee, nil
+}
+
+func FetchPayeesSince(ctx context.Context, username string, since time.Time) (*mongo.Cursor, error) {
+	filter := bson.M{
+		"last_update": bson.M{
+			"$gt": since,
+		},
+		"owner": username,
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "last_update", Value: -1},
+	})
+
+	return util.PayeeCollection.Find(ctx, filter, opts)
+}
+
+func AddPayee(ctx context.Context, payee model.Payee) (interface{}, error) {
+	payee.LastUpdate = time.Now()
+
+	result, err := util.PayeeCollection.InsertOne(ctx, payee)
+	if err != nil {
+		return nil, err
+	}
+	payee.ID = result.InsertedID.(primitive.ObjectID)
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "payees",
+		"action":     "create",
+		"detail":     payee,
+	})
+
+	return result.InsertedID, nil
+}
+
+func UpdatePayee(ctx context.Context, id primitive.ObjectID, payee model.Payee) error {
+	payee.LastUpdate = time.Now()
+
+	update := bson.M{"$set": payee}
+	unset := bson.M{}
+	if payee.DefaultCategory.IsZero() {
+		unset["default_category"] = ""
+	}
+	if payee.DefaultAccount.IsZero() {
+		unset["default_account"] = ""
+	}
+	if len(payee.IBANs) == 0 {
+		unset["ibans"] = ""
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	if _, err := util.PayeeCollection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return err
+	}
+
+	payee.ID = id
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "payees",
+		"action":     "update",
+		"detail":     payee,
+	})
+
+	return nil
+}
+
+// DeletePayee keeps the transactions, they just lose their payee. Rules
+// drop it too.
+func DeletePayee(ctx context.Context, id primitive.ObjectID) error {
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	now := time.Now()
+	rulesChanged := false
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := util.PayeeCollection.UpdateOne(sc, bson.M{"_id": id}, bson.M{"$set": bson.M{
+			"is_deleted":  true,
+			"last_update": now,
+		}}); err != nil {
+			return nil, fmt.Errorf("Error deleting payee: %w", err)
+		}
+
+		if _, err := util.TransactionCollection.UpdateMany(sc, bson.M{"payee": id}, bson.M{
+			"$unset": bson.M{"payee": ""},
+			"$set":   bson.M{"last_update": now},
+		}); err != nil {
+			return nil, fmt.Errorf("Error updating related transactions: %w", err)
+		}
+
+		var err error
+		rulesChanged, err = retargetRules(sc, payeeRuleFilter(id), func(rule *model.Rule) bool {
+			return RetargetRulePayee(rule, id, primitive.NilObjectID)
+		}, now)
+		return nil, err
+	})
+	if err != nil {
+		return err
+	}
+	if rulesChanged {
+		broadcastRulesChanged(ctx)
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "payees",
+		"action":     "delete",
+		"detail":     id,
+	})
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "update",
+		"detail":     "bulk",
+	})
+
+	return nil
+}
+
+func payeeRuleFilter(id primitive.ObjectID) bson.M {
+	return bson.M{"$or": []bson.M{{"actions.payee": id}, {"conditions.payee": id}}}
+}
+
+// MergePayee moves the transactions and rules of `from` to `into`. The name and aliases
+// of `from` become aliases of `into` so future notes keep matching.
+func MergePayee(ctx context.Context, from, into model.Payee) error {
+	if from.ID == into.ID {
+		return errors.New("cannot merge a payee into itself")
+	}
+
+	aliases := append([]string{from.Name}, from.Aliases...)
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	now := time.Now()
+	rulesChanged := false
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := util.TransactionCollection.UpdateMany(sc, bson.M{"payee": from.ID}, bson.M{
+			"$set": bson.M{"payee": into.ID, "last_update": now},
+		}); err != nil {
+			return nil, err
+		}
+
+		addToSet := bson.M{"aliases": bson.M{"$each": aliases}}
+		if len(from.IBANs) > 0 {
+			addToSet["ibans"] = bson.M{"$each": from.IBANs}
+		}
+		if _, err := util.PayeeCollection.UpdateByID(sc, into.ID, bson.M{
+			"$addToSet": addToSet,
+			"$set":      bson.M{"last_update": now},
+		}); err != nil {
+			return nil, err
+		}
+
+		var err error
+		rulesChanged, err = retargetRules(sc, payeeRuleFilter(from.ID), func(rule *model.Rule) bool {
+			return RetargetRulePayee(rule, from.ID, into.ID)
+		}, now)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = util.PayeeCollection.UpdateByID(sc, from.ID, bson.M{"$set": bson.M{
+			"is_deleted":  true,
+			"last_update": now,
+		}})
+		return nil, err
+	})
+	if err != nil {
+		return err
+	}
+	if rulesChanged {
+		broadcastRulesChanged(ctx)
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "payees",
+		"action":     "delete",
+		"detail":     from.ID,
+	})
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "payees",
+		"action":     "update",
+		"detail":     into.ID,
+	})
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "update",
+		"detail":     "bulk",
+	})
+
+	return nil
+}
+
+// PayeeMatcher finds the payee mentioned in a note or bank description. Load
+// it once per request or import, matching is done in memory.
+type PayeeMatcher struct {
+	payees []model.Payee
+	keys   [][]string // normalized name and aliases per payee
+	ibans  map[string]int
+}
+
+func LoadPayeeMatcher(ctx context.Context, owner string) (*PayeeMatcher, error) {
+	cursor, err := util.PayeeCollection.Find(ctx, bson.M{"owner": owner, "is_deleted": false})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch payees: %w", err)
+	}
+	var payees []model.Payee
+	if err := cursor.All(ctx, &payees); err != nil {
+		return nil, err
+	}
+	return NewPayeeMatcher(payees), nil
+}
+
+func NewPayeeMatcher(payees []model.Payee) *PayeeMatcher {
+	m := &PayeeMatcher{payees: payees, ibans: map[string]int{}}
+	for i, payee := range payees {
+		for _, iban := range payee.IBANs {
+			m.ibans[NormalizeIBAN(iban)] = i
+		}
+
+		var keys []string
+		for _, name := range append([]string{payee.Name}, payee.Aliases...) {
+			if key := util.NormalizeText(name); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		m.keys = append(m.keys, keys)
+	}
+	return m
+}
+
+// Match returns the payee whose name or alias appears in text as whole words.
+// The longest match wins, so "highlands coffee" beats "highlands".
+func (m *PayeeMatcher) Match(text string) (model.Payee, bool) {
+	haystack := " " + util.NormalizeText(text) + " "
+	if haystack == "  " {
+		return model.Payee{}, false
+	}
+
+	best, bestLen := -1, 0
+	for i, keys := range m.keys {
+		for _, key := range keys {
+			if len(key) > bestLen && strings.Contains(haystack, " "+key+" ") {
+				best, bestLen = i, len(key)
+			}
+		}
+	}
+	if best < 0 {
+		return model.Payee{}, false
+	}
+	return m.payees[best], true
+}
+
+// MatchIBAN finds the payee a counterparty account number belongs to.
+func (m *PayeeMatcher) MatchIBAN(iban string) (model.Payee, bool) {
+	if iban == "" {
+		return model.Payee{}, false
+	}
+	i, ok := m.ibans[NormalizeIBAN(iban)]
+	if !ok {
+		return model.Payee{}, false
+	}
+	return m.payees[i], true
+}
+
+// NormalizeIBAN drops the spaces banks print IBANs with.
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fintrack/server/quickadd"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// quickAddParser reads quick-add phrases. Swap it for a model-backed parser
+// once one exists.
+var quickAddParser quickadd.Parser = quickadd.RuleParser{}
+
+// QuickAdd proposes the transaction text describes, matched against the
+// owner's live accounts, savings, categories and payees, in currency.
+// Nothing is saved.
+func QuickAdd(ctx context.Context, owner, text string, loc *time.Location, currency string) (quickadd.Proposal, error) {
+	vocab := quickadd.Vocabulary{Now: time.Now().In(loc), Currency: currency}
+	live := bson.M{"owner": owner, "is_deleted": false}
+
+	queries := []struct {
+		name       string
+		collection *mongo.Collection
+		out        interface{}
+	}{
+		{"accounts", util.AccountCollection, &vocab.Accounts},
+		{"savings", util.SavingCollection, &vocab.Savings},
+		{"categories", util.CategoryCollection, &vocab.Categories},
+		{"payees", util.PayeeCollection, &vocab.Payees},
+	}
+	for _, q := range queries {
+		cursor, err := q.collection.Find(ctx, live)
+		if err != nil {
+			return quickadd.Proposal{}, fmt.Errorf("Failed to fetch %s: %w", q.name, err)
+		}
+		if err := cursor.All(ctx, q.out); err != nil {
+			return quickadd.Proposal{}, fmt.Errorf("Failed to read %s: %w", q.name, err)
+		}
+	}
+
+	proposal, err := quickAddParser.Parse(ctx, text, vocab)
+	if err != nil {
+		return proposal, err
+	}
+	proposal.Transaction.Creator = owner
+	return proposal, nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type RepairMode string
+
+const (
+	// Trust the transaction log, overwrite the stored balance.
+	RepairBalance RepairMode = "balance"
+	// Trust the stored balance, move the opening balance instead. Meant for
+	// accounts created before opening balances were recorded.
+	RepairOpening RepairMode = "opening"
+)
+
+type BalanceDiscrepancy struct {
+	BalanceHolder
+	Net        float64 `json:"net"`
+	Computed   float64 `json:"computed"`
+	Difference float64 `json:"difference"`
+}
+
+type ReconcileReport struct {
+	CheckedAt     time.Time            `json:"checkedAt"`
+	Checked       int                  `json:"checked"`
+	Discrepancies []BalanceDiscrepancy `json:"discrepancies"`
+	Repaired      bool                 `json:"repaired"`
+	Mode          RepairMode           `json:"mode,omitempty"`
+}
+
+// netTransactionAmounts sums the balance effect of every non-deleted
+// transaction matching match per account or saving.
+func netTransactionAmounts(ctx context.Context, match bson.M) (map[primitive.ObjectID]float64, error) {
+	match["is_deleted"] = false
+
+	cursor, err := util.TransactionCollection.Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$project": bson.M{
+			"legs": []bson.M{
+				{"id": "$source_account", "amount": bson.M{"$multiply": []interface{}{"$amount", -1}}},
+				{"id": "$destination_account", "amount": "$amount"},
+			},
+		}},
+		{"$unwind": "$legs"},
+		{"$match": bson.M{"legs.id": bson.M{"$nin": []interface{}{nil, primitive.NilObjectID}}}},
+		{"$group": bson.M{
+			"_id": "$legs.id",
+			"net": bson.M{"$sum": "$legs.amount"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID  primitive.ObjectID `bson:"_id"`
+		Net float64            `bson:"net"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	nets := map[primitive.ObjectID]float64{}
+	for _, row := range rows {
+		nets[row.ID] = row.Net
+	}
+	return nets, nil
+}
+
+// FindDiscrepancies compares each holder's balance with its opening balance
+// plus nets, the net transaction amount per holder.
+func FindDiscrepancies(holders []BalanceHolder, nets map[primitive.ObjectID]float64) []BalanceDiscrepancy {
+	discrepancies := []BalanceDiscrepancy{}
+	for _, holder := range holders {
+		computed := holder.Opening + nets[holder.ID]
+		if math.Abs(computed-holder.Balance) <= balanceEpsilon {
+			continue
+		}
+		discrepancies = append(discrepancies, BalanceDiscrepancy{
+			BalanceHolder: holder,
+			Net:           nets[holder.ID],
+			Computed:      computed,
+			Difference:    holder.Balance - computed,
+		})
+	}
+	return discrepancies
+}
+
+// ReconcileBalances recomputes every balance as opening balance plus the net
+// of non-deleted transactions and reports the ones that drifted. With repair
+// set, all discrepancies are fixed in a single database transaction. An empty
+// owner checks every user.
+func ReconcileBalances(ctx context.Context, owner string, repair bool, mode RepairMode) (ReconcileReport, error) {
+	report := ReconcileReport{
+		CheckedAt:     time.Now(),
+		Discrepancies: []BalanceDiscrepancy{},
+	}
+
+	holders, err := FetchBalanceHolders(ctx, owner)
+	if err != nil {
+		return report, err
+	}
+	match := bson.M{}
+	if owner != "" {
+		match["creator"] = owner
+	}
+	nets, err := netTransactionAmounts(ctx, match)
+	if err != nil {
+		return report, fmt.Errorf("Failed to aggregate transactions: %w", err)
+	}
+
+	report.Checked = len(holders)
+	report.Discrepancies = FindDiscrepancies(holders, nets)
+
+	if !repair || len(report.Discrepancies) == 0 {
+		return report, nil
+	}
+	if mode != RepairBalance && mode != RepairOpening {
+		return report, fmt.Errorf("invalid repair mode `%s`, expected {balance|opening}", mode)
+	}
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return report, fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	// Balance and net are read again inside the transaction: one committed
+	// since the check moved both, repairing from the old figures would lose
+	// it. A transaction committing meanwhile conflicts and this one retries.
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		for i, d := range report.Discrepancies {
+			collection := util.AccountCollection
+			if d.Kind == "saving" {
+				collection = util.SavingCollection
+			}
+
+			var current struct {
+				Balance float64 `bson:"balance"`
+				Opening float64 `bson:"opening_balance"`
+			}
+			if err := collection.FindOne(sc, bson.M{"_id": d.ID}).Decode(&current); err != nil {
+				return nil, fmt.Errorf("Failed to read %s %s: %w", d.Kind, d.ID.Hex(), err)
+			}
+			nets, err := netTransactionAmounts(sc, bson.M{"$or": []bson.M{
+				{"source_account": d.ID},
+				{"destination_account": d.ID},
+			}})
+			if err != nil {
+				return nil, fmt.Errorf("Failed to aggregate transactions: %w", err)
+			}
+			d.Balance, d.Opening, d.Net = current.Balance, current.Opening, nets[d.ID]
+			d.Computed = d.Opening + d.Net
+			d.Difference = d.Balance - d.Computed
+			report.Discrepancies[i] = d
+
+			set := bson.M{"last_update": time.Now()}
+			if mode == RepairBalance {
+				set["balance"] = d.Computed
+			} else {
+				set["opening_balance"] = d.Balance - d.Net
+			}
+
+			if _, err := collection.UpdateByID(sc, d.ID, bson.M{"$set": set}); err != nil {
+				return nil, fmt.Errorf("Failed to repair %s %s: %w", d.Kind, d.ID.Hex(), err)
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	report.Repaired = true
+	report.Mode = mode
+
+	for _, d := range report.Discrepancies {
+		socket.BroadcastFromContext(userContext(ctx, d.Owner), map[string]interface{}{
+			"collection": d.Kind + "s",
+			"action":     "reconcile",
+			"detail":     d.ID,
+		})
+	}
+
+	return report, nil
+}
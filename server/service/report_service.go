@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReportQuery struct {
+	Owner            string
+	From             time.Time
+	To               time.Time
+	Location         *time.Location
+	Type             string               // only this transaction type when set
+	Tags             []primitive.ObjectID // only transactions carrying every tag
+	IncludeTransfers bool
+}
+
+type ReportRow struct {
+	Key   interface{} `bson:"key" json:"key"`
+	Label string      `bson:"label,omitempty" json:"label,omitempty"`
+	Type  string      `bson:"type" json:"type"`
+	Total float64     `bson:"total" json:"total"`
+	Count int         `bson:"count" json:"count"`
+}
+
+// $dateToString formats, weeks are ISO weeks so they start on Monday.
+var reportPeriodFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%G-W%V",
+	"month": "%Y-%m",
+	"year":  "%Y",
+}
+
+func reportMatch(q ReportQuery) bson.M {
+	types := []string{"income", "expense"}
+	if q.IncludeTransfers {
+		types = append(types, "transfer")
+	}
+	if q.Type != "" {
+		types = []string{q.Type}
+		if q.Type == "transfer" && !q.IncludeTransfers {
+			types = []string{}
+		}
+	}
+
+	match := bson.M{
+		"creator":    q.Owner,
+		"is_deleted": false,
+		"type":       bson.M{"$in": types},
+		"date_time":  bson.M{"$gte": q.From, "$lt": q.To},
+	}
+	if len(q.Tags) > 0 {
+		match["tags"] = bson.M{"$all": q.Tags}
+	}
+	return match
+}
+
+// unwindSplits turns a split transaction into one document per split line,
+// carrying the line's category and amount. Other transactions pass through.
+var unwindSplits = []bson.M{
+	{"$unwind": bson.M{"path": "$splits", "preserveNullAndEmptyArrays": true}},
+	{"$set": bson.M{
+		"category": bson.M{"$ifNull": []string{"$splits.category", "$category"}},
+		"amount":   bson.M{"$ifNull": []string{"$splits.amount", "$amount"}},
+	}},
+}
+
+func runReport(ctx context.Context, pipeline []bson.M) ([]ReportRow, error) {
+	cursor, err := util.TransactionCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []ReportRow{}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ReportByPeriod totals transactions per day, week, month or year in the
+// query's timezone.
+func ReportByPeriod(ctx context.Context, q ReportQuery, unit string) ([]ReportRow, error) {
+	format, ok := reportPeriodFormats[unit]
+	if !ok {
+		return nil, fmt.Errorf("invalid period `%s`, expected {day|week|month|year}", unit)
+	}
+
+	return runReport(ctx, []bson.M{
+		{"$match": reportMatch(q)},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"key": bson.M{"$dateToString": bson.M{
+					"date":     "$date_time",
+					"format":   format,
+					"timezone": q.Location.String(),
+				}},
+				"type": "$type",
+			},
+			"total": bson.M{"$sum": "$amount"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$project": bson.M{
+			"_id":   0,
+			"key":   "$_id.key",
+			"type":  "$_id.type",
+			"total": 1,
+			"count": 1,
+		}},
+		{"$sort": bson.D{{Key: "key", Value: 1}, {Key: "type", Value: 1}}},
+	})
+}
+
+// ReportByCategory never includes transfers, they have no category. Split
+// transactions count once per split line.
+func ReportByCategory(ctx context.Context, q ReportQuery) ([]ReportRow, error) {
+	q.IncludeTransfers = false
+
+	pipeline := append([]bson.M{{"$match": reportMatch(q)}}, unwindSplits...)
+	return runReport(ctx, append(pipeline, []bson.M{
+		{"$group": bson.M{
+			"_id":   bson.M{"key": "$category", "type": "$type"},
+			"total": bson.M{"$sum": "$amount"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$lookup": bson.M{
+			"from":         "categories",
+			"localField":   "_id.key",
+			"foreignField": "_id",
+			"as":           "category",
+		}},
+		{"$project": bson.M{
+			"_id":   0,
+			"key":   "$_id.key",
+			"type":  "$_id.type",
+			"label": bson.M{"$first": "$category.name"},
+			"total": 1,
+			"count": 1,
+		}},
+		{"$sort": bson.D{{Key: "total", Value: -1}}},
+	}...))
+}
+
+// ReportByPayee groups spending and income by payee. Transactions without a
+// payee end up in a row with a null key.
+func ReportByPayee(ctx context.Context, q ReportQuery) ([]ReportRow, error) {
+	q.IncludeTransfers = false
+
+	return runReport(ctx, []bson.M{
+		{"$match": reportMatch(q)},
+		{"$group": bson.M{
+			"_id":   bson.M{"key": "$payee", "type": "$type"},
+			"total": bson.M{"$sum": "$amount"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$lookup": bson.M{
+			"from":         "payees",
+			"localField":   "_id.key",
+			"foreignField": "_id",
+			"as":           "payee",
+		}},
+		{"$project": bson.M{
+			"_id":   0,
+			"key":   "$_id.key",
+			"type":  "$_id.type",
+			"label": bson.M{"$first": "$payee.name"},
+			"total": 1,
+			"count": 1,
+		}},
+		{"$sort": bson.D{{Key: "total", Value: -1}}},
+	})
+}
+
+// ReportByAccount splits transfers into a transfer_out row on the source and a
+// transfer_in row on the destination.
+func ReportByAccount(ctx context.Context, q ReportQuery) ([]ReportRow, error) {
+	return runReport(ctx, []bson.M{
+		{"$match": reportMatch(q)},
+		{"$project": bson.M{
+			"amount": 1,
+			"legs": bson.M{"$switch": bson.M{
+				"branches": []bson.M{
+					{
+						"case": bson.M{"$eq": []string{"$type", "income"}},
+						"then": []bson.M{{"account": "$destination_account", "type": "income"}},
+					},
+					{
+						"case": bson.M{"$eq": []string{"$type", "expense"}},
+						"then": []bson.M{{"account": "$source_account", "type": "expense"}},
+					},
+				},
+				"default": []bson.M{
+					{"account": "$source_account", "type": "transfer_out"},
+					{"account": "$destination_account", "type": "transfer_in"},
+				},
+			}},
+		}},
+		{"$unwind": "$legs"},
+		{"$group": bson.M{
+			"_id":   bson.M{"key": "$legs.account", "type": "$legs.type"},
+			"total": bson.M{"$sum": "$amount"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$lookup": bson.M{
+			"from":         "accounts",
+			"localField":   "_id.key",
+			"foreignField": "_id",
+			"as":           "account",
+		}},
+		{"$lookup": bson.M{
+			"from":         "savings",
+			"localField":   "_id.key",
+			"foreignField": "_id",
+			"as":           "saving",
+		}},
+		{"$project": bson.M{
+			"_id":  0,
+			"key":  "$_id.key",
+			"type": "$_id.type",
+			"label": bson.M{"$ifNull": []interface{}{
+				bson.M{"$first": "$account.name"},
+				bson.M{"$first": "$saving.name"},
+			}},
+			"total": 1,
+			"count": 1,
+		}},
+		{"$sort": bson.D{{Key: "label", Value: 1}, {Key: "type", Value: 1}}},
+	})
+}
+
+func ReportByType(ctx context.Context, q ReportQuery) ([]ReportRow, error) {
+	return runReport(ctx, []bson.M{
+		{"$match": reportMatch(q)},
+		{"$group": bson.M{
+			"_id":   "$type",
+			"total": bson.M{"$sum": "$amount"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$project": bson.M{
+			"_id":   0,
+			"key":   "$_id",
+			"type":  "$_id",
+			"total": 1,
+			"count": 1,
+		}},
+		{"$sort": bson.M{"key": 1}},
+	})
+}
@@ -0,0 +1,553 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RestorePlan is what a restore writes for the target user.
+type RestorePlan struct {
+	Dataset *model.Dataset // records to insert, owned by the target
+	// Balance changes of the target's accounts and savings records were
+	// merged into: the transactions restored onto them.
+	Balances map[primitive.ObjectID]float64
+	Merged   int // records folded into the target's own
+	Skipped  int // transactions, statements and settings the target already has
+}
+
+type RestoreSummary struct {
+	Strategy model.RestoreStrategy `json:"strategy"`
+	Inserted map[string]int        `json:"inserted"` // by collection
+	Deleted  int64                 `json:"deleted,omitempty"`
+	Merged   int                   `json:"merged"`
+	Skipped  int                   `json:"skipped"`
+}
+
+// restorer hands out the ids of a restore. Every record gets a new one, the
+// exported ids may still be in use by the user the data came from.
+type restorer struct {
+	strategy model.RestoreStrategy
+	ids      map[primitive.ObjectID]primitive.ObjectID
+	merged   map[primitive.ObjectID]bool // target records something was merged into
+	missing  []string
+	plan     *RestorePlan
+}
+
+// place gives the record old its id in the target: the id of the target's
+// record with the same key when merging, a new one otherwise. insert is
+// false when the record was merged.
+func (r *restorer) place(old primitive.ObjectID, deleted bool, key string, names map[string]primitive.ObjectID) (id primitive.ObjectID, insert bool) {
+	if r.strategy == model.RestoreMerge && !deleted {
+		if id, ok := names[key]; ok {
+			r.ids[old] = id
+			r.merged[id] = true
+			r.plan.Merged++
+			return id, false
+		}
+	}
+	id = primitive.NewObjectID()
+	r.ids[old] = id
+	return id, true
+}
+
+// rename numbers a name the target already uses when keeping both.
+func (r *restorer) rename(name, prefix string, deleted bool, names map[string]primitive.ObjectID) string {
+	if r.strategy != model.RestoreKeepBoth || deleted {
+		return name
+	}
+	unique := name
+	for n := 2; ; n++ {
+		if _, ok := names[prefix+util.NormalizeText(unique)]; !ok {
+			break
+		}
+		unique = fmt.Sprintf("%s (%d)", name, n)
+	}
+	names[prefix+util.NormalizeText(unique)] = primitive.NilObjectID
+	return unique
+}
+
+// ref is the new id of an optional reference, zero when it points outside
+// the export.
+func (r *restorer) ref(id primitive.ObjectID) primitive.ObjectID {
+	return r.ids[id]
+}
+
+// need is the new id of a reference that cannot be dropped, money moves
+// through it.
+func (r *restorer) need(what string, id primitive.ObjectID) primitive.ObjectID {
+	if id.IsZero() {
+		return id
+	}
+	newID, ok := r.ids[id]
+	if !ok {
+		r.missing = append(r.missing, what+" "+id.Hex())
+	}
+	return newID
+}
+
+func (r *restorer) refs(ids []primitive.ObjectID) []primitive.ObjectID {
+	if ids == nil {
+		return nil
+	}
+	out := []primitive.ObjectID{}
+	for _, id := range ids {
+		if newID, ok := r.ids[id]; ok && !containsID(out, newID) {
+			out = append(out, newID)
+		}
+	}
+	return out
+}
+
+func namesOf(n int, id func(int) primitive.ObjectID, key func(int) string) map[string]primitive.ObjectID {
+	names := map[string]primitive.ObjectID{}
+	for i := 0; i < n; i++ {
+		names[key(i)] = id(i)
+	}
+	return names
+}
+
+// restoreTransactionKey tells a transaction apart once its accounts are
+// mapped to the target's.
+func restoreTransactionKey(tx model.Transaction) string {
+	if tx.ExternalID != "" {
+		return "external:" + tx.SourceAccount.Hex() + tx.DestinationAccount.Hex() + ":" + tx.ExternalID
+	}
+	return fmt.Sprintf("%d:%s:%v:%s:%s:%s", tx.DateTime.UnixNano(), tx.Type, tx.Amount,
+		tx.SourceAccount.Hex(), tx.DestinationAccount.Hex(), util.NormalizeText(tx.Note))
+}
+
+// RemapDataset rewrites an export for owner following strategy. existing is
+// what owner has now, live records only, and is only read when merging or
+// keeping both. Every reference follows the records it points at; optional
+// ones that point outside the export are dropped, accounts money moves
+// through must be in it.
+func RemapDataset(ds *model.Dataset, owner string, strategy model.RestoreStrategy, existing *model.Dataset) (RestorePlan, error) {
+	plan := RestorePlan{
+		Dataset: &model.Dataset{
+			Version:    model.DatasetVersion,
+			Owner:      owner,
+			ExportedAt: ds.ExportedAt,
+			Filter:     ds.Filter,
+		},
+		Balances: map[primitive.ObjectID]float64{},
+	}
+	if ds.Version < 1 || ds.Version > model.DatasetVersion {
+		return plan, fmt.Errorf("Unsupported export version %d", ds.Version)
+	}
+	if existing == nil || strategy == model.RestoreReplace {
+		existing = &model.Dataset{}
+	}
+	r := &restorer{
+		strategy: strategy,
+		ids:      map[primitive.ObjectID]primitive.ObjectID{},
+		merged:   map[primitive.ObjectID]bool{},
+		plan:     &plan,
+	}
+	out := plan.Dataset
+	now := time.Now()
+
+	// Ids first, references can point either way
+
+	names := namesOf(len(existing.Accounts),
+		func(i int) primitive.ObjectID { return existing.Accounts[i].ID },
+		func(i int) string { return util.NormalizeText(existing.Accounts[i].Name) })
+	for _, a := range ds.Accounts {
+		id, insert := r.place(a.ID, a.IsDeleted, util.NormalizeText(a.Name), names)
+		if insert {
+			a.ID, a.Owner, a.LastUpdate = id, owner, now
+			a.Name = r.rename(a.Name, "", a.IsDeleted, names)
+			out.Accounts = append(out.Accounts, a)
+		}
+	}
+
+	names = namesOf(len(existing.Savings),
+		func(i int) primitive.ObjectID { return existing.Savings[i].ID },
+		func(i int) string { return util.NormalizeText(existing.Savings[i].Name) })
+	for _, s := range ds.Savings {
+		id, insert := r.place(s.ID, s.IsDeleted, util.NormalizeText(s.Name), names)
+		if insert {
+			s.ID, s.Owner, s.LastUpdate = id, owner, now
+			s.Name = r.rename(s.Name, "", s.IsDeleted, names)
+			out.Savings = append(out.Savings, s)
+		}
+	}
+
+	names = namesOf(len(existing.Categories),
+		func(i int) primitive.ObjectID { return existing.Categories[i].ID },
+		func(i int) string {
+			return existing.Categories[i].Type + ":" + util.NormalizeText(existing.Categories[i].Name)
+		})
+	for _, c := range ds.Categories {
+		id, insert := r.place(c.ID, c.IsDeleted, c.Type+":"+util.NormalizeText(c.Name), names)
+		if insert {
+			c.ID, c.Owner, c.LastUpdate = id, owner, now
+			c.Name = r.rename(c.Name, c.Type+":", c.IsDeleted, names)
+			out.Categories = append(out.Categories, c)
+		}
+	}
+
+	names = namesOf(len(existing.Tags),
+		func(i int) primitive.ObjectID { return existing.Tags[i].ID },
+		func(i int) string { return util.NormalizeText(existing.Tags[i].Name) })
+	for _, t := range ds.Tags {
+		id, insert := r.place(t.ID, t.IsDeleted, util.NormalizeText(t.Name), names)
+		if insert {
+			t.ID, t.Owner, t.LastUpdate = id, owner, now
+			t.Name = r.rename(t.Name, "", t.IsDeleted, names)
+			out.Tags = append(out.Tags, t)
+		}
+	}
+
+	names = namesOf(len(existing.Payees),
+		func(i int) primitive.ObjectID { return existing.Payees[i].ID },
+		func(i int) string { return util.NormalizeText(existing.Payees[i].Name) })
+	for _, p := range ds.Payees {
+		id, insert := r.place(p.ID, p.IsDeleted, util.NormalizeText(p.Name), names)
+		if insert {
+			p.ID, p.Owner, p.LastUpdate = id, owner, now
+			p.Name = r.rename(p.Name, "", p.IsDeleted, names)
+			out.Payees = append(out.Payees, p)
+		}
+	}
+
+	// Transactions the target has on the accounts merged into are skipped
+	known := map[string]primitive.ObjectID{}
+	if strategy == model.RestoreMerge {
+		for _, tx := range existing.Transactions {
+			known[restoreTransactionKey(tx)] = tx.ID
+		}
+	}
+	for _, tx := range ds.Transactions {
+		mapped := tx
+		mapped.SourceAccount, mapped.DestinationAccount = r.ids[tx.SourceAccount], r.ids[tx.DestinationAccount]
+		if id, ok := known[restoreTransactionKey(mapped)]; ok && !tx.IsDeleted {
+			r.ids[tx.ID] = id
+			plan.Skipped++
+			continue
+		}
+		r.ids[tx.ID] = primitive.NewObjectID()
+		tx.ID, tx.Creator, tx.LastUpdate = r.ids[tx.ID], owner, now
+		// Exports carry no attachment files
+		tx.Attachments = nil
+		out.Transactions = append(out.Transactions, tx)
+	}
+
+	names = namesOf(len(existing.Subscriptions),
+		func(i int) primitive.ObjectID { return existing.Subscriptions[i].ID },
+		func(i int) string { return util.NormalizeText(existing.Subscriptions[i].Name) })
+	for _, s := range ds.Subscriptions {
+		id, insert := r.place(s.ID, s.IsDeleted, util.NormalizeText(s.Name), names)
+		if insert {
+			s.ID, s.Creator, s.LastUpdate = id, owner, now
+			s.Name = r.rename(s.Name, "", s.IsDeleted, names)
+			out.Subscriptions = append(out.Subscriptions, s)
+		}
+	}
+
+	names = namesOf(len(existing.Loans),
+		func(i int) primitive.ObjectID { return existing.Loans[i].ID },
+		func(i int) string { return util.NormalizeText(existing.Loans[i].Name) })
+	for _, l := range ds.Loans {
+		id, insert := r.place(l.ID, l.IsDeleted, util.NormalizeText(l.Name), names)
+		if insert {
+			l.ID, l.Creator, l.LastUpdate = id, owner, now
+			l.Name = r.rename(l.Name, "", l.IsDeleted, names)
+			out.Loans = append(out.Loans, l)
+		}
+	}
+
+	names = namesOf(len(existing.Rules),
+		func(i int) primitive.ObjectID { return existing.Rules[i].ID },
+		func(i int) string { return util.NormalizeText(existing.Rules[i].Name) })
+	for _, rule := range ds.Rules {
+		id, insert := r.place(rule.ID, rule.IsDeleted, util.NormalizeText(rule.Name), names)
+		if insert {
+			rule.ID, rule.Owner, rule.LastUpdate = id, owner, now
+			rule.Name = r.rename(rule.Name, "", rule.IsDeleted, names)
+			out.Rules = append(out.Rules, rule)
+		}
+	}
+
+	names = namesOf(len(existing.ImportProfiles),
+		func(i int) primitive.ObjectID { return existing.ImportProfiles[i].ID },
+		func(i int) string { return util.NormalizeText(existing.ImportProfiles[i].Name) })
+	for _, p := range ds.ImportProfiles {
+		id, insert := r.place(p.ID, p.IsDeleted, util.NormalizeText(p.Name), names)
+		if insert {
+			p.ID, p.Owner, p.LastUpdate = id, owner, now
+			p.Name = r.rename(p.Name, "", p.IsDeleted, names)
+			out.ImportProfiles = append(out.ImportProfiles, p)
+		}
+	}
+
+	names = namesOf(len(existing.MessageTemplates),
+		func(i int) primitive.ObjectID { return existing.MessageTemplates[i].ID },
+		func(i int) string { return util.NormalizeText(existing.MessageTemplates[i].Name) })
+	for _, t := range ds.MessageTemplates {
+		id, insert := r.place(t.ID, t.IsDeleted, util.NormalizeText(t.Name), names)
+		if insert {
+			t.ID, t.Owner, t.LastUpdate = id, owner, now
+			t.Name = r.rename(t.Name, "", t.IsDeleted, names)
+			out.MessageTemplates = append(out.MessageTemplates, t)
+		}
+	}
+
+	// Statements and snapshots are derived: the target's own win, snapshots
+	// of accounts merged into would be wrong
+	periods := map[string]bool{}
+	for _, s := range existing.Statements {
+		periods[s.Account.Hex()+s.PeriodEnd.String()] = true
+	}
+	for _, s := range ds.Statements {
+		account := r.ids[s.Account]
+		if periods[account.Hex()+s.PeriodEnd.String()] {
+			r.ids[s.ID] = primitive.NilObjectID
+			plan.Skipped++
+			continue
+		}
+		r.ids[s.ID] = primitive.NewObjectID()
+		s.ID, s.Owner, s.LastUpdate = r.ids[s.ID], owner, now
+		out.Statements = append(out.Statements, s)
+	}
+	for _, s := range ds.BalanceSnapshots {
+		if r.merged[r.ids[s.Account]] {
+			continue
+		}
+		s.ID, s.Owner = primitive.NewObjectID(), owner
+		out.BalanceSnapshots = append(out.BalanceSnapshots, s)
+	}
+
+	for _, n := range ds.Notifications {
+		r.ids[n.ID] = primitive.NewObjectID()
+		n.ID, n.Owner, n.LastUpdate = r.ids[n.ID], owner, now
+		out.Notifications = append(out.Notifications, n)
+	}
+
+	// One set of preferences per user, the target's stays
+	if len(ds.NotificationPreferences) > 0 {
+		if len(existing.NotificationPreferences) > 0 {
+			plan.Skipped++
+		} else {
+			p := ds.NotificationPreferences[0]
+			p.ID, p.Owner, p.LastUpdate = primitive.NewObjectID(), owner, now
+			out.NotificationPreferences = append(out.NotificationPreferences, p)
+		}
+	}
+
+	// References
+
+	for i := range out.Payees {
+		p := &out.Payees[i]
+		p.DefaultCategory, p.DefaultAccount = r.ref(p.DefaultCategory), r.ref(p.DefaultAccount)
+	}
+	for i := range out.Transactions {
+		tx := &out.Transactions[i]
+		what := "transaction " + tx.ID.Hex() + ": account"
+		tx.SourceAccount = r.need(what, tx.SourceAccount)
+		tx.DestinationAccount = r.need(what, tx.DestinationAccount)
+		tx.Category, tx.Payee = r.ref(tx.Category), r.ref(tx.Payee)
+		tx.Tags = r.refs(tx.Tags)
+		if tx.Splits != nil {
+			splits := make([]model.Split, len(tx.Splits))
+			for j, split := range tx.Splits {
+				split.Category = r.ref(split.Category)
+				splits[j] = split
+			}
+			tx.Splits = splits
+		}
+		tx.MergedInto = r.ref(tx.MergedInto)
+		tx.NotDuplicates = r.refs(tx.NotDuplicates)
+		// Batches are not exported
+		tx.ImportBatch = primitive.NilObjectID
+
+		if !tx.IsDeleted {
+			for _, id := range []primitive.ObjectID{tx.SourceAccount, tx.DestinationAccount} {
+				if r.merged[id] {
+					plan.Balances[id] = roundMoney(plan.Balances[id] + transactionEffect(*tx, id))
+				}
+			}
+		}
+	}
+	for i := range out.Subscriptions {
+		s := &out.Subscriptions[i]
+		s.SourceAccount = r.need("subscription "+s.Name+": account", s.SourceAccount)
+		s.Category = r.ref(s.Category)
+	}
+	for i := range out.Loans {
+		l := &out.Loans[i]
+		l.Account = r.need("loan "+l.Name+": account", l.Account)
+		l.SourceAccount = r.need("loan "+l.Name+": account", l.SourceAccount)
+		l.InterestCategory = r.ref(l.InterestCategory)
+		schedule := make([]model.Installment, len(l.Schedule))
+		for j, inst := range l.Schedule {
+			inst.PrincipalTransaction = r.ref(inst.PrincipalTransaction)
+			inst.InterestTransaction = r.ref(inst.InterestTransaction)
+			schedule[j] = inst
+		}
+		l.Schedule = schedule
+	}
+	for i := range out.Rules {
+		rule := &out.Rules[i]
+		rule.Conditions.Payee, rule.Conditions.Account = r.ref(rule.Conditions.Payee), r.ref(rule.Conditions.Account)
+		rule.Actions.Category, rule.Actions.Payee = r.ref(rule.Actions.Category), r.ref(rule.Actions.Payee)
+		rule.Actions.Tags = r.refs(rule.Actions.Tags)
+		rule.Actions.TransferAccount = r.ref(rule.Actions.TransferAccount)
+	}
+	for i := range out.ImportProfiles {
+		out.ImportProfiles[i].Account = r.ref(out.ImportProfiles[i].Account)
+	}
+	for i := range out.MessageTemplates {
+		out.MessageTemplates[i].Account = r.ref(out.MessageTemplates[i].Account)
+	}
+	for i := range out.Statements {
+		s := &out.Statements[i]
+		s.Account = r.need("statement: account", s.Account)
+		s.Notification = r.ref(s.Notification)
+	}
+	for i := range out.BalanceSnapshots {
+		s := &out.BalanceSnapshots[i]
+		s.Account = r.need("balance snapshot: account", s.Account)
+	}
+	for i := range out.Notifications {
+		out.Notifications[i].ReferenceId = r.ref(out.Notifications[i].ReferenceId)
+	}
+
+	if len(r.missing) > 0 {
+		more := ""
+		if len(r.missing) > 3 {
+			more = fmt.Sprintf(" and %d more", len(r.missing)-3)
+			r.missing = r.missing[:3]
+		}
+		return plan, fmt.Errorf("The export is incomplete, %s%s are not in it", strings.Join(r.missing, ", "), more)
+	}
+	return plan, nil
+}
+
+// restoreCollections lists where each part of a dataset goes and which field
+// names its owner.
+func restoreCollections(ds *model.Dataset) []struct {
+	name       string
+	collection *mongo.Collection
+	owner      string
+	docs       []interface{}
+} {
+	docs := func(n int, at func(int) interface{}) []interface{} {
+		out := make([]interface{}, n)
+		for i := range out {
+			out[i] = at(i)
+		}
+		return out
+	}
+	return []struct {
+		name       string
+		collection *mongo.Collection
+		owner      string
+		docs       []interface{}
+	}{
+		{"accounts", util.AccountCollection, "owner", docs(len(ds.Accounts), func(i int) interface{} { return ds.Accounts[i] })},
+		{"savings", util.SavingCollection, "owner", docs(len(ds.Savings), func(i int) interface{} { return ds.Savings[i] })},
+		{"categories", util.CategoryCollection, "owner", docs(len(ds.Categories), func(i int) interface{} { return ds.Categories[i] })},
+		{"tags", util.TagCollection, "owner", docs(len(ds.Tags), func(i int) interface{} { return ds.Tags[i] })},
+		{"payees", util.PayeeCollection, "owner", docs(len(ds.Payees), func(i int) interface{} { return ds.Payees[i] })},
+		{"transactions", util.TransactionCollection, "creator", docs(len(ds.Transactions), func(i int) interface{} { return ds.Transactions[i] })},
+		{"subscriptions", util.SubscriptionCollection, "creator", docs(len(ds.Subscriptions), func(i int) interface{} { return ds.Subscriptions[i] })},
+		{"loans", util.LoanCollection, "creator", docs(len(ds.Loans), func(i int) interface{} { return ds.Loans[i] })},
+		{"rules", util.RuleCollection, "owner", docs(len(ds.Rules), func(i int) interface{} { return ds.Rules[i] })},
+		{"import_profiles", util.ImportProfileCollection, "owner", docs(len(ds.ImportProfiles), func(i int) interface{} { return ds.ImportProfiles[i] })},
+		{"message_templates", util.MessageTemplateCollection, "owner", docs(len(ds.MessageTemplates), func(i int) interface{} { return ds.MessageTemplates[i] })},
+		{"statements", util.StatementCollection, "owner", docs(len(ds.Statements), func(i int) interface{} { return ds.Statements[i] })},
+		{"balance_snapshots", util.BalanceSnapshotCollection, "owner", docs(len(ds.BalanceSnapshots), func(i int) interface{} { return ds.BalanceSnapshots[i] })},
+		{"notifications", util.NotificationCollection, "owner", docs(len(ds.Notifications), func(i int) interface{} { return ds.Notifications[i] })},
+		{"notification_preferences", util.NotificationPreferenceCollection, "owner", docs(len(ds.NotificationPreferences), func(i int) interface{} { return ds.NotificationPreferences[i] })},
+	}
+}
+
+// RestoreDataset loads an export into owner's data in one database
+// transaction, so a failed restore leaves nothing behind.
+func RestoreDataset(ctx context.Context, owner string, ds *model.Dataset, strategy model.RestoreStrategy) (RestoreSummary, error) {
+	summary := RestoreSummary{Strategy: strategy, Inserted: map[string]int{}}
+
+	var existing *model.Dataset
+	if strategy != model.RestoreReplace {
+		var err error
+		if existing, err = LoadDataset(ctx, owner, model.ExportFilter{}); err != nil {
+			return summary, err
+		}
+	}
+	plan, err := RemapDataset(ds, owner, strategy, existing)
+	if err != nil {
+		return summary, err
+	}
+	summary.Merged, summary.Skipped = plan.Merged, plan.Skipped
+
+	// Files of the transactions a replace removes go once it committed
+	var orphaned []model.Attachment
+	if strategy == model.RestoreReplace {
+		if orphaned, err = ownerAttachments(ctx, owner); err != nil {
+			return summary, err
+		}
+	}
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return summary, fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	collections := restoreCollections(plan.Dataset)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		summary.Deleted = 0
+		if strategy == model.RestoreReplace {
+			for _, c := range collections {
+				res, err := c.collection.DeleteMany(sc, bson.M{c.owner: owner})
+				if err != nil {
+					return nil, fmt.Errorf("Failed to clear %s: %w", c.name, err)
+				}
+				summary.Deleted += res.DeletedCount
+			}
+		}
+
+		for _, c := range collections {
+			if len(c.docs) == 0 {
+				continue
+			}
+			if _, err := c.collection.InsertMany(sc, c.docs); err != nil {
+				return nil, fmt.Errorf("Failed to restore %s: %w", c.name, err)
+			}
+			summary.Inserted[c.name] = len(c.docs)
+		}
+
+		for id, delta := range plan.Balances {
+			if _, err := util.AdjustBalance(sc, id, delta); err != nil {
+				return nil, fmt.Errorf("Failed to adjust balance: %w", err)
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return summary, err
+	}
+	deleteAttachmentFiles(ctx, orphaned)
+
+	for _, c := range collections {
+		if len(c.docs) > 0 || summary.Deleted > 0 {
+			socket.BroadcastFromContext(ctx, map[string]interface{}{
+				"collection": c.name,
+				"action":     "restore",
+				"detail":     "bulk",
+			})
+		}
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func GetRuleByID(id string) (model.Rule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Rule{}, err
+	}
+
+	var rule model.Rule
+
+	err = util.RuleCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&rule)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.Rule{}, errors.New("rule not found")
+		}
+		return model.Rule{}, err
+	}
+
+	return rule, nil
+}
+
+func FetchRulesSince(ctx context.Context, username string, since time.Time) (*mongo.Cursor, error) {
+	filter := bson.M{
+		"last_update": bson.M{
+			"$gt": since,
+		},
+		"owner": username,
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "last_update", Value: -1},
+	})
+
+	return util.RuleCollection.Find(ctx, filter, opts)
+}
+
+func AddRule(ctx context.Context, rule model.Rule) (interface{}, error) {
+	rule.LastUpdate = time.Now()
+
+	result, err := util.RuleCollection.InsertOne(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+	rule.ID = result.InsertedID.(primitive.ObjectID)
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "rules",
+		"action":     "create",
+		"detail":     rule,
+	})
+
+	return result.InsertedID, nil
+}
+
+func UpdateRule(ctx context.Context, id primitive.ObjectID, rule model.Rule) error {
+	rule.LastUpdate = time.Now()
+
+	// Conditions and actions are replaced as a whole
+	if _, err := util.RuleCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": rule}); err != nil {
+		return err
+	}
+
+	rule.ID = id
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "rules",
+		"action":     "update",
+		"detail":     rule,
+	})
+
+	return nil
+}
+
+func DeleteRule(ctx context.Context, id primitive.ObjectID) error {
+	_, err := util.RuleCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"is_deleted":  true,
+		"last_update": time.Now(),
+	}})
+	if err != nil {
+		return fmt.Errorf("Error deleting rule: %w", err)
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "rules",
+		"action":     "delete",
+		"detail":     id,
+	})
+
+	return nil
+}
+
+// RetargetRuleTag points rule at into wherever it adds the tag from, or
+// drops from when into is zero. It tells whether rule changed.
+func RetargetRuleTag(rule *model.Rule, from, into primitive.ObjectID) bool {
+	if !containsID(rule.Actions.Tags, from) {
+		return false
+	}
+	var tags []primitive.ObjectID
+	for _, tag := range rule.Actions.Tags {
+		if tag == from {
+			tag = into
+		}
+		if !tag.IsZero() && !containsID(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	rule.Actions.Tags = tags
+	return true
+}
+
+// RetargetRulePayee points rule at into wherever it names the payee from.
+// When from is deleted (into is zero) the action is dropped, and a rule that
+// matched on from is switched off: without the condition it would match
+// every transaction.
+func RetargetRulePayee(rule *model.Rule, from, into primitive.ObjectID) bool {
+	changed := false
+	if rule.Actions.Payee == from {
+		rule.Actions.Payee = into
+		changed = true
+	}
+	if rule.Conditions.Payee == from {
+		rule.Conditions.Payee = into
+		if into.IsZero() {
+			rule.IsActive = false
+		}
+		changed = true
+	}
+	return changed
+}
+
+// retargetRules rewrites the rules matching filter with retarget, inside the
+// session of a merge or delete. It tells whether any rule changed.
+func retargetRules(sc mongo.SessionContext, filter bson.M, retarget func(*model.Rule) bool, now time.Time) (bool, error) {
+	filter["is_deleted"] = false
+	cursor, err := util.RuleCollection.Find(sc, filter)
+	if err != nil {
+		return false, fmt.Errorf("Failed to fetch rules: %w", err)
+	}
+	var rules []model.Rule
+	if err := cursor.All(sc, &rules); err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, rule := range rules {
+		if !retarget(&rule) {
+			continue
+		}
+		if _, err := util.RuleCollection.UpdateByID(sc, rule.ID, bson.M{"$set": bson.M{
+			"conditions":  rule.Conditions,
+			"actions":     rule.Actions,
+			"is_active":   rule.IsActive,
+			"last_update": now,
+		}}); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+func broadcastRulesChanged(ctx context.Context) {
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "rules",
+		"action":     "update",
+		"detail":     "bulk",
+	})
+}
+
+// RuleSet is an owner's active rules in the order they run.
+type RuleSet struct {
+	rules []model.Rule
+}
+
+func LoadRules(ctx context.Context, owner string) (*RuleSet, error) {
+	cursor, err := util.RuleCollection.Find(ctx, bson.M{
+		"owner":      owner,
+		"is_active":  true,
+		"is_deleted": false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch rules: %w", err)
+	}
+	var rules []model.Rule
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return NewRuleSet(rules), nil
+}
+
+// NewRuleSet orders rules by priority, ties go to the older rule.
+func NewRuleSet(rules []model.Rule) *RuleSet {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].ID.Hex() < rules[j].ID.Hex()
+	})
+	return &RuleSet{rules: rules}
+}
+
+// ruleTypes are the transactions rules look at, balance entries are left
+// alone.
+var ruleTypes = []string{"income", "expense", "transfer"}
+
+// RuleMatches tells whether every condition of rule holds for tx.
+func RuleMatches(rule model.Rule, tx model.Transaction) bool {
+	cond := rule.Conditions
+
+	if cond.Type != "" && cond.Type != tx.Type {
+		return false
+	}
+	if !cond.Payee.IsZero() && cond.Payee != tx.Payee {
+		return false
+	}
+	if !cond.Account.IsZero() && cond.Account != tx.SourceAccount && cond.Account != tx.DestinationAccount {
+		return false
+	}
+	if cond.MinAmount > 0 && tx.Amount < cond.MinAmount {
+		return false
+	}
+	if cond.MaxAmount > 0 && tx.Amount > cond.MaxAmount {
+		return false
+	}
+	if cond.NoteContains != "" {
+		note := " " + util.NormalizeText(tx.Note) + " "
+		if !strings.Contains(note, " "+util.NormalizeText(cond.NoteContains)+" ") {
+			return false
+		}
+	}
+
+	if len(cond.Weekdays) == 0 && cond.TimeFrom == "" {
+		return true
+	}
+
+	loc, err := time.LoadLocation(rule.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := tx.DateTime.In(loc)
+
+	if len(cond.Weekdays) > 0 {
+		found := false
+		for _, day := range cond.Weekdays {
+			found = found || day == local.Weekday()
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if cond.TimeFrom != "" && cond.TimeTo != "" {
+		// "HH:MM" compares correctly as a string
+		at := local.Format("15:04")
+		if cond.TimeFrom <= cond.TimeTo {
+			return at >= cond.TimeFrom && at < cond.TimeTo
+		}
+		return at >= cond.TimeFrom || at < cond.TimeTo
+	}
+
+	return true
+}
+
+// Apply runs the rules on tx. Without overwrite, rules only fill in what tx
+// is missing: a category (or transfer) and a payee. It returns the rules that
+// fired.
+func (rs *RuleSet) Apply(tx *model.Transaction, overwrite bool) []model.Rule {
+	// Whether the category and payee are taken, by tx or an earlier rule
+	classified := !overwrite && (!tx.Category.IsZero() || len(tx.Splits) > 0 || tx.Type == "transfer")
+	hasPayee := !overwrite && !tx.Payee.IsZero()
+
+	var fired []model.Rule
+	for _, rule := range rs.rules {
+		if !RuleMatches(rule, *tx) {
+			continue
+		}
+		fired = append(fired, rule)
+		act := rule.Actions
+
+		if !classified && tx.Type != "transfer" && len(tx.Splits) == 0 {
+			if !act.TransferAccount.IsZero() {
+				classified = markTransfer(tx, act.TransferAccount)
+			} else if !act.Category.IsZero() {
+				tx.Category = act.Category
+				classified = true
+			}
+		}
+
+		if !hasPayee && !act.Payee.IsZero() {
+			tx.Payee = act.Payee
+			hasPayee = true
+		}
+
+		for _, tag := range act.Tags {
+			if !containsID(tx.Tags, tag) {
+				tx.Tags = append(tx.Tags, tag)
+			}
+		}
+
+		if rule.StopProcessing {
+			break
+		}
+	}
+	return fired
+}
+
+// markTransfer puts account on the other side of an expense or income.
+func markTransfer(tx *model.Transaction, account primitive.ObjectID) bool {
+	switch tx.Type {
+	case "expense":
+		if account == tx.SourceAccount {
+			return false
+		}
+		tx.DestinationAccount = account
+	case "income":
+		if account == tx.DestinationAccount {
+			return false
+		}
+		tx.SourceAccount = account
+	default:
+		return false
+	}
+	tx.Type = "transfer"
+	tx.Category = primitive.NilObjectID
+	return true
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleChanged tells whether Apply changed anything the rules can touch.
+func ruleChanged(before, after model.Transaction) bool {
+	if before.Type != after.Type || before.Category != after.Category || before.Payee != after.Payee ||
+		before.SourceAccount != after.SourceAccount || before.DestinationAccount != after.DestinationAccount {
+		return true
+	}
+	return len(before.Tags) != len(after.Tags)
+}
+
+type RuleChange struct {
+	Before model.Transaction `json:"before"`
+	After  model.Transaction `json:"after"`
+	// Error says why the change was not made
+	Error string `json:"error,omitempty"`
+}
+
+// CheckRuleSource checks the spending rule of the account a rule moved the
+// money of tx out of, as when a rule turns an income into a transfer.
+func CheckRuleSource(before, after model.Transaction) error {
+	if after.SourceAccount == before.SourceAccount || after.SourceAccount.IsZero() {
+		return nil
+	}
+	// Savings have no rules
+	account, err := GetAccountByID(after.SourceAccount.Hex())
+	if err != nil {
+		return nil
+	}
+	replacing := ""
+	if !before.ID.IsZero() {
+		replacing = before.ID.Hex()
+	}
+	return CheckSpendingRule(account, after.Amount, replacing)
+}
+
+// ruleTestLimit caps how many changes a dry run sends back.
+const ruleTestLimit = 200
+
+// RunRulesOnHistory applies rules to the owner's transactions dated from
+// onwards, overwriting what they set. With dryRun nothing is written and up
+// to ruleTestLimit changes are returned. Otherwise the changes returned are
+// the ones skipped for breaking an account's spending rule. It returns how
+// many transactions changed.
+func RunRulesOnHistory(ctx context.Context, owner string, rules *RuleSet, from time.Time, dryRun bool) ([]RuleChange, int, error) {
+	filter := bson.M{
+		"creator":    owner,
+		"is_deleted": false,
+		"type":       bson.M{"$in": ruleTypes},
+	}
+	if !from.IsZero() {
+		filter["date_time"] = bson.M{"$gte": from}
+	}
+
+	cursor, err := util.TransactionCollection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "date_time", Value: -1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to fetch transactions: %w", err)
+	}
+	var transactions []model.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, 0, err
+	}
+
+	changes := []RuleChange{}
+	count := 0
+	for _, before := range transactions {
+		after := before
+		after.Tags = append([]primitive.ObjectID(nil), before.Tags...)
+		if len(rules.Apply(&after, true)) == 0 || !ruleChanged(before, after) {
+			continue
+		}
+
+		if err := CheckRuleSource(before, after); err != nil {
+			if len(changes) < ruleTestLimit {
+				changes = append(changes, RuleChange{Before: before, After: after, Error: err.Error()})
+			}
+			continue
+		}
+		count++
+
+		if dryRun {
+			if len(changes) < ruleTestLimit {
+				changes = append(changes, RuleChange{Before: before, After: after})
+			}
+			continue
+		}
+
+		id := after.ID
+		after.ID = primitive.NilObjectID
+		if err := updateTransactionInternal(ctx, id, after); err != nil {
+			return nil, count - 1, fmt.Errorf("Failed to update transaction %s: %w", id.Hex(), err)
+		}
+	}
+
+	if !dryRun && count > 0 {
+		socket.BroadcastFromContext(ctx, map[string]interface{}{
+			"collection": "transactions",
+			"action":     "update",
+			"detail":     "bulk",
+		})
+	}
+
+	return changes, count, nil
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// scheduleSavingInterest fills in the term and accrual dates of a saving.
+// Interest starts at since for savings that never accrued before.
+func scheduleSavingInterest(saving *model.Saving, since time.Time) {
+	if saving.TermStart.IsZero() {
+		saving.TermStart = since
+	}
+	if saving.LastAccrual.IsZero() {
+		saving.LastAccrual = since
+	}
+
+	saving.MaturityDate = time.Time{}
+	if saving.TermMonths > 0 {
+		saving.MaturityDate = saving.TermStart.AddDate(0, saving.TermMonths, 0)
+	}
+
+	saving.NextAccrual = nextAccrualAt(*saving)
+}
+
+// nextAccrualAt is when the next interest payment is due, zero when the
+// saving already matured or earns nothing and has no term. A term deposit
+// without interest is still looked at on its maturity date.
+func nextAccrualAt(saving model.Saving) time.Time {
+	matured := !saving.MaturityDate.IsZero() && !saving.LastAccrual.Before(saving.MaturityDate)
+	if matured {
+		return time.Time{}
+	}
+	if saving.Rate <= 0 {
+		return saving.MaturityDate
+	}
+
+	var next time.Time
+	switch saving.Compounding {
+	case model.CompoundDaily:
+		next = saving.LastAccrual.AddDate(0, 0, 1)
+	case model.CompoundMonthly:
+		next = saving.LastAccrual.AddDate(0, 1, 0)
+	case model.CompoundMaturity:
+		next = saving.MaturityDate
+	default:
+		return time.Time{}
+	}
+
+	if !saving.MaturityDate.IsZero() && next.After(saving.MaturityDate) {
+		next = saving.MaturityDate
+	}
+	return next
+}
+
+// AccrueSavingInterest computes the interest earned on the current balance
+// between the last accrual and now, in whole compounding periods, never past
+// maturity. It returns the amount and the date it was earned through.
+func AccrueSavingInterest(saving model.Saving, now time.Time) (float64, time.Time) {
+	last := saving.LastAccrual
+	limit := now
+	if !saving.MaturityDate.IsZero() && saving.MaturityDate.Before(limit) {
+		limit = saving.MaturityDate
+	}
+	if !last.Before(limit) {
+		return 0, last
+	}
+	if saving.Rate <= 0 {
+		// Nothing to earn, but the term still runs out.
+		if limit.Equal(saving.MaturityDate) {
+			return 0, limit
+		}
+		return 0, last
+	}
+
+	rate := saving.Rate / 100
+	switch saving.Compounding {
+	case model.CompoundDaily:
+		days := 0
+		for !last.AddDate(0, 0, days+1).After(limit) {
+			days++
+		}
+		// A last partial day up to maturity still earns its share.
+		through := last.AddDate(0, 0, days)
+		fraction := float64(days)
+		if limit.Equal(saving.MaturityDate) && through.Before(limit) {
+			fraction += limit.Sub(through).Hours() / 24
+			through = limit
+		}
+		return roundMoney(saving.Balance * (math.Pow(1+rate/365, fraction) - 1)), through
+
+	case model.CompoundMonthly:
+		months := 0
+		for !last.AddDate(0, months+1, 0).After(limit) {
+			months++
+		}
+		through := last.AddDate(0, months, 0)
+		interest := saving.Balance * (math.Pow(1+rate/12, float64(months)) - 1)
+		if limit.Equal(saving.MaturityDate) && through.Before(limit) {
+			// Simple interest for the broken period before maturity.
+			interest += (saving.Balance + interest) * rate * limit.Sub(through).Hours() / 24 / 365
+			through = limit
+		}
+		return roundMoney(interest), through
+
+	case model.CompoundMaturity:
+		if saving.MaturityDate.IsZero() || now.Before(saving.MaturityDate) {
+			return 0, last
+		}
+		days := saving.MaturityDate.Sub(last).Hours() / 24
+		return roundMoney(saving.Balance * rate * days / 365), saving.MaturityDate
+	}
+
+	return 0, last
+}
+
+// PostSavingInterest books the interest every saving earned so far as income
+// into the saving, and tells owners about matured term deposits.
+func PostSavingInterest(ctx context.Context) error {
+	now := time.Now()
+
+	cursor, err := util.SavingCollection.Find(ctx, bson.M{
+		"is_deleted":   false,
+		"next_accrual": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to fetch savings: %w", err)
+	}
+	var savings []model.Saving
+	if err := cursor.All(ctx, &savings); err != nil {
+		return err
+	}
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	for _, saving := range savings {
+		userCtx := userContext(ctx, saving.Owner)
+		interest, through := AccrueSavingInterest(saving, now)
+
+		// The accrual only moves past maturity once the owner was told,
+		// a failed notification is tried again on the next run.
+		matured := !saving.MaturityDate.IsZero() && !through.Before(saving.MaturityDate)
+		if matured && !saving.MaturityNotified {
+			if err := notifyMaturity(userCtx, saving); err != nil {
+				log.Printf("Failed to notify maturity of saving %s: %v", saving.ID.Hex(), err)
+				continue
+			}
+			saving.MaturityNotified = true
+		}
+
+		posted := false
+		_, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			set := bson.M{"last_update": now}
+
+			// Sub-cent amounts wait until they add up to something.
+			if interest >= 0.01 {
+				_, err := insertTransaction(sc, model.Transaction{
+					Creator:            saving.Owner,
+					Amount:             interest,
+					DateTime:           through,
+					Type:               "income",
+					DestinationAccount: saving.ID,
+					Note:               "Interest on " + saving.Name,
+					LastUpdate:         now,
+				})
+				if err != nil {
+					return nil, err
+				}
+				posted = true
+			}
+			if posted || through.Equal(saving.MaturityDate) {
+				saving.LastAccrual = through
+				set["last_accrual"] = through
+			}
+
+			update := bson.M{"$set": set}
+			if next := nextAccrualAt(saving); next.IsZero() {
+				update["$unset"] = bson.M{"next_accrual": ""}
+			} else {
+				if !next.After(now) {
+					// Nothing posted yet, look again tomorrow.
+					next = now.AddDate(0, 0, 1)
+				}
+				set["next_accrual"] = next
+			}
+
+			_, err := util.SavingCollection.UpdateByID(sc, saving.ID, update)
+			return nil, err
+		})
+		if err != nil {
+			log.Printf("Failed to post interest for saving %s: %v", saving.ID.Hex(), err)
+			continue
+		}
+
+		if posted {
+			socket.BroadcastFromContext(userCtx, map[string]interface{}{
+				"collection": "transactions",
+				"action":     "create",
+				"detail":     "bulk",
+			})
+			socket.BroadcastFromContext(userCtx, map[string]interface{}{
+				"collection": "savings",
+				"action":     "update",
+				"detail":     saving.ID,
+			})
+		}
+	}
+
+	return nil
+}
+
+// notifyMaturity stores the maturity notification and marks the saving as
+// notified.
+func notifyMaturity(ctx context.Context, saving model.Saving) error {
+	_, err := DeliverNotification(ctx, model.Notification{
+		Owner:       saving.Owner,
+		Type:        model.TypeSavingMatured,
+		ReferenceId: saving.ID,
+		Title:       "Term deposit matured",
+		Message: fmt.Sprintf("%s matured on %s. You can withdraw it or roll it over for another %d months.",
+			saving.Name, saving.MaturityDate.Format("Jan 2, 2006"), saving.TermMonths),
+		ScheduledAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"maturity_notified": true}}
+	_, err = util.SavingCollection.UpdateByID(ctx, saving.ID, update)
+	return err
+}
+
+// RolloverSaving starts a new term of the same length at the maturity date,
+// at the saving's current rate.
+func RolloverSaving(ctx context.Context, id primitive.ObjectID) (model.Saving, error) {
+	var saving model.Saving
+	if err := util.SavingCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&saving); err != nil {
+		return saving, err
+	}
+	if saving.TermMonths <= 0 || saving.MaturityDate.IsZero() {
+		return saving, errors.New("saving has no term")
+	}
+	if time.Now().Before(saving.MaturityDate) {
+		return saving, errors.New("saving has not matured yet")
+	}
+	if saving.LastAccrual.Before(saving.MaturityDate) && saving.Rate > 0 {
+		return saving, errors.New("interest for this term is not posted yet")
+	}
+
+	saving.TermStart = saving.MaturityDate
+	saving.LastAccrual = saving.MaturityDate
+	saving.MaturityNotified = false
+	scheduleSavingInterest(&saving, saving.TermStart)
+	saving.LastUpdate = time.Now()
+
+	set := bson.M{
+		"term_start":    saving.TermStart,
+		"maturity_date": saving.MaturityDate,
+		"last_accrual":  saving.LastAccrual,
+		"last_update":   saving.LastUpdate,
+	}
+	update := bson.M{"$set": set, "$unset": bson.M{"maturity_notified": ""}}
+	if saving.NextAccrual.IsZero() {
+		update["$unset"].(bson.M)["next_accrual"] = ""
+	} else {
+		set["next_accrual"] = saving.NextAccrual
+	}
+
+	if _, err := util.SavingCollection.UpdateByID(ctx, id, update); err != nil {
+		return saving, err
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "savings",
+		"action":     "update",
+		"detail":     saving,
+	})
+
+	return saving, nil
+}
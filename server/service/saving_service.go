@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"fintrack/server/model"
@@ -53,29 +54,124 @@ func FetchSavingsSince(ctx context.Context, username string, since time.Time) (*
 	return util.SavingCollection.Find(ctx, filter, opts)
 }
 
+// AddSaving records a non-zero starting balance as an opening_balance
+// transaction, so the ledger explains the balance from day one.
 func AddSaving(ctx context.Context, saving model.Saving) (interface{}, error) {
 	saving.LastUpdate = time.Now()
+	since := saving.CreatedDate
+	if since.IsZero() {
+		since = saving.LastUpdate
+	}
+	// The term runs from when the saving was opened, interest on the
+	// balance entered today only from today.
+	saving.LastAccrual = saving.LastUpdate
+	scheduleSavingInterest(&saving, since)
+	opening := saving.Balance
+	saving.Balance = 0
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		res, err := util.SavingCollection.InsertOne(sc, saving)
+		if err != nil {
+			return nil, err
+		}
+
+		if opening != 0 {
+			id := res.InsertedID.(primitive.ObjectID)
+			txn := BalanceTransaction(saving.Owner, id, "opening_balance", opening, "Opening balance")
+			if _, err := insertTransaction(sc, txn); err != nil {
+				return nil, err
+			}
+		}
 
-	result, err := util.SavingCollection.InsertOne(ctx, saving)
+		return res.InsertedID, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	saving.ID = result.(primitive.ObjectID)
+	saving.Balance = opening
+
 	socket.BroadcastFromContext(ctx, map[string]interface{}{
 		"collection": "savings",
 		"action":     "create",
 		"detail":     saving,
 	})
+	if opening != 0 {
+		socket.BroadcastFromContext(ctx, map[string]interface{}{
+			"collection": "transactions",
+			"action":     "create",
+			"detail":     "bulk",
+		})
+	}
 
-	return result.InsertedID, nil
+	return result, nil
 }
 
+// UpdateSaving never overwrites the balance directly, a different balance is
+// turned into an adjustment transaction for the difference.
 func UpdateSaving(ctx context.Context, id primitive.ObjectID, saving model.Saving) error {
-	saving.LastUpdate = time.Now()
 	filter := bson.M{"_id": id}
-	updateSaving := bson.M{"$set": saving}
+	saving.LastUpdate = time.Now()
+
+	adjusted := false
+	err := util.MongoClient.UseSession(ctx, func(sc mongo.SessionContext) error {
+		if err := sc.StartTransaction(); err != nil {
+			return err
+		}
+
+		var old model.Saving
+		if err := util.SavingCollection.FindOne(sc, filter).Decode(&old); err != nil {
+			_ = sc.AbortTransaction(sc)
+			return err
+		}
 
-	_, err := util.SavingCollection.UpdateOne(ctx, filter, updateSaving)
+		// Rate and term changes apply from now on, the current term keeps
+		// its start. A new rate starts earning now, not back at the last
+		// accrual.
+		saving.TermStart = old.TermStart
+		saving.LastAccrual = old.LastAccrual
+		if saving.Rate != old.Rate {
+			saving.LastAccrual = saving.LastUpdate
+		}
+		saving.MaturityNotified = old.MaturityNotified
+		scheduleSavingInterest(&saving, saving.LastUpdate)
+
+		if delta := saving.Balance - old.Balance; math.Abs(delta) > balanceEpsilon {
+			txn := BalanceTransaction(old.Owner, id, "adjustment", delta, "Balance adjustment")
+			if _, err := insertTransaction(sc, txn); err != nil {
+				_ = sc.AbortTransaction(sc)
+				return err
+			}
+			adjusted = true
+		} else {
+			saving.Balance = old.Balance
+		}
+
+		unset := bson.M{}
+		if saving.NextAccrual.IsZero() {
+			unset["next_accrual"] = ""
+		}
+		if saving.MaturityDate.IsZero() {
+			unset["maturity_date"] = ""
+		}
+		update := bson.M{"$set": saving}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		if _, err := util.SavingCollection.UpdateOne(sc, filter, update); err != nil {
+			_ = sc.AbortTransaction(sc)
+			return err
+		}
+
+		return sc.CommitTransaction(sc)
+	})
 	if err != nil {
 		return err
 	}
@@ -85,6 +181,13 @@ func UpdateSaving(ctx context.Context, id primitive.ObjectID, saving model.Savin
 		"action":     "update",
 		"detail":     saving,
 	})
+	if adjusted {
+		socket.BroadcastFromContext(ctx, map[string]interface{}{
+			"collection": "transactions",
+			"action":     "create",
+			"detail":     "bulk",
+		})
+	}
 
 	return nil
 }
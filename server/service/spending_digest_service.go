@@ -0,0 +1,422 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"text/template"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CategoryTotal struct {
+	Category primitive.ObjectID `bson:"_id" json:"category"`
+	Name     string             `bson:"name" json:"name"`
+	Icon     string             `bson:"icon" json:"icon"`
+	Total    float64            `bson:"total" json:"total"`
+	Count    int                `bson:"count" json:"count"`
+}
+
+type BudgetStatus struct {
+	Category primitive.ObjectID `json:"category"`
+	Name     string             `json:"name"`
+	Budget   float64            `json:"budget"`
+	Spent    float64            `json:"spent"`
+	Percent  float64            `json:"percent"`
+	Over     bool               `json:"over"`
+}
+
+type SavingProgress struct {
+	Saving   primitive.ObjectID `json:"saving"`
+	Name     string             `json:"name"`
+	Balance  float64            `json:"balance"`
+	Goal     float64            `json:"goal"`
+	Percent  float64            `json:"percent"`
+	GoalDate time.Time          `json:"goalDate"`
+}
+
+type SpendingDigest struct {
+	Owner     string                `json:"owner"`
+	Frequency model.DigestFrequency `json:"frequency"`
+	From      time.Time             `json:"from"`
+	To        time.Time             `json:"to"`
+
+	Income  float64 `json:"income"`
+	Expense float64 `json:"expense"`
+	Net     float64 `json:"net"`
+
+	TopCategories         []CategoryTotal      `json:"topCategories"`
+	BiggestTransactions   []model.Transaction  `json:"biggestTransactions"`
+	Budgets               []BudgetStatus       `json:"budgets"`
+	UpcomingSubscriptions []model.Subscription `json:"upcomingSubscriptions"`
+	Savings               []SavingProgress     `json:"savings"`
+}
+
+const digestListSize = 5
+
+// BuildSpendingDigest summarizes the owner's money between from and to. Budget
+// status is month to date as of `to`, upcoming subscriptions look one period
+// ahead.
+func BuildSpendingDigest(ctx context.Context, owner string, frequency model.DigestFrequency, from, to time.Time) (SpendingDigest, error) {
+	digest := SpendingDigest{
+		Owner:     owner,
+		Frequency: frequency,
+		From:      from,
+		To:        to,
+	}
+
+	match := bson.M{
+		"creator":    owner,
+		"is_deleted": false,
+		"date_time":  bson.M{"$gte": from, "$lt": to},
+	}
+
+	// Totals by type
+	cursor, err := util.TransactionCollection.Aggregate(ctx, []bson.M{
+		{"$match": match},
+		{"$match": bson.M{"type": bson.M{"$in": []string{"income", "expense"}}}},
+		{"$group": bson.M{"_id": "$type", "total": bson.M{"$sum": "$amount"}}},
+	})
+	if err != nil {
+		return digest, fmt.Errorf("Failed to aggregate totals: %w", err)
+	}
+	var totals []struct {
+		Type  string  `bson:"_id"`
+		Total float64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return digest, err
+	}
+	for _, total := range totals {
+		if total.Type == "income" {
+			digest.Income = total.Total
+		} else {
+			digest.Expense = total.Total
+		}
+	}
+	digest.Net = digest.Income - digest.Expense
+
+	// Top expense categories
+	digest.TopCategories, err = expenseByCategory(ctx, match, digestListSize)
+	if err != nil {
+		return digest, fmt.Errorf("Failed to aggregate categories: %w", err)
+	}
+
+	// Biggest expenses
+	opts := options.Find().
+		SetSort(bson.D{{Key: "amount", Value: -1}}).
+		SetLimit(digestListSize)
+	cursor, err = util.TransactionCollection.Find(ctx, bson.M{
+		"creator":    owner,
+		"is_deleted": false,
+		"type":       "expense",
+		"date_time":  bson.M{"$gte": from, "$lt": to},
+	}, opts)
+	if err != nil {
+		return digest, fmt.Errorf("Failed to fetch biggest transactions: %w", err)
+	}
+	if err := cursor.All(ctx, &digest.BiggestTransactions); err != nil {
+		return digest, err
+	}
+
+	// Budget status, month to date
+	monthStart := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, to.Location())
+	spent, err := expenseByCategory(ctx, bson.M{
+		"creator":    owner,
+		"is_deleted": false,
+		"date_time":  bson.M{"$gte": monthStart, "$lt": to},
+	}, 0)
+	if err != nil {
+		return digest, fmt.Errorf("Failed to aggregate budgets: %w", err)
+	}
+	spentByCategory := map[primitive.ObjectID]float64{}
+	for _, s := range spent {
+		spentByCategory[s.Category] = s.Total
+	}
+
+	cursor, err = util.CategoryCollection.Find(ctx, bson.M{
+		"owner":      owner,
+		"is_deleted": false,
+		"type":       "expense",
+		"budget":     bson.M{"$gt": 0},
+	})
+	if err != nil {
+		return digest, fmt.Errorf("Failed to fetch categories: %w", err)
+	}
+	var categories []model.Category
+	if err := cursor.All(ctx, &categories); err != nil {
+		return digest, err
+	}
+	for _, category := range categories {
+		status := BudgetStatus{
+			Category: category.ID,
+			Name:     category.Name,
+			Budget:   category.Budget,
+			Spent:    spentByCategory[category.ID],
+		}
+		status.Percent = status.Spent / status.Budget * 100
+		status.Over = status.Spent > status.Budget
+		digest.Budgets = append(digest.Budgets, status)
+	}
+
+	// Upcoming subscription charges
+	cursor, err = util.SubscriptionCollection.Find(ctx, bson.M{
+		"creator":     owner,
+		"is_active":   true,
+		"is_deleted":  false,
+		"next_active": bson.M{"$gte": to, "$lt": to.Add(to.Sub(from))},
+	}, options.Find().SetSort(bson.D{{Key: "next_active", Value: 1}}))
+	if err != nil {
+		return digest, fmt.Errorf("Failed to fetch subscriptions: %w", err)
+	}
+	if err := cursor.All(ctx, &digest.UpcomingSubscriptions); err != nil {
+		return digest, err
+	}
+
+	// Savings progress
+	cursor, err = util.SavingCollection.Find(ctx, bson.M{
+		"owner":      owner,
+		"is_deleted": false,
+	})
+	if err != nil {
+		return digest, fmt.Errorf("Failed to fetch savings: %w", err)
+	}
+	var savings []model.Saving
+	if err := cursor.All(ctx, &savings); err != nil {
+		return digest, err
+	}
+	for _, saving := range savings {
+		progress := SavingProgress{
+			Saving:   saving.ID,
+			Name:     saving.Name,
+			Balance:  saving.Balance,
+			Goal:     saving.Goal,
+			GoalDate: saving.GoalDate,
+		}
+		if saving.Goal > 0 {
+			progress.Percent = saving.Balance / saving.Goal * 100
+		}
+		digest.Savings = append(digest.Savings, progress)
+	}
+
+	return digest, nil
+}
+
+// expenseByCategory sums expenses per category, biggest first. A limit of 0
+// returns every category.
+func expenseByCategory(ctx context.Context, match bson.M, limit int64) ([]CategoryTotal, error) {
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$match": bson.M{"type": "expense"}},
+	}
+	pipeline = append(pipeline, unwindSplits...)
+	pipeline = append(pipeline, []bson.M{
+		{"$group": bson.M{
+			"_id":   "$category",
+			"total": bson.M{"$sum": "$amount"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"total": -1}},
+	}...)
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	pipeline = append(pipeline,
+		bson.M{"$lookup": bson.M{
+			"from":         "categories",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "category",
+		}},
+		bson.M{"$set": bson.M{
+			"name": bson.M{"$first": "$category.name"},
+			"icon": bson.M{"$first": "$category.icon"},
+		}},
+	)
+
+	cursor, err := util.TransactionCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var totals []CategoryTotal
+	if err := cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// SpendingDigestPeriod returns the period a digest sent at `at` covers.
+func SpendingDigestPeriod(frequency model.DigestFrequency, at time.Time) (time.Time, time.Time) {
+	if frequency == model.FrequencyMonthly {
+		return at.AddDate(0, -1, 0), at
+	}
+	return at.AddDate(0, 0, -7), at
+}
+
+// NextSpendingDigestRun returns the first run strictly after `after`, in the
+// user's timezone.
+func NextSpendingDigestRun(settings model.SpendingDigestSettings, after time.Time, loc *time.Location) time.Time {
+	t := after.In(loc)
+	next := time.Date(t.Year(), t.Month(), t.Day(), settings.Hour, 0, 0, 0, loc)
+
+	switch settings.Frequency {
+	case model.FrequencyWeekly:
+		days := (settings.Day - int(next.Weekday()) + 7) % 7
+		next = next.AddDate(0, 0, days)
+		if !next.After(t) {
+			next = next.AddDate(0, 0, 7)
+		}
+	case model.FrequencyMonthly:
+		next = time.Date(t.Year(), t.Month(), settings.Day, settings.Hour, 0, 0, 0, loc)
+		if !next.After(t) {
+			next = next.AddDate(0, 1, 0)
+		}
+	default:
+		return time.Time{}
+	}
+
+	return next
+}
+
+func SendSpendingDigest(ctx context.Context, pref model.NotificationPreference, at time.Time) error {
+	loc := loadLocation(pref.Timezone)
+	from, to := SpendingDigestPeriod(pref.SpendingDigest.Frequency, at.In(loc))
+
+	digest, err := BuildSpendingDigest(ctx, pref.Owner, pref.SpendingDigest.Frequency, from, to)
+	if err != nil {
+		return err
+	}
+
+	markdown, err := RenderSpendingDigestMarkdown(digest)
+	if err != nil {
+		return err
+	}
+	html, err := RenderSpendingDigestHTML(digest)
+	if err != nil {
+		return err
+	}
+
+	notif := model.Notification{
+		Owner: pref.Owner,
+		Type:  model.TypeSpendingDigest,
+		Title: fmt.Sprintf("Your %s spending digest", digest.Frequency),
+		Message: fmt.Sprintf("Income %s, expense %s, net %s from %s to %s.",
+			formatMoney(digest.Income), formatMoney(digest.Expense), formatMoney(digest.Net),
+			digest.From.Format("02/01"), digest.To.Format("02/01")),
+		Markdown:    markdown,
+		HTML:        html,
+		ScheduledAt: at,
+	}
+
+	_, err = DeliverNotification(ctx, notif)
+	return err
+}
+
+// RunDueSpendingDigests sends every digest whose run time has come and moves
+// its next run forward.
+func RunDueSpendingDigests(ctx context.Context) error {
+	now := time.Now()
+
+	cursor, err := util.NotificationPreferenceCollection.Find(ctx, bson.M{
+		"spending_digest.frequency": bson.M{"$in": []model.DigestFrequency{model.FrequencyWeekly, model.FrequencyMonthly}},
+		"spending_digest.next_run":  bson.M{"$lte": now},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to fetch due digests: %w", err)
+	}
+	var prefs []model.NotificationPreference
+	if err := cursor.All(ctx, &prefs); err != nil {
+		return err
+	}
+
+	for _, pref := range prefs {
+		if err := SendSpendingDigest(userContext(ctx, pref.Owner), pref, now); err != nil {
+			log.Println("Failed to send spending digest:", err)
+		}
+
+		next := NextSpendingDigestRun(pref.SpendingDigest, now, loadLocation(pref.Timezone))
+		update := bson.M{"$set": bson.M{"spending_digest.next_run": next}}
+		if _, err := util.NotificationPreferenceCollection.UpdateByID(ctx, pref.ID, update); err != nil {
+			log.Println("Failed to schedule next spending digest:", err)
+		}
+	}
+
+	return nil
+}
+
+func formatMoney(amount float64) string {
+	return fmt.Sprintf("%.0f", amount)
+}
+
+var digestFuncs = map[string]interface{}{
+	"money": formatMoney,
+	"date":  func(t time.Time) string { return t.Format("02/01/2006") },
+	"pct":   func(p float64) string { return fmt.Sprintf("%.0f%%", p) },
+}
+
+var digestMarkdownTemplate = template.Must(template.New("digest").Funcs(digestFuncs).Parse(
+	`# Spending digest {{date .From}} - {{date .To}}
+
+**Income:** {{money .Income}}
+**Expense:** {{money .Expense}}
+**Net:** {{money .Net}}
+{{if .TopCategories}}
+## Top categories
+{{range .TopCategories}}- {{.Name}}: {{money .Total}} ({{.Count}} transactions)
+{{end}}{{end}}{{if .BiggestTransactions}}
+## Biggest transactions
+{{range .BiggestTransactions}}- {{date .DateTime}} {{money .Amount}} {{.Note}}
+{{end}}{{end}}{{if .Budgets}}
+## Budgets this month
+{{range .Budgets}}- {{.Name}}: {{money .Spent}} / {{money .Budget}} ({{pct .Percent}}){{if .Over}} **over budget**{{end}}
+{{end}}{{end}}{{if .UpcomingSubscriptions}}
+## Upcoming charges
+{{range .UpcomingSubscriptions}}- {{date .NextActive}} {{.Name}}: {{money .Amount}}
+{{end}}{{end}}{{if .Savings}}
+## Savings
+{{range .Savings}}- {{.Name}}: {{money .Balance}}{{if .Goal}} / {{money .Goal}} ({{pct .Percent}}){{end}}
+{{end}}{{end}}`))
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Funcs(digestFuncs).Parse(
+	`<h1>Spending digest {{date .From}} - {{date .To}}</h1>
+<p><b>Income:</b> {{money .Income}}<br><b>Expense:</b> {{money .Expense}}<br><b>Net:</b> {{money .Net}}</p>
+{{if .TopCategories}}<h2>Top categories</h2><ul>
+{{range .TopCategories}}<li>{{.Name}}: {{money .Total}} ({{.Count}} transactions)</li>
+{{end}}</ul>{{end}}
+{{if .BiggestTransactions}}<h2>Biggest transactions</h2><ul>
+{{range .BiggestTransactions}}<li>{{date .DateTime}} {{money .Amount}} {{.Note}}</li>
+{{end}}</ul>{{end}}
+{{if .Budgets}}<h2>Budgets this month</h2><ul>
+{{range .Budgets}}<li>{{.Name}}: {{money .Spent}} / {{money .Budget}} ({{pct .Percent}}){{if .Over}} <b>over budget</b>{{end}}</li>
+{{end}}</ul>{{end}}
+{{if .UpcomingSubscriptions}}<h2>Upcoming charges</h2><ul>
+{{range .UpcomingSubscriptions}}<li>{{date .NextActive}} {{.Name}}: {{money .Amount}}</li>
+{{end}}</ul>{{end}}
+{{if .Savings}}<h2>Savings</h2><ul>
+{{range .Savings}}<li>{{.Name}}: {{money .Balance}}{{if .Goal}} / {{money .Goal}} ({{pct .Percent}}){{end}}</li>
+{{end}}</ul>{{end}}`))
+
+func RenderSpendingDigestMarkdown(digest SpendingDigest) (string, error) {
+	var buf bytes.Buffer
+	if err := digestMarkdownTemplate.Execute(&buf, digest); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func RenderSpendingDigestHTML(digest SpendingDigest) (string, error) {
+	var buf bytes.Buffer
+	if err := digestHTMLTemplate.Execute(&buf, digest); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	statementMinimumRate = 0.05
+	// Days before the due date the reminder goes out.
+	statementReminderDays = 3
+)
+
+func FetchStatementsSince(ctx context.Context, username string, since time.Time) (*mongo.Cursor, error) {
+	filter := bson.M{
+		"last_update": bson.M{
+			"$gt": since,
+		},
+		"owner": username,
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "last_update", Value: -1},
+	})
+
+	return util.StatementCollection.Find(ctx, filter, opts)
+}
+
+// StatementPeriod returns the last billing cycle that closed before now. A
+// cycle closes at the end of the statement day.
+func StatementPeriod(statementDay int, now time.Time, loc *time.Location) (start, end time.Time) {
+	n := now.In(loc)
+	end = time.Date(n.Year(), n.Month(), statementDay, 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	if end.After(now) {
+		end = end.AddDate(0, -1, 0)
+	}
+	return end.AddDate(0, -1, 0), end
+}
+
+// StatementDueDate is the first due day after the statement closed.
+func StatementDueDate(periodEnd time.Time, dueDay int, loc *time.Location) time.Time {
+	e := periodEnd.In(loc)
+	due := time.Date(e.Year(), e.Month(), dueDay, 0, 0, 0, 0, loc)
+	if due.Before(e) {
+		due = due.AddDate(0, 1, 0)
+	}
+	return due
+}
+
+// BuildStatement computes a statement for the cycle [start, end) from the
+// account's current balance and its transactions since start.
+func BuildStatement(ctx context.Context, account model.Account, start, end, due time.Time) (model.Statement, error) {
+	statement := model.Statement{
+		Owner:       account.Owner,
+		Account:     account.ID,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		DueDate:     due,
+		Status:      model.StatementDue,
+	}
+
+	cursor, err := util.TransactionCollection.Find(ctx, bson.M{
+		"is_deleted": false,
+		"date_time":  bson.M{"$gte": start},
+		"$or": []bson.M{
+			{"source_account": account.ID},
+			{"destination_account": account.ID},
+		},
+	})
+	if err != nil {
+		return statement, fmt.Errorf("Failed to fetch transactions: %w", err)
+	}
+	var transactions []model.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return statement, err
+	}
+
+	balance := account.Balance
+	for _, tx := range transactions {
+		effect := transactionEffect(tx, account.ID)
+		if !tx.DateTime.Before(end) {
+			balance -= effect
+			continue
+		}
+		if effect < 0 {
+			statement.Charges -= effect
+		} else {
+			statement.Payments += effect
+		}
+	}
+
+	statement.Balance = math.Max(0, -balance)
+	statement.MinimumPayment = math.Min(statement.Balance, math.Ceil(statement.Balance*statementMinimumRate*100)/100)
+	if statement.Balance <= balanceEpsilon {
+		statement.Status = model.StatementPaid
+		statement.PaidAt = end
+	}
+
+	return statement, nil
+}
+
+// GenerateStatement closes the last finished cycle of a credit card, once. It
+// schedules a due-date reminder unless nothing is owed.
+func GenerateStatement(ctx context.Context, account model.Account, now time.Time) error {
+	pref, err := GetNotificationPreference(ctx, account.Owner)
+	if err != nil {
+		return err
+	}
+	loc := loadLocation(pref.Timezone)
+
+	start, end := StatementPeriod(account.StatementDay, now, loc)
+	count, err := util.StatementCollection.CountDocuments(ctx, bson.M{"account": account.ID, "period_end": end})
+	if err != nil || count > 0 {
+		return err
+	}
+
+	statement, err := BuildStatement(ctx, account, start, end, StatementDueDate(end, account.DueDay, loc))
+	if err != nil {
+		return err
+	}
+	statement.ID = primitive.NewObjectID()
+	statement.LastUpdate = now
+
+	// The statement goes in first: a failed insert must not leave a
+	// reminder behind for the next run to send again
+	if _, err := util.StatementCollection.InsertOne(ctx, statement); err != nil {
+		return err
+	}
+
+	if statement.Status != model.StatementPaid {
+		if err := scheduleStatementReminder(ctx, account, &statement, loc, now); err != nil {
+			return err
+		}
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "statements",
+		"action":     "create",
+		"detail":     statement,
+	})
+
+	// Payments may already have been made between closing and now.
+	return RefreshStatementPayments(ctx, account.ID, now)
+}
+
+// scheduleStatementReminder queues the due-date reminder of a statement, a
+// few days ahead of the due date or right away when that is already past.
+// Only a failure to remember the reminder on the statement is returned.
+func scheduleStatementReminder(ctx context.Context, account model.Account, statement *model.Statement, loc *time.Location, now time.Time) error {
+	remindAt := statement.DueDate.AddDate(0, 0, -statementReminderDays).Add(9 * time.Hour)
+	if remindAt.Before(now) {
+		remindAt = now
+	}
+
+	notifID, err := DeliverNotification(ctx, model.Notification{
+		Owner:       account.Owner,
+		Type:        model.TypeStatementDue,
+		ReferenceId: statement.ID,
+		Title:       "Card payment due",
+		Message: fmt.Sprintf("Your %s statement of %s is due on %s, minimum payment %s.",
+			account.Name, formatMoney(statement.Balance),
+			statement.DueDate.In(loc).Format("Jan 2"), formatMoney(statement.MinimumPayment)),
+		ScheduledAt: remindAt,
+	})
+	if err != nil {
+		log.Printf("Failed to schedule due reminder for statement %s: %v", statement.ID.Hex(), err)
+		return nil
+	}
+	if id, ok := notifID.(primitive.ObjectID); ok {
+		statement.Notification = id
+		_, err := util.StatementCollection.UpdateByID(ctx, statement.ID, bson.M{"$set": bson.M{"notification": id}})
+		return err
+	}
+	return nil
+}
+
+// GenerateDueStatements closes the finished cycle of every credit card.
+func GenerateDueStatements(ctx context.Context) error {
+	cursor, err := util.AccountCollection.Find(ctx, bson.M{
+		"type":          model.AccountCreditCard,
+		"is_deleted":    false,
+		"statement_day": bson.M{"$gt": 0},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to fetch credit cards: %w", err)
+	}
+	var accounts []model.Account
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, account := range accounts {
+		if err := GenerateStatement(userContext(ctx, account.Owner), account, now); err != nil {
+			log.Printf("Failed to generate statement for %s: %v", account.ID.Hex(), err)
+		}
+	}
+
+	return nil
+}
+
+// RefreshStatementPayments recounts the transfers into a card that pay the
+// statement whose payment window contains at. A statement's window runs from
+// its closing until the next cycle closes. Paid statements get their pending
+// reminder cancelled, and a new one when they are owed again before the due
+// date.
+func RefreshStatementPayments(ctx context.Context, account primitive.ObjectID, at time.Time) error {
+	cursor, err := util.StatementCollection.Find(ctx, bson.M{
+		"account":    account,
+		"period_end": bson.M{"$lte": at, "$gt": at.AddDate(0, -1, 0)},
+	})
+	if err != nil {
+		return err
+	}
+	var statements []model.Statement
+	if err := cursor.All(ctx, &statements); err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		if statement.Balance <= balanceEpsilon {
+			continue
+		}
+
+		cursor, err := util.TransactionCollection.Aggregate(ctx, []bson.M{
+			{"$match": bson.M{
+				"destination_account": account,
+				"type":                "transfer",
+				"is_deleted":          false,
+				"date_time": bson.M{
+					"$gte": statement.PeriodEnd,
+					"$lt":  statement.PeriodEnd.AddDate(0, 1, 0),
+				},
+			}},
+			{"$group": bson.M{"_id": nil, "paid": bson.M{"$sum": "$amount"}}},
+		})
+		if err != nil {
+			return err
+		}
+		var rows []struct {
+			Paid float64 `bson:"paid"`
+		}
+		if err := cursor.All(ctx, &rows); err != nil {
+			return err
+		}
+
+		paid := 0.0
+		if len(rows) > 0 {
+			paid = rows[0].Paid
+		}
+
+		status := model.StatementDue
+		switch {
+		case paid >= statement.Balance-balanceEpsilon:
+			status = model.StatementPaid
+		case paid > 0:
+			status = model.StatementPartial
+		}
+		if status == statement.Status && math.Abs(paid-statement.PaidAmount) <= balanceEpsilon {
+			continue
+		}
+
+		set := bson.M{
+			"paid_amount": paid,
+			"status":      status,
+			"last_update": time.Now(),
+		}
+		update := bson.M{"$set": set, "$unset": bson.M{"paid_at": ""}}
+		if status == model.StatementPaid {
+			set["paid_at"] = time.Now()
+			delete(update, "$unset")
+		}
+		if _, err := util.StatementCollection.UpdateByID(ctx, statement.ID, update); err != nil {
+			return err
+		}
+
+		if status == model.StatementPaid && !statement.Notification.IsZero() {
+			// Fails harmlessly when the reminder already went out.
+			_ = CancelNotification(ctx, statement.Notification)
+		}
+		if statement.Status == model.StatementPaid && status != model.StatementPaid && statement.DueDate.After(time.Now()) {
+			// A refunded or deleted payment leaves the statement owed again
+			if err := rescheduleStatementReminder(ctx, &statement); err != nil {
+				return err
+			}
+		}
+
+		statement.PaidAmount = paid
+		statement.Status = status
+		socket.BroadcastFromContext(ctx, map[string]interface{}{
+			"collection": "statements",
+			"action":     "update",
+			"detail":     statement,
+		})
+	}
+
+	return nil
+}
+
+// rescheduleStatementReminder brings the reminder back for a statement that
+// is owed again.
+func rescheduleStatementReminder(ctx context.Context, statement *model.Statement) error {
+	var account model.Account
+	if err := util.AccountCollection.FindOne(ctx, bson.M{"_id": statement.Account}).Decode(&account); err != nil {
+		return err
+	}
+	pref, err := GetNotificationPreference(ctx, account.Owner)
+	if err != nil {
+		return err
+	}
+
+	return scheduleStatementReminder(ctx, account, statement, loadLocation(pref.Timezone), time.Now())
+}
+
+// refreshStatementsFor is called after a transaction changed, only transfers
+// into an account can pay a statement.
+func refreshStatementsFor(ctx context.Context, transactions ...model.Transaction) {
+	for _, tx := range transactions {
+		if tx.Type != "transfer" || tx.DestinationAccount.IsZero() {
+			continue
+		}
+		if err := RefreshStatementPayments(ctx, tx.DestinationAccount, tx.DateTime); err != nil {
+			log.Println("Failed to refresh statement payments:", err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/socket"
+	"fintrack/server/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrTagExists = errors.New("a tag with this name already exists")
+
+func GetTagByID(id string) (model.Tag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Tag{}, err
+	}
+
+	var tag model.Tag
+
+	err = util.TagCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&tag)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return model.Tag{}, errors.New("tag not found")
+		}
+		return model.Tag{}, err
+	}
+
+	return tag, nil
+}
+
+func FetchTagsSince(ctx context.Context, username string, since time.Time) (*mongo.Cursor, error) {
+	filter := bson.M{
+		"last_update": bson.M{
+			"$gt": since,
+		},
+		"owner": username,
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "last_update", Value: -1},
+	})
+
+	return util.TagCollection.Find(ctx, filter, opts)
+}
+
+func AddTag(ctx context.Context, tag model.Tag) (interface{}, error) {
+	tag.LastUpdate = time.Now()
+
+	result, err := util.TagCollection.InsertOne(ctx, tag)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrTagExists
+		}
+		return nil, err
+	}
+	tag.ID = result.InsertedID.(primitive.ObjectID)
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "tags",
+		"action":     "create",
+		"detail":     tag,
+	})
+
+	return result.InsertedID, nil
+}
+
+// UpdateTag renames or recolors a tag. Transactions keep the tag id, clients
+// pick the new name up from the tag itself.
+func UpdateTag(ctx context.Context, id primitive.ObjectID, tag model.Tag) error {
+	tag.LastUpdate = time.Now()
+
+	_, err := util.TagCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"name":        tag.Name,
+		"color":       tag.Color,
+		"last_update": tag.LastUpdate,
+	}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrTagExists
+		}
+		return err
+	}
+
+	tag.ID = id
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "tags",
+		"action":     "update",
+		"detail":     tag,
+	})
+
+	return nil
+}
+
+// MergeTag moves every transaction and rule tagged with `from` over to
+// `into` and deletes `from`.
+func MergeTag(ctx context.Context, from, into primitive.ObjectID) error {
+	if from == into {
+		return errors.New("cannot merge a tag into itself")
+	}
+
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	now := time.Now()
+	rulesChanged := false
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		filter := bson.M{"tags": from}
+		if _, err := util.TransactionCollection.UpdateMany(sc, filter, bson.M{
+			"$addToSet": bson.M{"tags": into},
+			"$set":      bson.M{"last_update": now},
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := util.TransactionCollection.UpdateMany(sc, filter, bson.M{
+			"$pull": bson.M{"tags": from},
+		}); err != nil {
+			return nil, err
+		}
+
+		var err error
+		rulesChanged, err = retargetRules(sc, bson.M{"actions.tags": from}, func(rule *model.Rule) bool {
+			return RetargetRuleTag(rule, from, into)
+		}, now)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = util.TagCollection.UpdateByID(sc, from, bson.M{"$set": bson.M{
+			"is_deleted":  true,
+			"last_update": now,
+		}})
+		return nil, err
+	})
+	if err != nil {
+		return err
+	}
+	if rulesChanged {
+		broadcastRulesChanged(ctx)
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "tags",
+		"action":     "delete",
+		"detail":     from,
+	})
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "update",
+		"detail":     "bulk",
+	})
+
+	return nil
+}
+
+// DeleteTag removes the tag from every transaction and rule, the
+// transactions and rules stay.
+func DeleteTag(ctx context.Context, id primitive.ObjectID) error {
+	session, err := util.MongoClient.StartSession()
+	if err != nil {
+		return fmt.Errorf("Failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	now := time.Now()
+	rulesChanged := false
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := util.TagCollection.UpdateOne(sc, bson.M{"_id": id}, bson.M{"$set": bson.M{
+			"is_deleted":  true,
+			"last_update": now,
+		}}); err != nil {
+			return nil, fmt.Errorf("Error deleting tag: %w", err)
+		}
+
+		if _, err := util.TransactionCollection.UpdateMany(sc, bson.M{"tags": id}, bson.M{
+			"$pull": bson.M{"tags": id},
+			"$set":  bson.M{"last_update": now},
+		}); err != nil {
+			return nil, fmt.Errorf("Error untagging transactions: %w", err)
+		}
+
+		var err error
+		rulesChanged, err = retargetRules(sc, bson.M{"actions.tags": id}, func(rule *model.Rule) bool {
+			return RetargetRuleTag(rule, id, primitive.NilObjectID)
+		}, now)
+		return nil, err
+	})
+	if err != nil {
+		return err
+	}
+	if rulesChanged {
+		broadcastRulesChanged(ctx)
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "tags",
+		"action":     "delete",
+		"detail":     id,
+	})
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "update",
+		"detail":     "bulk",
+	})
+
+	return nil
+}
+
+// TagTransactions adds (or with untag, removes) tags on many of the owner's
+// transactions at once. It returns how many transactions changed.
+func TagTransactions(ctx context.Context, owner string, transactions, tags []primitive.ObjectID, untag bool) (int64, error) {
+	filter := bson.M{
+		"_id":        bson.M{"$in": transactions},
+		"creator":    owner,
+		"is_deleted": false,
+	}
+
+	update := bson.M{
+		"$addToSet": bson.M{"tags": bson.M{"$each": tags}},
+		"$set":      bson.M{"last_update": time.Now()},
+	}
+	if untag {
+		update = bson.M{
+			"$pull": bson.M{"tags": bson.M{"$in": tags}},
+			"$set":  bson.M{"last_update": time.Now()},
+		}
+	}
+
+	res, err := util.TransactionCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	socket.BroadcastFromContext(ctx, map[string]interface{}{
+		"collection": "transactions",
+		"action":     "update",
+		"detail":     "bulk",
+	})
+
+	return res.ModifiedCount, nil
+}
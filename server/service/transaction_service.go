@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"fintrack/server/model"
@@ -38,13 +39,18 @@ func GetTransactionByID(id string) (model.Transaction, error) {
 	return transaction, nil
 }
 
-func FetchTransactionsSince(ctx context.Context, username string, since time.Time) (*mongo.Cursor, error) {
+// FetchTransactionsSince lists changed transactions, only the ones carrying
+// every tag in tags when given.
+func FetchTransactionsSince(ctx context.Context, username string, since time.Time, tags []primitive.ObjectID) (*mongo.Cursor, error) {
 	filter := bson.M{
 		"last_update": bson.M{
 			"$gt": since,
 		},
 		"creator": username,
 	}
+	if len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
 
 	opts := options.Find().SetSort(bson.D{
 		{Key: "last_update", Value: -1},
@@ -53,6 +59,68 @@ func FetchTransactionsSince(ctx context.Context, username string, since time.Tim
 	return util.TransactionCollection.Find(ctx, filter, opts)
 }
 
+// insertTransaction stores a transaction and applies its balance effect. It
+// must run inside a database transaction.
+func insertTransaction(sc mongo.SessionContext, transaction model.Transaction) (interface{}, error) {
+	res, err := util.TransactionCollection.InsertOne(sc, transaction)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to insert transaction: %w", err)
+	}
+
+	if _, err := util.AdjustBalance(sc, transaction.SourceAccount, -transaction.Amount); err != nil {
+		return nil, fmt.Errorf("Failed to adjust source account balance: %w", err)
+	}
+
+	if _, err := util.AdjustBalance(sc, transaction.DestinationAccount, transaction.Amount); err != nil {
+		return nil, fmt.Errorf("Failed to adjust destination account balance: %w", err)
+	}
+
+	return res.InsertedID, nil
+}
+
+// BalanceTransaction explains a balance change of an account or saving in the
+// ledger: an opening balance or a manual adjustment.
+func BalanceTransaction(owner string, id primitive.ObjectID, txType string, delta float64, note string) model.Transaction {
+	transaction := model.Transaction{
+		Creator:    owner,
+		Amount:     math.Abs(delta),
+		DateTime:   time.Now(),
+		Type:       txType,
+		Note:       note,
+		LastUpdate: time.Now(),
+	}
+	if delta >= 0 {
+		transaction.DestinationAccount = id
+	} else {
+		transaction.SourceAccount = id
+	}
+	return transaction
+}
+
+// CheckSplits validates the split lines of a transaction: only incomes and
+// expenses split, every line is positive and together they make up amount.
+// Category ownership is checked by the caller.
+func CheckSplits(txType string, amount float64, splits []model.Split) error {
+	if len(splits) == 0 {
+		return nil
+	}
+	if txType == "transfer" {
+		return errors.New("Transfers cannot be split")
+	}
+
+	total := 0.0
+	for i, line := range splits {
+		if line.Amount <= 0 {
+			return fmt.Errorf("Split %d: amount should be positive", i+1)
+		}
+		total += line.Amount
+	}
+	if math.Abs(total-amount) > balanceEpsilon {
+		return fmt.Errorf("Splits add up to %.2f, but the amount is %.2f", total, amount)
+	}
+	return nil
+}
+
 func addTransactionInternal(ctx context.Context, transaction model.Transaction) (interface{}, error) {
 	session, err := util.MongoClient.StartSession()
 	if err != nil {
@@ -63,27 +131,15 @@ func addTransactionInternal(ctx context.Context, transaction model.Transaction)
 	transaction.LastUpdate = time.Now()
 
 	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
-		res, err := util.TransactionCollection.InsertOne(sc, transaction)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to insert transaction: %w", err)
-		}
-
-		if transaction.SourceAccount != primitive.NilObjectID {
-			if _, err := util.AdjustBalance(sc, transaction.SourceAccount, -transaction.Amount); err != nil {
-				return nil, fmt.Errorf("Failed to adjust source account balance: %w", err)
-			}
-		}
-
-		if transaction.DestinationAccount != primitive.NilObjectID {
-			if _, err := util.AdjustBalance(sc, transaction.DestinationAccount, transaction.Amount); err != nil {
-				return nil, fmt.Errorf("Failed to adjust destination account balance: %w", err)
-			}
-		}
-
-		return res.InsertedID, nil
+		return insertTransaction(sc, transaction)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshStatementsFor(ctx, transaction)
 
-	return result, err
+	return result, nil
 }
 
 func AddTransactionSilent(ctx context.Context, transaction model.Transaction) (interface{}, error) {
@@ -106,14 +162,14 @@ func AddTransaction(ctx context.Context, transaction model.Transaction) (interfa
 }
 
 
-func UpdateTransaction(ctx context.Context, id primitive.ObjectID, newTx model.Transaction) error {
+func updateTransactionInternal(ctx context.Context, id primitive.ObjectID, newTx model.Transaction) error {
 	newTx.LastUpdate = time.Now()
+	var oldTx model.Transaction
 	err := util.MongoClient.UseSession(ctx, func(sc mongo.SessionContext) error {
 		if err := sc.StartTransaction(); err != nil {
 			return err
 		}
 
-		var oldTx model.Transaction
 		err := util.TransactionCollection.FindOne(sc, bson.M{"_id": id}).Decode(&oldTx)
 		if err != nil {
 			_ = sc.AbortTransaction(sc)
@@ -144,11 +200,27 @@ func UpdateTransaction(ctx context.Context, id primitive.ObjectID, newTx model.T
 			return err
 		}
 
-		// Update transaction record
+		// Update transaction record, a split replaces the category and the
+		// other way around
+		update := bson.M{"$set": newTx}
+		unset := bson.M{}
+		if len(newTx.Splits) == 0 {
+			unset["splits"] = ""
+		}
+		if newTx.Category.IsZero() {
+			unset["category"] = ""
+		}
+		if len(newTx.Tags) == 0 {
+			unset["tags"] = ""
+		}
+		if newTx.Payee.IsZero() {
+			unset["payee"] = ""
+		}
+		update["$unset"] = unset
 		_, err = util.TransactionCollection.UpdateOne(
 			sc,
 			bson.M{"_id": id},
-			bson.M{"$set": newTx},
+			update,
 		)
 		if err != nil {
 			_ = sc.AbortTransaction(sc)
@@ -162,6 +234,17 @@ func UpdateTransaction(ctx context.Context, id primitive.ObjectID, newTx model.T
 		return err
 	}
 
+	refreshStatementsFor(ctx, oldTx, newTx)
+
+	return nil
+}
+
+func UpdateTransaction(ctx context.Context, id primitive.ObjectID, newTx model.Transaction) error {
+	if err := updateTransactionInternal(ctx, id, newTx); err != nil {
+		return err
+	}
+
+	newTx.LastUpdate = time.Now()
 	socket.BroadcastFromContext(ctx, map[string]interface{}{
 		"collection": "transactions",
 		"action":     "update",
@@ -172,12 +255,12 @@ func UpdateTransaction(ctx context.Context, id primitive.ObjectID, newTx model.T
 }
 
 func DeleteTransaction(ctx context.Context, id primitive.ObjectID) error {
+	var tx model.Transaction
 	err := util.MongoClient.UseSession(ctx, func(sc mongo.SessionContext) error {
 		if err := sc.StartTransaction(); err != nil {
 			return err
 		}
 
-		var tx model.Transaction
 		err := util.TransactionCollection.FindOne(sc, bson.M{"_id": id}).Decode(&tx)
 		if err != nil {
 			_ = sc.AbortTransaction(sc)
@@ -216,6 +299,8 @@ func DeleteTransaction(ctx context.Context, id primitive.ObjectID) error {
 		return err
 	}
 
+	refreshStatementsFor(ctx, tx)
+
 	socket.BroadcastFromContext(ctx, map[string]interface{}{
 		"collection": "transactions",
 		"action":     "delete",
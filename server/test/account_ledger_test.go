@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"fintrack/server/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBalanceTransaction(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	opening := service.BalanceTransaction("testaccount1", id, "opening_balance", 500, "Opening balance")
+	if opening.Type != "opening_balance" || opening.Amount != 500 || opening.Creator != "testaccount1" {
+		t.Errorf("unexpected opening balance %+v", opening)
+	}
+	if opening.DestinationAccount != id || !opening.SourceAccount.IsZero() {
+		t.Errorf("an opening balance should go into the account: %+v", opening)
+	}
+
+	adjustment := service.BalanceTransaction("testaccount1", id, "adjustment", -120.5, "Balance adjustment")
+	if adjustment.Amount != 120.5 {
+		t.Errorf("expected a positive amount of 120.50, got %.2f", adjustment.Amount)
+	}
+	if adjustment.SourceAccount != id || !adjustment.DestinationAccount.IsZero() {
+		t.Errorf("a downward adjustment should come out of the account: %+v", adjustment)
+	}
+
+}
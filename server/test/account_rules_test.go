@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+)
+
+func TestCheckSpendingRule(t *testing.T) {
+	cases := []struct {
+		name    string
+		account model.Account
+		amount  float64
+		ok      bool
+	}{
+		{"no rules", model.Account{Name: "Wallet", Balance: 50}, 80, true},
+		{"no overdraft, covered", model.Account{Name: "Checking", Balance: 100, NoOverdraft: true}, 100, true},
+		{"no overdraft, overdrawn", model.Account{Name: "Checking", Balance: 100, NoOverdraft: true}, 100.01, false},
+		{"within the credit limit", model.Account{Name: "Card", Type: model.AccountCreditCard, Balance: -300,
+			CreditLimit: 1000, EnforceCreditLimit: true}, 700, true},
+		{"over the credit limit", model.Account{Name: "Card", Type: model.AccountCreditCard, Balance: -300,
+			CreditLimit: 1000, EnforceCreditLimit: true}, 750, false},
+		{"credit limit not enforced", model.Account{Name: "Card", Type: model.AccountCreditCard, Balance: -300,
+			CreditLimit: 1000}, 5000, true},
+		{"no overdraft ignored on a liability", model.Account{Name: "Loan", Type: model.AccountLoan, Balance: -100,
+			NoOverdraft: true}, 50, true},
+	}
+
+	for _, tc := range cases {
+		err := service.CheckSpendingRule(tc.account, tc.amount, "")
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: expected ok %v, got %v", tc.name, tc.ok, err)
+		}
+	}
+}
+
+func TestAccountType(t *testing.T) {
+	if (model.Account{}).AccountType() != model.AccountCash {
+		t.Error("accounts without a type should count as cash")
+	}
+	for _, accountType := range model.AccountTypes {
+		liability := accountType == model.AccountCreditCard || accountType == model.AccountLoan
+		if accountType.IsLiability() != liability {
+			t.Errorf("%s: expected liability %v", accountType, liability)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"fintrack/server/blob"
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewLocalStore(t.TempDir())
+
+	if err := store.Put(ctx, "alice/tx/receipt", bytes.NewReader([]byte("receipt"))); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	r, err := store.Get(ctx, "alice/tx/receipt")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "receipt" {
+		t.Errorf("got %q, want %q", data, "receipt")
+	}
+
+	if err := store.Delete(ctx, "alice/tx/receipt"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "alice/tx/receipt"); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("get after delete: got %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "alice/tx/receipt"); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+
+	for _, key := range []string{"", "../escape", "alice/../../escape", "/etc/passwd"} {
+		if err := store.Put(ctx, key, bytes.NewReader(nil)); err == nil {
+			t.Errorf("put %q: want an error", key)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 800, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 800; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	thumb, ok := blob.Thumbnail(buf.Bytes())
+	if !ok {
+		t.Fatal("no thumbnail for a PNG")
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if size := decoded.Bounds().Size(); size != image.Pt(256, 128) {
+		t.Errorf("thumbnail is %v, want 256x128", size)
+	}
+
+	if _, ok := blob.Thumbnail([]byte("%PDF-1.4 not an image")); ok {
+		t.Error("thumbnail made from a PDF")
+	}
+}
+
+func TestAttachmentsFollowTransactions(t *testing.T) {
+	photo := model.Attachment{ID: primitive.NewObjectID(), FileName: "bill.jpg", Key: "old/a/photo"}
+	invoice := model.Attachment{ID: primitive.NewObjectID(), FileName: "invoice.pdf", Key: "old/b/invoice"}
+
+	keep := model.Transaction{ID: primitive.NewObjectID(), Attachments: []model.Attachment{photo}}
+	remove := model.Transaction{ID: primitive.NewObjectID(), Attachments: []model.Attachment{invoice}}
+	merged := service.MergedTransaction(keep, remove)
+	if len(merged.Attachments) != 2 || merged.Attachments[0].ID != photo.ID || merged.Attachments[1].ID != invoice.ID {
+		t.Errorf("merged attachments = %+v, want both", merged.Attachments)
+	}
+	if len(keep.Attachments) != 1 {
+		t.Error("merging changed keep")
+	}
+
+	// Exports carry no files, a restored transaction must not point at them
+	ds := restoreDataset()
+	ds.Transactions[0].Attachments = []model.Attachment{photo}
+	plan, err := service.RemapDataset(ds, "new", model.RestoreMerge, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range plan.Dataset.Transactions {
+		if len(tx.Attachments) != 0 {
+			t.Errorf("restored attachments = %+v, want none", tx.Attachments)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReplayBalanceHistory(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2024, 3, d, h, 0, 0, 0, time.UTC) }
+
+	checking := service.BalanceHolder{ID: primitive.NewObjectID(), Name: "Checking", Balance: 1000}
+	card := service.BalanceHolder{ID: primitive.NewObjectID(), Name: "Card", Balance: -300, Liability: true}
+
+	// Newest first, as they come from the database
+	transactions := []model.Transaction{
+		{Type: "expense", Amount: 50, DateTime: day(6, 12), SourceAccount: card.ID},
+		{Type: "expense", Amount: 200, DateTime: day(3, 12), SourceAccount: checking.ID},
+		{Type: "transfer", Amount: 100, DateTime: day(2, 12), SourceAccount: checking.ID, DestinationAccount: card.ID},
+		{Type: "income", Amount: 500, DateTime: day(1, 12), DestinationAccount: checking.ID},
+	}
+	// The card replays from a snapshot after the range, the checking
+	// account from its current balance
+	anchors := map[primitive.ObjectID]model.BalanceSnapshot{
+		card.ID: {Account: card.ID, Balance: -250, TakenAt: day(5, 0)},
+	}
+	inRange := map[primitive.ObjectID][]model.BalanceSnapshot{
+		checking.ID: {{Account: checking.ID, Balance: 1250, TakenAt: day(2, 18)}},
+	}
+
+	points := []service.BalancePoint{}
+	for d := 1; d <= 3; d++ {
+		points = append(points, service.BalancePoint{Date: day(d, 0), At: day(d+1, 0), Balances: map[string]float64{}})
+	}
+
+	inconsistencies := service.ReplayBalanceHistory(points, []service.BalanceHolder{checking, card}, transactions, anchors, inRange)
+
+	expected := []struct {
+		checking, card, assets, liabilities, netWorth float64
+	}{
+		{1300, -350, 1300, 350, 950},
+		{1200, -250, 1200, 250, 950},
+		{1000, -250, 1000, 250, 750},
+	}
+	for i, want := range expected {
+		p := points[i]
+		if p.Balances[checking.ID.Hex()] != want.checking || p.Balances[card.ID.Hex()] != want.card {
+			t.Errorf("%s: expected balances %.2f and %.2f, got %v", p.Date.Format("Jan 2"), want.checking, want.card, p.Balances)
+		}
+		if math.Abs(p.Assets-want.assets) > 0.001 || math.Abs(p.Liabilities-want.liabilities) > 0.001 ||
+			math.Abs(p.NetWorth-want.netWorth) > 0.001 {
+			t.Errorf("%s: expected assets %.2f, liabilities %.2f, net worth %.2f, got %.2f, %.2f, %.2f",
+				p.Date.Format("Jan 2"), want.assets, want.liabilities, want.netWorth, p.Assets, p.Liabilities, p.NetWorth)
+		}
+	}
+
+	if len(inconsistencies) != 1 {
+		t.Fatalf("expected 1 inconsistency, got %+v", inconsistencies)
+	}
+	if got := inconsistencies[0]; got.Account != checking.ID || got.Expected != 1200 || got.Difference != 50 {
+		t.Errorf("unexpected inconsistency %+v", got)
+	}
+}
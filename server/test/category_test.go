@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 	"io"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -207,3 +208,67 @@ func TestCategoryFlow(t *testing.T) {
 	}
 	t.Log("Category deletion verified")
 }
+
+// Deleting a category clears it from split lines without deleting the
+// transaction they belong to
+func TestCategorySplitCascade(t *testing.T) {
+	token, err := login()
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	kept, err := createCategory(token, Category{Owner: "testaccount1", Type: "expense", Icon: "basket", Name: "Groceries"})
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	removed, err := createCategory(token, Category{Owner: "testaccount1", Type: "expense", Icon: "gift", Name: "Gifts"})
+	if err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	note := fmt.Sprintf("Split receipt %d", time.Now().UnixNano())
+	_, err = createTransaction(token, Transaction{
+		Creator:       "testaccount1",
+		Amount:        100.0,
+		DateTime:      time.Now().Format(time.RFC3339),
+		Type:          "expense",
+		SourceAccount: "6758476703a5bb195bfc2dd3",
+		Splits: []Split{
+			{Category: kept.Hex(), Amount: 70.0},
+			{Category: removed.Hex(), Amount: 30.0},
+		},
+		Note: note,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create split transaction: %v", err)
+	}
+
+	if err := deleteCategory(token, removed); err != nil {
+		t.Fatalf("Failed to delete category: %v", err)
+	}
+
+	transactions, err := getTransactionsByYear(token, time.Now().Format("2006"))
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	found := false
+	for _, tr := range transactions {
+		if tr.Note != note {
+			continue
+		}
+		found = true
+		if len(tr.Splits) != 2 || tr.Splits[0].Category != kept.Hex() {
+			t.Fatalf("Other split lines changed: %+v", tr.Splits)
+		}
+		if tr.Splits[1].Category == removed.Hex() {
+			t.Fatalf("Split still points at the deleted category: %+v", tr.Splits)
+		}
+	}
+	if !found {
+		t.Fatalf("Split transaction was deleted with the category")
+	}
+
+	if err := deleteCategory(token, kept); err != nil {
+		t.Fatalf("Failed to delete category: %v", err)
+	}
+}
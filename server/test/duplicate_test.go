@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDetectDuplicates(t *testing.T) {
+	card := primitive.NewObjectID()
+	wallet := primitive.NewObjectID()
+	day := time.Date(2024, 5, 3, 9, 0, 0, 0, time.UTC)
+
+	expense := func(amount float64, at time.Time, note string) model.Transaction {
+		return model.Transaction{
+			ID:            primitive.NewObjectID(),
+			Type:          "expense",
+			Amount:        amount,
+			DateTime:      at,
+			SourceAccount: card,
+			Note:          note,
+		}
+	}
+
+	typed := expense(45000, day, "highlands")
+	imported := expense(45000, day.Add(26*time.Hour), "CARD 1234 HIGHLANDS COFFEE Q1")
+	imported.ExternalID = "FT001"
+	otherWallet := expense(45000, day, "highlands")
+	otherWallet.SourceAccount = wallet
+	tooLate := expense(45000, day.AddDate(0, 0, 5), "highlands")
+	otherShop := expense(45200, day.Add(time.Hour), "phuc long")
+	// Two coffees on one statement are two coffees
+	first := expense(30000, day.AddDate(0, 0, 10), "CARD 1234 PHUC LONG")
+	first.ExternalID = "FT010"
+	second := expense(30000, day.AddDate(0, 0, 10), "CARD 1234 PHUC LONG")
+	second.ExternalID = "FT011"
+
+	transactions := []model.Transaction{typed, otherWallet, otherShop, imported, tooLate, first, second}
+	pairs := service.DetectDuplicates(transactions, service.DefaultDuplicateCriteria)
+	if len(pairs) != 1 {
+		t.Fatalf("got %d pairs, want 1: %+v", len(pairs), pairs)
+	}
+	if pairs[0].Keep.ID != imported.ID || pairs[0].Remove.ID != typed.ID || pairs[0].Similarity != 1 {
+		t.Errorf("pair: keep %s, remove %s, similarity %v", pairs[0].Keep.Note, pairs[0].Remove.Note, pairs[0].Similarity)
+	}
+
+	typed.NotDuplicates = []primitive.ObjectID{imported.ID}
+	if pairs := service.DetectDuplicates([]model.Transaction{typed, imported}, service.DefaultDuplicateCriteria); len(pairs) != 0 {
+		t.Errorf("dismissed pair reported again: %+v", pairs)
+	}
+}
+
+func TestMergedTransaction(t *testing.T) {
+	food, coffee, work := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	payee, batch := primitive.NewObjectID(), primitive.NewObjectID()
+
+	keep := model.Transaction{
+		ID:         primitive.NewObjectID(),
+		Type:       "expense",
+		Amount:     45000,
+		Tags:       []primitive.ObjectID{coffee},
+		ExternalID: "FT001",
+		Note:       "CARD 1234 HIGHLANDS COFFEE",
+	}
+	remove := model.Transaction{
+		ID:          primitive.NewObjectID(),
+		Type:        "expense",
+		Amount:      45000,
+		Category:    food,
+		Payee:       payee,
+		Tags:        []primitive.ObjectID{coffee, work},
+		ImportBatch: batch,
+		Note:        "with the team",
+	}
+
+	merged := service.MergedTransaction(keep, remove)
+	if merged.ID != keep.ID || merged.Category != food || merged.Payee != payee || merged.ImportBatch != batch {
+		t.Errorf("links not carried over: %+v", merged)
+	}
+	if merged.ExternalID != "FT001" || merged.Note != keep.Note {
+		t.Errorf("keep's own fields overwritten: %+v", merged)
+	}
+	if len(merged.Tags) != 2 || len(keep.Tags) != 1 {
+		t.Errorf("tags: merged %v, keep %v", merged.Tags, keep.Tags)
+	}
+
+	keep.Type, keep.Category = "transfer", primitive.NilObjectID
+	if merged := service.MergedTransaction(keep, remove); !merged.Category.IsZero() {
+		t.Errorf("transfer got a category: %+v", merged)
+	}
+}
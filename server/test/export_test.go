@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"fintrack/server/exporter"
+	"fintrack/server/model"
+	"fintrack/server/parser"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWriteArchive(t *testing.T) {
+	checking := model.Account{ID: primitive.NewObjectID(), Name: "Tài khoản chính", Type: model.AccountChecking, Balance: 955000, BankAccountNumber: "0071000123"}
+	card := model.Account{ID: primitive.NewObjectID(), Name: "Visa", Type: model.AccountCreditCard, Balance: -45000}
+	food := model.Category{ID: primitive.NewObjectID(), Name: "Food", Type: "expense"}
+	coffee := model.Tag{ID: primitive.NewObjectID(), Name: "coffee"}
+	highlands := model.Payee{ID: primitive.NewObjectID(), Name: "Highlands Coffee", Aliases: []string{"highlands"}}
+	day := time.Date(2024, 5, 3, 9, 30, 0, 0, time.UTC)
+
+	lunch := model.Transaction{
+		ID: primitive.NewObjectID(), Type: "expense", Amount: 45000, DateTime: day,
+		SourceAccount: card.ID, Category: food.ID, Tags: []primitive.ObjectID{coffee.ID},
+		Payee: highlands.ID, Note: "latte", ExternalID: "FT001",
+	}
+	payment := model.Transaction{
+		ID: primitive.NewObjectID(), Type: "transfer", Amount: 45000, DateTime: day.Add(48 * time.Hour),
+		SourceAccount: checking.ID, DestinationAccount: card.ID, Note: "card payment",
+	}
+	deleted := model.Transaction{
+		ID: primitive.NewObjectID(), Type: "expense", Amount: 1, DateTime: day,
+		SourceAccount: card.ID, Category: food.ID, IsDeleted: true,
+	}
+
+	ds := &model.Dataset{
+		Version:      model.DatasetVersion,
+		Owner:        "alice",
+		ExportedAt:   day.AddDate(0, 0, 7),
+		Filter:       model.ExportFilter{IncludeDeleted: true, Currency: "VND"},
+		Accounts:     []model.Account{checking, card},
+		Categories:   []model.Category{food},
+		Tags:         []model.Tag{coffee},
+		Payees:       []model.Payee{highlands},
+		Transactions: []model.Transaction{lunch, payment, deleted},
+	}
+
+	var buf bytes.Buffer
+	if err := exporter.WriteArchive(&buf, ds, nil); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+
+	// The JSON dump reads back as it was written
+	var back model.Dataset
+	if err := json.Unmarshal(files[exporter.DatasetFile], &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Transactions) != 3 || back.Transactions[0].Payee != highlands.ID ||
+		back.Transactions[0].Tags[0] != coffee.ID || !back.Transactions[0].DateTime.Equal(day) ||
+		back.Accounts[0].BankAccountNumber != "0071000123" || !back.Transactions[2].IsDeleted {
+		t.Errorf("dataset did not round-trip: %+v", back.Transactions)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(files["csv/transactions.csv"])).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0][0] != "_id" || records[1][0] != lunch.ID.Hex() {
+		t.Fatalf("transactions.csv: %v", records)
+	}
+	col := map[string]int{}
+	for i, name := range records[0] {
+		col[name] = i
+	}
+	if records[1][col["tags"]] != coffee.ID.Hex() || records[1][col["dateTime"]] != "2024-05-03T09:30:00Z" ||
+		records[1][col["amount"]] != "45000" || records[3][col["isDeleted"]] != "true" {
+		t.Errorf("transaction row: %v", records[1])
+	}
+
+	// Each account's OFX reads back with the importer
+	var cardOFX, checkingOFX []byte
+	for name, data := range files {
+		switch name {
+		case "ofx/visa-" + card.ID.Hex()[18:] + ".ofx":
+			cardOFX = data
+		case "ofx/tai-khoan-chinh-" + checking.ID.Hex()[18:] + ".ofx":
+			checkingOFX = data
+		}
+	}
+	if cardOFX == nil || checkingOFX == nil {
+		t.Fatalf("missing OFX files in %v", len(files))
+	}
+
+	rows, err := parser.ParseOFX(string(cardOFX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("card statement: %+v", rows)
+	}
+	if rows[0].Amount != -45000 || rows[0].Reference != "FT001" || rows[0].Payee != "Highlands Coffee" {
+		t.Errorf("card expense: %+v", rows[0])
+	}
+	if rows[1].Amount != 45000 || rows[1].Reference != payment.ID.Hex() {
+		t.Errorf("card payment: %+v", rows[1])
+	}
+
+	rows, err = parser.ParseOFX(string(checkingOFX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Amount != -45000 || rows[0].Account != "0071000123" {
+		t.Errorf("checking statement: %+v", rows)
+	}
+}
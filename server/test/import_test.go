@@ -0,0 +1,335 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/parser"
+)
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		in           string
+		decimalComma bool
+		want         float64
+	}{
+		{"1,234.50", false, 1234.5},
+		{"1.234,50", true, 1234.5},
+		{"-45,000 VND", false, -45000},
+		{"(12.00)", false, -12},
+		{"12.00-", false, -12},
+		{"$ 7.5", false, 7.5},
+		{"", false, 0},
+	}
+
+	for _, tc := range cases {
+		got, err := parser.ParseAmount(tc.in, tc.decimalComma)
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%q: got %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	// UTF-8 with a BOM, a title line, semicolons and split debit/credit
+	data := []byte("\xEF\xBB\xBFSao kê tài khoản\n" +
+		"Ngày;Mô tả;Ghi nợ;Ghi có;Số tham chiếu\n" +
+		"03/05/2024;\"Highlands; Q1\";45.000;;FT001\n" +
+		"04/05/2024;Lương tháng 4;;15.000.000;FT002\n" +
+		";;;;\n" +
+		"Tổng;;;;\n")
+
+	text, enc, err := parser.DecodeText(data, "")
+	if err != nil || enc != "utf-8" {
+		t.Fatalf("decode: %q, %v", enc, err)
+	}
+	if d := parser.DetectDelimiter(text); d != ';' {
+		t.Fatalf("delimiter: got %q", d)
+	}
+
+	rows, err := parser.ParseCSV(text, model.ImportProfile{
+		SkipRows:     1,
+		HasHeader:    true,
+		DateFormat:   "DD/MM/YYYY",
+		Timezone:     "Asia/Ho_Chi_Minh",
+		DecimalComma: true,
+		Columns: model.ColumnMapping{
+			Date:        "Ngày",
+			Description: "mô tả",
+			Debit:       "Ghi nợ",
+			Credit:      "Ghi có",
+			Reference:   "5",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	loc, _ := time.LoadLocation("Asia/Ho_Chi_Minh")
+	first := rows[0]
+	if first.Amount != -45000 || first.Description != "Highlands; Q1" || first.Reference != "FT001" ||
+		!first.Date.Equal(time.Date(2024, 5, 3, 0, 0, 0, 0, loc)) || first.Line != 3 {
+		t.Errorf("first row: %+v", first)
+	}
+	if rows[1].Amount != 15000000 {
+		t.Errorf("salary: got %v", rows[1].Amount)
+	}
+	if rows[2].Err == "" {
+		t.Errorf("total line should not parse: %+v", rows[2])
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	// "Cà" in UTF-16LE with a byte order mark
+	text, enc, err := parser.DecodeText([]byte{0xFF, 0xFE, 'C', 0, 0xE0, 0}, "")
+	if err != nil || enc != "utf-16le" || text != "Cà" {
+		t.Errorf("utf-16: got %q %q %v", text, enc, err)
+	}
+
+	// Not UTF-8, read as Windows-1252
+	text, enc, err = parser.DecodeText([]byte("caf\xE9"), "")
+	if err != nil || enc != "windows-1252" || text != "café" {
+		t.Errorf("windows-1252: got %q %q %v", text, enc, err)
+	}
+}
+
+func TestParseOFX(t *testing.T) {
+	// OFX 1.x: SGML header, leaves are not closed
+	sgml := `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKACCTFROM><BANKID>121000248<ACCTID>0071-000123<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20240501
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240503120000.000[-5:EST]
+<TRNAMT>-45.00
+<FITID>FT001
+<NAME>HIGHLANDS COFFEE
+<MEMO>POS purchase
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240504
+<TRNAMT>1500.00
+<FITID>FT002
+<NAME>ACME &amp; CO PAYROLL
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>`
+
+	rows, err := parser.ParseOFX(sgml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("bank: got %d rows, want 2", len(rows))
+	}
+	first := rows[0]
+	if first.Amount != -45 || first.Reference != "FT001" || first.Account != "0071-000123" ||
+		first.Description != "HIGHLANDS COFFEE - POS purchase" ||
+		!first.Date.Equal(time.Date(2024, 5, 3, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("bank row: %+v", first)
+	}
+	if rows[1].Payee != "ACME & CO PAYROLL" {
+		t.Errorf("escaped name: %q", rows[1].Payee)
+	}
+
+	// OFX 2.x: XML, a credit card and an investment statement
+	xml := `<?xml version="1.0"?><?OFX OFXHEADER="200" VERSION="220"?>
+<OFX>
+<CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+<CCACCTFROM><ACCTID>4111XXXX1111</ACCTID></CCACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20240510</DTPOSTED><TRNAMT>-20.50</TRNAMT><FITID>CC1</FITID><NAME>GRAB</NAME><MEMO></MEMO></STMTTRN>
+</BANKTRANLIST>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+<INVSTMTMSGSRSV1><INVSTMTTRNRS><INVSTMTRS>
+<INVACCTFROM><BROKERID>broker.com</BROKERID><ACCTID>INV-9</ACCTID></INVACCTFROM>
+<INVTRANLIST>
+<BUYSTOCK><INVBUY><INVTRAN><FITID>B1</FITID><DTTRADE>20240511</DTTRADE><MEMO>Buy VNM</MEMO></INVTRAN>
+<SECID><UNIQUEID>VNM</UNIQUEID><UNIQUEIDTYPE>TICKER</UNIQUEIDTYPE></SECID>
+<UNITS>100</UNITS><UNITPRICE>70</UNITPRICE><TOTAL>-7010</TOTAL></INVBUY><BUYTYPE>BUY</BUYTYPE></BUYSTOCK>
+<INCOME><INVTRAN><FITID>D1</FITID><DTTRADE>20240520</DTTRADE></INVTRAN><SECID><UNIQUEID>VNM</UNIQUEID></SECID><INCOMETYPE>DIV</INCOMETYPE><TOTAL>150</TOTAL></INCOME>
+<INVBANKTRAN><STMTTRN><TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>20240502</DTPOSTED><TRNAMT>10000</TRNAMT><FITID>X1</FITID><NAME>Deposit</NAME></STMTTRN><SUBACCTFUND>CASH</SUBACCTFUND></INVBANKTRAN>
+</INVTRANLIST>
+</INVSTMTRS></INVSTMTTRNRS></INVSTMTMSGSRSV1>
+</OFX>`
+
+	rows, err = parser.ParseOFX(xml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		ref     string
+		account string
+		amount  float64
+	}{
+		{"CC1", "4111XXXX1111", -20.5},
+		{"B1", "INV-9", -7010},
+		{"D1", "INV-9", 150},
+		{"X1", "INV-9", 10000},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("xml: got %d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		r := rows[i]
+		if r.Reference != w.ref || r.Account != w.account || r.Amount != w.amount || r.Err != "" {
+			t.Errorf("xml row %d: %+v, want %+v", i, r, w)
+		}
+	}
+}
+
+func TestParseQIF(t *testing.T) {
+	qif := "!Account\nNChecking\nTBank\n^\n" +
+		"!Type:Bank\n" +
+		"D5/3'24\nT-45.00\nPHighlands Coffee\nMlatte\nN1001\n^\n" +
+		"D5/4/2024\nT1,500.00\nPACME Payroll\n^\n" +
+		"!Account\nNBrokerage\nTInvst\n^\n" +
+		"!Type:Invst\n" +
+		"D5/11/2024\nNBuy\nYVNM\nI70\nQ100\nT7,010.00\n^\n" +
+		"D5/12/2024\nNReinvDiv\nYVNM\nT50.00\n^\n" +
+		"D5/20/2024\nNDiv\nYVNM\nT150.00\n^\n"
+
+	rows, err := parser.ParseQIF(qif, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want 4: %+v", len(rows), rows)
+	}
+
+	first := rows[0]
+	if first.Amount != -45 || first.Account != "Checking" || first.Description != "Highlands Coffee - latte" ||
+		!first.Date.Equal(time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)) || first.Reference != "" {
+		t.Errorf("bank row: %+v", first)
+	}
+	if rows[1].Amount != 1500 {
+		t.Errorf("salary: %+v", rows[1])
+	}
+	if rows[2].Amount != -7010 || rows[2].Account != "Brokerage" || rows[2].Description != "Buy - VNM" {
+		t.Errorf("buy: %+v", rows[2])
+	}
+	if rows[3].Amount != 150 {
+		t.Errorf("dividend: %+v", rows[3])
+	}
+}
+
+func TestParseCamt053(t *testing.T) {
+	camt := `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt><Stmt>
+  <Acct><Id><IBAN>DE89370400440532013000</IBAN></Id><Ccy>EUR</Ccy></Acct>
+  <Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">1000.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2024-05-01</Dt></Dt></Bal>
+  <Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">2380.50</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2024-05-03</Dt></Dt></Bal>
+  <Ntry>
+    <Amt Ccy="EUR">19.50</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+    <BookgDt><Dt>2024-05-02</Dt></BookgDt><ValDt><Dt>2024-05-01</Dt></ValDt>
+    <AcctSvcrRef>E1</AcctSvcrRef>
+    <NtryDtls><TxDtls>
+      <RltdPties><Cdtr><Nm>Stadtwerke</Nm></Cdtr><CdtrAcct><Id><IBAN>DE02120300000000202051</IBAN></Id></CdtrAcct></RltdPties>
+      <RmtInf><Ustrd>Strom Mai</Ustrd></RmtInf>
+    </TxDtls></NtryDtls>
+  </Ntry>
+  <Ntry>
+    <Amt Ccy="EUR">1400.00</Amt><CdtDbtInd>CRDT</CdtDbtInd>
+    <BookgDt><Dt>2024-05-03</Dt></BookgDt>
+    <AcctSvcrRef>E2</AcctSvcrRef>
+    <NtryDtls>
+      <TxDtls><Amt Ccy="EUR">1200.00</Amt><RltdPties><Dbtr><Nm>ACME GmbH</Nm></Dbtr></RltdPties><RmtInf><Ustrd>Gehalt</Ustrd></RmtInf></TxDtls>
+      <TxDtls><Amt Ccy="EUR">200.00</Amt><RltdPties><Dbtr><Pty><Nm>Anna</Nm></Pty></Dbtr></RltdPties></TxDtls>
+    </NtryDtls>
+  </Ntry>
+</Stmt></BkToCstmrStmt>
+</Document>`
+
+	rows, balances, err := parser.ParseCamt053(camt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3: %+v", len(rows), rows)
+	}
+
+	bill := rows[0]
+	if bill.Amount != -19.5 || bill.Account != "DE89370400440532013000" || bill.Reference != "E1" ||
+		bill.Payee != "Stadtwerke" || bill.CounterpartyIBAN != "DE02120300000000202051" ||
+		!bill.Date.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)) ||
+		!bill.ValueDate.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("bill: %+v", bill)
+	}
+	if rows[1].Amount != 1200 || rows[1].Payee != "ACME GmbH" || rows[1].Reference != "E2/1" {
+		t.Errorf("salary: %+v", rows[1])
+	}
+	if rows[2].Amount != 200 || rows[2].Payee != "Anna" || rows[2].Reference != "E2/2" {
+		t.Errorf("batch detail: %+v", rows[2])
+	}
+
+	if len(balances) != 1 {
+		t.Fatalf("got %d balances, want 1", len(balances))
+	}
+	b := balances[0]
+	if b.Opening != 1000 || b.Closing != 2380.5 || b.Currency != "EUR" ||
+		!b.OpeningDate.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)) ||
+		!b.ClosingDate.Equal(time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)) {
+		t.Errorf("balance: %+v", b)
+	}
+}
+
+func TestParseMT940(t *testing.T) {
+	mt940 := "{1:F01BANKDEFFXXXX0000000000}{2:O940}{4:\r\n" +
+		":20:STMT1\r\n" +
+		":25:NL91ABNA0417164300\r\n" +
+		":28C:1/1\r\n" +
+		":60F:C240501EUR1000,00\r\n" +
+		":61:2405020502D19,50NTRFNONREF//B1\r\n" +
+		":86:/TRTP/SEPA OVERBOEKING/IBAN/NL20INGB0001234567/BIC/INGBNL2A/NAME/Energie B.V./REMI/USTD//Factuur 5/2024/\r\n" +
+		":61:2405310601C1200,00NTRFSAL-05\r\n" +
+		":86:166?00GUTSCHRIFT?20Gehalt ?21Mai?31DE44500105175407324931?32ACME?33 GmbH\r\n" +
+		":62F:C240601EUR2180,50\r\n" +
+		"-}"
+
+	rows, balances, err := parser.ParseMT940(mt940)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2: %+v", len(rows), rows)
+	}
+
+	bill := rows[0]
+	if bill.Amount != -19.5 || bill.Account != "NL91ABNA0417164300" || bill.Reference != "B1" ||
+		bill.Payee != "Energie B.V." || bill.CounterpartyIBAN != "NL20INGB0001234567" ||
+		bill.Description != "Energie B.V. - Factuur 5/2024" {
+		t.Errorf("bill: %+v", bill)
+	}
+
+	salary := rows[1]
+	if salary.Amount != 1200 || salary.Payee != "ACME GmbH" || salary.Reference != "SAL-05" ||
+		salary.CounterpartyIBAN != "DE44500105175407324931" ||
+		!salary.ValueDate.Equal(time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)) ||
+		!salary.Date.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("salary: %+v", salary)
+	}
+
+	if len(balances) != 1 || balances[0].Opening != 1000 || balances[0].Closing != 2180.5 ||
+		balances[0].Currency != "EUR" || balances[0].Account != "NL91ABNA0417164300" {
+		t.Errorf("balances: %+v", balances)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"fintrack/server/journal"
+	"fintrack/server/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func journalDataset() *model.Dataset {
+	checking := model.Account{ID: primitive.NewObjectID(), Name: "Tài khoản chính", Type: model.AccountChecking, BankAccountNumber: "0071000123"}
+	card := model.Account{ID: primitive.NewObjectID(), Name: "Visa", Type: model.AccountCreditCard}
+	trip := model.Saving{ID: primitive.NewObjectID(), Name: "Japan trip", Icon: "plane"}
+	food := model.Category{ID: primitive.NewObjectID(), Name: "Food", Type: "expense"}
+	household := model.Category{ID: primitive.NewObjectID(), Name: "Household", Type: "expense"}
+	salary := model.Category{ID: primitive.NewObjectID(), Name: "Salary", Type: "income"}
+	coffee := model.Tag{ID: primitive.NewObjectID(), Name: "coffee", Color: "#6f4e37"}
+	work := model.Tag{ID: primitive.NewObjectID(), Name: "Work trip", Color: "#000000"}
+	highlands := model.Payee{ID: primitive.NewObjectID(), Name: "Highlands Coffee", Aliases: []string{"highlands", "hlc"}}
+	day := time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)
+
+	return &model.Dataset{
+		Version:    model.DatasetVersion,
+		Owner:      "alice",
+		Filter:     model.ExportFilter{Currency: "VND"},
+		Accounts:   []model.Account{checking, card},
+		Savings:    []model.Saving{trip},
+		Categories: []model.Category{food, household, salary},
+		Tags:       []model.Tag{coffee, work},
+		Payees:     []model.Payee{highlands},
+		Transactions: []model.Transaction{
+			{
+				ID: primitive.NewObjectID(), Type: "opening_balance", Amount: 1000000, DateTime: day,
+				DestinationAccount: checking.ID, Note: "Opening balance",
+			},
+			{
+				ID: primitive.NewObjectID(), Type: "expense", Amount: 45000, DateTime: day.Add(9*time.Hour + 30*time.Minute),
+				SourceAccount: card.ID, Category: food.ID, Tags: []primitive.ObjectID{coffee.ID, work.ID},
+				Payee: highlands.ID, Note: `latte "large"`, ExternalID: "FT001", ValueDate: day.AddDate(0, 0, 1),
+			},
+			{
+				ID: primitive.NewObjectID(), Type: "expense", Amount: 300000.5, DateTime: day.AddDate(0, 0, 1),
+				SourceAccount: checking.ID, Note: "supermarket",
+				Splits: []model.Split{
+					{Category: food.ID, Amount: 200000, Note: "groceries"},
+					{Category: household.ID, Amount: 100000.5},
+				},
+			},
+			{
+				ID: primitive.NewObjectID(), Type: "income", Amount: 15000000, DateTime: day.AddDate(0, 0, 2),
+				DestinationAccount: checking.ID, Category: salary.ID, Note: "May | bonus",
+			},
+			{
+				ID: primitive.NewObjectID(), Type: "transfer", Amount: 45000, DateTime: day.AddDate(0, 0, 3),
+				SourceAccount: checking.ID, DestinationAccount: card.ID, Note: "card payment",
+			},
+			{
+				ID: primitive.NewObjectID(), Type: "transfer", Amount: 2000000, DateTime: day.AddDate(0, 0, 3),
+				SourceAccount: checking.ID, DestinationAccount: trip.ID,
+			},
+			{
+				ID: primitive.NewObjectID(), Type: "expense", Amount: 10000, DateTime: day.AddDate(0, 0, 4),
+				SourceAccount: checking.ID, Note: "parking",
+			},
+		},
+	}
+}
+
+func TestJournalRoundTrip(t *testing.T) {
+	for _, dialect := range []journal.Dialect{journal.Beancount, journal.Ledger} {
+		t.Run(string(dialect), func(t *testing.T) {
+			ds := journalDataset()
+			var buf bytes.Buffer
+			if err := journal.Write(&buf, ds, dialect); err != nil {
+				t.Fatal(err)
+			}
+			back, err := journal.Read(buf.String())
+			if err != nil {
+				t.Fatalf("%v\n%s", err, buf.String())
+			}
+
+			if len(back.Accounts) != 2 || len(back.Savings) != 1 || len(back.Categories) != 3 ||
+				len(back.Tags) != 2 || len(back.Payees) != 1 || len(back.Transactions) != len(ds.Transactions) {
+				t.Fatalf("read %d accounts, %d savings, %d categories, %d tags, %d payees, %d transactions\n%s",
+					len(back.Accounts), len(back.Savings), len(back.Categories), len(back.Tags),
+					len(back.Payees), len(back.Transactions), buf.String())
+			}
+			for i, a := range ds.Accounts {
+				b := back.Accounts[i]
+				if b.ID != a.ID || b.Name != a.Name || b.Type != a.Type || b.BankAccountNumber != a.BankAccountNumber {
+					t.Errorf("account %+v, want %+v", b, a)
+				}
+			}
+			if s := back.Savings[0]; s.ID != ds.Savings[0].ID || s.Name != "Japan trip" || s.Icon != "plane" {
+				t.Errorf("saving %+v", s)
+			}
+			for i, c := range ds.Categories {
+				b := back.Categories[i]
+				if b.ID != c.ID || b.Name != c.Name || b.Type != c.Type {
+					t.Errorf("category %+v, want %+v", b, c)
+				}
+			}
+			for i, tag := range ds.Tags {
+				if back.Tags[i] != tag {
+					t.Errorf("tag %+v, want %+v", back.Tags[i], tag)
+				}
+			}
+			if p := back.Payees[0]; p.ID != ds.Payees[0].ID || p.Name != "Highlands Coffee" ||
+				len(p.Aliases) != 2 || p.Aliases[1] != "hlc" {
+				t.Errorf("payee %+v", p)
+			}
+
+			for i, want := range ds.Transactions {
+				got := back.Transactions[i]
+				if got.ID != want.ID || got.Type != want.Type || got.Amount != want.Amount ||
+					!got.DateTime.Equal(want.DateTime) || !got.ValueDate.Equal(want.ValueDate) ||
+					got.SourceAccount != want.SourceAccount || got.DestinationAccount != want.DestinationAccount ||
+					got.Category != want.Category || got.Payee != want.Payee || got.Note != want.Note ||
+					got.ExternalID != want.ExternalID || len(got.Tags) != len(want.Tags) || len(got.Splits) != len(want.Splits) {
+					t.Errorf("transaction %d\n got %+v\nwant %+v", i, got, want)
+					continue
+				}
+				for j := range want.Tags {
+					if got.Tags[j] != want.Tags[j] {
+						t.Errorf("transaction %d tags %v, want %v", i, got.Tags, want.Tags)
+					}
+				}
+				for j := range want.Splits {
+					if got.Splits[j] != want.Splits[j] {
+						t.Errorf("transaction %d split %+v, want %+v", i, got.Splits[j], want.Splits[j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadLedgerJournal(t *testing.T) {
+	text := `; hand-written, no fintrack metadata
+2024/05/01 Opening
+    assets:bank:checking          5,000,000 VND
+    equity:opening balances
+
+2024/05/02 * Circle K | snacks  ; :food:late:
+    expenses:food                    35000 VND
+    assets:bank:checking
+
+2024/05/03 Salary
+    assets:bank:checking         20000000 VND
+    revenue:salary
+
+2024/05/04 (1042) Rent
+    Expenses:Housing            4000000 VND
+    Liabilities:Visa
+`
+	ds, err := journal.Read(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.Transactions) != 4 || len(ds.Accounts) != 2 || len(ds.Categories) != 3 {
+		t.Fatalf("read %+v", ds)
+	}
+	checking := ds.Accounts[0].ID
+
+	opening := ds.Transactions[0]
+	if opening.Type != "opening_balance" || opening.Amount != 5000000 || opening.DestinationAccount != checking {
+		t.Errorf("opening %+v", opening)
+	}
+	snack := ds.Transactions[1]
+	if snack.Type != "expense" || snack.Amount != 35000 || snack.SourceAccount != checking ||
+		snack.Note != "snacks" || snack.Payee != ds.Payees[0].ID || ds.Payees[0].Name != "Circle K" {
+		t.Errorf("expense %+v", snack)
+	}
+	if salary := ds.Transactions[2]; salary.Type != "income" || salary.DestinationAccount != checking ||
+		ds.Categories[1].Type != "income" || ds.Categories[1].Name != "salary" {
+		t.Errorf("income %+v, %+v", salary, ds.Categories)
+	}
+	rent := ds.Transactions[3]
+	if rent.Type != "expense" || rent.Note != "Rent" || rent.SourceAccount != ds.Accounts[1].ID ||
+		ds.Accounts[1].Type != model.AccountCreditCard {
+		t.Errorf("rent %+v, %+v", rent, ds.Accounts[1])
+	}
+}
+
+func TestReadJournalRefundLeg(t *testing.T) {
+	text := `2024/05/02 Groceries
+    Assets:Cash                 -80 VND
+    Expenses:Food               100 VND
+    Expenses:Household           30 VND
+    Expenses:Food               -50 VND
+`
+	ds, err := journal.Read(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := ds.Transactions[0]
+	total := 0.0
+	for _, split := range tx.Splits {
+		if split.Amount <= 0 {
+			t.Errorf("split %+v is not positive", split)
+		}
+		total += split.Amount
+	}
+	if tx.Type != "expense" || tx.Amount != 80 || len(tx.Splits) != 2 || total != tx.Amount {
+		t.Errorf("groceries %+v", tx)
+	}
+
+	for name, text := range map[string]string{
+		"refund outweighs": `2024/05/02 Refund
+    Assets:Cash                  70 VND
+    Expenses:Food              -100 VND
+    Expenses:Household           30 VND
+`,
+		"unknown type": `2024/05/02 Fix
+    type: transfer
+    Assets:Cash                  70 VND
+    Equity:Adjustments
+`,
+	} {
+		if _, err := journal.Read(text); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
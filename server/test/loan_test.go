@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+)
+
+func TestAmortizationSchedule(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		method   model.InterestMethod
+		rate     float64
+		payment  float64 // first installment
+		interest float64 // total
+	}{
+		{model.InterestReducing, 12, 888.49, 661.85},
+		{model.InterestFlat, 12, 933.33, 1200},
+		{model.InterestReducing, 0, 833.33, 0},
+	}
+
+	for _, tc := range cases {
+		schedule, err := service.BuildAmortizationSchedule(10000, tc.rate, tc.method, 12, start)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.method, err)
+		}
+		if len(schedule) != 12 {
+			t.Fatalf("%s: expected 12 installments, got %d", tc.method, len(schedule))
+		}
+		if schedule[0].Payment != tc.payment {
+			t.Errorf("%s at %.0f%%: expected first payment %.2f, got %.2f", tc.method, tc.rate, tc.payment, schedule[0].Payment)
+		}
+		if !schedule[0].DueDate.Equal(start.AddDate(0, 1, 0)) {
+			t.Errorf("%s: first installment due %v", tc.method, schedule[0].DueDate)
+		}
+
+		principal, interest := 0.0, 0.0
+		for _, inst := range schedule {
+			principal += inst.Principal
+			interest += inst.Interest
+		}
+		if math.Abs(principal-10000) > 0.001 {
+			t.Errorf("%s: principal parts add up to %.2f", tc.method, principal)
+		}
+		if math.Abs(interest-tc.interest) > 0.05 {
+			t.Errorf("%s at %.0f%%: expected total interest %.2f, got %.2f", tc.method, tc.rate, tc.interest, interest)
+		}
+		if last := schedule[11]; last.Remaining != 0 {
+			t.Errorf("%s: %.2f left after the last installment", tc.method, last.Remaining)
+		}
+	}
+
+	// Month ends: one installment each month, on its last day when shorter
+	endOfJanuary := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	schedule, err := service.BuildAmortizationSchedule(10000, 12, model.InterestReducing, 4, endOfJanuary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []time.Time{
+		time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC),
+	} {
+		if !schedule[i].DueDate.Equal(want) {
+			t.Errorf("installment %d due %v, want %v", i+1, schedule[i].DueDate, want)
+		}
+	}
+
+	if _, err := service.BuildAmortizationSchedule(10000, 12, "balloon", 12, start); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
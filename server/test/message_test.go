@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/parser"
+)
+
+func TestParseBuiltinMessages(t *testing.T) {
+	received := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	vn, _ := time.LoadLocation("Asia/Ho_Chi_Minh")
+
+	cases := []struct {
+		name, sender, text string
+		provider           string
+		amount             float64
+		balance            float64 // 0 when the message has none
+		reference, account string
+		payee              string
+		date               time.Time
+	}{
+		{
+			name: "vcb", sender: "Vietcombank",
+			text:     "SD TK 0071000123456 -50,000VND luc 15-05-2024 09:12:45. SD 1,234,567VND. Ref MBVCB.5839201.097321.thanh toan QR",
+			provider: "Vietcombank", amount: -50000, balance: 1234567,
+			reference: "MBVCB.5839201.097321", account: "0071000123456",
+			date: time.Date(2024, 5, 15, 9, 12, 45, 0, vn),
+		},
+		{
+			name: "techcombank", sender: "Techcombank",
+			text:     "TK 1903xxxx1234\nSo tien GD:+5,000,000 So du:12,345,678 NGUYEN VAN A chuyen tien",
+			provider: "Techcombank", amount: 5000000, balance: 12345678, account: "1903xxxx1234", date: received,
+		},
+		{
+			name: "mb", sender: "MBBANK",
+			text:     "TK 03xxx789|GD: -45,000VND 14/05/24 20:05 |SD: 955,000VND|ND: highlands coffee",
+			provider: "MB Bank", amount: -45000, balance: 955000, account: "03xxx789",
+			date: time.Date(2024, 5, 14, 20, 5, 0, 0, vn),
+		},
+		{
+			name: "momo in", sender: "MoMo",
+			text:     "Bạn đã nhận được 100.000đ từ NGUYEN VAN B. Lời nhắn: tra tien an. Mã giao dịch: 123456789",
+			provider: "MoMo", amount: 100000, reference: "123456789", payee: "NGUYEN VAN B", date: received,
+		},
+		{
+			name: "momo out", sender: "MoMo",
+			text:     "Bạn đã thanh toán thành công 45.000đ cho Highlands Coffee. Mã giao dịch: 987654321",
+			provider: "MoMo", amount: -45000, reference: "987654321", payee: "Highlands Coffee", date: received,
+		},
+		{
+			name: "zalopay", sender: "ZaloPay",
+			text:     "ZaloPay: Thanh toan thanh cong 59.000d cho GrabFood. So du vi: 1.200.000d. Ma GD: 240515000123",
+			provider: "ZaloPay", amount: -59000, balance: 1200000, reference: "240515000123", payee: "GrabFood", date: received,
+		},
+	}
+
+	for _, tc := range cases {
+		msg, ok := parser.ParseMessage(parser.BuiltinTemplates, tc.sender, tc.text, received)
+		if !ok {
+			t.Errorf("%s: not read", tc.name)
+			continue
+		}
+		if msg.Template.Provider != tc.provider || msg.Amount != tc.amount || msg.Reference != tc.reference ||
+			msg.Account != tc.account || msg.Payee != tc.payee || !msg.Date.Equal(tc.date) {
+			t.Errorf("%s: read %+v", tc.name, msg.Row)
+		}
+		if (tc.balance == 0) != (msg.Balance == nil) || (msg.Balance != nil && *msg.Balance != tc.balance) {
+			t.Errorf("%s: balance %v", tc.name, msg.Balance)
+		}
+	}
+
+	if _, ok := parser.ParseMessage(parser.BuiltinTemplates, "VCB", "Ma OTP cua ban la 123456", received); ok {
+		t.Error("read an OTP as a transaction")
+	}
+}
+
+func TestParseMessageOwnTemplate(t *testing.T) {
+	received := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	own := model.MessageTemplate{
+		Name:         "ACB",
+		Sender:       "ACB",
+		Pattern:      `ACB: TK (?P<account>\d+)\s+(?P<amount>[\d.,]+)\s+VND\s+GD\s+(?P<description>.*)`,
+		Direction:    model.DirectionOut,
+		DecimalComma: true,
+	}
+	templates := append([]model.MessageTemplate{own}, parser.BuiltinTemplates...)
+	text := "ACB: TK 12345  1.250.000,50 VND GD tien dien thang 5"
+
+	msg, ok := parser.ParseMessage(templates, "ACB Bank", text, received)
+	if !ok || msg.Template.Name != "ACB" || msg.Amount != -1250000.5 || msg.Description != "tien dien thang 5" {
+		t.Errorf("read %+v, %v", msg.Row, ok)
+	}
+	// Another sender is not read by it
+	if _, ok := parser.ParseMessage(templates, "Spam", text, received); ok {
+		t.Error("read a message from another sender")
+	}
+
+	for _, bad := range []model.MessageTemplate{
+		{Pattern: `(?P<amount>\d+`, Direction: model.DirectionIn},
+		{Pattern: `paid (\d+)`, Direction: model.DirectionIn},
+		{Pattern: `paid (?P<amount>\d+)`},
+		{Pattern: `(?P<amount>\d+) on (?P<date>\S+)`, Direction: model.DirectionIn},
+	} {
+		if _, err := parser.CompileTemplate(bad); err == nil {
+			t.Errorf("accepted %q", bad.Pattern)
+		}
+	}
+}
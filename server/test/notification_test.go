@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+)
+
+func TestRouteNotification(t *testing.T) {
+	ict := time.FixedZone("ICT", 7*60*60)
+	morning := time.Date(2024, 3, 10, 10, 0, 0, 0, ict)
+	night := time.Date(2024, 3, 10, 23, 0, 0, 0, ict)
+
+	pref := service.DefaultNotificationPreference("testaccount1")
+	pref.Timezone = "Asia/Ho_Chi_Minh"
+	pref.QuietHours.Enabled = true
+	pref.Channels[model.TypeReminder] = map[model.NotificationChannel]bool{model.ChannelEmail: true}
+	pref.Channels[model.TypeFinishIncome] = map[model.NotificationChannel]bool{model.ChannelInApp: false}
+
+	digest := pref
+	digest.Digest.Enabled = true
+	digest.Digest.Types = append(digest.Digest.Types, model.TypeStatementDue)
+	digest.Digest.Hour = 20
+
+	cases := []struct {
+		name      string
+		pref      model.NotificationPreference
+		notifType model.NotificationType
+		now       time.Time
+		status    model.NotificationStatus
+		deliverAt time.Time
+		channels  int
+	}{
+		{"outside quiet hours", pref, model.TypeTransaction, morning, model.StatusDelivered, morning, 1},
+		{"extra channel", pref, model.TypeReminder, morning, model.StatusDelivered, morning, 2},
+		{"quiet hours, held until morning", pref, model.TypeTransaction, night,
+			model.StatusHeld, time.Date(2024, 3, 11, 7, 0, 0, 0, ict), 1},
+		{"quiet hours, after midnight", pref, model.TypeTransaction, night.Add(3 * time.Hour),
+			model.StatusHeld, time.Date(2024, 3, 11, 7, 0, 0, 0, ict), 1},
+		{"digested", digest, model.TypeTransaction, morning,
+			model.StatusQueued, time.Date(2024, 3, 10, 20, 0, 0, 0, ict), 1},
+		{"digested after the digest hour", digest, model.TypeTransaction, time.Date(2024, 3, 10, 21, 0, 0, 0, ict),
+			model.StatusQueued, time.Date(2024, 3, 11, 20, 0, 0, 0, ict), 1},
+		{"urgent, never digested", digest, model.TypeStatementDue, morning, model.StatusDelivered, morning, 1},
+	}
+
+	for _, tc := range cases {
+		notif := model.Notification{Owner: "testaccount1", Type: tc.notifType}
+		if !service.RouteNotification(tc.pref, &notif, tc.now.UTC()) {
+			t.Errorf("%s: expected the notification to be routed", tc.name)
+			continue
+		}
+		if notif.Status != tc.status || !notif.DeliverAt.Equal(tc.deliverAt) {
+			t.Errorf("%s: expected %s at %v, got %s at %v", tc.name, tc.status, tc.deliverAt, notif.Status, notif.DeliverAt)
+		}
+		if len(notif.Channels) != tc.channels {
+			t.Errorf("%s: expected %d channels, got %v", tc.name, tc.channels, notif.Channels)
+		}
+	}
+
+	notif := model.Notification{Owner: "testaccount1", Type: model.TypeFinishIncome}
+	if service.RouteNotification(pref, &notif, morning) {
+		t.Error("expected a notification with every channel disabled to be dropped")
+	}
+}
+
+func TestScheduleNotification(t *testing.T) {
+	now := time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC)
+	due := time.Date(2024, 3, 25, 9, 0, 0, 0, time.UTC)
+
+	notif := model.Notification{Type: model.TypeReminder, ScheduledAt: due}
+	if !service.ScheduleNotification(&notif, now) {
+		t.Fatal("expected a future notification to be scheduled")
+	}
+	if notif.Status != model.StatusPending || !notif.DeliverAt.Equal(due) {
+		t.Errorf("expected pending until %v, got %s until %v", due, notif.Status, notif.DeliverAt)
+	}
+
+	for _, at := range []time.Time{{}, now.Add(-time.Hour), now} {
+		notif := model.Notification{Type: model.TypeReminder, ScheduledAt: at}
+		if service.ScheduleNotification(&notif, now) {
+			t.Errorf("scheduled at %v: expected immediate delivery", at)
+		}
+		if notif.Status != "" {
+			t.Errorf("scheduled at %v: status set to %s", at, notif.Status)
+		}
+	}
+
+	// Once due, a scheduled notification still waits out quiet hours
+	pref := service.DefaultNotificationPreference("testaccount1")
+	pref.QuietHours = model.QuietHours{Enabled: true, Start: "22:00", End: "07:00"}
+	notif = model.Notification{Type: model.TypeReminder, ScheduledAt: time.Date(2024, 3, 25, 23, 30, 0, 0, time.UTC)}
+	service.ScheduleNotification(&notif, now)
+	if !service.RouteNotification(pref, &notif, notif.DeliverAt) {
+		t.Fatal("expected the notification to be routed")
+	}
+	if want := time.Date(2024, 3, 26, 7, 0, 0, 0, time.UTC); notif.Status != model.StatusHeld || !notif.DeliverAt.Equal(want) {
+		t.Errorf("expected held until %v, got %s until %v", want, notif.Status, notif.DeliverAt)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+)
+
+func TestPayeeMatcher(t *testing.T) {
+	matcher := service.NewPayeeMatcher([]model.Payee{
+		{Name: "Highlands", Aliases: []string{}},
+		{Name: "Highlands Coffee", Aliases: []string{"HLC"}},
+		{Name: "Grab", Aliases: []string{"GrabFood", "Grab*Food"}},
+		{Name: "Điện lực", Aliases: []string{"EVN"}},
+	})
+
+	cases := []struct {
+		text string
+		want string // empty when nothing should match
+	}{
+		{"Cà phê ở Highlands Coffee Q1", "Highlands Coffee"},
+		{"HIGHLANDS q3", "Highlands"},
+		{"POS 1234 HLC HCM", "Highlands Coffee"},
+		{"GRAB*FOOD 0901", "Grab"},
+		{"grabbing lunch", ""},
+		{"Tiền điện lực tháng 5", "Điện lực"},
+		{"", ""},
+	}
+
+	for _, tc := range cases {
+		payee, ok := matcher.Match(tc.text)
+		if tc.want == "" {
+			if ok {
+				t.Errorf("%q: matched %q, want no match", tc.text, payee.Name)
+			}
+			continue
+		}
+		if !ok || payee.Name != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.text, payee.Name, tc.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/quickadd"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type quickAddFixture struct {
+	vocab                   quickadd.Vocabulary
+	cash, vcb, visa, momo   primitive.ObjectID
+	trip                    primitive.ObjectID
+	food, transport, salary primitive.ObjectID
+	highlands               primitive.ObjectID
+}
+
+func newQuickAddFixture() quickAddFixture {
+	loc, _ := time.LoadLocation("Asia/Ho_Chi_Minh")
+	f := quickAddFixture{
+		cash: primitive.NewObjectID(), vcb: primitive.NewObjectID(), visa: primitive.NewObjectID(), momo: primitive.NewObjectID(),
+		trip: primitive.NewObjectID(), food: primitive.NewObjectID(), transport: primitive.NewObjectID(),
+		salary: primitive.NewObjectID(), highlands: primitive.NewObjectID(),
+	}
+	f.vocab = quickadd.Vocabulary{
+		Accounts: []model.Account{
+			{ID: f.cash, Name: "Tiền mặt", Type: model.AccountCash},
+			{ID: f.vcb, Name: "VCB", Type: model.AccountChecking},
+			{ID: f.visa, Name: "Visa Platinum", Type: model.AccountCreditCard},
+			{ID: f.momo, Name: "Momo", Type: model.AccountEWallet},
+		},
+		Savings: []model.Saving{{ID: f.trip, Name: "Quỹ du lịch"}},
+		Categories: []model.Category{
+			{ID: f.food, Name: "Ăn uống", Type: "expense"},
+			{ID: f.transport, Name: "Đi lại", Type: "expense"},
+			{ID: f.salary, Name: "Lương", Type: "income"},
+		},
+		Payees: []model.Payee{{ID: f.highlands, Name: "Highlands", Aliases: []string{"Highlands Coffee"}, DefaultCategory: f.food}},
+		// a Wednesday
+		Now: time.Date(2024, 5, 15, 10, 0, 0, 0, loc),
+	}
+	return f
+}
+
+func (f quickAddFixture) parse(t *testing.T, text string) quickadd.Proposal {
+	t.Helper()
+	p, err := quickadd.RuleParser{}.Parse(context.Background(), text, f.vocab)
+	if err != nil {
+		t.Fatalf("%q: %v", text, err)
+	}
+	return p
+}
+
+func uncertain(p quickadd.Proposal, field string) bool {
+	for _, u := range p.Uncertain {
+		if u == field {
+			return true
+		}
+	}
+	return false
+}
+
+func TestQuickAddVietnamese(t *testing.T) {
+	f := newQuickAddFixture()
+	day := func(d, h, m int) time.Time {
+		return time.Date(2024, 5, d, h, m, 0, 0, f.vocab.Now.Location())
+	}
+
+	p := f.parse(t, "cà phê 45k tiền mặt hôm qua")
+	tx := p.Transaction
+	if tx.Type != "expense" || tx.Amount != 45000 || tx.SourceAccount != f.cash || !tx.DateTime.Equal(day(14, 10, 0)) ||
+		tx.Category != f.food || tx.Note != "cà phê" {
+		t.Errorf("coffee %+v", tx)
+	}
+	// The category was only hinted at
+	if !uncertain(p, quickadd.FieldCategory) || uncertain(p, quickadd.FieldAmount) || uncertain(p, quickadd.FieldAccount) {
+		t.Errorf("coffee confidence %v", p.Confidence)
+	}
+
+	p = f.parse(t, "chuyển 2tr từ VCB sang Momo lúc 20h30")
+	tx = p.Transaction
+	if tx.Type != "transfer" || tx.Amount != 2e6 || tx.SourceAccount != f.vcb || tx.DestinationAccount != f.momo ||
+		!tx.DateTime.Equal(day(15, 20, 30)) {
+		t.Errorf("transfer %+v", tx)
+	}
+
+	p = f.parse(t, "12/4 ăn trưa 120.000đ bằng thẻ")
+	tx = p.Transaction
+	if tx.Amount != 120000 || tx.SourceAccount != f.visa || !tx.DateTime.Equal(day(15, 10, 0).AddDate(0, -1, -3)) ||
+		tx.Category != f.food {
+		t.Errorf("lunch %+v", tx)
+	}
+
+	p = f.parse(t, "nhận lương 15tr5 vào vietcombank")
+	tx = p.Transaction
+	if tx.Type != "income" || tx.Amount != 15.5e6 || tx.Category != f.salary || p.Confidence[quickadd.FieldCategory] != 1 {
+		t.Errorf("salary %+v, %v", tx, p.Confidence)
+	}
+
+	p = f.parse(t, "gửi 5 triệu vào quỹ du lịch thứ 2")
+	tx = p.Transaction
+	if tx.Type != "transfer" || tx.Amount != 5e6 || tx.DestinationAccount != f.trip || !tx.SourceAccount.IsZero() ||
+		!tx.DateTime.Equal(day(13, 10, 0)) || !uncertain(p, quickadd.FieldAccount) {
+		t.Errorf("saving %+v, %v", tx, p.Confidence)
+	}
+}
+
+func TestQuickAddEnglish(t *testing.T) {
+	f := newQuickAddFixture()
+	loc := f.vocab.Now.Location()
+
+	p := f.parse(t, "salary 25tr to VCB")
+	tx := p.Transaction
+	if tx.Type != "income" || tx.Amount != 25e6 || tx.DestinationAccount != f.vcb || tx.Category != f.salary {
+		t.Errorf("salary %+v", tx)
+	}
+
+	// A bare small number is read as thousands, but flagged
+	p = f.parse(t, "lunch 85 yesterday at 12:30")
+	tx = p.Transaction
+	if tx.Amount != 85000 || !tx.DateTime.Equal(time.Date(2024, 5, 14, 12, 30, 0, 0, loc)) || tx.Category != f.food {
+		t.Errorf("lunch %+v", tx)
+	}
+	if !uncertain(p, quickadd.FieldAmount) || !uncertain(p, quickadd.FieldAccount) || p.Score != 0 {
+		t.Errorf("lunch confidence %v, score %v", p.Confidence, p.Score)
+	}
+
+	// Month first, but 5/12 could be either
+	p = f.parse(t, "5/12 grab 1,250,000 vnd on visa")
+	tx = p.Transaction
+	if tx.Amount != 1250000 || !tx.DateTime.Equal(time.Date(2024, 5, 12, 10, 0, 0, 0, loc)) ||
+		tx.SourceAccount != f.visa || tx.Category != f.transport || !uncertain(p, quickadd.FieldDate) {
+		t.Errorf("grab %+v, %v", tx, p.Confidence)
+	}
+
+	// The payee brings its category
+	p = f.parse(t, "Highlands Coffee 55.5k momo last friday")
+	tx = p.Transaction
+	if tx.Payee != f.highlands || tx.Amount != 55500 || tx.SourceAccount != f.momo || tx.Category != f.food ||
+		!tx.DateTime.Equal(time.Date(2024, 5, 10, 10, 0, 0, 0, loc)) {
+		t.Errorf("highlands %+v", tx)
+	}
+
+	if _, err := (quickadd.RuleParser{}).Parse(context.Background(), "  ", f.vocab); err == nil {
+		t.Error("parsed nothing")
+	}
+}
+
+func TestQuickAddAmounts(t *testing.T) {
+	f := newQuickAddFixture()
+	for text, want := range map[string]float64{
+		"45k":            45000,
+		"45 nghìn":       45000,
+		"1.5tr":          1.5e6,
+		"1,5 triệu":      1.5e6,
+		"1tr2":           1.2e6,
+		"2 tỷ":           2e9,
+		"45.000":         45000,
+		"1.234.567 đ":    1234567,
+		"1,234.5":        1234.5,
+		"3 củ":           3e6,
+		"2m":             2e6,
+		"thứ 6 tiêu 50k": 50000,
+	} {
+		if got := f.parse(t, text).Transaction.Amount; got != want {
+			t.Errorf("%q read as %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestQuickAddCurrency(t *testing.T) {
+	f := newQuickAddFixture()
+
+	// Dollars are not relabelled as dong
+	p := f.parse(t, "$12.50 lunch")
+	if p.Transaction.Amount != 12.5 || !uncertain(p, quickadd.FieldAmount) {
+		t.Errorf("dollars in VND: %v, %v", p.Transaction.Amount, p.Confidence)
+	}
+
+	f.vocab.Currency = "USD"
+	for text, want := range map[string]float64{
+		"lunch 12":       12,
+		"$12.50 lunch":   12.5,
+		"lunch 8.75 usd": 8.75,
+		"rent 1,200":     1200,
+	} {
+		p := f.parse(t, text)
+		if p.Transaction.Amount != want {
+			t.Errorf("%q read as %v, want %v", text, p.Transaction.Amount, want)
+		}
+	}
+	if p := f.parse(t, "$12.50 lunch"); uncertain(p, quickadd.FieldAmount) {
+		t.Errorf("dollars in USD: %v", p.Confidence)
+	}
+	if p := f.parse(t, "lunch 45.000đ"); !uncertain(p, quickadd.FieldAmount) {
+		t.Errorf("dong in USD: %v", p.Confidence)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"fintrack/server/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFindDiscrepancies(t *testing.T) {
+	holder := func(name string, opening, balance float64) service.BalanceHolder {
+		return service.BalanceHolder{ID: primitive.NewObjectID(), Name: name, Opening: opening, Balance: balance}
+	}
+	consistent := holder("Consistent", 100, 350)
+	rounded := holder("Rounded", 0, 0.1+0.2)
+	untouched := holder("Untouched", 500, 500)
+	overwritten := holder("Overwritten", 100, 1000)
+	card := holder("Card", 0, -150)
+
+	nets := map[primitive.ObjectID]float64{
+		consistent.ID:  250,
+		rounded.ID:     0.3,
+		overwritten.ID: 250,
+		card.ID:        -200, // a payment into it was lost
+	}
+
+	found := service.FindDiscrepancies([]service.BalanceHolder{consistent, rounded, untouched, overwritten, card}, nets)
+
+	expected := map[primitive.ObjectID]struct{ computed, difference float64 }{
+		overwritten.ID: {350, 650},
+		card.ID:        {-200, 50},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d discrepancies, got %+v", len(expected), found)
+	}
+	for _, d := range found {
+		want, ok := expected[d.ID]
+		if !ok {
+			t.Errorf("%s reported as drifted", d.Name)
+			continue
+		}
+		if math.Abs(d.Computed-want.computed) > 0.001 || math.Abs(d.Difference-want.difference) > 0.001 {
+			t.Errorf("%s: expected computed %.2f and difference %.2f, got %.2f and %.2f",
+				d.Name, want.computed, want.difference, d.Computed, d.Difference)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fintrack/server/middleware"
+	"fintrack/server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportQuery runs the report query middleware on query and returns the
+// status code and the query it produced.
+func reportQuery(mode middleware.TransferMode, query string) (int, service.ReportQuery) {
+	gin.SetMode(gin.TestMode)
+
+	var q service.ReportQuery
+	router := gin.New()
+	router.GET("/report", middleware.ReportQueryMiddleware(mode), func(c *gin.Context) {
+		q = c.MustGet("reportQuery").(service.ReportQuery)
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/report?"+query, nil))
+	return w.Code, q
+}
+
+func TestReportQueryMiddleware(t *testing.T) {
+	cases := []struct {
+		mode     middleware.TransferMode
+		query    string
+		status   int
+		includes bool // transfers
+	}{
+		{middleware.TransfersNever, "", http.StatusOK, false},
+		{middleware.TransfersNever, "includeTransfers=true", http.StatusOK, false},
+		{middleware.TransfersNever, "type=transfer", http.StatusBadRequest, false},
+		{middleware.TransfersNever, "type=transfer&includeTransfers=true", http.StatusBadRequest, false},
+		{middleware.TransfersOptIn, "", http.StatusOK, false},
+		{middleware.TransfersOptIn, "type=transfer", http.StatusBadRequest, false},
+		{middleware.TransfersOptIn, "type=transfer&includeTransfers=true", http.StatusOK, true},
+		{middleware.TransfersIncluded, "", http.StatusOK, true},
+		{middleware.TransfersIncluded, "includeTransfers=false", http.StatusOK, false},
+		{middleware.TransfersIncluded, "type=spending", http.StatusBadRequest, false},
+	}
+
+	for _, tc := range cases {
+		status, q := reportQuery(tc.mode, tc.query)
+		if status != tc.status {
+			t.Errorf("mode %d, %q: expected status %d, got %d", tc.mode, tc.query, tc.status, status)
+			continue
+		}
+		if status == http.StatusOK && q.IncludeTransfers != tc.includes {
+			t.Errorf("mode %d, %q: expected transfers included %v", tc.mode, tc.query, tc.includes)
+		}
+	}
+
+	status, q := reportQuery(middleware.TransfersIncluded,
+		"from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z&tz=Asia/Ho_Chi_Minh")
+	if status != http.StatusOK {
+		t.Fatalf("expected a valid range, got status %d", status)
+	}
+	if q.Location.String() != "Asia/Ho_Chi_Minh" || q.To.Sub(q.From).Hours() != 31*24 {
+		t.Errorf("unexpected range %v to %v in %v", q.From, q.To, q.Location)
+	}
+
+	for _, query := range []string{"tz=Local", "tz=Mars/Olympus", "from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z"} {
+		if status, _ := reportQuery(middleware.TransfersIncluded, query); status != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", query, status)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func restoreDataset() *model.Dataset {
+	cash := model.Account{ID: primitive.NewObjectID(), Owner: "old", Name: "Cash", Balance: 955000}
+	card := model.Account{ID: primitive.NewObjectID(), Owner: "old", Name: "Visa", Type: model.AccountCreditCard, Balance: -45000}
+	food := model.Category{ID: primitive.NewObjectID(), Owner: "old", Name: "Food", Type: "expense"}
+	coffee := model.Tag{ID: primitive.NewObjectID(), Owner: "old", Name: "coffee"}
+	highlands := model.Payee{ID: primitive.NewObjectID(), Owner: "old", Name: "Highlands", DefaultCategory: food.ID}
+	day := time.Date(2024, 5, 3, 9, 30, 0, 0, time.UTC)
+
+	lunch := model.Transaction{
+		ID: primitive.NewObjectID(), Creator: "old", Type: "expense", Amount: 45000, DateTime: day,
+		SourceAccount: cash.ID, Tags: []primitive.ObjectID{coffee.ID}, Payee: highlands.ID,
+		Splits: []model.Split{{Category: food.ID, Amount: 45000}},
+	}
+	payment := model.Transaction{
+		ID: primitive.NewObjectID(), Creator: "old", Type: "transfer", Amount: 45000, DateTime: day.AddDate(0, 0, 1),
+		SourceAccount: cash.ID, DestinationAccount: card.ID,
+	}
+	netflix := model.Subscription{ID: primitive.NewObjectID(), Creator: "old", Name: "Netflix", SourceAccount: card.ID, Category: food.ID}
+	statement := model.Statement{ID: primitive.NewObjectID(), Owner: "old", Account: card.ID, PeriodEnd: day}
+	notification := model.Notification{ID: primitive.NewObjectID(), Owner: "old", Type: model.TypeStatementDue, ReferenceId: statement.ID}
+	statement.Notification = notification.ID
+	rule := model.Rule{
+		ID: primitive.NewObjectID(), Owner: "old", Name: "Coffee",
+		Conditions: model.RuleConditions{Payee: highlands.ID},
+		Actions:    model.RuleActions{Category: food.ID, Tags: []primitive.ObjectID{coffee.ID}},
+	}
+
+	return &model.Dataset{
+		Version:                 model.DatasetVersion,
+		Owner:                   "old",
+		Accounts:                []model.Account{cash, card},
+		Categories:              []model.Category{food},
+		Tags:                    []model.Tag{coffee},
+		Payees:                  []model.Payee{highlands},
+		Transactions:            []model.Transaction{lunch, payment},
+		Subscriptions:           []model.Subscription{netflix},
+		Rules:                   []model.Rule{rule},
+		Statements:              []model.Statement{statement},
+		Notifications:           []model.Notification{notification},
+		NotificationPreferences: []model.NotificationPreference{{ID: primitive.NewObjectID(), Owner: "old", Timezone: "Asia/Ho_Chi_Minh"}},
+	}
+}
+
+func TestRemapDatasetFreshUser(t *testing.T) {
+	ds := restoreDataset()
+	plan, err := service.RemapDataset(ds, "new", model.RestoreMerge, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := plan.Dataset
+
+	// No exported id survives, every owner is the new user
+	old := map[primitive.ObjectID]bool{}
+	for _, a := range ds.Accounts {
+		old[a.ID] = true
+	}
+	for _, id := range []primitive.ObjectID{ds.Categories[0].ID, ds.Tags[0].ID, ds.Payees[0].ID, ds.Transactions[0].ID,
+		ds.Transactions[1].ID, ds.Subscriptions[0].ID, ds.Rules[0].ID, ds.Statements[0].ID, ds.Notifications[0].ID} {
+		old[id] = true
+	}
+	account := map[primitive.ObjectID]string{}
+	for _, a := range out.Accounts {
+		if old[a.ID] || a.Owner != "new" {
+			t.Errorf("account %+v", a)
+		}
+		account[a.ID] = a.Name
+	}
+	food, coffee, highlands := out.Categories[0].ID, out.Tags[0].ID, out.Payees[0].ID
+	if old[food] || old[coffee] || old[highlands] || out.Payees[0].DefaultCategory != food {
+		t.Errorf("category %v, tag %v, payee %+v", food, coffee, out.Payees[0])
+	}
+
+	lunch, payment := out.Transactions[0], out.Transactions[1]
+	if old[lunch.ID] || lunch.Creator != "new" || account[lunch.SourceAccount] != "Cash" ||
+		lunch.Splits[0].Category != food || lunch.Tags[0] != coffee || lunch.Payee != highlands {
+		t.Errorf("lunch %+v", lunch)
+	}
+	if account[payment.SourceAccount] != "Cash" || account[payment.DestinationAccount] != "Visa" {
+		t.Errorf("payment %+v", payment)
+	}
+	if ds.Transactions[0].Splits[0].Category != ds.Categories[0].ID {
+		t.Error("the export was modified")
+	}
+
+	if s := out.Subscriptions[0]; s.Creator != "new" || account[s.SourceAccount] != "Visa" || s.Category != food {
+		t.Errorf("subscription %+v", s)
+	}
+	if r := out.Rules[0]; r.Conditions.Payee != highlands || r.Actions.Category != food || r.Actions.Tags[0] != coffee {
+		t.Errorf("rule %+v", r)
+	}
+	statement, notification := out.Statements[0], out.Notifications[0]
+	if statement.Notification != notification.ID || notification.ReferenceId != statement.ID ||
+		account[statement.Account] != "Visa" || old[statement.ID] {
+		t.Errorf("statement %+v, notification %+v", statement, notification)
+	}
+	if len(out.NotificationPreferences) != 1 || out.NotificationPreferences[0].Owner != "new" {
+		t.Errorf("preferences %+v", out.NotificationPreferences)
+	}
+	if plan.Merged != 0 || plan.Skipped != 0 || len(plan.Balances) != 0 {
+		t.Errorf("plan %+v", plan)
+	}
+}
+
+func TestRemapDatasetMerge(t *testing.T) {
+	ds := restoreDataset()
+	cash := model.Account{ID: primitive.NewObjectID(), Owner: "new", Name: "cash", Balance: 100}
+	food := model.Category{ID: primitive.NewObjectID(), Owner: "new", Name: "FOOD", Type: "expense"}
+	// The payment is already there
+	payment := ds.Transactions[1]
+	payment.ID, payment.Creator, payment.SourceAccount = primitive.NewObjectID(), "new", cash.ID
+	existing := &model.Dataset{
+		Accounts:                []model.Account{cash},
+		Categories:              []model.Category{food},
+		Transactions:            []model.Transaction{payment},
+		NotificationPreferences: []model.NotificationPreference{{ID: primitive.NewObjectID(), Owner: "new"}},
+	}
+
+	plan, err := service.RemapDataset(ds, "new", model.RestoreMerge, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := plan.Dataset
+	if len(out.Accounts) != 1 || out.Accounts[0].Name != "Visa" || len(out.Categories) != 0 {
+		t.Fatalf("accounts %+v, categories %+v", out.Accounts, out.Categories)
+	}
+	// The card is new, so the payment on it is not recognized
+	if len(out.Transactions) != 2 {
+		t.Fatalf("transactions %+v", out.Transactions)
+	}
+	if lunch := out.Transactions[0]; lunch.SourceAccount != cash.ID || lunch.Splits[0].Category != food.ID {
+		t.Errorf("lunch %+v", lunch)
+	}
+	if plan.Balances[cash.ID] != -90000 || plan.Merged != 2 || plan.Skipped != 1 || len(out.NotificationPreferences) != 0 {
+		t.Errorf("plan %+v", plan)
+	}
+
+	// Once the card is merged too, the payment is recognized
+	card := model.Account{ID: primitive.NewObjectID(), Owner: "new", Name: "Visa", Type: model.AccountCreditCard}
+	payment.DestinationAccount = card.ID
+	existing.Accounts = append(existing.Accounts, card)
+	existing.Transactions = []model.Transaction{payment}
+	plan, err = service.RemapDataset(ds, "new", model.RestoreMerge, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Dataset.Transactions) != 1 || plan.Balances[cash.ID] != -45000 || plan.Skipped != 2 {
+		t.Errorf("plan %+v, transactions %+v", plan, plan.Dataset.Transactions)
+	}
+	if _, ok := plan.Balances[card.ID]; ok {
+		t.Errorf("card balance changed: %v", plan.Balances)
+	}
+}
+
+func TestRemapDatasetKeepBoth(t *testing.T) {
+	ds := restoreDataset()
+	existing := &model.Dataset{
+		Tags:       []model.Tag{{ID: primitive.NewObjectID(), Owner: "new", Name: "Coffee"}},
+		Categories: []model.Category{{ID: primitive.NewObjectID(), Owner: "new", Name: "Food", Type: "income"}},
+	}
+	plan, err := service.RemapDataset(ds, "new", model.RestoreKeepBoth, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := plan.Dataset.Tags[0].Name; name != "coffee (2)" {
+		t.Errorf("tag named %q", name)
+	}
+	// Categories clash only within a type
+	if name := plan.Dataset.Categories[0].Name; name != "Food" {
+		t.Errorf("category named %q", name)
+	}
+	if plan.Merged != 0 || len(plan.Dataset.Transactions) != 2 {
+		t.Errorf("plan %+v", plan)
+	}
+}
+
+func TestRemapDatasetIncomplete(t *testing.T) {
+	ds := restoreDataset()
+	ds.Accounts = ds.Accounts[:1]
+	_, err := service.RemapDataset(ds, "new", model.RestoreReplace, nil)
+	if err == nil || !strings.Contains(err.Error(), "incomplete") {
+		t.Errorf("restored without the card: %v", err)
+	}
+
+	ds = restoreDataset()
+	ds.Version = model.DatasetVersion + 1
+	if _, err := service.RemapDataset(ds, "new", model.RestoreReplace, nil); err == nil {
+		t.Error("restored a newer export")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRuleSetApply(t *testing.T) {
+	card, wallet := primitive.NewObjectID(), primitive.NewObjectID()
+	coffee, food := primitive.NewObjectID(), primitive.NewObjectID()
+	lateNight := primitive.NewObjectID()
+
+	rules := service.NewRuleSet([]model.Rule{
+		{
+			Name:       "Food",
+			Priority:   10,
+			Conditions: model.RuleConditions{Type: "expense", MaxAmount: 200000},
+			Actions:    model.RuleActions{Category: food},
+		},
+		{
+			Name:       "Coffee",
+			Priority:   1,
+			Conditions: model.RuleConditions{NoteContains: "cà phê"},
+			Actions:    model.RuleActions{Category: coffee},
+		},
+		{
+			Name:       "Late night",
+			Priority:   5,
+			Timezone:   "Asia/Ho_Chi_Minh",
+			Conditions: model.RuleConditions{TimeFrom: "22:00", TimeTo: "04:00"},
+			Actions:    model.RuleActions{Tags: []primitive.ObjectID{lateNight}},
+		},
+		{
+			Name:           "Card payment",
+			Priority:       0,
+			Conditions:     model.RuleConditions{NoteContains: "thanh toan the", Account: wallet},
+			Actions:        model.RuleActions{TransferAccount: card},
+			StopProcessing: true,
+		},
+	})
+
+	// 16:30 UTC is 23:30 in Ho Chi Minh City
+	night := time.Date(2024, 5, 3, 16, 30, 0, 0, time.UTC)
+	noon := time.Date(2024, 5, 3, 5, 0, 0, 0, time.UTC)
+
+	tx := model.Transaction{Type: "expense", Amount: 45000, SourceAccount: wallet, Note: "Ca phe sua da", DateTime: night}
+	rules.Apply(&tx, false)
+	if tx.Category != coffee {
+		t.Errorf("coffee: category %s, want the coffee category", tx.Category.Hex())
+	}
+	if len(tx.Tags) != 1 || tx.Tags[0] != lateNight {
+		t.Errorf("coffee: tags %v, want the late night tag", tx.Tags)
+	}
+
+	tx = model.Transaction{Type: "expense", Amount: 80000, SourceAccount: wallet, Note: "Bun bo", DateTime: noon, Category: coffee}
+	rules.Apply(&tx, false)
+	if tx.Category != coffee || len(tx.Tags) != 0 {
+		t.Errorf("hand picked category was overwritten: %+v", tx)
+	}
+	rules.Apply(&tx, true)
+	if tx.Category != food {
+		t.Errorf("overwrite: category %s, want the food category", tx.Category.Hex())
+	}
+
+	tx = model.Transaction{Type: "expense", Amount: 150000, SourceAccount: wallet, Note: "Thanh toán thẻ tín dụng", DateTime: night}
+	rules.Apply(&tx, false)
+	if tx.Type != "transfer" || tx.DestinationAccount != card || !tx.Category.IsZero() || len(tx.Tags) != 0 {
+		t.Errorf("card payment: got %+v, want a transfer to the card and nothing else", tx)
+	}
+}
+
+func TestRetargetRules(t *testing.T) {
+	old, keep, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	// Merging moves the tag, without adding it twice
+	rule := model.Rule{Actions: model.RuleActions{Tags: []primitive.ObjectID{old, keep, other}}}
+	if !service.RetargetRuleTag(&rule, old, keep) {
+		t.Fatal("tag merge changed nothing")
+	}
+	if tags := rule.Actions.Tags; len(tags) != 2 || tags[0] != keep || tags[1] != other {
+		t.Errorf("merged tags %v, want [keep other]", tags)
+	}
+	// Deleting drops it
+	if !service.RetargetRuleTag(&rule, other, primitive.NilObjectID) || len(rule.Actions.Tags) != 1 {
+		t.Errorf("deleted tag kept: %v", rule.Actions.Tags)
+	}
+	if service.RetargetRuleTag(&rule, other, keep) {
+		t.Error("unrelated rule changed")
+	}
+
+	rule = model.Rule{
+		IsActive:   true,
+		Conditions: model.RuleConditions{Payee: old},
+		Actions:    model.RuleActions{Payee: old, Category: other},
+	}
+	merged := rule
+	if !service.RetargetRulePayee(&merged, old, keep) {
+		t.Fatal("payee merge changed nothing")
+	}
+	if merged.Conditions.Payee != keep || merged.Actions.Payee != keep || !merged.IsActive {
+		t.Errorf("merged payee rule %+v", merged)
+	}
+
+	// A rule matching a deleted payee must not start matching everything
+	deleted := rule
+	if !service.RetargetRulePayee(&deleted, old, primitive.NilObjectID) {
+		t.Fatal("payee delete changed nothing")
+	}
+	if !deleted.Conditions.Payee.IsZero() || !deleted.Actions.Payee.IsZero() || deleted.IsActive {
+		t.Errorf("rule of a deleted payee %+v", deleted)
+	}
+
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+)
+
+func TestAccrueSavingInterest(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	maturity := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		saving   model.Saving
+		now      time.Time
+		interest float64
+		through  time.Time
+	}{
+		{
+			"monthly, whole months only",
+			model.Saving{Balance: 10000, Rate: 12, Compounding: model.CompoundMonthly, LastAccrual: start},
+			time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC),
+			303.01, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"daily",
+			model.Saving{Balance: 10000, Rate: 3.65, Compounding: model.CompoundDaily, LastAccrual: start},
+			time.Date(2024, 1, 11, 12, 0, 0, 0, time.UTC),
+			10.00, time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"at maturity, before it",
+			model.Saving{Balance: 10000, Rate: 6, Compounding: model.CompoundMaturity, LastAccrual: start, MaturityDate: maturity},
+			time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC),
+			0, start,
+		},
+		{
+			"at maturity, after it",
+			model.Saving{Balance: 10000, Rate: 6, Compounding: model.CompoundMaturity, LastAccrual: start, MaturityDate: maturity},
+			time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC),
+			299.18, maturity,
+		},
+		{
+			"no interest, still matures",
+			model.Saving{Balance: 10000, Compounding: model.CompoundMonthly, LastAccrual: start, MaturityDate: maturity},
+			time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC),
+			0, maturity,
+		},
+		{
+			"no interest, no term",
+			model.Saving{Balance: 10000, Compounding: model.CompoundMonthly, LastAccrual: start},
+			time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC),
+			0, start,
+		},
+	}
+
+	for _, tc := range cases {
+		interest, through := service.AccrueSavingInterest(tc.saving, tc.now)
+		if interest != tc.interest {
+			t.Errorf("%s: expected interest %.2f, got %.2f", tc.name, tc.interest, interest)
+		}
+		if !through.Equal(tc.through) {
+			t.Errorf("%s: expected accrual through %v, got %v", tc.name, tc.through, through)
+		}
+	}
+}
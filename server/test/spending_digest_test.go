@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+)
+
+func TestNextSpendingDigestRun(t *testing.T) {
+	ict := time.FixedZone("ICT", 7*60*60)
+	weekly := model.SpendingDigestSettings{Frequency: model.FrequencyWeekly, Day: 1, Hour: 8} // Mondays
+	monthly := model.SpendingDigestSettings{Frequency: model.FrequencyMonthly, Day: 1, Hour: 8}
+
+	cases := []struct {
+		name     string
+		settings model.SpendingDigestSettings
+		after    time.Time
+		loc      *time.Location
+		next     time.Time
+	}{
+		{"weekly, from a Sunday", weekly, time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC), time.UTC,
+			time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)},
+		{"weekly, earlier on the day", weekly, time.Date(2024, 3, 11, 7, 0, 0, 0, time.UTC), time.UTC,
+			time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)},
+		{"weekly, right after a run", weekly, time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC), time.UTC,
+			time.Date(2024, 3, 18, 8, 0, 0, 0, time.UTC)},
+		{"weekly, in the user's timezone", weekly, time.Date(2024, 3, 11, 0, 30, 0, 0, time.UTC), ict,
+			time.Date(2024, 3, 11, 8, 0, 0, 0, ict)},
+		{"monthly", monthly, time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC), time.UTC,
+			time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)},
+		{"monthly, earlier on the day", monthly, time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC), time.UTC,
+			time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)},
+		{"off", model.SpendingDigestSettings{Frequency: model.FrequencyOff}, time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC), time.UTC,
+			time.Time{}},
+	}
+
+	for _, tc := range cases {
+		if next := service.NextSpendingDigestRun(tc.settings, tc.after, tc.loc); !next.Equal(tc.next) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.next, next)
+		}
+	}
+
+	at := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	if from, to := service.SpendingDigestPeriod(model.FrequencyMonthly, at); !from.Equal(time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC)) || !to.Equal(at) {
+		t.Errorf("monthly digest covers %v to %v", from, to)
+	}
+	if from, _ := service.SpendingDigestPeriod(model.FrequencyWeekly, at); !from.Equal(time.Date(2024, 2, 23, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly digest starts %v", from)
+	}
+}
+
+func TestRenderSpendingDigest(t *testing.T) {
+	digest := service.SpendingDigest{
+		From:    time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+		To:      time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		Income:  5000000,
+		Expense: 1250000,
+		Net:     3750000,
+		TopCategories: []service.CategoryTotal{
+			{Name: "Food", Total: 800000, Count: 12},
+		},
+		BiggestTransactions: []model.Transaction{
+			{Amount: 450000, DateTime: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC), Note: "<b>Dinner</b>"},
+		},
+		Budgets: []service.BudgetStatus{
+			{Name: "Food", Budget: 700000, Spent: 800000, Percent: 114.29, Over: true},
+		},
+	}
+
+	markdown, err := service.RenderSpendingDigestMarkdown(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# Spending digest 04/03/2024 - 11/03/2024",
+		"**Net:** 3750000",
+		"- Food: 800000 (12 transactions)",
+		"- Food: 800000 / 700000 (114%) **over budget**",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown digest is missing %q:\n%s", want, markdown)
+		}
+	}
+	if strings.Contains(markdown, "## Savings") {
+		t.Error("markdown digest has a section for savings it does not have")
+	}
+
+	html, err := service.RenderSpendingDigestHTML(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(html, "<b>Dinner</b>") || !strings.Contains(html, "&lt;b&gt;Dinner&lt;/b&gt;") {
+		t.Errorf("transaction notes are not escaped in the HTML digest:\n%s", html)
+	}
+}
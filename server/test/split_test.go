@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"fintrack/server/model"
+	"fintrack/server/service"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckSplits(t *testing.T) {
+	groceries, household, gift := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	receipt := []model.Split{
+		{Category: groceries, Amount: 120.45},
+		{Category: household, Amount: 60.3},
+		{Category: gift, Amount: 19.25, Note: "Birthday card"},
+	}
+
+	cases := []struct {
+		name   string
+		txType string
+		amount float64
+		splits []model.Split
+		ok     bool
+	}{
+		{"adds up", "expense", 200, receipt, true},
+		{"income", "income", 200, receipt, true},
+		{"not split", "transfer", 200, nil, true},
+		{"short", "expense", 210, receipt, false},
+		{"over", "expense", 199.99, receipt, false},
+		{"transfer", "transfer", 200, receipt, false},
+		{"zero line", "expense", 200, append([]model.Split{{Category: gift, Amount: 0}}, receipt...), false},
+		{"negative line", "expense", 180, []model.Split{{Category: groceries, Amount: 200}, {Category: gift, Amount: -20}}, false},
+	}
+
+	for _, tc := range cases {
+		err := service.CheckSplits(tc.txType, tc.amount, tc.splits)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: expected ok %v, got %v", tc.name, tc.ok, err)
+		}
+	}
+}
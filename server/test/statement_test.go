@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"fintrack/server/service"
+)
+
+func TestStatementPeriod(t *testing.T) {
+	ict := time.FixedZone("ICT", 7*60*60)
+
+	cases := []struct {
+		name  string
+		now   time.Time
+		loc   *time.Location
+		start time.Time
+		end   time.Time
+	}{
+		{
+			"after the statement day",
+			time.Date(2024, 3, 20, 10, 0, 0, 0, time.UTC), time.UTC,
+			time.Date(2024, 2, 16, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"before the statement day",
+			time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC), time.UTC,
+			time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"right as the cycle closes",
+			time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC), time.UTC,
+			time.Date(2024, 2, 16, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"closed in the owner's timezone, not yet in UTC",
+			time.Date(2024, 3, 15, 20, 0, 0, 0, time.UTC), ict,
+			time.Date(2024, 2, 16, 0, 0, 0, 0, ict), time.Date(2024, 3, 16, 0, 0, 0, 0, ict),
+		},
+	}
+
+	for _, tc := range cases {
+		start, end := service.StatementPeriod(15, tc.now, tc.loc)
+		if !start.Equal(tc.start) || !end.Equal(tc.end) {
+			t.Errorf("%s: expected [%v, %v), got [%v, %v)", tc.name, tc.start, tc.end, start, end)
+		}
+	}
+}
+
+func TestStatementDueDate(t *testing.T) {
+	periodEnd := time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		dueDay int
+		due    time.Time
+	}{
+		{25, time.Date(2024, 3, 25, 0, 0, 0, 0, time.UTC)},
+		{5, time.Date(2024, 4, 5, 0, 0, 0, 0, time.UTC)},
+		{16, time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		if due := service.StatementDueDate(periodEnd, tc.dueDay, time.UTC); !due.Equal(tc.due) {
+			t.Errorf("due day %d: expected %v, got %v", tc.dueDay, tc.due, due)
+		}
+	}
+}
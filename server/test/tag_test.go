@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fintrack/server/middleware"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTagFilterMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var filter []primitive.ObjectID
+	router := gin.New()
+	router.GET("/transactions", middleware.TagFilterMiddleware(), func(c *gin.Context) {
+		filter = c.MustGet("tagFilter").([]primitive.ObjectID)
+		c.Status(http.StatusOK)
+	})
+
+	trip, reimbursable := primitive.NewObjectID(), primitive.NewObjectID()
+
+	cases := []struct {
+		query  string
+		status int
+		tags   []primitive.ObjectID
+	}{
+		{"", http.StatusOK, nil},
+		{"tags=" + trip.Hex(), http.StatusOK, []primitive.ObjectID{trip}},
+		{"tags=" + trip.Hex() + "," + reimbursable.Hex(), http.StatusOK, []primitive.ObjectID{trip, reimbursable}},
+		{"tags=," + trip.Hex() + ",", http.StatusOK, []primitive.ObjectID{trip}},
+		{"tags=trip-dalat-2026", http.StatusBadRequest, nil},
+	}
+
+	for _, tc := range cases {
+		filter = nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/transactions?"+tc.query, nil))
+		if w.Code != tc.status {
+			t.Errorf("%q: expected status %d, got %d", tc.query, tc.status, w.Code)
+			continue
+		}
+		if len(filter) != len(tc.tags) {
+			t.Errorf("%q: expected tags %v, got %v", tc.query, tc.tags, filter)
+			continue
+		}
+		for i := range filter {
+			if filter[i] != tc.tags[i] {
+				t.Errorf("%q: expected tags %v, got %v", tc.query, tc.tags, filter)
+				break
+			}
+		}
+	}
+
+	// Reports take the same filter
+	status, q := reportQuery(middleware.TransfersIncluded, "tags="+trip.Hex()+","+reimbursable.Hex())
+	if status != http.StatusOK || len(q.Tags) != 2 || q.Tags[0] != trip || q.Tags[1] != reimbursable {
+		t.Errorf("report tag filter: status %d, tags %v", status, q.Tags)
+	}
+}
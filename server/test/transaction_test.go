@@ -19,9 +19,15 @@ type Transaction struct {
 	SourceAccount    string  `json:"source_account,omitempty"`
 	DestinationAccount string `json:"destination_account,omitempty"`
 	Category         string  `json:"category,omitempty"`
+	Splits           []Split `json:"splits,omitempty"`
 	Note             string  `json:"note"`
 }
 
+type Split struct {
+	Category string  `json:"category"`
+	Amount   float64 `json:"amount"`
+}
+
 
 func createTransaction(token string, transaction Transaction) (string, error) {
 	payload, _ := json.Marshal(transaction)
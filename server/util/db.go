@@ -2,12 +2,15 @@ package util
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -19,6 +22,25 @@ var (
 	SavingCollection       *mongo.Collection
 	SubscriptionCollection *mongo.Collection
 	NotificationCollection *mongo.Collection
+
+	NotificationPreferenceCollection *mongo.Collection
+	BalanceSnapshotCollection        *mongo.Collection
+	StatementCollection              *mongo.Collection
+	LoanCollection                   *mongo.Collection
+	TagCollection                    *mongo.Collection
+	PayeeCollection                  *mongo.Collection
+	RuleCollection                   *mongo.Collection
+	ImportProfileCollection          *mongo.Collection
+	ImportBatchCollection            *mongo.Collection
+	ExportJobCollection              *mongo.Collection
+	MessageTemplateCollection        *mongo.Collection
+	UnmatchedMessageCollection       *mongo.Collection
+
+	// ExportBucket holds the archives of export jobs.
+	ExportBucket *gridfs.Bucket
+	// AttachmentBucket holds transaction attachments when they are kept in
+	// the database.
+	AttachmentBucket *gridfs.Bucket
 )
 
 func InitDB() {
@@ -37,6 +59,27 @@ func InitDB() {
 	SavingCollection = db.Collection("savings")
 	SubscriptionCollection = db.Collection("subscriptions")
 	NotificationCollection = db.Collection("notifications")
+	NotificationPreferenceCollection = db.Collection("notification_preferences")
+	BalanceSnapshotCollection = db.Collection("balance_snapshots")
+	StatementCollection = db.Collection("statements")
+	LoanCollection = db.Collection("loans")
+	TagCollection = db.Collection("tags")
+	PayeeCollection = db.Collection("payees")
+	RuleCollection = db.Collection("rules")
+	ImportProfileCollection = db.Collection("import_profiles")
+	ImportBatchCollection = db.Collection("import_batches")
+	ExportJobCollection = db.Collection("export_jobs")
+	MessageTemplateCollection = db.Collection("message_templates")
+	UnmatchedMessageCollection = db.Collection("unmatched_messages")
+
+	ExportBucket, err = gridfs.NewBucket(db, options.GridFSBucket().SetName("exports"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	AttachmentBucket, err = gridfs.NewBucket(db, options.GridFSBucket().SetName("attachments"))
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	if err := createTransactionIndex(); err != nil {
 		log.Fatal("Failed to create transaction index:", err)
@@ -56,6 +99,36 @@ func InitDB() {
 	if err := createNotificationIndex(); err != nil {
 		log.Fatal("Failed to create notification index:", err)
 	}
+	if err := createNotificationPreferenceIndex(); err != nil {
+		log.Fatal("Failed to create notification preference index:", err)
+	}
+	if err := createBalanceSnapshotIndex(); err != nil {
+		log.Fatal("Failed to create balance snapshot index:", err)
+	}
+	if err := createStatementIndex(); err != nil {
+		log.Fatal("Failed to create statement index:", err)
+	}
+	if err := createLoanIndex(); err != nil {
+		log.Fatal("Failed to create loan index:", err)
+	}
+	if err := createTagIndex(); err != nil {
+		log.Fatal("Failed to create tag index:", err)
+	}
+	if err := createPayeeIndex(); err != nil {
+		log.Fatal("Failed to create payee index:", err)
+	}
+	if err := createRuleIndex(); err != nil {
+		log.Fatal("Failed to create rule index:", err)
+	}
+	if err := createImportIndex(); err != nil {
+		log.Fatal("Failed to create import index:", err)
+	}
+	if err := createExportIndex(); err != nil {
+		log.Fatal("Failed to create export index:", err)
+	}
+	if err := createMessageIndex(); err != nil {
+		log.Fatal("Failed to create message index:", err)
+	}
 }
 
 func createTransactionIndex() error {
@@ -65,6 +138,18 @@ func createTransactionIndex() error {
 	indexModel := []mongo.IndexModel{
 		{Keys: bson.M{"creator": 1}},
 		{Keys: bson.M{"last_update": 1}},
+		// Reporting
+		{Keys: bson.D{{Key: "creator", Value: 1}, {Key: "is_deleted", Value: 1}, {Key: "date_time", Value: 1}}},
+		{Keys: bson.D{{Key: "creator", Value: 1}, {Key: "type", Value: 1}, {Key: "date_time", Value: 1}}},
+		{Keys: bson.D{{Key: "creator", Value: 1}, {Key: "category", Value: 1}, {Key: "date_time", Value: 1}}},
+		{Keys: bson.D{{Key: "creator", Value: 1}, {Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "creator", Value: 1}, {Key: "payee", Value: 1}, {Key: "date_time", Value: 1}}},
+		// Imports
+		{
+			Keys:    bson.D{{Key: "creator", Value: 1}, {Key: "external_id", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{Keys: bson.M{"import_batch": 1}, Options: options.Index().SetSparse(true)},
 	}
 
 	_, err := TransactionCollection.Indexes().CreateMany(ctx, indexModel)
@@ -91,6 +176,7 @@ func createSavingIndex() error {
 	indexModel := []mongo.IndexModel{
 		{Keys: bson.M{"owner": 1}},
 		{Keys: bson.M{"last_update": 1}},
+		{Keys: bson.M{"next_accrual": 1}},
 	}
 
 	_, err := SavingCollection.Indexes().CreateMany(ctx, indexModel)
@@ -132,13 +218,181 @@ func createNotificationIndex() error {
 		{Keys: bson.M{"owner": 1}},
 		{Keys: bson.M{"scheduled_at": 1}},
 		{Keys: bson.M{"last_update": 1}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "deliver_at", Value: 1}}},
 	}
 
 	_, err := NotificationCollection.Indexes().CreateMany(ctx, indexModel)
 	return err
 }
 
+func createNotificationPreferenceIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := []mongo.IndexModel{
+		{Keys: bson.M{"owner": 1}, Options: options.Index().SetUnique(true)},
+	}
+
+	_, err := NotificationPreferenceCollection.Indexes().CreateMany(ctx, indexModel)
+	return err
+}
+
+func createBalanceSnapshotIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "taken_at", Value: 1}}},
+		{Keys: bson.D{{Key: "account", Value: 1}, {Key: "taken_at", Value: 1}}},
+	}
+
+	_, err := BalanceSnapshotCollection.Indexes().CreateMany(ctx, indexModel)
+	return err
+}
+
+func createStatementIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := []mongo.IndexModel{
+		{Keys: bson.M{"owner": 1}},
+		{Keys: bson.M{"last_update": 1}},
+		// One statement per cycle, lets the cron retry safely.
+		{
+			Keys:    bson.D{{Key: "account", Value: 1}, {Key: "period_end", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "account", Value: 1}, {Key: "status", Value: 1}}},
+	}
+
+	_, err := StatementCollection.Indexes().CreateMany(ctx, indexModel)
+	return err
+}
+
+func createLoanIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := []mongo.IndexModel{
+		{Keys: bson.M{"creator": 1}},
+		{Keys: bson.M{"last_update": 1}},
+		{Keys: bson.D{{Key: "is_active", Value: 1}, {Key: "next_due", Value: 1}}},
+	}
+
+	_, err := LoanCollection.Indexes().CreateMany(ctx, indexModel)
+	return err
+}
+
+func createTagIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := []mongo.IndexModel{
+		{Keys: bson.M{"last_update": 1}},
+		// Names are unique per user among live tags.
+		{
+			Keys: bson.D{{Key: "owner", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"is_deleted": false}),
+		},
+	}
+
+	_, err := TagCollection.Indexes().CreateMany(ctx, indexModel)
+	return err
+}
+
+func createPayeeIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := []mongo.IndexModel{
+		{Keys: bson.M{"owner": 1}},
+		{Keys: bson.M{"last_update": 1}},
+	}
+
+	_, err := PayeeCollection.Indexes().CreateMany(ctx, indexModel)
+	return err
+}
+
+func createRuleIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	indexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "priority", Value: 1}}},
+		{Keys: bson.M{"last_update": 1}},
+	}
+
+	_, err := RuleCollection.Indexes().CreateMany(ctx, indexModel)
+	return err
+}
+
+func createImportIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := ImportProfileCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"owner": 1}},
+		{Keys: bson.M{"last_update": 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Previews nobody committed go away on their own
+	_, err = ImportBatchCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"owner": 1}},
+		{Keys: bson.M{"expire_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Export jobs are not a TTL collection: their archives live in GridFS and
+// are removed with them, see service.PurgeExpiredExports.
+func createExportIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := ExportJobCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.M{"expire_at": 1}},
+	})
+	return err
+}
+
+func createMessageIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := MessageTemplateCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"owner": 1}},
+		{Keys: bson.M{"last_update": 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The same text received again is counted on one document
+	_, err = UnmatchedMessageCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "last_seen", Value: -1}}},
+	})
+	return err
+}
+
+var ErrBalanceTargetNotFound = errors.New("balance target is neither an account nor a saving")
+
+// AdjustBalance moves the balance of an account or saving. A nil id is a
+// no-op, so one-sided transactions can be passed as they are.
 func AdjustBalance(sc mongo.SessionContext, id primitive.ObjectID, amount float64) (int64, error) {
+	if id == primitive.NilObjectID {
+		return 0, nil
+	}
+
 	now := time.Now()
 
 	// Try to update in account collection
@@ -169,5 +423,9 @@ func AdjustBalance(sc mongo.SessionContext, id primitive.ObjectID, amount float6
 		}
 	}
 
+	if res.MatchedCount == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrBalanceTargetNotFound, id.Hex())
+	}
+
 	return res.ModifiedCount, nil
 }
@@ -0,0 +1,28 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeText lowercases s, strips diacritics ("Cà phê" -> "ca phe") and
+// collapses everything that is not a letter or digit into single spaces, so
+// free text from different sources can be compared.
+func NormalizeText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+
+	// đ has no decomposition
+	folded = strings.NewReplacer("đ", "d", "Đ", "d").Replace(folded)
+
+	return strings.Join(strings.FieldsFunc(strings.ToLower(folded), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}